@@ -0,0 +1,301 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const (
+	tarFormat = "tar"
+	zipFormat = "zip"
+
+	tarMagicOffset = 257
+)
+
+var (
+	zipMagic = []byte("PK\x03\x04")
+	tarMagic = []byte("ustar")
+
+	errNotArchive = errors.New("file is not a tar or zip archive")
+)
+
+// archiveConfig configures reading the members of tar and zip archives.
+type archiveConfig struct {
+	Enabled bool `config:"enabled"`
+	// Members are glob patterns of the members to read. Patterns
+	// without a '/' are matched against the base name of the members.
+	// All members are read if no pattern is configured.
+	Members []string `config:"members"`
+}
+
+func (c *archiveConfig) Validate() error {
+	for _, pattern := range c.Members {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("invalid archive member pattern %q: %w", pattern, err)
+		}
+	}
+	return nil
+}
+
+// matches returns true if the member should be read.
+func (c *archiveConfig) matches(member string) bool {
+	if len(c.Members) == 0 {
+		return true
+	}
+	for _, pattern := range c.Members {
+		name := member
+		if !strings.Contains(pattern, "/") {
+			name = path.Base(member)
+		}
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+// archiveMember is a regular file in an archive.
+type archiveMember struct {
+	Path string `json:"path" struct:"path"`
+	Size int64  `json:"size" struct:"size"`
+}
+
+// detectArchive returns the format of the archive f, and for tar archives
+// their compression. errNotArchive is returned if f is not an archive.
+func detectArchive(f io.ReadSeeker) (format, compression string, err error) {
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	var magic [4]byte
+	n, err := io.ReadFull(f, magic[:])
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", "", err
+	}
+	if bytes.Equal(magic[:n], zipMagic) {
+		return zipFormat, "", nil
+	}
+
+	compression, err = detectCompression(f)
+	if err != nil {
+		return "", "", err
+	}
+	r, err := openTar(f, compression)
+	if err != nil {
+		return "", "", errNotArchive
+	}
+	defer r.Close()
+
+	var header [tarMagicOffset + 5]byte
+	if err = readHeader(r, header[:]); err != nil {
+		// compressed files can be too short to tell while they are written
+		if compression != "" && !errors.Is(err, io.EOF) {
+			return "", "", decompressionError(err)
+		}
+		return "", "", errNotArchive
+	}
+	if !bytes.Equal(header[tarMagicOffset:], tarMagic) {
+		return "", "", errNotArchive
+	}
+	return tarFormat, compression, nil
+}
+
+// readHeader fills buf from r. Unlike io.ReadFull, it returns the error of
+// r, so content that ends early can be told from incomplete compressed
+// content.
+func readHeader(r io.Reader, buf []byte) error {
+	for n := 0; n < len(buf); {
+		m, err := r.Read(buf[n:])
+		n += m
+		if err != nil && n < len(buf) {
+			return err
+		}
+	}
+	return nil
+}
+
+// openTar returns a reader of the tar stream of the file, decompressed if
+// needed.
+func openTar(f io.ReadSeeker, compression string) (io.ReadCloser, error) {
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	if compression == "" {
+		return io.NopCloser(f), nil
+	}
+	return newDecompressor(compression, f)
+}
+
+// listArchiveMembers returns the regular files of the archive at path
+// that match the configuration. errNotArchive is returned if the file is
+// not an archive. Archives that are still being written return an error.
+func (c *archiveConfig) listArchiveMembers(path string) ([]archiveMember, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	format, compression, err := detectArchive(f)
+	if err != nil {
+		return nil, err
+	}
+
+	members := []archiveMember{}
+	if format == zipFormat {
+		zr, err := newZipReader(f)
+		if err != nil {
+			return nil, err
+		}
+		for _, zf := range zr.File {
+			name := memberName(zf.Name)
+			if zf.Mode().IsRegular() && c.matches(name) {
+				members = append(members, archiveMember{Path: name, Size: int64(zf.UncompressedSize64)}) //nolint:gosec // sizes fit in int64
+			}
+		}
+		return members, nil
+	}
+
+	r, err := openTar(f, compression)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return members, nil
+		}
+		if err != nil {
+			return nil, decompressionError(err)
+		}
+		name := memberName(hdr.Name)
+		if hdr.Typeflag == tar.TypeReg && c.matches(name) {
+			members = append(members, archiveMember{Path: name, Size: hdr.Size})
+		}
+	}
+}
+
+// memberName normalizes the path of an archive member.
+func memberName(name string) string {
+	return path.Clean(strings.TrimPrefix(name, "/"))
+}
+
+func newZipReader(f *os.File) (*zip.Reader, error) {
+	fi, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+	zr, err := zip.NewReader(f, fi.Size())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", errIncompleteCompressedFile, err)
+	}
+	return zr, nil
+}
+
+// newArchiveMemberFile returns a File reading the content of a member of
+// the archive f. The file is not closed on errors.
+func newArchiveMemberFile(f *os.File, member string) (*compressedFile, error) {
+	format, compression, err := detectArchive(f)
+	if err != nil {
+		return nil, err
+	}
+
+	if format == zipFormat {
+		return newReopenableFile(f, func() (io.ReadCloser, error) {
+			zr, err := newZipReader(f)
+			if err != nil {
+				return nil, err
+			}
+			for _, zf := range zr.File {
+				if memberName(zf.Name) == member {
+					return zf.Open()
+				}
+			}
+			return nil, fmt.Errorf("member %q not found in archive %s", member, f.Name())
+		})
+	}
+
+	return newReopenableFile(f, func() (io.ReadCloser, error) {
+		r, err := openTar(f, compression)
+		if err != nil {
+			return nil, err
+		}
+		tr := tar.NewReader(r)
+		for {
+			hdr, err := tr.Next()
+			if err != nil {
+				_ = r.Close()
+				if errors.Is(err, io.EOF) {
+					return nil, fmt.Errorf("member %q not found in archive %s", member, f.Name())
+				}
+				return nil, decompressionError(err)
+			}
+			if hdr.Typeflag == tar.TypeReg && memberName(hdr.Name) == member {
+				return struct {
+					io.Reader
+					io.Closer
+				}{tr, r}, nil
+			}
+		}
+	})
+}
+
+// archiveMetaReader adds the path of the archive to the events read from
+// one of its members.
+type archiveMetaReader struct {
+	reader.Reader
+	path string
+}
+
+func (r archiveMetaReader) Next() (reader.Message, error) {
+	message, err := r.Reader.Next()
+	if message.IsEmpty() {
+		return message, err
+	}
+	message.Fields.DeepUpdate(mapstr.M{
+		"log": mapstr.M{
+			"file": mapstr.M{
+				"archive": mapstr.M{
+					"path": r.path,
+				},
+			},
+		},
+	})
+	return message, err
+}
+
+// archiveMemberSource returns the source of a member of the archive src.
+// Its registry key is the one of the archive followed by the member path.
+func archiveMemberSource(src fileSource, member string) fileSource {
+	src.member = member
+	src.fileID += identitySep + member
+	return src
+}
@@ -0,0 +1,336 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+type archiveTestMember struct {
+	path    string
+	content string
+}
+
+var archiveTestMembers = []archiveTestMember{
+	{path: "logs/app.log", content: compressionTestContent},
+	{path: "logs/app.txt", content: "not a log\n"},
+	{path: "./other/app.log", content: "other first line\nother second line\n"},
+}
+
+func TestArchiveConfigMatches(t *testing.T) {
+	tests := map[string]struct {
+		members  []string
+		member   string
+		expected bool
+	}{
+		"no patterns":          {members: nil, member: "logs/app.log", expected: true},
+		"base name":            {members: []string{"*.log"}, member: "logs/app.log", expected: true},
+		"base name no match":   {members: []string{"*.log"}, member: "logs/app.txt", expected: false},
+		"path":                 {members: []string{"logs/*"}, member: "logs/app.txt", expected: true},
+		"path no match":        {members: []string{"logs/*"}, member: "other/app.log", expected: false},
+		"path does not nest":   {members: []string{"*/*.log"}, member: "a/b/app.log", expected: false},
+		"any of many patterns": {members: []string{"*.txt", "other/*"}, member: "other/app.log", expected: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := archiveConfig{Enabled: true, Members: test.members}
+			require.NoError(t, c.Validate())
+			assert.Equal(t, test.expected, c.matches(test.member))
+		})
+	}
+
+	c := archiveConfig{Members: []string{"logs/["}}
+	assert.ErrorContains(t, c.Validate(), `invalid archive member pattern "logs/["`)
+}
+
+func TestListArchiveMembers(t *testing.T) {
+	c := archiveConfig{Enabled: true, Members: []string{"*.log"}}
+	expected := []archiveMember{
+		{Path: "logs/app.log", Size: int64(len(compressionTestContent))},
+		{Path: "other/app.log", Size: 35},
+	}
+
+	for _, format := range []string{tarFormat, tarFormat + "." + gzipFormat, tarFormat + "." + zstdFormat, zipFormat} {
+		t.Run(format, func(t *testing.T) {
+			path := createTestArchive(t, format, archiveTestMembers)
+
+			members, err := c.listArchiveMembers(path)
+			require.NoError(t, err)
+			assert.Equal(t, expected, members)
+		})
+
+		t.Run(format+" incomplete", func(t *testing.T) {
+			content := strings.Repeat(compressionTestContent, 1000)
+			path := createTestArchive(t, format, []archiveTestMember{{path: "app.log", content: content}})
+			data, err := os.ReadFile(path)
+			require.NoError(t, err)
+			require.NoError(t, os.WriteFile(path, data[:len(data)/2], 0o644))
+
+			_, err = c.listArchiveMembers(path)
+			assert.ErrorIs(t, err, errIncompleteCompressedFile)
+		})
+	}
+
+	t.Run("not an archive", func(t *testing.T) {
+		for name, content := range map[string][]byte{
+			"plain": []byte(strings.Repeat(compressionTestContent, 100)),
+			"gzip":  compress(t, gzipFormat, strings.Repeat(compressionTestContent, 100)),
+			"empty": nil,
+		} {
+			f := createTestFile(t, name, content)
+			_, err := c.listArchiveMembers(f.Name())
+			assert.ErrorIs(t, err, errNotArchive, name)
+		}
+	})
+}
+
+func TestArchiveMemberFile(t *testing.T) {
+	for _, format := range []string{tarFormat, tarFormat + "." + gzipFormat, zipFormat} {
+		t.Run(format, func(t *testing.T) {
+			f, err := os.Open(createTestArchive(t, format, archiveTestMembers))
+			require.NoError(t, err)
+
+			mf, err := newArchiveMemberFile(f, "logs/app.log")
+			require.NoError(t, err)
+			defer mf.Close()
+
+			content, err := io.ReadAll(mf)
+			require.NoError(t, err)
+			assert.Equal(t, compressionTestContent, string(content))
+
+			// backwards
+			offset, err := mf.Seek(11, io.SeekStart)
+			require.NoError(t, err)
+			assert.Equal(t, int64(11), offset)
+			assertReadLine(t, mf, "second line\n")
+
+			// past the end
+			_, err = mf.Seek(int64(len(compressionTestContent)+1), io.SeekStart)
+			assert.ErrorIs(t, err, io.EOF)
+
+			_, err = newArchiveMemberFile(f, "logs/missing.log")
+			assert.ErrorContains(t, err, `member "logs/missing.log" not found`)
+		})
+	}
+}
+
+func TestFilestreamOpenArchiveMember(t *testing.T) {
+	inp := filestream{encodingFactory: encoding.Plain}
+	logger := logptest.NewTestingLogger(t, "")
+	path := createTestArchive(t, zipFormat, archiveTestMembers)
+
+	f, _, truncated, err := inp.openArchiveMember(logger, path, "other/app.log", 17)
+	require.NoError(t, err)
+	assert.False(t, truncated)
+	assertReadLine(t, f, "other second line\n")
+	require.NoError(t, f.Close())
+
+	f, _, truncated, err = inp.openArchiveMember(logger, path, "other/app.log", 1000)
+	require.NoError(t, err)
+	assert.True(t, truncated)
+	assertReadLine(t, f, "other first line\n")
+	require.NoError(t, f.Close())
+}
+
+func TestProspectorArchive(t *testing.T) {
+	path := createTestArchive(t, tarFormat+"."+gzipFormat, archiveTestMembers)
+	archiveID := "path::" + path
+	appID := archiveID + "::logs/app.log"
+	otherID := archiveID + "::other/app.log"
+	event := loginp.FSEvent{Op: loginp.OpCreate, NewPath: path, Descriptor: createTestFileDescriptor()}
+
+	testCases := map[string]struct {
+		cursors        map[string]interface{}
+		expectedEvents []harvesterEvent
+	}{
+		"new archive": {
+			expectedEvents: []harvesterEvent{
+				harvesterStart(appID),
+				harvesterStart(otherID),
+				harvesterGroupStop{},
+			},
+		},
+		"partially read archive": {
+			cursors: map[string]interface{}{
+				appID:   state{Offset: int64(len(compressionTestContent))},
+				otherID: state{Offset: 5},
+			},
+			expectedEvents: []harvesterEvent{
+				harvesterStart(otherID),
+				harvesterGroupStop{},
+			},
+		},
+		"finished archive": {
+			cursors: map[string]interface{}{
+				appID:   state{Offset: int64(len(compressionTestContent))},
+				otherID: state{Offset: 35},
+			},
+			expectedEvents: []harvesterEvent{
+				harvesterGroupStop{},
+			},
+		},
+	}
+
+	for name, test := range testCases {
+		t.Run(name, func(t *testing.T) {
+			p := fileProspector{
+				logger:      logp.L(),
+				filewatcher: newMockFileWatcher([]loginp.FSEvent{event}, 1),
+				identifier:  mustPathIdentifier(false),
+				archive:     archiveConfig{Enabled: true, Members: []string{"*.log"}},
+			}
+			ctx := input.Context{Logger: logp.L(), Cancelation: context.Background()}
+			hg := newTestHarvesterGroup()
+			updater := newMockMetadataUpdater()
+			for id, cursor := range test.cursors {
+				updater.table[id] = cursor
+			}
+
+			p.Run(ctx, updater, hg)
+
+			assert.ElementsMatch(t, test.expectedEvents, hg.events)
+
+			var meta fileMeta
+			require.NoError(t, updater.FindCursorMeta(fileSource{fileID: archiveID}, &meta))
+			assert.Len(t, meta.Members, 2, "members of the archive must be stored")
+		})
+	}
+}
+
+func TestProspectorArchiveSkipsPlainFilesOnWrite(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "app.log")
+	require.NoError(t, os.WriteFile(path, []byte(compressionTestContent), 0o600))
+	id := "path::" + path
+	// The file is gone when it is written to, probing it again would fail.
+	missing := filepath.Join(t.TempDir(), "app.log")
+	create := loginp.FSEvent{Op: loginp.OpCreate, NewPath: path, Descriptor: createTestFileDescriptor()}
+	write := loginp.FSEvent{Op: loginp.OpWrite, NewPath: missing, Descriptor: createTestFileDescriptor()}
+
+	p := fileProspector{
+		logger:     logp.L(),
+		identifier: mustPathIdentifier(false),
+		archive:    archiveConfig{Enabled: true, Members: []string{"*.log"}},
+	}
+	ctx := input.Context{Logger: logp.L(), Cancelation: context.Background()}
+	hg := newTestHarvesterGroup()
+	updater := newMockMetadataUpdater()
+
+	// The write event is reported for the same source as the create event.
+	p.onFSEvent(p.logger, ctx, create, fileSource{fileID: id, newPath: path}, updater, hg, time.Time{})
+	p.onFSEvent(p.logger, ctx, write, fileSource{fileID: id, newPath: missing}, updater, hg, time.Time{})
+
+	assert.Equal(t, []harvesterEvent{harvesterStart(id), harvesterStart(id)}, hg.events)
+	var meta fileMeta
+	require.NoError(t, updater.FindCursorMeta(fileSource{fileID: id}, &meta))
+	assert.True(t, meta.NotArchive, "the file must be known not to be an archive")
+	assert.Equal(t, path, meta.Source)
+}
+
+func TestFilestreamArchive(t *testing.T) {
+	for _, format := range []string{tarFormat + "." + gzipFormat, zipFormat} {
+		t.Run(format, func(t *testing.T) {
+			path := createTestArchive(t, format, archiveTestMembers)
+			cfg := fmt.Sprintf(`
+type: filestream
+id: foo
+prospector.scanner.check_interval: 1s
+prospector.scanner.fingerprint.enabled: false
+file_identity.native: ~
+archive:
+  enabled: true
+  members: ["*.log"]
+paths:
+    - %s`, path)
+			runner := createFilestreamTestRunner(context.Background(), t, "archive-"+format, cfg, 5, true)
+			events := runner(t)
+			require.Len(t, events, 5)
+
+			lines := map[string][]string{}
+			for _, event := range events {
+				member, err := event.GetValue("log.file.path")
+				require.NoError(t, err)
+				archive, err := event.GetValue("log.file.archive.path")
+				require.NoError(t, err)
+				assert.Equal(t, path, archive)
+				message, err := event.GetValue("message")
+				require.NoError(t, err)
+				lines[member.(string)] = append(lines[member.(string)], message.(string))
+			}
+			assert.Equal(t, map[string][]string{
+				"logs/app.log":  {"first line", "second line", "third line"},
+				"other/app.log": {"other first line", "other second line"},
+			}, lines)
+		})
+	}
+}
+
+// createTestArchive writes an archive of the members and returns its path.
+// format is a tar or zip format, tar archives can be compressed, like
+// "tar.gz".
+func createTestArchive(t *testing.T, format string, members []archiveTestMember) string {
+	var buf bytes.Buffer
+	if format == zipFormat {
+		w := zip.NewWriter(&buf)
+		_, err := w.Create("logs/")
+		require.NoError(t, err)
+		for _, m := range members {
+			mw, err := w.Create(m.path)
+			require.NoError(t, err)
+			_, err = io.WriteString(mw, m.content)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+	} else {
+		w := tar.NewWriter(&buf)
+		require.NoError(t, w.WriteHeader(&tar.Header{Name: "logs/", Typeflag: tar.TypeDir, Mode: 0o755}))
+		for _, m := range members {
+			require.NoError(t, w.WriteHeader(&tar.Header{Name: m.path, Mode: 0o644, Size: int64(len(m.content))}))
+			_, err := io.WriteString(w, m.content)
+			require.NoError(t, err)
+		}
+		require.NoError(t, w.Close())
+	}
+
+	content := buf.Bytes()
+	if compression, ok := strings.CutPrefix(format, tarFormat+"."); ok {
+		content = compress(t, compression, buf.String())
+	}
+	path := filepath.Join(t.TempDir(), "bundle."+format)
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+	return path
+}
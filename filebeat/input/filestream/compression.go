@@ -0,0 +1,199 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+)
+
+const (
+	compressionNone = "none"
+	compressionAuto = "auto"
+
+	gzipFormat = "gzip"
+	zstdFormat = "zstd"
+)
+
+var (
+	gzipMagic = []byte{0x1f, 0x8b}
+	zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+	errIncompleteCompressedFile = errors.New("compressed file is incomplete")
+)
+
+// File is a file read by the input. Compressed files read and seek in
+// their decompressed content.
+type File interface {
+	io.ReadSeekCloser
+	Name() string
+	Stat() (os.FileInfo, error)
+	// OSFile returns the underlying file.
+	OSFile() *os.File
+}
+
+// plainFile is a File that is not compressed.
+type plainFile struct {
+	*os.File
+}
+
+func (f plainFile) OSFile() *os.File { return f.File }
+
+// detectCompression returns the compression format of a file, detected
+// from the magic bytes at its start, or an empty string if the file is not
+// compressed. The offset of the file is restored.
+func detectCompression(f io.ReadSeeker) (string, error) {
+	offset, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", err
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	var magic [4]byte
+	n, err := io.ReadFull(f, magic[:])
+	if err != nil && !errors.Is(err, io.EOF) && !errors.Is(err, io.ErrUnexpectedEOF) {
+		return "", err
+	}
+	if _, err = f.Seek(offset, io.SeekStart); err != nil {
+		return "", err
+	}
+
+	switch {
+	case bytes.HasPrefix(magic[:n], gzipMagic):
+		return gzipFormat, nil
+	case bytes.HasPrefix(magic[:n], zstdMagic):
+		return zstdFormat, nil
+	default:
+		return "", nil
+	}
+}
+
+// newDecompressor returns a reader of the decompressed content of r.
+func newDecompressor(format string, r io.Reader) (io.ReadCloser, error) {
+	switch format {
+	case gzipFormat:
+		dec, err := gzip.NewReader(r)
+		if err != nil {
+			return nil, decompressionError(err)
+		}
+		return dec, nil
+	case zstdFormat:
+		dec, err := zstd.NewReader(r, zstd.WithDecoderConcurrency(1), zstd.WithDecoderLowmem(true))
+		if err != nil {
+			return nil, err
+		}
+		return dec.IOReadCloser(), nil
+	default:
+		return nil, fmt.Errorf("unknown compression format %q", format)
+	}
+}
+
+// decompressionError returns errIncompleteCompressedFile if the compressed
+// content ended early, like while the file is being written.
+func decompressionError(err error) error {
+	if errors.Is(err, io.ErrUnexpectedEOF) || errors.Is(err, io.EOF) {
+		return fmt.Errorf("%w: %w", errIncompleteCompressedFile, err)
+	}
+	return err
+}
+
+// compressedFile is a File that reads the decompressed content of a
+// compressed file or the content of an archive member. Offsets are offsets
+// in the decompressed content. Seeking backwards decompresses the file
+// again from its start.
+type compressedFile struct {
+	file   *os.File
+	open   func() (io.ReadCloser, error)
+	dec    io.ReadCloser
+	offset int64
+}
+
+func newCompressedFile(f *os.File, format string) (*compressedFile, error) {
+	return newReopenableFile(f, func() (io.ReadCloser, error) {
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return nil, err
+		}
+		return newDecompressor(format, f)
+	})
+}
+
+// newReopenableFile returns a compressedFile reading the content returned
+// by open. open is called again when seeking backwards.
+func newReopenableFile(f *os.File, open func() (io.ReadCloser, error)) (*compressedFile, error) {
+	dec, err := open()
+	if err != nil {
+		return nil, err
+	}
+	return &compressedFile{file: f, open: open, dec: dec}, nil
+}
+
+// Read reads decompressed content. It returns an error wrapping
+// errIncompleteCompressedFile if the compressed content ends early.
+func (f *compressedFile) Read(p []byte) (int, error) {
+	n, err := f.dec.Read(p)
+	f.offset += int64(n)
+	if err != nil && !errors.Is(err, io.EOF) {
+		err = decompressionError(err)
+	}
+	return n, err
+}
+
+// Seek sets the offset in the decompressed content. Seeking from the end
+// is not supported. Seeking past the end of the content returns io.EOF.
+func (f *compressedFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += f.offset
+	default:
+		return f.offset, errors.New("seeking from the end of compressed files is not supported")
+	}
+	if offset < 0 {
+		return f.offset, errors.New("negative offset")
+	}
+
+	if offset < f.offset {
+		dec, err := f.open()
+		if err != nil {
+			return f.offset, err
+		}
+		_ = f.dec.Close()
+		f.dec = dec
+		f.offset = 0
+	}
+
+	_, err := io.CopyN(io.Discard, f, offset-f.offset)
+	return f.offset, err
+}
+
+func (f *compressedFile) Close() error {
+	_ = f.dec.Close()
+	return f.file.Close()
+}
+
+func (f *compressedFile) Name() string               { return f.file.Name() }
+func (f *compressedFile) Stat() (os.FileInfo, error) { return f.file.Stat() }
+func (f *compressedFile) OSFile() *os.File           { return f.file }
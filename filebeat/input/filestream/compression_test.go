@@ -0,0 +1,294 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile/encoding"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+const compressionTestContent = "first line\nsecond line\nthird line\n"
+
+func TestDetectCompression(t *testing.T) {
+	tests := map[string]struct {
+		content []byte
+		format  string
+	}{
+		"gzip":  {content: compress(t, gzipFormat, compressionTestContent), format: gzipFormat},
+		"zstd":  {content: compress(t, zstdFormat, compressionTestContent), format: zstdFormat},
+		"plain": {content: []byte(compressionTestContent), format: ""},
+		"short": {content: []byte{0x1f}, format: ""},
+		"empty": {content: nil, format: ""},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			r := bytes.NewReader(test.content)
+			if len(test.content) > 0 {
+				_, err := r.Seek(1, io.SeekStart)
+				require.NoError(t, err)
+			}
+
+			format, err := detectCompression(r)
+			require.NoError(t, err)
+			assert.Equal(t, test.format, format)
+
+			offset, err := r.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, int64(min(1, len(test.content))), offset, "offset must be restored")
+		})
+	}
+}
+
+func TestCompressedFile(t *testing.T) {
+	for _, format := range []string{gzipFormat, zstdFormat} {
+		t.Run(format, func(t *testing.T) {
+			f := createCompressedTestFile(t, format, compressionTestContent)
+			cf, err := newCompressedFile(f, format)
+			require.NoError(t, err)
+			defer cf.Close()
+
+			content, err := io.ReadAll(cf)
+			require.NoError(t, err)
+			assert.Equal(t, compressionTestContent, string(content))
+
+			offset, err := cf.Seek(0, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, int64(len(compressionTestContent)), offset)
+
+			// backwards
+			offset, err = cf.Seek(11, io.SeekStart)
+			require.NoError(t, err)
+			assert.Equal(t, int64(11), offset)
+			assertReadLine(t, cf, "second line\n")
+
+			// forwards
+			offset, err = cf.Seek(-1, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, int64(22), offset)
+			offset, err = cf.Seek(1, io.SeekCurrent)
+			require.NoError(t, err)
+			assert.Equal(t, int64(23), offset)
+			assertReadLine(t, cf, "third line\n")
+
+			// past the end
+			_, err = cf.Seek(int64(len(compressionTestContent)+1), io.SeekStart)
+			assert.ErrorIs(t, err, io.EOF)
+
+			_, err = cf.Seek(0, io.SeekEnd)
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestCompressedFileIncomplete(t *testing.T) {
+	content := strings.Repeat(compressionTestContent, 1000)
+	for _, format := range []string{gzipFormat, zstdFormat} {
+		t.Run(format, func(t *testing.T) {
+			compressed := compress(t, format, content)
+			f := createTestFile(t, "incomplete.log."+format, compressed[:len(compressed)/2])
+
+			cf, err := newCompressedFile(f, format)
+			require.NoError(t, err)
+			defer cf.Close()
+
+			_, err = io.ReadAll(cf)
+			assert.ErrorIs(t, err, errIncompleteCompressedFile)
+		})
+	}
+}
+
+func TestFilestreamOpenCompressedFile(t *testing.T) {
+	inp := filestream{
+		readerConfig:    readerConfig{Compression: compressionAuto},
+		encodingFactory: encoding.Plain,
+	}
+	logger := logptest.NewTestingLogger(t, "")
+
+	for _, format := range []string{gzipFormat, zstdFormat} {
+		t.Run(format, func(t *testing.T) {
+			f := createCompressedTestFile(t, format, compressionTestContent)
+			f.Close()
+
+			t.Run("from offset", func(t *testing.T) {
+				f, _, truncated, err := inp.openFile(logger, f.Name(), 11)
+				require.NoError(t, err)
+				defer f.Close()
+
+				assert.False(t, truncated)
+				assert.IsType(t, &compressedFile{}, f)
+				assertReadLine(t, f, "second line\n")
+			})
+
+			t.Run("offset past the end is truncated", func(t *testing.T) {
+				f, _, truncated, err := inp.openFile(logger, f.Name(), 1000)
+				require.NoError(t, err)
+				defer f.Close()
+
+				assert.True(t, truncated)
+				assertReadLine(t, f, "first line\n")
+			})
+
+			t.Run("compression disabled", func(t *testing.T) {
+				inp := inp
+				inp.readerConfig.Compression = compressionNone
+				f, _, _, err := inp.openFile(logger, f.Name(), 0)
+				require.NoError(t, err)
+				defer f.Close()
+
+				assert.IsType(t, plainFile{}, f)
+			})
+		})
+	}
+}
+
+func TestFileScannerCompressedFingerprint(t *testing.T) {
+	dir := t.TempDir()
+	content := strings.Repeat(compressionTestContent, 100)
+	plainPath := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(plainPath, []byte(content), 0o644))
+	gzPath := filepath.Join(dir, "app.log.1.gz")
+	require.NoError(t, os.WriteFile(gzPath, compress(t, gzipFormat, content), 0o644))
+	shortPath := filepath.Join(dir, "short.log.gz")
+	require.NoError(t, os.WriteFile(shortPath, compress(t, gzipFormat, "short\n"), 0o644))
+
+	cfg := fileScannerConfig{
+		Fingerprint: fingerprintConfig{
+			Enabled: true,
+			Offset:  10,
+			Length:  1024,
+		},
+		decompress: true,
+	}
+	s, err := newFileScanner(logp.NewNopLogger(), []string{filepath.Join(dir, "*")}, cfg)
+	require.NoError(t, err)
+
+	plain, err := s.toFileDescriptor(ingestTargetFor(t, s, plainPath))
+	require.NoError(t, err)
+	assert.Empty(t, plain.Compression)
+
+	gz, err := s.toFileDescriptor(ingestTargetFor(t, s, gzPath))
+	require.NoError(t, err)
+	assert.Equal(t, gzipFormat, gz.Compression)
+	assert.Equal(t, plain.Fingerprint, gz.Fingerprint)
+
+	_, err = s.toFileDescriptor(ingestTargetFor(t, s, shortPath))
+	assert.ErrorIs(t, err, errFileTooSmall)
+}
+
+func TestFileWatcherCompressedRename(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "app.log*")}
+	cfgStr := `
+scanner:
+  check_interval: 100ms
+  fingerprint:
+    enabled: true
+    length: 64
+`
+	content := strings.Repeat(compressionTestContent, 10)
+	plainPath := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(plainPath, []byte(content), 0o644))
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	cfg, err := conf.NewConfigWithYAML([]byte(cfgStr), cfgStr)
+	require.NoError(t, err)
+	ns := &conf.Namespace{}
+	require.NoError(t, ns.Unpack(cfg))
+	fw, err := newFileWatcher(logp.NewNopLogger(), paths, ns, compressionAuto)
+	require.NoError(t, err)
+	go fw.Run(ctx)
+
+	e := fw.Event()
+	require.Equal(t, loginp.OpCreate, e.Op)
+
+	// rotate and compress the file like logrotate does
+	gzPath := filepath.Join(dir, "app.log.1.gz")
+	require.NoError(t, os.WriteFile(gzPath, compress(t, gzipFormat, content), 0o644))
+	require.NoError(t, os.Remove(plainPath))
+
+	e = fw.Event()
+	assert.Equal(t, loginp.OpRename, e.Op)
+	assert.Equal(t, plainPath, e.OldPath)
+	assert.Equal(t, gzPath, e.NewPath)
+	assert.Equal(t, gzipFormat, e.Descriptor.Compression)
+}
+
+func ingestTargetFor(t *testing.T, s *fileScanner, filename string) *ingestTarget {
+	it, err := s.getIngestTarget(filename)
+	require.NoError(t, err)
+	return &it
+}
+
+func assertReadLine(t *testing.T, r io.Reader, expected string) {
+	buf := make([]byte, len(expected))
+	_, err := io.ReadFull(r, buf)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(buf))
+}
+
+func createCompressedTestFile(t *testing.T, format, content string) *os.File {
+	return createTestFile(t, "test.log."+format, compress(t, format, content))
+}
+
+func createTestFile(t *testing.T, name string, content []byte) *os.File {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, content, 0o644))
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
+
+func compress(t *testing.T, format, content string) []byte {
+	var buf bytes.Buffer
+	var w io.WriteCloser
+	switch format {
+	case gzipFormat:
+		w = gzip.NewWriter(&buf)
+	case zstdFormat:
+		enc, err := zstd.NewWriter(&buf)
+		require.NoError(t, err)
+		w = enc
+	default:
+		t.Fatalf("unknown format %q", format)
+	}
+	_, err := io.WriteString(w, content)
+	require.NoError(t, err)
+	require.NoError(t, w.Close())
+	return buf.Bytes()
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/dustin/go-humanize"
 
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
 	"github.com/elastic/beats/v7/libbeat/common/match"
 	"github.com/elastic/beats/v7/libbeat/reader/parser"
 	"github.com/elastic/beats/v7/libbeat/reader/readfile"
@@ -50,6 +51,11 @@ type config struct {
 	IgnoreInactive ignoreInactiveType `config:"ignore_inactive"`
 	Rotation       *conf.Namespace    `config:"rotation"`
 	TakeOver       takeOverConfig     `config:"take_over"`
+	Archive        archiveConfig      `config:"archive"`
+
+	// RateLimit is used by InputManager.Create
+	// (see internal/input-logfile/manager.go).
+	RateLimit loginp.RateLimitConfig `config:"rate_limit"`
 
 	// AllowIDDuplication is used by InputManager.Create
 	// (see internal/input-logfile/manager.go).
@@ -81,6 +87,7 @@ type stateChangeCloserConfig struct {
 type readerConfig struct {
 	Backoff        backoffConfig           `config:"backoff"`
 	BufferSize     int                     `config:"buffer_size"`
+	Compression    string                  `config:"compression"`
 	Encoding       string                  `config:"encoding"`
 	ExcludeLines   []match.Matcher         `config:"exclude_lines"`
 	IncludeLines   []match.Matcher         `config:"include_lines"`
@@ -141,6 +148,7 @@ func defaultReaderConfig() readerConfig {
 			Max:  10 * time.Second,
 		},
 		BufferSize:     16 * humanize.KiByte,
+		Compression:    compressionNone,
 		LineTerminator: readfile.AutoLineTerminator,
 		MaxBytes:       10 * humanize.MiByte,
 		Tail:           false,
@@ -168,6 +176,12 @@ func (c *config) Validate() error {
 		return errors.New("'take_over' mode is only allowed if an input ID is set")
 	}
 
+	switch c.Reader.Compression {
+	case "", compressionNone, compressionAuto:
+	default:
+		return fmt.Errorf("invalid compression %q, must be %q or %q", c.Reader.Compression, compressionNone, compressionAuto)
+	}
+
 	return nil
 }
 
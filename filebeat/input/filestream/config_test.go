@@ -55,6 +55,17 @@ func TestConfigValidate(t *testing.T) {
 		err := c.Validate()
 		assert.NoError(t, err)
 	})
+
+	t.Run("compression must be none or auto", func(t *testing.T) {
+		c := defaultConfig()
+		c.Paths = []string{"/foo/bar"}
+		c.Reader.Compression = "gzip"
+		err := c.Validate()
+		assert.ErrorContains(t, err, `invalid compression "gzip"`)
+
+		c.Reader.Compression = compressionAuto
+		assert.NoError(t, c.Validate())
+	})
 }
 
 func TestValidateInputIDs(t *testing.T) {
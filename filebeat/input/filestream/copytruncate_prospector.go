@@ -299,7 +299,7 @@ func (p *copyTruncateFileProspector) onFSEvent(
 			p.onRotatedFile(log, ctx, event, src, group)
 		}
 
-		p.fileProspector.onRename(log, ctx, event, src, updater, group)
+		p.fileProspector.onRename(log, ctx, event, src, updater, group, ignoreSince)
 
 	default:
 		log.Error("Unknown return value %v", event.Op)
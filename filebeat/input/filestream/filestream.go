@@ -41,7 +41,7 @@ var (
 
 // logFile contains all log related data
 type logFile struct {
-	file      *os.File
+	file      File
 	log       *logp.Logger
 	readerCtx ctxtool.CancelContext
 
@@ -63,7 +63,7 @@ type logFile struct {
 func newFileReader(
 	log *logp.Logger,
 	canceler input.Canceler,
-	f *os.File,
+	f File,
 	config readerConfig,
 	closerConfig closerConfig,
 ) (*logFile, error) {
@@ -211,7 +211,7 @@ func (f *logFile) shouldBeClosed() bool {
 
 	if f.closeRemoved {
 		// Check if the file name exists. See https://github.com/elastic/filebeat/issues/93
-		if file.IsRemoved(f.file) {
+		if file.IsRemoved(f.file.OSFile()) {
 			f.log.Debugf("close.on_state_change.removed is enabled and file %s has been removed", f.file.Name())
 			return true
 		}
@@ -232,6 +232,12 @@ func isSameFile(path string, info os.FileInfo) bool {
 // errorChecks determines the cause for EOF errors, and how the EOF event should be handled
 // based on the config options.
 func (f *logFile) errorChecks(err error) error {
+	if errors.Is(err, errIncompleteCompressedFile) {
+		// The file is read again from the last offset once it is complete.
+		f.log.Debugf("End of incomplete compressed file reached: %s; Closing. Error: %s", f.file.Name(), err)
+		return io.EOF
+	}
+
 	if !errors.Is(err, io.EOF) {
 		f.log.Error("Unexpected state reading from %s; error: %s", f.file.Name(), err)
 		return err
@@ -62,7 +62,7 @@ func TestLogFileTimedClosing(t *testing.T) {
 			reader, err := newFileReader(
 				logptest.NewTestingLogger(t, ""),
 				context.TODO(),
-				f,
+				plainFile{f},
 				readerConfig{},
 				closerConfig{
 					OnStateChange: stateChangeCloserConfig{
@@ -90,7 +90,7 @@ func TestLogFileTruncated(t *testing.T) {
 	defer f.Close()
 	defer os.Remove(f.Name())
 
-	reader, err := newFileReader(logptest.NewTestingLogger(t, ""), context.TODO(), f, readerConfig{}, closerConfig{})
+	reader, err := newFileReader(logptest.NewTestingLogger(t, ""), context.TODO(), plainFile{f}, readerConfig{}, closerConfig{})
 	if err != nil {
 		t.Fatalf("error while creating logReader: %+v", err)
 	}
@@ -76,7 +76,7 @@ func TestLogFileRemoved(t *testing.T) {
 	reader, err := newFileReader(
 		logptest.NewTestingLogger(t, ""),
 		context.TODO(),
-		f,
+		plainFile{f},
 		readerConfig{},
 		closerConfig{
 			OnStateChange: stateChangeCloserConfig{
@@ -26,6 +26,7 @@ import (
 	"io"
 	"os"
 	"path/filepath"
+	"runtime"
 	"time"
 
 	"github.com/elastic/go-concert/timed"
@@ -44,6 +45,9 @@ const (
 	DefaultFingerprintSize int64 = 1024 // 1KB
 	scannerDebugKey              = "scanner"
 	watcherDebugKey              = "file_watcher"
+
+	pollingMode = "polling"
+	inotifyMode = "inotify"
 )
 
 var (
@@ -51,7 +55,11 @@ var (
 )
 
 type fileWatcherConfig struct {
-	// Interval is the time between two scans.
+	// Mode is how file changes are detected, by scanning the files
+	// every Interval or from inotify events.
+	Mode string `config:"mode"`
+	// Interval is the time between two scans. In inotify mode the scans
+	// are a fallback for events that have been missed.
 	Interval time.Duration `config:"check_interval"`
 	// ResendOnModTime  if a file has been changed according to modtime but the size is the same
 	// it is still considered truncation.
@@ -70,7 +78,7 @@ type fileWatcher struct {
 	events  chan loginp.FSEvent
 }
 
-func newFileWatcher(logger *logp.Logger, paths []string, ns *conf.Namespace) (loginp.FSWatcher, error) {
+func newFileWatcher(logger *logp.Logger, paths []string, ns *conf.Namespace, compression string) (loginp.FSWatcher, error) {
 	var config *conf.C
 	if ns == nil {
 		config = conf.NewConfig()
@@ -78,15 +86,16 @@ func newFileWatcher(logger *logp.Logger, paths []string, ns *conf.Namespace) (lo
 		config = ns.Config()
 	}
 
-	return newScannerWatcher(logger, paths, config)
+	return newScannerWatcher(logger, paths, config, compression)
 }
 
-func newScannerWatcher(logger *logp.Logger, paths []string, c *conf.C) (loginp.FSWatcher, error) {
+func newScannerWatcher(logger *logp.Logger, paths []string, c *conf.C, compression string) (loginp.FSWatcher, error) {
 	config := defaultFileWatcherConfig()
 	err := c.Unpack(&config)
 	if err != nil {
 		return nil, err
 	}
+	config.Scanner.decompress = compression == compressionAuto
 	scanner, err := newFileScanner(logger, paths, config.Scanner)
 	if err != nil {
 		return nil, err
@@ -101,8 +110,22 @@ func newScannerWatcher(logger *logp.Logger, paths []string, c *conf.C) (loginp.F
 	}, nil
 }
 
+func (c *fileWatcherConfig) Validate() error {
+	switch c.Mode {
+	case pollingMode:
+	case inotifyMode:
+		if runtime.GOOS != "linux" {
+			return fmt.Errorf("scanner mode %q is only supported on Linux", inotifyMode)
+		}
+	default:
+		return fmt.Errorf("invalid scanner mode %q, must be %q or %q", c.Mode, pollingMode, inotifyMode)
+	}
+	return nil
+}
+
 func defaultFileWatcherConfig() fileWatcherConfig {
 	return fileWatcherConfig{
+		Mode:            pollingMode,
 		Interval:        10 * time.Second,
 		ResendOnModTime: false,
 		Scanner:         defaultFileScannerConfig(),
@@ -112,6 +135,15 @@ func defaultFileWatcherConfig() fileWatcherConfig {
 func (w *fileWatcher) Run(ctx unison.Canceler) {
 	defer close(w.events)
 
+	if w.cfg.Mode == inotifyMode {
+		w.runNotify(ctx)
+		return
+	}
+
+	w.runPolling(ctx)
+}
+
+func (w *fileWatcher) runPolling(ctx unison.Canceler) {
 	// run initial scan before starting regular
 	w.watch(ctx)
 
@@ -126,7 +158,18 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 	w.log.Debug("Start next scan")
 
 	paths := w.scanner.GetFiles()
+	if !w.compare(ctx, paths, w.prev) {
+		return
+	}
 
+	w.prev = paths
+}
+
+// compare sends the events for the differences between the current files
+// and the previous files with the same paths. Files in prev that are seen
+// again are removed from it, new empty files are removed from paths.
+// It returns false if the context was cancelled.
+func (w *fileWatcher) compare(ctx unison.Canceler, paths, prev map[string]loginp.FileDescriptor) bool {
 	// for debugging purposes
 	writtenCount := 0
 	truncatedCount := 0
@@ -140,7 +183,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 	for path, fd := range paths {
 		// if the scanner found a new path or an existing path
 		// with a different file, it is a new file
-		prevDesc, ok := w.prev[path]
+		prevDesc, ok := prev[path]
 		sfd := fd // to avoid memory aliasing
 		if !ok || !loginp.SameFile(&prevDesc, &sfd) {
 			newFilesByName[path] = &sfd
@@ -173,18 +216,18 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		if e.Op != loginp.OpDone {
 			select {
 			case <-ctx.Done():
-				return
+				return false
 			case w.events <- e:
 			}
 		}
 
 		// delete from previous state to mark that we've seen the existing file again
-		delete(w.prev, path)
+		delete(prev, path)
 	}
 
 	// remaining files in the prev map are the ones that are missing
 	// either because they have been deleted or renamed
-	for remainingPath, remainingDesc := range w.prev {
+	for remainingPath, remainingDesc := range prev {
 		var e loginp.FSEvent
 
 		id := remainingDesc.FileID()
@@ -199,7 +242,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		}
 		select {
 		case <-ctx.Done():
-			return
+			return false
 		case w.events <- e:
 		}
 	}
@@ -214,7 +257,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		}
 		select {
 		case <-ctx.Done():
-			return
+			return false
 		case w.events <- createEvent(path, *fd):
 			createdCount++
 		}
@@ -229,7 +272,7 @@ func (w *fileWatcher) watch(ctx unison.Canceler) {
 		"created", createdCount,
 	).Debugf("File scan complete")
 
-	w.prev = paths
+	return true
 }
 
 func createEvent(path string, fd loginp.FileDescriptor) loginp.FSEvent {
@@ -272,6 +315,10 @@ type fileScannerConfig struct {
 	Symlinks      bool              `config:"symlinks"`
 	RecursiveGlob bool              `config:"recursive_glob"`
 	Fingerprint   fingerprintConfig `config:"fingerprint"`
+
+	// decompress is set from the reader configuration, if enabled
+	// compressed files are fingerprinted over their decompressed content.
+	decompress bool
 }
 
 func defaultFileScannerConfig() fileScannerConfig {
@@ -500,9 +547,10 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 
 	if s.cfg.Fingerprint.Enabled {
 		fileSize := it.info.Size()
-		// we should not open the file if we know it's too small
+		// we should not open the file if we know it's too small,
+		// compressed files are checked after decompression
 		minSize := s.cfg.Fingerprint.Offset + s.cfg.Fingerprint.Length
-		if fileSize < minSize {
+		if !s.cfg.decompress && fileSize < minSize {
 			return fd, fmt.Errorf("filesize of %q is %d bytes, expected at least %d bytes for fingerprinting: %w", fd.Filename, fileSize, minSize, errFileTooSmall)
 		}
 
@@ -512,7 +560,35 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 		}
 		defer file.Close()
 
-		if s.cfg.Fingerprint.Offset != 0 {
+		var r io.Reader = file
+		if s.cfg.decompress {
+			fd.Compression, err = detectCompression(file)
+			if err != nil {
+				return fd, fmt.Errorf("failed to detect compression of %q: %w", fd.Filename, err)
+			}
+			if fd.Compression == "" && fileSize < minSize {
+				return fd, fmt.Errorf("filesize of %q is %d bytes, expected at least %d bytes for fingerprinting: %w", fd.Filename, fileSize, minSize, errFileTooSmall)
+			}
+		}
+
+		if fd.Compression != "" {
+			dec, err := newDecompressor(fd.Compression, file)
+			if err != nil {
+				if errors.Is(decompressionError(err), errIncompleteCompressedFile) {
+					return fd, fmt.Errorf("compressed file %q is too short for fingerprinting: %w", fd.Filename, errFileTooSmall)
+				}
+				return fd, fmt.Errorf("failed to decompress %q for fingerprinting: %w", fd.Filename, err)
+			}
+			defer dec.Close()
+			r = dec
+
+			if s.cfg.Fingerprint.Offset != 0 {
+				_, err = io.CopyN(io.Discard, r, s.cfg.Fingerprint.Offset)
+				if err != nil {
+					return fd, s.compressedFingerprintError(fd.Filename, err)
+				}
+			}
+		} else if s.cfg.Fingerprint.Offset != 0 {
 			_, err = file.Seek(s.cfg.Fingerprint.Offset, io.SeekStart)
 			if err != nil {
 				return fd, fmt.Errorf("failed to seek %q for fingerprinting: %w", fd.Filename, err)
@@ -520,11 +596,17 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 		}
 
 		s.hasher.Reset()
-		lr := io.LimitReader(file, s.cfg.Fingerprint.Length)
+		lr := io.LimitReader(r, s.cfg.Fingerprint.Length)
 		written, err := io.CopyBuffer(s.hasher, lr, s.readBuffer)
 		if err != nil {
+			if fd.Compression != "" {
+				return fd, s.compressedFingerprintError(fd.Filename, err)
+			}
 			return fd, fmt.Errorf("failed to compute hash for first %d bytes of %q: %w", s.cfg.Fingerprint.Length, fd.Filename, err)
 		}
+		if fd.Compression != "" && written < s.cfg.Fingerprint.Length {
+			return fd, fmt.Errorf("read only %d bytes from decompressed content of %q, expected %d bytes for fingerprinting: %w", written, fd.Filename, s.cfg.Fingerprint.Length, errFileTooSmall)
+		}
 		if written != s.cfg.Fingerprint.Length {
 			return fd, fmt.Errorf("failed to read %d bytes from %q to compute fingerprint, read only %d", written, fd.Filename, s.cfg.Fingerprint.Length)
 		}
@@ -535,6 +617,15 @@ func (s *fileScanner) toFileDescriptor(it *ingestTarget) (fd loginp.FileDescript
 	return fd, nil
 }
 
+// compressedFingerprintError reports compressed files which end before the
+// fingerprint as too small, they might still be written.
+func (s *fileScanner) compressedFingerprintError(filename string, err error) error {
+	if errors.Is(err, io.EOF) || errors.Is(decompressionError(err), errIncompleteCompressedFile) {
+		return fmt.Errorf("decompressed content of %q is too short for fingerprinting: %w", filename, errFileTooSmall)
+	}
+	return fmt.Errorf("failed to decompress %q for fingerprinting: %w", filename, err)
+}
+
 func (s *fileScanner) isFileExcluded(file string) bool {
 	return len(s.cfg.ExcludedFiles) > 0 && s.matchAny(s.cfg.ExcludedFiles, file)
 }
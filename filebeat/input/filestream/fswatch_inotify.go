@@ -0,0 +1,331 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package filestream
+
+import (
+	"errors"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"time"
+
+	"github.com/elastic/go-concert/unison"
+	"github.com/fsnotify/fsnotify"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// notifyBatchDelay is how long events are collected before the changed
+// files are compared. The two events of a rename are usually in the same
+// batch.
+const notifyBatchDelay = 100 * time.Millisecond
+
+// notifyScanner is a scanner that can look up single files, used by the
+// inotify mode of the fileWatcher.
+type notifyScanner interface {
+	loginp.FSScanner
+	// watchDirs returns the existing directories that can contain
+	// matching files.
+	watchDirs() []string
+	// getFilesByName returns the file descriptors of the filenames that
+	// match the configured paths.
+	getFilesByName(filenames map[string]struct{}) map[string]loginp.FileDescriptor
+}
+
+// runNotify compares the files that changed according to inotify events.
+// Full scans still run every check_interval and when events were lost,
+// like when the inotify queue overflowed. Events of files in directories
+// that are not watched yet, or of symlink targets in other directories,
+// are only found by the full scans.
+func (w *fileWatcher) runNotify(ctx unison.Canceler) {
+	scanner, ok := w.scanner.(notifyScanner)
+	if !ok {
+		w.log.Errorf("Scanner does not support %s mode, falling back to polling", inotifyMode)
+		w.runPolling(ctx)
+		return
+	}
+
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		w.log.Errorf("Failed to create inotify watcher, falling back to polling: %v", err)
+		w.runPolling(ctx)
+		return
+	}
+	defer watcher.Close()
+
+	// the directories are watched before the initial scan, so that no
+	// change is missed
+	n := dirNotifier{watcher: watcher, log: w.log}
+	n.update(scanner.watchDirs())
+	w.watch(ctx)
+
+	ticker := time.NewTicker(w.cfg.Interval)
+	defer ticker.Stop()
+
+	var batch <-chan time.Time
+	fullScan := false
+	// paths changed since the last comparison, and the ones of them
+	// that were renamed
+	changed := map[string]struct{}{}
+	renamed := map[string]struct{}{}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+
+		case e, ok := <-watcher.Events:
+			if !ok {
+				return
+			}
+			if n.isDir(e.Name) {
+				// the watched directory itself was removed or renamed
+				if e.Has(fsnotify.Remove) || e.Has(fsnotify.Rename) {
+					n.forget(e.Name)
+					fullScan = true
+				}
+			} else {
+				changed[e.Name] = struct{}{}
+				if e.Has(fsnotify.Rename) {
+					renamed[e.Name] = struct{}{}
+				}
+				// new directories might need to be watched
+				if e.Has(fsnotify.Create) && isDir(e.Name) {
+					fullScan = true
+				}
+			}
+			if batch == nil {
+				batch = time.After(notifyBatchDelay)
+			}
+
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return
+			}
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.log.Warn("Inotify event queue overflowed, scanning all files")
+			} else {
+				w.log.Errorf("Inotify watcher failed, scanning all files: %v", err)
+			}
+			fullScan = true
+			if batch == nil {
+				batch = time.After(notifyBatchDelay)
+			}
+
+		case <-batch:
+			batch = nil
+			if fullScan {
+				w.watch(ctx)
+				n.update(scanner.watchDirs())
+				ticker.Reset(w.cfg.Interval)
+				fullScan = false
+				clear(changed)
+				clear(renamed)
+				continue
+			}
+
+			changed = w.watchPaths(ctx, scanner, changed, renamed)
+			clear(renamed)
+			if len(changed) > 0 {
+				batch = time.After(notifyBatchDelay)
+			}
+
+		case <-ticker.C:
+			w.watch(ctx)
+			n.update(scanner.watchDirs())
+		}
+	}
+}
+
+// watchPaths compares the files of the changed paths with their previous
+// state and sends the events. Renamed files whose new path is not known
+// yet are kept for the next batch, so that the rename is not reported as
+// a removal if the other event of the rename is late. The paths kept for
+// the next batch are returned.
+func (w *fileWatcher) watchPaths(
+	ctx unison.Canceler,
+	scanner notifyScanner,
+	changed, renamed map[string]struct{},
+) map[string]struct{} {
+	paths := scanner.getFilesByName(changed)
+
+	pending := map[string]struct{}{}
+	for path := range renamed {
+		prevDesc, known := w.prev[path]
+		if _, exists := paths[path]; exists || !known {
+			continue
+		}
+		if !hasFileID(paths, prevDesc.FileID()) {
+			pending[path] = struct{}{}
+			delete(changed, path)
+		}
+	}
+
+	w.removeKnownFiles(paths, changed)
+
+	prev := make(map[string]loginp.FileDescriptor, len(changed))
+	for path := range changed {
+		if fd, ok := w.prev[path]; ok {
+			prev[path] = fd
+		}
+	}
+
+	if !w.compare(ctx, paths, prev) {
+		return pending
+	}
+
+	for path := range changed {
+		delete(w.prev, path)
+	}
+	maps.Copy(w.prev, paths)
+
+	return pending
+}
+
+// removeKnownFiles removes new files that are already known under a path
+// that has not changed, like the scanner skips files found twice.
+func (w *fileWatcher) removeKnownFiles(paths map[string]loginp.FileDescriptor, changed map[string]struct{}) {
+	var known map[string]string
+	for path, fd := range paths {
+		if prevDesc, ok := w.prev[path]; ok && loginp.SameFile(&prevDesc, &fd) {
+			continue
+		}
+		if known == nil {
+			known = make(map[string]string, len(w.prev))
+			for knownPath, knownDesc := range w.prev {
+				if _, ok := changed[knownPath]; !ok {
+					known[knownDesc.FileID()] = knownPath
+				}
+			}
+		}
+		if knownPath, exists := known[fd.FileID()]; exists {
+			w.log.Warnf("%q points to an already known ingest target %q [%s==%s]. Skipping", path, knownPath, fd.FileID(), fd.FileID())
+			delete(paths, path)
+		}
+	}
+}
+
+func hasFileID(paths map[string]loginp.FileDescriptor, id string) bool {
+	for _, fd := range paths {
+		if fd.FileID() == id {
+			return true
+		}
+	}
+	return false
+}
+
+func isDir(path string) bool {
+	info, err := os.Stat(path)
+	return err == nil && info.IsDir()
+}
+
+// dirNotifier keeps the inotify watches on the directories of the
+// scanned paths.
+type dirNotifier struct {
+	watcher *fsnotify.Watcher
+	dirs    map[string]struct{}
+	log     *logp.Logger
+}
+
+// update watches the dirs and stops watching the other directories.
+func (n *dirNotifier) update(dirs []string) {
+	watched := make(map[string]struct{}, len(dirs))
+	for _, dir := range dirs {
+		if _, ok := n.dirs[dir]; !ok {
+			if err := n.watcher.Add(dir); err != nil {
+				n.log.Warnf("Failed to watch directory %q, its files are only checked by full scans: %v", dir, err)
+				continue
+			}
+			n.log.Debugf("Watching directory %q", dir)
+		}
+		watched[dir] = struct{}{}
+	}
+	for dir := range n.dirs {
+		if _, ok := watched[dir]; !ok {
+			// the watch of a removed directory is already gone
+			_ = n.watcher.Remove(dir)
+		}
+	}
+	n.dirs = watched
+}
+
+func (n *dirNotifier) isDir(path string) bool {
+	_, ok := n.dirs[path]
+	return ok
+}
+
+// forget removes a directory whose watch is gone, it is watched again on
+// the next update if it exists.
+func (n *dirNotifier) forget(dir string) {
+	delete(n.dirs, dir)
+}
+
+// watchDirs returns the existing directories that can contain files
+// matching the paths.
+func (s *fileScanner) watchDirs() []string {
+	dirs := map[string]struct{}{}
+	for _, path := range s.paths {
+		matches, err := filepath.Glob(filepath.Dir(path))
+		if err != nil {
+			s.log.Errorf("glob(%s) failed: %v", filepath.Dir(path), err)
+			continue
+		}
+		for _, match := range matches {
+			if isDir(match) {
+				dirs[match] = struct{}{}
+			}
+		}
+	}
+	return slices.Sorted(maps.Keys(dirs))
+}
+
+// getFilesByName returns the file descriptors of the filenames that match
+// the configured paths.
+func (s *fileScanner) getFilesByName(filenames map[string]struct{}) map[string]loginp.FileDescriptor {
+	fdByName := make(map[string]loginp.FileDescriptor, len(filenames))
+	for filename := range filenames {
+		if !s.matchesPaths(filename) {
+			continue
+		}
+
+		it, err := s.getIngestTarget(filename)
+		if err != nil {
+			s.log.Debugf("cannot create an ingest target for file %q: %s", filename, err)
+			continue
+		}
+
+		fd, err := s.toFileDescriptor(&it)
+		if err != nil {
+			s.log.Debugf("cannot create a file descriptor for an ingest target %q: %s", filename, err)
+			continue
+		}
+		fdByName[filename] = fd
+	}
+	return fdByName
+}
+
+func (s *fileScanner) matchesPaths(filename string) bool {
+	for _, path := range s.paths {
+		if matched, _ := filepath.Match(path, filename); matched {
+			return true
+		}
+	}
+	return false
+}
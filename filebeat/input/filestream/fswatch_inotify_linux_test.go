@@ -0,0 +1,297 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build linux
+
+package filestream
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	loginp "github.com/elastic/beats/v7/filebeat/input/filestream/internal/input-logfile"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+func TestFileWatcherConfigMode(t *testing.T) {
+	tests := map[string]struct {
+		mode   string
+		expErr string
+	}{
+		"polling": {mode: pollingMode},
+		"inotify": {mode: inotifyMode},
+		"invalid": {mode: "fanotify", expErr: `invalid scanner mode "fanotify"`},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := defaultFileWatcherConfig()
+			c.Mode = test.mode
+			err := c.Validate()
+			if test.expErr != "" {
+				assert.ErrorContains(t, err, test.expErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+func TestFileWatcherInotify(t *testing.T) {
+	// full scans are not expected to run during the test, the events must
+	// come from inotify
+	cfgStr := `
+scanner:
+  mode: inotify
+  check_interval: 1h
+  fingerprint.enabled: false
+`
+
+	t.Run("detects changes", func(t *testing.T) {
+		dir := t.TempDir()
+		fw := runInotifyWatcher(t, []string{filepath.Join(dir, "*.log")}, cfgStr)
+		filename := filepath.Join(dir, "app.log")
+
+		require.NoError(t, os.WriteFile(filename, []byte("hello\n"), 0o644))
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename})
+
+		appendToFile(t, filename, "world\n")
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpWrite, OldPath: filename, NewPath: filename})
+
+		require.NoError(t, os.Truncate(filename, 2))
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpTruncate, OldPath: filename, NewPath: filename})
+
+		renamed := filepath.Join(dir, "app.1.log")
+		require.NoError(t, os.Rename(filename, renamed))
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpRename, OldPath: filename, NewPath: renamed})
+
+		require.NoError(t, os.Remove(renamed))
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpDelete, OldPath: renamed})
+	})
+
+	t.Run("ignores files not matching the paths", func(t *testing.T) {
+		dir := t.TempDir()
+		fw := runInotifyWatcher(t, []string{filepath.Join(dir, "*.log")}, cfgStr)
+
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "app.txt"), []byte("hello\n"), 0o644))
+		filename := filepath.Join(dir, "app.log")
+		require.NoError(t, os.WriteFile(filename, []byte("hello\n"), 0o644))
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename})
+	})
+
+	t.Run("rotation in a single batch", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		require.NoError(t, os.WriteFile(filename, []byte("before rotation\n"), 0o644))
+		fw := runInotifyWatcher(t, []string{filepath.Join(dir, "*.log*")}, cfgStr)
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename})
+
+		// rotate and write the new file before the batch is compared
+		rotated := filepath.Join(dir, "app.log.1")
+		require.NoError(t, os.Rename(filename, rotated))
+		require.NoError(t, os.WriteFile(filename, []byte("after rotation\n"), 0o644))
+
+		assertEvents(t, fw,
+			loginp.FSEvent{Op: loginp.OpRename, OldPath: filename, NewPath: rotated},
+			loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename},
+		)
+	})
+
+	t.Run("truncate and write less in a single batch", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		require.NoError(t, os.WriteFile(filename, []byte(strings.Repeat("line\n", 10)), 0o644))
+		fw := runInotifyWatcher(t, []string{filepath.Join(dir, "*.log")}, cfgStr)
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename})
+
+		require.NoError(t, os.Truncate(filename, 0))
+		appendToFile(t, filename, "new\n")
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpTruncate, OldPath: filename, NewPath: filename})
+	})
+
+	t.Run("copytruncate keeps the fingerprint identity", func(t *testing.T) {
+		dir := t.TempDir()
+		filename := filepath.Join(dir, "app.log")
+		content := strings.Repeat("a line long enough for a fingerprint\n", 10)
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+		fw := runInotifyWatcher(t, []string{filepath.Join(dir, "*.log*")}, `
+scanner:
+  mode: inotify
+  check_interval: 1h
+  fingerprint:
+    enabled: true
+    length: 64
+`)
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename})
+
+		rotated := filepath.Join(dir, "app.log.1")
+		require.NoError(t, os.WriteFile(rotated, []byte(content), 0o644))
+		require.NoError(t, os.Truncate(filename, 0))
+
+		// the copy has the fingerprint of the original file, the truncated
+		// file is too small to have one
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpRename, OldPath: filename, NewPath: rotated})
+	})
+
+	t.Run("new directories are found by full scans", func(t *testing.T) {
+		dir := t.TempDir()
+		fw := runInotifyWatcher(t, []string{filepath.Join(dir, "*", "*.log")}, `
+scanner:
+  mode: inotify
+  check_interval: 200ms
+  fingerprint.enabled: false
+`)
+
+		subdir := filepath.Join(dir, "sub")
+		require.NoError(t, os.Mkdir(subdir, 0o755))
+		filename := filepath.Join(subdir, "app.log")
+		require.NoError(t, os.WriteFile(filename, []byte("hello\n"), 0o644))
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpCreate, NewPath: filename})
+
+		// the new directory is watched after the full scan
+		appendToFile(t, filename, "world\n")
+		assertEvents(t, fw, loginp.FSEvent{Op: loginp.OpWrite, OldPath: filename, NewPath: filename})
+	})
+}
+
+func TestFileWatcherWatchPathsRenameRace(t *testing.T) {
+	dir := t.TempDir()
+	paths := []string{filepath.Join(dir, "*.log")}
+	scanner, err := newFileScanner(logp.NewNopLogger(), paths, fileScannerConfig{})
+	require.NoError(t, err)
+
+	filename := filepath.Join(dir, "app.log")
+	require.NoError(t, os.WriteFile(filename, []byte("hello\n"), 0o644))
+
+	w := &fileWatcher{
+		log:     logp.NewNopLogger(),
+		cfg:     defaultFileWatcherConfig(),
+		prev:    scanner.GetFiles(),
+		scanner: scanner,
+		events:  make(chan loginp.FSEvent, 10),
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	t.Run("rename split across batches", func(t *testing.T) {
+		renamed := filepath.Join(dir, "app.1.log")
+		require.NoError(t, os.Rename(filename, renamed))
+
+		// only the event of the old path is in the first batch
+		pending := w.watchPaths(ctx, scanner, set(filename), set(filename))
+		assert.Equal(t, set(filename), pending)
+		assert.Empty(t, w.events, "no event is expected before the new path is known")
+		assert.Contains(t, w.prev, filename)
+
+		pending[renamed] = struct{}{}
+		pending = w.watchPaths(ctx, scanner, pending, set())
+		assert.Empty(t, pending)
+		requireEvent(t, w.events, loginp.FSEvent{Op: loginp.OpRename, OldPath: filename, NewPath: renamed})
+		assert.NotContains(t, w.prev, filename)
+		assert.Contains(t, w.prev, renamed)
+
+		filename = renamed
+	})
+
+	t.Run("rename out of the paths is a removal", func(t *testing.T) {
+		renamed := filepath.Join(dir, "app.log.old")
+		require.NoError(t, os.Rename(filename, renamed))
+
+		pending := w.watchPaths(ctx, scanner, set(filename), set(filename))
+		assert.Equal(t, set(filename), pending)
+
+		pending = w.watchPaths(ctx, scanner, pending, set())
+		assert.Empty(t, pending)
+		requireEvent(t, w.events, loginp.FSEvent{Op: loginp.OpDelete, OldPath: filename})
+		assert.Empty(t, w.prev)
+	})
+
+	t.Run("known files under unchanged paths are skipped", func(t *testing.T) {
+		first := filepath.Join(dir, "first.log")
+		require.NoError(t, os.WriteFile(first, []byte("hello\n"), 0o644))
+		w.prev = scanner.GetFiles()
+
+		link := filepath.Join(dir, "link.log")
+		require.NoError(t, os.Link(first, link))
+		w.watchPaths(ctx, scanner, set(link), set())
+		assert.Empty(t, w.events)
+		assert.NotContains(t, w.prev, link)
+	})
+}
+
+func runInotifyWatcher(t *testing.T, paths []string, cfgStr string) loginp.FSWatcher {
+	t.Helper()
+	cfg, err := conf.NewConfigWithYAML([]byte(cfgStr), cfgStr)
+	require.NoError(t, err)
+	ns := &conf.Namespace{}
+	require.NoError(t, ns.Unpack(cfg))
+
+	fw, err := newFileWatcher(logp.NewNopLogger(), paths, ns, compressionNone)
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	t.Cleanup(cancel)
+	go fw.Run(ctx)
+
+	// wait for the watches to be added after the initial scan
+	time.Sleep(notifyBatchDelay)
+	return fw
+}
+
+// assertEvents checks the next events of the watcher in any order. Only
+// the operation and the paths are compared.
+func assertEvents(t *testing.T, fw loginp.FSWatcher, expected ...loginp.FSEvent) {
+	t.Helper()
+	actual := make([]loginp.FSEvent, 0, len(expected))
+	for range expected {
+		e := fw.Event()
+		actual = append(actual, loginp.FSEvent{Op: e.Op, OldPath: e.OldPath, NewPath: e.NewPath})
+	}
+	assert.ElementsMatch(t, expected, actual)
+}
+
+func requireEvent(t *testing.T, events chan loginp.FSEvent, expected loginp.FSEvent) {
+	t.Helper()
+	require.Len(t, events, 1)
+	e := <-events
+	assert.Equal(t, expected, loginp.FSEvent{Op: e.Op, OldPath: e.OldPath, NewPath: e.NewPath})
+}
+
+func appendToFile(t *testing.T, filename, content string) {
+	t.Helper()
+	f, err := os.OpenFile(filename, os.O_APPEND|os.O_WRONLY, 0)
+	require.NoError(t, err)
+	defer f.Close()
+	_, err = f.WriteString(content)
+	require.NoError(t, err)
+}
+
+func set(paths ...string) map[string]struct{} {
+	s := make(map[string]struct{}, len(paths))
+	for _, path := range paths {
+		s[path] = struct{}{}
+	}
+	return s
+}
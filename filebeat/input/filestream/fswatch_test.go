@@ -888,7 +888,7 @@ scanner:
 		require.NoError(t, err)
 
 		logger := logptest.NewTestingLogger(t, "log-selector")
-		_, err = newFileWatcher(logger, paths, ns)
+		_, err = newFileWatcher(logger, paths, ns, compressionNone)
 		require.Error(t, err)
 		require.Contains(t, err.Error(), "fingerprint size 1 bytes cannot be smaller than 64 bytes")
 	})
@@ -994,7 +994,7 @@ func createWatcherWithConfig(t *testing.T, logger *logp.Logger, paths []string,
 	err = ns.Unpack(cfg)
 	require.NoError(t, err)
 
-	fw, err := newFileWatcher(logger, paths, ns)
+	fw, err := newFileWatcher(logger, paths, ns, compressionNone)
 	require.NoError(t, err)
 
 	return fw
@@ -64,6 +64,9 @@ type fileSource struct {
 	oldPath   string
 	truncated bool
 	archived  bool
+	// member is the path of the file in the archive newPath, if the
+	// source is an archive member.
+	member string
 
 	fileID              string
 	identifierGenerator string
@@ -55,6 +55,13 @@ type state struct {
 type fileMeta struct {
 	Source         string `json:"source" struct:"source"`
 	IdentifierName string `json:"identifier_name" struct:"identifier_name"`
+	// Member is the path of an archive member in the archive Source.
+	Member string `json:"member,omitempty" struct:"member,omitempty"`
+	// Members are the members read from the archive Source.
+	Members []archiveMember `json:"members,omitempty" struct:"members,omitempty"`
+	// NotArchive is set if Source was found not to be an archive, so
+	// that it is only probed again once it is recreated or truncated.
+	NotArchive bool `json:"not_archive,omitempty" struct:"not_archive,omitempty"`
 }
 
 // filestream is the input for reading from files which
@@ -140,6 +147,9 @@ func (inp *filestream) Run(
 	}
 
 	log := ctx.Logger.With("path", fs.newPath).With("state-id", src.Name())
+	if fs.member != "" {
+		log = log.With("member", fs.member)
+	}
 	state := initState(log, cursor, fs)
 
 	r, truncated, err := inp.open(log, ctx.Cancelation, fs, state.Offset)
@@ -192,7 +202,17 @@ func (inp *filestream) open(
 	offset int64,
 ) (reader.Reader, bool, error) {
 
-	f, encoding, truncated, err := inp.openFile(log, fs.newPath, offset)
+	var (
+		f         File
+		encoding  encoding.Encoding
+		truncated bool
+		err       error
+	)
+	if fs.member != "" {
+		f, encoding, truncated, err = inp.openArchiveMember(log, fs.newPath, fs.member, offset)
+	} else {
+		f, encoding, truncated, err = inp.openFile(log, fs.newPath, offset)
+	}
 	if err != nil {
 		return nil, truncated, err
 	}
@@ -207,9 +227,11 @@ func (inp *filestream) open(
 	log.Debug("newLogFileReader with config.MaxBytes:", inp.readerConfig.MaxBytes)
 
 	// if the file is archived, it means that it is not going to be updated in the future
-	// thus, when EOF is reached, it can be closed
+	// thus, when EOF is reached, it can be closed. Compressed files and
+	// archive members are not updated either once they are complete.
 	closerCfg := inp.closerConfig
-	if fs.archived && !inp.closerConfig.Reader.OnEOF {
+	_, compressed := f.(*compressedFile)
+	if (fs.archived || compressed) && !inp.closerConfig.Reader.OnEOF {
 		closerCfg = closerConfig{
 			Reader: readerCloserConfig{
 				OnEOF:         true,
@@ -250,7 +272,12 @@ func (inp *filestream) open(
 
 	r = readfile.NewStripNewline(r, inp.readerConfig.LineTerminator)
 
-	r = readfile.NewFilemeta(r, fs.newPath, fs.desc.Info, fs.desc.Fingerprint, offset)
+	if fs.member != "" {
+		r = readfile.NewFilemeta(r, fs.member, fs.desc.Info, fs.desc.Fingerprint, offset)
+		r = archiveMetaReader{Reader: r, path: fs.newPath}
+	} else {
+		r = readfile.NewFilemeta(r, fs.newPath, fs.desc.Info, fs.desc.Fingerprint, offset)
+	}
 
 	r = inp.parsers.Create(r, log)
 
@@ -267,11 +294,14 @@ func (inp *filestream) open(
 //
 // openFile will also detect and hadle file truncation. If a file is truncated
 // then the 3rd return value is true.
+//
+// When decompression is enabled, compressed files are detected and read
+// decompressed. Their offsets are offsets in the decompressed content.
 func (inp *filestream) openFile(
 	log *logp.Logger,
 	path string,
 	offset int64,
-) (*os.File, encoding.Encoding, bool, error) {
+) (File, encoding.Encoding, bool, error) {
 	fi, err := os.Stat(path)
 	if err != nil {
 		return nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
@@ -283,10 +313,11 @@ func (inp *filestream) openFile(
 		return nil, nil, false, fmt.Errorf("failed to open file %s, named pipes are not supported", fi.Name())
 	}
 
-	f, err := file.ReadOpen(path)
+	osFile, err := file.ReadOpen(path)
 	if err != nil {
 		return nil, nil, false, fmt.Errorf("failed opening %s: %w", path, err)
 	}
+	var f File = plainFile{osFile}
 	ok := false
 	defer cleanup.IfNot(&ok, cleanup.IgnoreError(f.Close))
 
@@ -300,6 +331,21 @@ func (inp *filestream) openFile(
 		return nil, nil, false, err
 	}
 
+	if inp.readerConfig.Compression == compressionAuto {
+		format, err := detectCompression(osFile)
+		if err != nil {
+			return nil, nil, false, fmt.Errorf("failed to detect the compression of %s: %w", path, err)
+		}
+		if format != "" {
+			cf, encoding, truncated, err := inp.openCompressedFile(log, osFile, format, offset)
+			if err != nil {
+				return nil, nil, truncated, err
+			}
+			ok = true // no need to close the file
+			return cf, encoding, truncated, nil
+		}
+	}
+
 	truncated := false
 	if fi.Size() < offset {
 		// if the file was truncated we need to reset the offset and notify
@@ -325,6 +371,95 @@ func (inp *filestream) openFile(
 	return f, encoding, truncated, nil
 }
 
+// openCompressedFile opens the decompressed content of a compressed file
+// at the offset. If the decompressed content is shorter than the offset,
+// the file is considered truncated, like plain files. The file is not
+// closed on errors.
+func (inp *filestream) openCompressedFile(
+	log *logp.Logger,
+	osFile *os.File,
+	format string,
+	offset int64,
+) (File, encoding.Encoding, bool, error) {
+	path := osFile.Name()
+	f, err := newCompressedFile(osFile, format)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to open %s compressed file %s: %w", format, path, err)
+	}
+	ok := false
+	defer cleanup.IfNot(&ok, cleanup.IgnoreError(func() error { return f.dec.Close() }))
+
+	truncated := false
+	err = inp.initFileOffset(f, offset)
+	if errors.Is(err, io.EOF) {
+		truncated = true
+		log.Infof("Compressed file is shorter than the offset. Reading file from offset 0. Path=%s", path)
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, nil, truncated, err
+	}
+
+	encoding, err := inp.encodingFactory(f)
+	if err != nil {
+		return nil, nil, truncated, fmt.Errorf("initialising encoding for '%v' failed: %w", path, err)
+	}
+
+	ok = true // no need to close the decompressor
+	return f, encoding, truncated, nil
+}
+
+// openArchiveMember opens the content of a member of an archive at the
+// offset. If the member is shorter than the offset, it is considered
+// truncated, like plain files.
+func (inp *filestream) openArchiveMember(
+	log *logp.Logger,
+	path string,
+	member string,
+	offset int64,
+) (File, encoding.Encoding, bool, error) {
+	osFile, err := file.ReadOpen(path)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed opening %s: %w", path, err)
+	}
+	ok := false
+	defer cleanup.IfNot(&ok, cleanup.IgnoreError(osFile.Close))
+
+	fi, err := osFile.Stat()
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to stat source file %s: %w", path, err)
+	}
+	err = checkFileBeforeOpening(fi)
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	f, err := newArchiveMemberFile(osFile, member)
+	if err != nil {
+		return nil, nil, false, fmt.Errorf("failed to open member %s of archive %s: %w", member, path, err)
+	}
+	defer cleanup.IfNot(&ok, cleanup.IgnoreError(func() error { return f.dec.Close() }))
+
+	truncated := false
+	err = inp.initFileOffset(f, offset)
+	if errors.Is(err, io.EOF) {
+		truncated = true
+		log.Infof("Archive member is shorter than the offset. Reading member from offset 0. Path=%s, Member=%s", path, member)
+		_, err = f.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, nil, truncated, err
+	}
+
+	encoding, err := inp.encodingFactory(f)
+	if err != nil {
+		return nil, nil, truncated, fmt.Errorf("initialising encoding for member %s of '%v' failed: %w", member, path, err)
+	}
+
+	ok = true // no need to close the file
+	return f, encoding, truncated, nil
+}
+
 func checkFileBeforeOpening(fi os.FileInfo) error {
 	if !fi.Mode().IsRegular() {
 		return fmt.Errorf("tried to open non regular file: %q %s", fi.Mode(), fi.Name())
@@ -333,7 +468,7 @@ func checkFileBeforeOpening(fi os.FileInfo) error {
 	return nil
 }
 
-func (inp *filestream) initFileOffset(file *os.File, offset int64) error {
+func (inp *filestream) initFileOffset(file File, offset int64) error {
 	if offset > 0 {
 		_, err := file.Seek(offset, io.SeekCurrent)
 		return err
@@ -400,7 +535,7 @@ func (inp *filestream) readFromSource(
 			_ = mapstr.AddTags(message.Fields, []string{"take_over"})
 		}
 
-		if err := p.Publish(message.ToEvent(), s); err != nil {
+		if err := loginp.PublishSized(p, message.ToEvent(), s, message.Bytes); err != nil {
 			metrics.ProcessingErrors.Inc()
 			return err
 		}
@@ -26,6 +26,7 @@ import (
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	v2 "github.com/elastic/beats/v7/filebeat/input/v2"
@@ -162,6 +163,35 @@ paths:
 	}
 }
 
+func TestRateLimit(t *testing.T) {
+	testCases := map[string]string{
+		"file":  "rate_limit.file.events_per_second: 20",
+		"input": "rate_limit.input.events_per_second: 20",
+		"bytes": "rate_limit.file.bytes_per_second: 1KiB",
+	}
+	for name, rateLimit := range testCases {
+		t.Run(name, func(t *testing.T) {
+			// the lines are about 80 bytes, 30 lines are more than one
+			// second of any of the limits
+			filename := generateFile(t, t.TempDir(), 30)
+			cfg := fmt.Sprintf(`
+type: filestream
+id: foo
+prospector.scanner.check_interval: 1s
+prospector.scanner.fingerprint.enabled: false
+%s
+paths:
+    - %s`, rateLimit, filename)
+			runner := createFilestreamTestRunner(context.Background(), t, "rate-limit-"+name, cfg, 30, true)
+
+			start := time.Now()
+			events := runner(t)
+			require.Len(t, events, 30)
+			assert.Greater(t, time.Since(start), 400*time.Millisecond)
+		})
+	}
+}
+
 // runFilestreamBenchmark runs the entire filestream input with the in-memory registry and the test pipeline.
 // `testID` must be unique for each test run
 // `cfg` must be a valid YAML string containing valid filestream configuration
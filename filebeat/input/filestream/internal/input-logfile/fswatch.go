@@ -64,6 +64,10 @@ type FileDescriptor struct {
 	Info file.ExtendedFileInfo
 	// Fingerprint is a computed hash of the file header
 	Fingerprint string
+	// Compression is the compression format of the file, like gzip, if it
+	// was detected. The fingerprint of compressed files is computed from
+	// their decompressed content.
+	Compression string
 }
 
 // FileID returns a unique file ID
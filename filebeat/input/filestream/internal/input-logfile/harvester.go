@@ -127,6 +127,10 @@ type defaultHarvesterGroup struct {
 	identifier   *sourceIdentifier
 	tg           *task.Group
 	metrics      *Metrics
+	rateLimit    RateLimitConfig
+	// inputLimiter is shared by all harvesters, nil if the input is not
+	// rate limited
+	inputLimiter *limiter
 }
 
 // Start starts the Harvester for a Source if no Harvester is running for the
@@ -232,7 +236,12 @@ func startHarvester(
 
 		hg.store.UpdateTTL(resource, hg.cleanTimeout)
 		cursor := makeCursor(resource)
-		publisher := &cursorPublisher{canceler: ctx.Cancelation, client: client, cursor: &cursor}
+		publisher := &cursorPublisher{
+			canceler: ctx.Cancelation,
+			client:   client,
+			cursor:   &cursor,
+			limiter:  newHarvesterLimiter(hg.rateLimit, hg.inputLimiter, metrics),
+		}
 
 		err = hg.harvester.Run(ctx, src, cursor, publisher, metrics)
 		if err != nil && !errors.Is(err, context.Canceled) {
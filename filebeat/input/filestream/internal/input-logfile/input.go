@@ -39,6 +39,7 @@ type managedInput struct {
 	harvester        Harvester
 	cleanTimeout     time.Duration
 	harvesterLimit   uint64
+	rateLimit        RateLimitConfig
 }
 
 // Name is required to implement the v2.Input interface
@@ -79,7 +80,9 @@ func (inp *managedInput) Run(
 			time.Minute, // magic number
 			ctx.Logger,
 			"harvester:"),
-		metrics: metrics,
+		metrics:      metrics,
+		rateLimit:    inp.rateLimit,
+		inputLimiter: newLimiter(inp.rateLimit.Input),
 	}
 
 	prospectorStore := inp.manager.getRetainedStore()
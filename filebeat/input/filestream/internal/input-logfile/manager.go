@@ -151,10 +151,11 @@ func (cim *InputManager) Create(config *conf.C) (inp v2.Input, retErr error) {
 
 	settings := struct {
 		// All those values are duplicated from the Filestream configuration
-		ID                 string        `config:"id"`
-		CleanInactive      time.Duration `config:"clean_inactive"`
-		HarvesterLimit     uint64        `config:"harvester_limit"`
-		AllowIDDuplication bool          `config:"allow_deprecated_id_duplication"`
+		ID                 string          `config:"id"`
+		CleanInactive      time.Duration   `config:"clean_inactive"`
+		HarvesterLimit     uint64          `config:"harvester_limit"`
+		RateLimit          RateLimitConfig `config:"rate_limit"`
+		AllowIDDuplication bool            `config:"allow_deprecated_id_duplication"`
 		TakeOver           struct {
 			Enabled bool     `config:"enabled"`
 			FromIDs []string `config:"from_ids"`
@@ -272,6 +273,7 @@ func (cim *InputManager) Create(config *conf.C) (inp v2.Input, retErr error) {
 		sourceIdentifier: srcIdentifier,
 		cleanTimeout:     settings.CleanInactive,
 		harvesterLimit:   settings.HarvesterLimit,
+		rateLimit:        settings.RateLimit,
 	}, nil
 }
 
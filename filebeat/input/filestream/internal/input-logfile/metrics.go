@@ -35,6 +35,8 @@ type Metrics struct {
 	EventsProcessed   *monitoring.Uint // Number of events processed.
 	ProcessingErrors  *monitoring.Uint // Number of processing errors.
 	ProcessingTime    metrics.Sample   // Histogram of the elapsed time for processing an event.
+	ThrottledEvents   *monitoring.Uint // Number of events delayed by the rate limits.
+	ThrottledTime     *monitoring.Uint // Total time in nanoseconds events were delayed by the rate limits.
 
 	// Those metrics use the same registry/keys as the log input uses
 	HarvesterStarted   *monitoring.Int
@@ -60,6 +62,8 @@ func NewMetrics(reg *monitoring.Registry) *Metrics {
 		EventsProcessed:   monitoring.NewUint(reg, "events_processed_total"),
 		ProcessingErrors:  monitoring.NewUint(reg, "processing_errors_total"),
 		ProcessingTime:    metrics.NewUniformSample(1024),
+		ThrottledEvents:   monitoring.NewUint(reg, "throttled_events_total"),
+		ThrottledTime:     monitoring.NewUint(reg, "throttled_time_ns_total"),
 
 		HarvesterStarted:   monitoring.NewInt(harvesterMetrics, "started"),
 		HarvesterClosed:    monitoring.NewInt(harvesterMetrics, "closed"),
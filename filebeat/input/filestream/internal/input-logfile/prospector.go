@@ -43,6 +43,8 @@ type Prospector interface {
 type StateMetadataUpdater interface {
 	// FindCursorMeta retrieves and unpacks the cursor metadata of an entry of the given Source.
 	FindCursorMeta(s Source, v interface{}) error
+	// FindCursor retrieves and unpacks the ACKed cursor of an entry of the given Source.
+	FindCursor(s Source, v interface{}) error
 	// UpdateMetadata updates the source metadata of a registry entry of a given Source.
 	UpdateMetadata(s Source, v interface{}) error
 	// Remove marks a state for deletion of a given Source.
@@ -42,6 +42,24 @@ type cursorPublisher struct {
 	canceler input.Canceler
 	client   beat.Client
 	cursor   *Cursor
+	limiter  *harvesterLimiter // nil if the harvester is not rate limited
+}
+
+// sizedPublisher is a Publisher that is told how many bytes were read for
+// an event, used to limit the bytes per second.
+type sizedPublisher interface {
+	Publisher
+	PublishSized(event beat.Event, cursor interface{}, size int) error
+}
+
+// PublishSized publishes an event read from size bytes of the source. The
+// size counts towards the bytes_per_second rate limits, events published
+// with Publish only count towards the events_per_second rate limits.
+func PublishSized(p Publisher, event beat.Event, cursor interface{}, size int) error {
+	if sp, ok := p.(sizedPublisher); ok {
+		return sp.PublishSized(event, cursor, size)
+	}
+	return p.Publish(event, cursor)
 }
 
 // updateOp keeps track of pending updates that are not written to the persistent store yet.
@@ -75,6 +93,17 @@ func (op *updateOp) Key() string {
 // The ACK ordering in the publisher pipeline guarantees that update operations
 // will be ACKed and executed in the correct order.
 func (c *cursorPublisher) Publish(event beat.Event, cursorUpdate interface{}) error {
+	return c.PublishSized(event, cursorUpdate, 0)
+}
+
+// PublishSized publishes an event like Publish. If the harvester is rate
+// limited, it first waits until the event and its size bytes are within
+// the limits.
+func (c *cursorPublisher) PublishSized(event beat.Event, cursorUpdate interface{}, size int) error {
+	if err := c.limiter.wait(c.canceler, size); err != nil {
+		return err
+	}
+
 	if cursorUpdate == nil {
 		return c.forward(event)
 	}
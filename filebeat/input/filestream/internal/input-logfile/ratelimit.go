@@ -0,0 +1,179 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package input_logfile
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"golang.org/x/time/rate"
+
+	input "github.com/elastic/beats/v7/filebeat/input/v2"
+	"github.com/elastic/beats/v7/libbeat/common/cfgtype"
+	"github.com/elastic/go-concert/ctxtool"
+)
+
+// RateLimitConfig limits how fast the harvesters of an input publish
+// events. Zero values are not limited.
+type RateLimitConfig struct {
+	// File limits each harvester.
+	File RateLimit `config:"file"`
+	// Input limits all harvesters of the input together.
+	Input RateLimit `config:"input"`
+}
+
+// RateLimit is a number of bytes and events per second.
+type RateLimit struct {
+	Bytes  cfgtype.ByteSize `config:"bytes_per_second"`
+	Events uint64           `config:"events_per_second"`
+}
+
+func (r RateLimit) Validate() error {
+	if r.Bytes < 0 {
+		return fmt.Errorf("bytes_per_second cannot be negative: %d", r.Bytes)
+	}
+	return nil
+}
+
+func (r RateLimit) enabled() bool {
+	return r.Bytes > 0 || r.Events > 0
+}
+
+// limiter is a token bucket for bytes and one for events. A bucket holds
+// one second of its rate. Tokens are reserved in the order they are asked
+// for, so harvesters sharing a limiter take turns once its budget is used
+// up: a waiting harvester asks again only after it has been served.
+type limiter struct {
+	bytes  *rate.Limiter
+	events *rate.Limiter
+}
+
+// newLimiter returns nil if the rate is not limited.
+func newLimiter(r RateLimit) *limiter {
+	if !r.enabled() {
+		return nil
+	}
+
+	l := &limiter{}
+	if r.Bytes > 0 {
+		l.bytes = rate.NewLimiter(rate.Limit(r.Bytes), int(r.Bytes))
+	}
+	if r.Events > 0 {
+		l.events = rate.NewLimiter(rate.Limit(r.Events), int(r.Events))
+	}
+	return l
+}
+
+// wait blocks until an event of size bytes can be published. It returns
+// how long it waited.
+func (l *limiter) wait(ctx context.Context, size int) (time.Duration, error) {
+	if l == nil {
+		return 0, nil
+	}
+
+	var throttled time.Duration
+	if l.events != nil {
+		d, err := reserve(ctx, l.events, 1)
+		throttled += d
+		if err != nil {
+			return throttled, err
+		}
+	}
+	if l.bytes != nil {
+		// events larger than the bucket take several turns
+		for size > 0 {
+			n := min(size, l.bytes.Burst())
+			d, err := reserve(ctx, l.bytes, n)
+			throttled += d
+			if err != nil {
+				return throttled, err
+			}
+			size -= n
+		}
+	}
+	return throttled, nil
+}
+
+// reserve reserves n tokens and waits until they are available.
+func reserve(ctx context.Context, lim *rate.Limiter, n int) (time.Duration, error) {
+	now := time.Now()
+	r := lim.ReserveN(now, n)
+	if !r.OK() {
+		return 0, fmt.Errorf("cannot reserve %d tokens from a bucket of %d", n, lim.Burst())
+	}
+
+	delay := r.DelayFrom(now)
+	if delay == 0 {
+		return 0, nil
+	}
+
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return delay, nil
+	case <-ctx.Done():
+		// return the tokens to the other harvesters
+		r.Cancel()
+		return time.Since(now), ctx.Err()
+	}
+}
+
+// harvesterLimiter limits a harvester by its own limits and the limits
+// shared by all harvesters of the input.
+type harvesterLimiter struct {
+	file    *limiter
+	input   *limiter
+	metrics *Metrics
+}
+
+// newHarvesterLimiter returns nil if the harvester is not limited.
+func newHarvesterLimiter(cfg RateLimitConfig, input *limiter, metrics *Metrics) *harvesterLimiter {
+	file := newLimiter(cfg.File)
+	if file == nil && input == nil {
+		return nil
+	}
+	return &harvesterLimiter{file: file, input: input, metrics: metrics}
+}
+
+// wait blocks until an event of size bytes can be published by the
+// harvester. The file limit is waited for first, so a throttled file does
+// not hold back the other files of the input.
+func (h *harvesterLimiter) wait(canceler input.Canceler, size int) error {
+	if h == nil {
+		return nil
+	}
+
+	ctx := context.Background()
+	if canceler != nil {
+		ctx = ctxtool.FromCanceller(canceler)
+	}
+	throttled, err := h.file.wait(ctx, size)
+	if err == nil {
+		var d time.Duration
+		d, err = h.input.wait(ctx, size)
+		throttled += d
+	}
+
+	if throttled > 0 && h.metrics != nil {
+		h.metrics.ThrottledEvents.Inc()
+		h.metrics.ThrottledTime.Add(uint64(throttled))
+	}
+	return err
+}
@@ -0,0 +1,197 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package input_logfile
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	pubtest "github.com/elastic/beats/v7/libbeat/publisher/testing"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestRateLimitConfig(t *testing.T) {
+	c := conf.MustNewConfigFrom(map[string]interface{}{
+		"file.bytes_per_second":   "1MiB",
+		"file.events_per_second":  100,
+		"input.events_per_second": 1000,
+	})
+
+	var cfg RateLimitConfig
+	require.NoError(t, c.Unpack(&cfg))
+	assert.EqualValues(t, 1024*1024, cfg.File.Bytes)
+	assert.EqualValues(t, 100, cfg.File.Events)
+	assert.True(t, cfg.File.enabled())
+	assert.EqualValues(t, 0, cfg.Input.Bytes)
+	assert.EqualValues(t, 1000, cfg.Input.Events)
+	assert.False(t, RateLimit{}.enabled())
+}
+
+func TestLimiter(t *testing.T) {
+	t.Run("not limited", func(t *testing.T) {
+		l := newLimiter(RateLimit{})
+		assert.Nil(t, l)
+		throttled, err := l.wait(context.Background(), 1000)
+		require.NoError(t, err)
+		assert.Zero(t, throttled)
+	})
+
+	t.Run("events", func(t *testing.T) {
+		l := newLimiter(RateLimit{Events: 10})
+		for i := 0; i < 10; i++ {
+			throttled, err := l.wait(context.Background(), 0)
+			require.NoError(t, err)
+			assert.Zero(t, throttled, "the first second of events is not throttled")
+		}
+
+		start := time.Now()
+		throttled, err := l.wait(context.Background(), 0)
+		require.NoError(t, err)
+		assert.Greater(t, throttled, 50*time.Millisecond)
+		assert.GreaterOrEqual(t, time.Since(start), throttled)
+	})
+
+	t.Run("events larger than the bucket", func(t *testing.T) {
+		l := newLimiter(RateLimit{Bytes: 1000})
+
+		start := time.Now()
+		throttled, err := l.wait(context.Background(), 1200)
+		require.NoError(t, err)
+		assert.Greater(t, throttled, 150*time.Millisecond)
+		assert.GreaterOrEqual(t, time.Since(start), throttled)
+	})
+
+	t.Run("cancelled wait returns the tokens", func(t *testing.T) {
+		l := newLimiter(RateLimit{Events: 1})
+		_, err := l.wait(context.Background(), 0)
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+		defer cancel()
+		_, err = l.wait(ctx, 0)
+		assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+		// without the cancelled reservation the next token is due in less
+		// than a second
+		r := l.events.Reserve()
+		assert.Less(t, r.Delay(), time.Second)
+	})
+}
+
+func TestLimiterRoundRobin(t *testing.T) {
+	const harvesters = 3
+
+	l := newLimiter(RateLimit{Events: 100})
+	// use up the burst, so all harvesters wait from the start
+	l.events.ReserveN(time.Now(), 100)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+
+	var wg sync.WaitGroup
+	counts := make([]int, harvesters)
+	for i := range harvesters {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				if _, err := l.wait(ctx, 0); err != nil {
+					return
+				}
+				counts[i]++
+			}
+		}()
+	}
+	wg.Wait()
+
+	total := 0
+	for _, c := range counts {
+		total += c
+	}
+	require.Greater(t, total, 30)
+	for i, c := range counts {
+		assert.InDelta(t, total/harvesters, c, 2, "harvester %d got %d of %d turns", i, c, total)
+	}
+}
+
+func TestHarvesterLimiter(t *testing.T) {
+	t.Run("not limited", func(t *testing.T) {
+		assert.Nil(t, newHarvesterLimiter(RateLimitConfig{}, nil, nil))
+	})
+
+	t.Run("throttled time is reported", func(t *testing.T) {
+		metrics := NewMetrics(monitoring.NewRegistry())
+		input := newLimiter(RateLimit{Events: 20})
+		h := newHarvesterLimiter(RateLimitConfig{File: RateLimit{Events: 10}}, input, metrics)
+
+		for i := 0; i < 10; i++ {
+			require.NoError(t, h.wait(context.Background(), 0))
+		}
+		assert.Zero(t, metrics.ThrottledEvents.Get())
+
+		require.NoError(t, h.wait(context.Background(), 0))
+		assert.EqualValues(t, 1, metrics.ThrottledEvents.Get())
+		assert.Greater(t, metrics.ThrottledTime.Get(), uint64(50*time.Millisecond))
+	})
+
+	t.Run("the input limit is shared", func(t *testing.T) {
+		input := newLimiter(RateLimit{Events: 10})
+		h1 := newHarvesterLimiter(RateLimitConfig{}, input, nil)
+		h2 := newHarvesterLimiter(RateLimitConfig{}, input, nil)
+
+		for i := 0; i < 5; i++ {
+			require.NoError(t, h1.wait(context.Background(), 0))
+			require.NoError(t, h2.wait(context.Background(), 0))
+		}
+
+		start := time.Now()
+		require.NoError(t, h1.wait(context.Background(), 0))
+		assert.Greater(t, time.Since(start), 50*time.Millisecond)
+	})
+}
+
+func TestPublishSized(t *testing.T) {
+	store := testOpenStore(t, "test", createSampleStore(t, nil))
+	defer store.Release()
+	cursor := makeCursor(store.Get("test::key"))
+
+	published := 0
+	client := &pubtest.FakeClient{
+		PublishFunc: func(beat.Event) { published++ },
+	}
+	limiter := newHarvesterLimiter(RateLimitConfig{File: RateLimit{Bytes: 100}}, nil, nil)
+	publisher := &cursorPublisher{nil, client, &cursor, limiter}
+
+	require.NoError(t, PublishSized(publisher, beat.Event{}, nil, 100))
+	start := time.Now()
+	require.NoError(t, PublishSized(publisher, beat.Event{}, nil, 10))
+	assert.Greater(t, time.Since(start), 50*time.Millisecond)
+
+	// events without a size are not limited by bytes
+	start = time.Now()
+	require.NoError(t, publisher.Publish(beat.Event{}, nil))
+	assert.Less(t, time.Since(start), 50*time.Millisecond)
+	assert.Equal(t, 3, published)
+}
@@ -193,6 +193,11 @@ func (s *sourceStore) FindCursorMeta(src Source, v interface{}) error {
 	return s.store.findCursorMeta(key, v)
 }
 
+func (s *sourceStore) FindCursor(src Source, v interface{}) error {
+	key := s.identifier.ID(src)
+	return s.store.findCursor(key, v)
+}
+
 func (s *sourceStore) UpdateMetadata(src Source, v interface{}) error {
 	key := s.identifier.ID(src)
 	return s.store.updateMetadata(key, v)
@@ -550,9 +555,28 @@ func (s *store) findCursorMeta(key string, to interface{}) error {
 	if resource == nil {
 		return fmt.Errorf("resource '%s' not found", key)
 	}
+	defer resource.Release()
 	return typeconv.Convert(to, resource.cursorMeta)
 }
 
+// findCursor unpacks the ACKed cursor of a resource. Pending updates
+// are not taken into account.
+func (s *store) findCursor(key string, to interface{}) error {
+	resource := s.ephemeralStore.Find(key, false)
+	if resource == nil {
+		return fmt.Errorf("resource '%s' not found", key)
+	}
+	defer resource.Release()
+
+	resource.stateMutex.Lock()
+	defer resource.stateMutex.Unlock()
+
+	if resource.cursor == nil {
+		return fmt.Errorf("resource '%s' has no cursor", key)
+	}
+	return typeconv.Convert(to, resource.cursor)
+}
+
 // updateMetadata updates the cursor metadata in the persistent store.
 func (s *store) updateMetadata(key string, meta interface{}) error {
 	resource := s.ephemeralStore.Find(key, true)
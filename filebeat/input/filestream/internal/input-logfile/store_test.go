@@ -336,6 +336,57 @@ func TestStore_ResetCursor(t *testing.T) {
 	})
 }
 
+func TestStore_FindCursor(t *testing.T) {
+	type cur struct {
+		Offset int
+	}
+	store := testOpenStore(t, "test", createSampleStore(t, map[string]state{
+		"test::key": {
+			TTL:    60 * time.Second,
+			Cursor: cur{Offset: 6},
+		},
+		"test::new": {
+			TTL: 60 * time.Second,
+		},
+	}))
+	defer store.Release()
+
+	res, err := lock(input.Context{}, store, "test::key")
+	require.NoError(t, err)
+	op, err := createUpdateOp(res, cur{Offset: 42})
+	require.NoError(t, err)
+	defer op.done(1)
+	defer releaseResource(res)
+
+	var c cur
+	require.NoError(t, store.findCursor("test::key", &c))
+	require.Equal(t, 6, c.Offset, "pending updates must be ignored")
+
+	require.Error(t, store.findCursor("test::new", &c))
+	require.Error(t, store.findCursor("test::unknown", &c))
+}
+
+func TestStore_FindCursorMeta(t *testing.T) {
+	store := testOpenStore(t, "test", createSampleStore(t, map[string]state{
+		"test::key": {
+			TTL:  60 * time.Second,
+			Meta: testMeta{IdentifierName: "method"},
+		},
+	}))
+	defer store.Release()
+
+	var meta testMeta
+	require.NoError(t, store.findCursorMeta("test::key", &meta))
+	require.Equal(t, "method", meta.IdentifierName)
+
+	res := store.ephemeralStore.Find("test::key", false)
+	require.NotNil(t, res)
+	res.Release()
+	require.True(t, res.Finished(), "resource must be released after reading its metadata")
+
+	require.Error(t, store.findCursorMeta("test::unknown", &meta))
+}
+
 type testMeta struct {
 	IdentifierName string
 }
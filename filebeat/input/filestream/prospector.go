@@ -82,6 +82,7 @@ type fileProspector struct {
 	cleanRemoved        bool
 	stateChangeCloser   stateChangeCloserConfig
 	takeOver            takeOverConfig
+	archive             archiveConfig
 }
 
 func (p *fileProspector) Init(
@@ -106,7 +107,7 @@ func (p *fileProspector) Init(
 			return "", fm
 		}
 
-		newKey := newID(p.identifier.GetSource(loginp.FSEvent{NewPath: fm.Source, Descriptor: fd}))
+		newKey := newID(entrySource(p.identifier, fm, fd))
 		return newKey, fm
 	})
 
@@ -179,11 +180,7 @@ func (p *fileProspector) Init(
 				)
 				return "", nil
 			}
-			previousIdentifierKey := newID(oldIdentifier.GetSource(
-				loginp.FSEvent{
-					NewPath:    fm.Source,
-					Descriptor: fd,
-				}))
+			previousIdentifierKey := newID(entrySource(oldIdentifier, fm, fd))
 
 			// If the registry key and the key generated by the old identifier
 			// do not match, log it at debug level and do nothing.
@@ -193,7 +190,7 @@ func (p *fileProspector) Init(
 
 			// The resource matches the file we found in the file system, generate
 			// a new registry key and return it alongside the updated meta.
-			newKey := newID(p.identifier.GetSource(loginp.FSEvent{NewPath: fm.Source, Descriptor: fd}))
+			newKey := newID(entrySource(p.identifier, fm, fd))
 			fm.IdentifierName = identifierName
 			p.logger.Infof("registry key: '%s' and previous file identity key: '%s', are the same, migrating. Source: '%s'",
 				registryKey, previousIdentifierKey, fm.Source)
@@ -215,6 +212,12 @@ func (p *fileProspector) Init(
 			return "", nil
 		}
 
+		// Archive members are not taken over, as the Log input does not
+		// read archives.
+		if fm.Member != "" {
+			return "", nil
+		}
+
 		fd, ok := files[fm.Source]
 		if !ok {
 			return "", fm
@@ -328,10 +331,22 @@ func (p *fileProspector) onFSEvent(
 ) {
 	switch event.Op {
 	case loginp.OpCreate, loginp.OpWrite:
+		if p.archive.Enabled && p.onArchive(log, ctx, event, src, updater, group, ignoreSince) {
+			return
+		}
+
 		if event.Op == loginp.OpCreate {
 			log.Debugf("A new file %s has been found", event.NewPath)
 
-			err := updater.UpdateMetadata(src, fileMeta{Source: event.NewPath, IdentifierName: p.identifier.Name()})
+			meta := fileMeta{Source: event.NewPath, IdentifierName: p.identifier.Name()}
+			if p.archive.Enabled {
+				// keep the result of probing the file for an archive
+				var prev fileMeta
+				if err := updater.FindCursorMeta(src, &prev); err == nil {
+					meta.NotArchive = prev.NotArchive
+				}
+			}
+			err := updater.UpdateMetadata(src, meta)
 			if err != nil {
 				log.Errorf("Failed to set cursor meta data of entry %s: %v", src.Name(), err)
 			}
@@ -341,6 +356,13 @@ func (p *fileProspector) onFSEvent(
 		}
 
 		if p.isFileIgnored(log, event, ignoreSince) {
+			// The offsets of compressed files are offsets in the
+			// decompressed content, the file size can't be used for them.
+			// Compressed files are not appended to, so there is nothing
+			// to skip later anyway.
+			if event.Descriptor.Compression != "" {
+				return
+			}
 			err := updater.ResetCursor(src, state{Offset: event.Descriptor.Info.Size()})
 			if err != nil {
 				log.Errorf("setting cursor for ignored file: %v", err)
@@ -351,6 +373,10 @@ func (p *fileProspector) onFSEvent(
 		group.Start(ctx, src)
 
 	case loginp.OpTruncate:
+		if p.archive.Enabled && p.onArchive(log, ctx, event, src, updater, group, ignoreSince) {
+			return
+		}
+
 		log.Debugf("File %s has been truncated setting offset to 0", event.NewPath)
 
 		err := updater.ResetCursor(src, state{Offset: 0})
@@ -367,7 +393,7 @@ func (p *fileProspector) onFSEvent(
 	case loginp.OpRename:
 		log.Debugf("File %s has been renamed to %s", event.OldPath, event.NewPath)
 
-		p.onRename(log, ctx, event, src, updater, group)
+		p.onRename(log, ctx, event, src, updater, group, ignoreSince)
 
 	default:
 		log.Error("Unknown return value %v", event.Op)
@@ -389,35 +415,172 @@ func (p *fileProspector) isFileIgnored(log *logp.Logger, fe loginp.FSEvent, igno
 	return false
 }
 
-func (p *fileProspector) onRemove(log *logp.Logger, fe loginp.FSEvent, src loginp.Source, s loginp.StateMetadataUpdater, hg loginp.HarvesterGroup) {
-	if p.stateChangeCloser.Removed {
-		log.Debugf("Stopping harvester as file %s has been removed and close.on_state_change.removed is enabled.", src.Name())
-		hg.Stop(src)
+// onArchive starts the harvesters of the members of an archive that have
+// not been read completely. It returns false if the file is not an archive.
+func (p *fileProspector) onArchive(
+	log *logp.Logger,
+	ctx input.Context,
+	event loginp.FSEvent,
+	src loginp.Source,
+	updater loginp.StateMetadataUpdater,
+	group loginp.HarvesterGroup,
+	ignoreSince time.Time,
+) bool {
+	fs, ok := src.(fileSource)
+	if !ok {
+		return false
 	}
 
-	if p.cleanRemoved {
-		log.Debugf("Remove state for file as file removed: %s", fe.OldPath)
+	// The members of known archives are only listed again if the
+	// archive has changed. Files that are not archives are only probed
+	// again if they are recreated or truncated.
+	var meta fileMeta
+	_ = updater.FindCursorMeta(src, &meta)
+	if meta.NotArchive && event.Op == loginp.OpWrite {
+		return false
+	}
+	members := meta.Members
+	if len(members) == 0 || event.Op != loginp.OpCreate {
+		var err error
+		members, err = p.archive.listArchiveMembers(event.NewPath)
+		if errors.Is(err, errIncompleteCompressedFile) {
+			log.Debugf("Archive %s is incomplete, it is read once it is updated: %v", event.NewPath, err)
+			return true
+		}
+		if err != nil {
+			notArchive := errors.Is(err, errNotArchive)
+			if !notArchive {
+				log.Debugf("Cannot read %s as an archive: %v", event.NewPath, err)
+			}
+			if notArchive != meta.NotArchive {
+				meta.Source = event.NewPath
+				meta.IdentifierName = p.identifier.Name()
+				meta.NotArchive = notArchive
+				if err := updater.UpdateMetadata(src, meta); err != nil {
+					log.Errorf("Failed to set cursor meta data of entry %s: %v", src.Name(), err)
+				}
+			}
+			return false
+		}
+
+		err = updater.UpdateMetadata(src, fileMeta{Source: event.NewPath, IdentifierName: p.identifier.Name(), Members: members})
+		if err != nil {
+			log.Errorf("Failed to set cursor meta data of entry %s: %v", src.Name(), err)
+		}
+	}
+
+	if p.isFileIgnored(log, event, ignoreSince) {
+		return true
+	}
+
+	finished := 0
+	for _, member := range members {
+		memberSrc := archiveMemberSource(fs, member.Path)
+
+		// Archives are not updated, members are complete once their
+		// whole content has been ACKed.
+		var cursor state
+		err := updater.FindCursor(memberSrc, &cursor)
+		if err == nil && cursor.Offset >= member.Size && event.Op != loginp.OpTruncate {
+			finished++
+			continue
+		}
 
-		err := s.Remove(src)
+		err = updater.UpdateMetadata(memberSrc, fileMeta{Source: event.NewPath, IdentifierName: p.identifier.Name(), Member: member.Path})
 		if err != nil {
-			log.Errorf("Error while removing state from statestore: %v", err)
+			log.Errorf("Failed to set cursor meta data of entry %s: %v", memberSrc.Name(), err)
+		}
+
+		if event.Op == loginp.OpTruncate {
+			err = updater.ResetCursor(memberSrc, state{Offset: 0})
+			if err != nil {
+				log.Errorf("resetting cursor on truncated archive: %v", err)
+			}
+			group.Restart(ctx, memberSrc)
+			continue
 		}
+		group.Start(ctx, memberSrc)
 	}
+
+	if finished == len(members) {
+		log.Debugf("All members of archive %s have been read", event.NewPath)
+	}
+	return true
+}
+
+// archiveMemberSources returns the sources of the members of the archive
+// src that are in the registry.
+func (p *fileProspector) archiveMemberSources(src loginp.Source, s loginp.StateMetadataUpdater) []fileSource {
+	fs, ok := src.(fileSource)
+	if !p.archive.Enabled || !ok {
+		return nil
+	}
+
+	var meta fileMeta
+	if err := s.FindCursorMeta(src, &meta); err != nil {
+		return nil
+	}
+	sources := make([]fileSource, 0, len(meta.Members))
+	for _, member := range meta.Members {
+		sources = append(sources, archiveMemberSource(fs, member.Path))
+	}
+	return sources
 }
 
-func (p *fileProspector) onRename(log *logp.Logger, ctx input.Context, fe loginp.FSEvent, src loginp.Source, s loginp.StateMetadataUpdater, hg loginp.HarvesterGroup) {
+func (p *fileProspector) onRemove(log *logp.Logger, fe loginp.FSEvent, src loginp.Source, s loginp.StateMetadataUpdater, hg loginp.HarvesterGroup) {
+	// the members of a removed archive are removed with it
+	sources := []loginp.Source{src}
+	for _, memberSrc := range p.archiveMemberSources(src, s) {
+		sources = append(sources, memberSrc)
+	}
+
+	for _, src := range sources {
+		if p.stateChangeCloser.Removed {
+			log.Debugf("Stopping harvester as file %s has been removed and close.on_state_change.removed is enabled.", src.Name())
+			hg.Stop(src)
+		}
+
+		if p.cleanRemoved {
+			log.Debugf("Remove state for file as file removed: %s", fe.OldPath)
+
+			err := s.Remove(src)
+			if err != nil {
+				log.Errorf("Error while removing state from statestore: %v", err)
+			}
+		}
+	}
+}
+
+func (p *fileProspector) onRename(
+	log *logp.Logger,
+	ctx input.Context,
+	fe loginp.FSEvent,
+	src loginp.Source,
+	s loginp.StateMetadataUpdater,
+	hg loginp.HarvesterGroup,
+	ignoreSince time.Time,
+) {
 	// if file_identity is based on path, the current reader has to be cancelled
 	// and a new one has to start.
 	if !p.identifier.Supports(trackRename) {
 		prevSrc := p.identifier.GetSource(loginp.FSEvent{NewPath: fe.OldPath})
-		hg.Stop(prevSrc)
+		prevSources := []loginp.Source{prevSrc}
+		for _, memberSrc := range p.archiveMemberSources(prevSrc, s) {
+			prevSources = append(prevSources, memberSrc)
+		}
+		for _, prevSrc := range prevSources {
+			hg.Stop(prevSrc)
 
-		log.Debugf("Remove state for file as file renamed and path file_identity is configured: %s", fe.OldPath)
-		err := s.Remove(prevSrc)
-		if err != nil {
-			log.Errorf("Error while removing old state of renamed file (%s): %v", fe.OldPath, err)
+			log.Debugf("Remove state for file as file renamed and path file_identity is configured: %s", fe.OldPath)
+			err := s.Remove(prevSrc)
+			if err != nil {
+				log.Errorf("Error while removing old state of renamed file (%s): %v", fe.OldPath, err)
+			}
 		}
 
+		if p.archive.Enabled && p.onArchive(log, ctx, fe, src, s, hg, ignoreSince) {
+			return
+		}
 		hg.Start(ctx, src)
 	} else {
 		// update file metadata as the path has changed
@@ -429,10 +592,31 @@ func (p *fileProspector) onRename(log *logp.Logger, ctx input.Context, fe loginp
 				", using prospector's identifier: '%s'",
 				src.Name(), err, meta.IdentifierName)
 		}
-		err = s.UpdateMetadata(src, fileMeta{Source: fe.NewPath, IdentifierName: meta.IdentifierName})
+		err = s.UpdateMetadata(src, fileMeta{Source: fe.NewPath, IdentifierName: meta.IdentifierName, Members: meta.Members})
 		if err != nil {
 			log.Errorf("Failed to update cursor meta data of entry %s: %v", src.Name(), err)
 		}
+		for _, memberSrc := range p.archiveMemberSources(src, s) {
+			err = s.UpdateMetadata(memberSrc, fileMeta{Source: fe.NewPath, IdentifierName: meta.IdentifierName, Member: memberSrc.member})
+			if err != nil {
+				log.Errorf("Failed to update cursor meta data of entry %s: %v", memberSrc.Name(), err)
+			}
+		}
+
+		// the harvesters of archive members keep reading the renamed archive
+		if len(meta.Members) > 0 {
+			return
+		}
+
+		// a file compressed during rotation keeps its identity, but the
+		// running harvester still reads the removed plain file. The
+		// harvester is restarted to continue from the cursor in the
+		// decompressed content of the new file.
+		if fe.Descriptor.Compression != "" {
+			log.Debugf("Restarting harvester as file %s has been renamed to compressed file %s.", fe.OldPath, fe.NewPath)
+			hg.Restart(ctx, src)
+			return
+		}
 
 		if p.stateChangeCloser.Renamed {
 			log.Debugf("Stopping harvester as file %s has been renamed and close.on_state_change.renamed is enabled.", src.Name())
@@ -444,6 +628,16 @@ func (p *fileProspector) onRename(log *logp.Logger, ctx input.Context, fe loginp
 	}
 }
 
+// entrySource returns the source of a registry entry of a file found by
+// the file watcher. Archive members are identified by their archive.
+func entrySource(identifier fileIdentifier, fm fileMeta, fd loginp.FileDescriptor) fileSource {
+	src := identifier.GetSource(loginp.FSEvent{NewPath: fm.Source, Descriptor: fd})
+	if fm.Member != "" {
+		return archiveMemberSource(src, fm.Member)
+	}
+	return src
+}
+
 func (p *fileProspector) stopHarvesterGroup(log *logp.Logger, hg loginp.HarvesterGroup) {
 	err := hg.StopHarvesters()
 	if err != nil {
@@ -44,7 +44,7 @@ func newProspector(config config, log *logp.Logger) (loginp.Prospector, error) {
 		return nil, err
 	}
 
-	filewatcher, err := newFileWatcher(logger, config.Paths, config.FileWatcher)
+	filewatcher, err := newFileWatcher(logger, config.Paths, config.FileWatcher, config.Reader.Compression)
 	if err != nil {
 		return nil, fmt.Errorf("error while creating filewatcher %w", err)
 	}
@@ -66,6 +66,7 @@ func newProspector(config config, log *logp.Logger) (loginp.Prospector, error) {
 		stateChangeCloser:   config.Close.OnStateChange,
 		logger:              logger.Named("prospector"),
 		takeOver:            config.TakeOver,
+		archive:             config.Archive,
 	}
 	if config.Rotation == nil {
 		return &fileprospector, nil
@@ -89,6 +90,9 @@ func newProspector(config config, log *logp.Logger) (loginp.Prospector, error) {
 		strategy := cfg.Strategy.Name()
 		switch strategy {
 		case copytruncateStrategy:
+			if config.Archive.Enabled {
+				return nil, fmt.Errorf("archives cannot be read with copytruncate rotation")
+			}
 			experimentalWarning.Do(func() {
 				cfgwarn.Experimental("rotation.external.copytruncate is used.")
 			})
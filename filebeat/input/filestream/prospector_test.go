@@ -456,6 +456,35 @@ func TestProspectorHarvesterUpdateIgnoredFiles(t *testing.T) {
 	)
 }
 
+// TestProspectorIgnoredCompressedFile checks that the size of an ignored
+// compressed file is not saved as its offset, as the offsets of compressed
+// files are offsets in the decompressed content.
+func TestProspectorIgnoredCompressedFile(t *testing.T) {
+	minuteAgo := time.Now().Add(-1 * time.Minute)
+
+	descriptor := createTestFileDescriptorWithInfo(&testFileInfo{"/path/to/file.1.gz", 5, minuteAgo, nil})
+	descriptor.Compression = gzipFormat
+	event := loginp.FSEvent{Op: loginp.OpCreate, NewPath: "/path/to/file.1.gz", Descriptor: descriptor}
+
+	p := fileProspector{
+		logger:      logp.L(),
+		filewatcher: newMockFileWatcher([]loginp.FSEvent{event}, 1),
+		identifier:  mustPathIdentifier(false),
+		ignoreOlder: 10 * time.Second,
+	}
+	ctx := input.Context{Logger: logp.L(), Cancelation: context.Background()}
+	hg := newTestHarvesterGroup()
+	testStore := newMockMetadataUpdater()
+
+	p.Run(ctx, testStore, hg)
+
+	assert.Equal(t, []harvesterEvent{harvesterGroupStop{}}, hg.events)
+	var cursor state
+	if err := testStore.FindCursor(fileSource{fileID: "path::/path/to/file.1.gz"}, &cursor); err == nil {
+		assert.Zero(t, cursor.Offset, "the compressed size must not be used as offset")
+	}
+}
+
 func TestProspectorDeletedFile(t *testing.T) {
 	testCases := map[string]struct {
 		events       []loginp.FSEvent
@@ -718,6 +747,14 @@ func (mu *mockMetadataUpdater) FindCursorMeta(s loginp.Source, v interface{}) er
 	return typeconv.Convert(v, meta)
 }
 
+func (mu *mockMetadataUpdater) FindCursor(s loginp.Source, v interface{}) error {
+	cursor, ok := mu.table[s.Name()]
+	if !ok {
+		return fmt.Errorf("no such id [%q]", s.Name())
+	}
+	return typeconv.Convert(v, cursor)
+}
+
 func (mu *mockMetadataUpdater) ResetCursor(s loginp.Source, cur interface{}) error {
 	mu.table[s.Name()] = cur
 	return nil
@@ -204,6 +204,7 @@ require (
 	github.com/microsoft/go-mssqldb v1.8.2
 	github.com/microsoft/wmi v0.25.1
 	github.com/open-telemetry/opentelemetry-collector-contrib/exporter/elasticsearchexporter v0.129.0
+	github.com/oschwald/maxminddb-golang v1.13.0
 	github.com/otiai10/copy v1.12.0
 	github.com/pierrec/lz4/v4 v4.1.22
 	github.com/pkg/xattr v0.4.9
@@ -151,6 +151,18 @@ type Processor interface {
 	Run(in *Event) (event *Event, err error)
 }
 
+// FanOutProcessor is a Processor that can replace an event with several
+// events. The publisher pipeline calls RunFanOut instead of Run for these
+// processors. Run is still called where only a single event can be
+// returned.
+type FanOutProcessor interface {
+	Processor
+
+	// RunFanOut returns the events replacing in. No events and a nil error
+	// drop the event.
+	RunFanOut(in *Event) ([]*Event, error)
+}
+
 // PublishMode enum sets some requirements on the client connection to the beats
 // publisher pipeline
 type PublishMode uint8
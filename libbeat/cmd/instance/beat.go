@@ -64,6 +64,7 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/pipeline"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/version"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
@@ -356,7 +357,15 @@ func (b *Beat) createBeater(bt beat.Creator) (beat.Beater, error) {
 
 	log.Debug("Initializing output plugins")
 	outputEnabled := b.Config.Output.IsSet() && b.Config.Output.Config().Enabled()
-	if !outputEnabled {
+	routedOutputs := len(b.Config.Pipeline.Outputs) > 0
+	if routedOutputs {
+		if outputEnabled {
+			return nil, errors.New("'output' and 'outputs' can not be configured at the same time")
+		}
+		if b.Manager.Enabled() {
+			return nil, errors.New("'outputs' is not supported when running under Central Management")
+		}
+	} else if !outputEnabled {
 		if b.Manager.Enabled() {
 			b.Info.Logger.Info("Output is configured through Central Management")
 		} else {
@@ -382,7 +391,11 @@ func (b *Beat) createBeater(bt beat.Creator) (beat.Beater, error) {
 		Processors:     b.processors,
 		InputQueueSize: b.InputQueueSize,
 	}
-	publisher, err = pipeline.LoadWithSettings(b.Info, monitors, b.Config.Pipeline, outputFactory, settings)
+	if routedOutputs {
+		publisher, err = pipeline.LoadRoutedWithSettings(b.Info, monitors, b.Config.Pipeline, b.createOutput, settings)
+	} else {
+		publisher, err = pipeline.LoadWithSettings(b.Info, monitors, b.Config.Pipeline, outputFactory, settings)
+	}
 	if err != nil {
 		return nil, fmt.Errorf("error initializing publisher: %w", err)
 	}
@@ -1559,15 +1572,20 @@ func (bc *beatConfig) Validate() error {
 			return fmt.Errorf("top level queue and output level queue settings defined, only one is allowed")
 		}
 		// elastic-agent doesn't support disk queue yet
-		if bc.Management.Enabled() && outputPC.Queue.Config().Enabled() && outputPC.Queue.Name() == diskqueue.QueueType {
-			return fmt.Errorf("disk queue is not supported when management is enabled")
+		if bc.Management.Enabled() && outputPC.Queue.Config().Enabled() && usesDiskQueue(outputPC.Queue.Name()) {
+			return fmt.Errorf("%s queue is not supported when management is enabled", outputPC.Queue.Name())
 		}
 	}
 
 	// elastic-agent doesn't support disk queue yet
-	if bc.Management.Enabled() && bc.Pipeline.Queue.Config().Enabled() && bc.Pipeline.Queue.Name() == diskqueue.QueueType {
-		return fmt.Errorf("disk queue is not supported when management is enabled")
+	if bc.Management.Enabled() && bc.Pipeline.Queue.Config().Enabled() && usesDiskQueue(bc.Pipeline.Queue.Name()) {
+		return fmt.Errorf("%s queue is not supported when management is enabled", bc.Pipeline.Queue.Name())
 	}
 
 	return nil
 }
+
+// usesDiskQueue reports whether the queue type stores events in a disk queue.
+func usesDiskQueue(queueType string) bool {
+	return queueType == diskqueue.QueueType || queueType == hybridqueue.QueueType
+}
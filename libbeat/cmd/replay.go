@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cmd
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+
+	"github.com/spf13/cobra"
+
+	"github.com/elastic/beats/v7/libbeat/cmd/instance"
+	"github.com/elastic/beats/v7/libbeat/cmd/instance/locks"
+	"github.com/elastic/beats/v7/libbeat/common/cli"
+	"github.com/elastic/beats/v7/libbeat/outputs/elasticsearch"
+)
+
+func genReplayCmd(settings instance.Settings) *cobra.Command {
+	var flagIndex string
+	var flagRemove bool
+	command := &cobra.Command{
+		Use:   "replay [FILE]...",
+		Short: "Re-publish documents rejected by Elasticsearch from dead letter files",
+		Long: `This command sends the documents of dead letter files, written by the
+dead_letter_file non_indexable_policy of the Elasticsearch output, to
+Elasticsearch again. Without FILE arguments, all files of the configured
+dead letter path are replayed. With --remove, the beat must not be running.
+`,
+		Run: cli.RunWith(func(cmd *cobra.Command, args []string) error {
+			return replay(settings, args, flagIndex, flagRemove)
+		}),
+	}
+	command.Flags().StringVar(&flagIndex, "index", "", "Publish all documents to this index instead of their original index")
+	command.Flags().BoolVar(&flagRemove, "remove", false, "Remove replayed documents from the files, and files once all their documents were replayed")
+	return command
+}
+
+func replay(settings instance.Settings, files []string, index string, remove bool) error {
+	b, err := instance.NewInitializedBeat(settings)
+	if err != nil {
+		return fmt.Errorf("error initializing beat: %w", err)
+	}
+	if b.Config.Output.Name() != "elasticsearch" {
+		return errors.New("replaying dead letter files requires the Elasticsearch output")
+	}
+
+	if remove {
+		// The beat keeps appending to the active dead letter file, removing
+		// or rewriting it would lose the documents written afterwards.
+		bl := locks.New(b.Info)
+		if err := bl.Lock(); err != nil {
+			if errors.Is(err, locks.ErrAlreadyLocked) {
+				return errors.New("the beat must be stopped before replaying dead letter files with --remove")
+			}
+			return err
+		}
+		defer func() {
+			_ = bl.Unlock()
+		}()
+	}
+
+	ctx := context.Background()
+	replayer, err := elasticsearch.NewDeadLetterReplayer(ctx, b.Config.Output.Config(), b.Info)
+	if err != nil {
+		return fmt.Errorf("error connecting to Elasticsearch: %w", err)
+	}
+	defer replayer.Close()
+	replayer.Index = index
+
+	if len(files) == 0 {
+		if files, err = replayer.Files(); err != nil {
+			return fmt.Errorf("error listing dead letter files: %w", err)
+		}
+	}
+
+	failed := 0
+	for _, path := range files {
+		stats, err := replayer.ReplayFile(ctx, path, remove)
+		if err != nil {
+			return fmt.Errorf("error replaying %v: %w", path, err)
+		}
+		fmt.Fprintf(os.Stdout, "%v: %d documents replayed, %d documents rejected\n", path, stats.Replayed, stats.Failed)
+		failed += stats.Failed
+	}
+
+	if failed > 0 {
+		return fmt.Errorf("%d documents were rejected again", failed)
+	}
+	return nil
+}
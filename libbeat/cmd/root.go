@@ -41,6 +41,7 @@ type BeatsRootCmd struct {
 	ExportCmd     *cobra.Command
 	TestCmd       *cobra.Command
 	KeystoreCmd   *cobra.Command
+	ReplayCmd     *cobra.Command
 }
 
 // GenRootCmdWithSettings returns the root command to use for your beat. It take the
@@ -72,6 +73,7 @@ func GenRootCmdWithSettings(beatCreator beat.Creator, settings instance.Settings
 	rootCmd.TestCmd = genTestCmd(settings, beatCreator)
 	rootCmd.SetupCmd = genSetupCmd(settings, beatCreator)
 	rootCmd.KeystoreCmd = genKeystoreCmd(settings)
+	rootCmd.ReplayCmd = genReplayCmd(settings)
 	rootCmd.VersionCmd = GenVersionCmd(settings)
 	rootCmd.CompletionCmd = genCompletionCmd(settings, rootCmd)
 
@@ -105,6 +107,7 @@ func GenRootCmdWithSettings(beatCreator beat.Creator, settings instance.Settings
 	rootCmd.AddCommand(rootCmd.CompletionCmd)
 	rootCmd.AddCommand(rootCmd.ExportCmd)
 	rootCmd.AddCommand(rootCmd.TestCmd)
+	rootCmd.AddCommand(rootCmd.ReplayCmd)
 	if rootCmd.KeystoreCmd != nil {
 		rootCmd.AddCommand(rootCmd.KeystoreCmd)
 	}
@@ -19,6 +19,7 @@ package conditions
 
 import (
 	"errors"
+	"strings"
 
 	"github.com/elastic/beats/v7/libbeat/common/match"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -28,15 +29,23 @@ const logName = "conditions"
 
 // Config represents a configuration for a condition, as you would find it in the config files.
 type Config struct {
-	Equals    *Fields                `config:"equals"`
-	Contains  *Fields                `config:"contains"`
-	Regexp    *Fields                `config:"regexp"`
-	Range     *Fields                `config:"range"`
-	HasFields []string               `config:"has_fields"`
-	Network   map[string]interface{} `config:"network"`
-	OR        []Config               `config:"or"`
-	AND       []Config               `config:"and"`
-	NOT       *Config                `config:"not"`
+	Equals               *Fields                `config:"equals"`
+	EqualsIgnoreCase     map[string]interface{} `config:"equals_ignore_case"`
+	Contains             *Fields                `config:"contains"`
+	ContainsIgnoreCase   map[string]interface{} `config:"contains_ignore_case"`
+	Regexp               *Fields                `config:"regexp"`
+	Range                *Fields                `config:"range"`
+	HasFields            []string               `config:"has_fields"`
+	Network              map[string]interface{} `config:"network"`
+	In                   map[string]interface{} `config:"in"`
+	InIgnoreCase         map[string]interface{} `config:"in_ignore_case"`
+	StartsWith           map[string]interface{} `config:"starts_with"`
+	StartsWithIgnoreCase map[string]interface{} `config:"starts_with_ignore_case"`
+	EndsWith             map[string]interface{} `config:"ends_with"`
+	EndsWithIgnoreCase   map[string]interface{} `config:"ends_with_ignore_case"`
+	OR                   []Config               `config:"or"`
+	AND                  []Config               `config:"and"`
+	NOT                  *Config                `config:"not"`
 }
 
 // Condition is the interface for all defined conditions
@@ -73,6 +82,22 @@ func NewCondition(config *Config, logger *logp.Logger) (Condition, error) {
 		condition = NewHasFieldsCondition(config.HasFields)
 	case config.Network != nil && len(config.Network) > 0:
 		condition, err = NewNetworkCondition(config.Network, logger)
+	case len(config.EqualsIgnoreCase) > 0:
+		condition, err = NewStringsCondition("equals_ignore_case", config.EqualsIgnoreCase, stringEquals, true)
+	case len(config.ContainsIgnoreCase) > 0:
+		condition, err = NewStringsCondition("contains_ignore_case", config.ContainsIgnoreCase, strings.Contains, true)
+	case len(config.In) > 0:
+		condition, err = NewInCondition(config.In, false, logger)
+	case len(config.InIgnoreCase) > 0:
+		condition, err = NewInCondition(config.InIgnoreCase, true, logger)
+	case len(config.StartsWith) > 0:
+		condition, err = NewStringsCondition("starts_with", config.StartsWith, strings.HasPrefix, false)
+	case len(config.StartsWithIgnoreCase) > 0:
+		condition, err = NewStringsCondition("starts_with_ignore_case", config.StartsWithIgnoreCase, strings.HasPrefix, true)
+	case len(config.EndsWith) > 0:
+		condition, err = NewStringsCondition("ends_with", config.EndsWith, strings.HasSuffix, false)
+	case len(config.EndsWithIgnoreCase) > 0:
+		condition, err = NewStringsCondition("ends_with_ignore_case", config.EndsWithIgnoreCase, strings.HasSuffix, true)
 	case len(config.OR) > 0:
 		var conditionsList []Condition
 		conditionsList, err = NewConditionList(config.OR, logger)
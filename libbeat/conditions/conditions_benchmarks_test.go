@@ -18,6 +18,7 @@
 package conditions
 
 import (
+	"fmt"
 	"testing"
 	"time"
 
@@ -113,3 +114,86 @@ func BenchmarkCombinedCondition(b *testing.B) {
 		cond.Check(event)
 	}
 }
+
+// BenchmarkInCondition compares the in condition with the or condition of
+// equals conditions it replaces.
+func BenchmarkInCondition(b *testing.B) {
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"user": mapstr.M{"name": "user-last"},
+		},
+	}
+
+	for _, n := range []int{10, 100, 1000} {
+		values := make([]interface{}, n)
+		equals := make([]Config, n)
+		for i := range values {
+			value := fmt.Sprintf("user-%d", i)
+			if i == n-1 {
+				value = "user-last"
+			}
+			values[i] = value
+			equals[i] = Config{Equals: &Fields{fields: map[string]interface{}{"user.name": value}}}
+		}
+
+		configs := map[string]Config{
+			"in":             {In: map[string]interface{}{"user.name": values}},
+			"in_ignore_case": {InIgnoreCase: map[string]interface{}{"user.name": values}},
+			"or equals":      {OR: equals},
+		}
+		for name, config := range configs {
+			b.Run(fmt.Sprintf("%s/%d values", name, n), func(b *testing.B) {
+				cond, err := NewCondition(&config, logp.NewNopLogger())
+				if err != nil {
+					b.Fatal(err)
+				}
+				b.ResetTimer()
+				for i := 0; i < b.N; i++ {
+					if !cond.Check(event) {
+						b.Fatal("no match")
+					}
+				}
+			})
+		}
+	}
+}
+
+// BenchmarkStringsCondition compares the starts_with and ends_with
+// conditions with the regexp and contains conditions.
+func BenchmarkStringsCondition(b *testing.B) {
+	event := &beat.Event{
+		Timestamp: time.Now(),
+		Fields: mapstr.M{
+			"url": mapstr.M{"path": "/api/v1/internal/users/1234/profile"},
+		},
+	}
+
+	configs := map[string]Config{
+		"starts_with":             {StartsWith: map[string]interface{}{"url.path": "/api/"}},
+		"starts_with_ignore_case": {StartsWithIgnoreCase: map[string]interface{}{"url.path": "/API/"}},
+		"regexp prefix":           {Regexp: &Fields{fields: map[string]interface{}{"url.path": "^/api/"}}},
+		"regexp prefix ignore case": {
+			Regexp: &Fields{fields: map[string]interface{}{"url.path": "(?i)^/API/"}},
+		},
+		"ends_with":             {EndsWith: map[string]interface{}{"url.path": "/profile"}},
+		"ends_with_ignore_case": {EndsWithIgnoreCase: map[string]interface{}{"url.path": "/PROFILE"}},
+		"regexp suffix":         {Regexp: &Fields{fields: map[string]interface{}{"url.path": "/profile$"}}},
+		"contains":              {Contains: &Fields{fields: map[string]interface{}{"url.path": "internal"}}},
+		"contains_ignore_case":  {ContainsIgnoreCase: map[string]interface{}{"url.path": "INTERNAL"}},
+	}
+	for name, config := range configs {
+		b.Run(name, func(b *testing.B) {
+			cond, err := NewCondition(&config, logp.NewNopLogger())
+			if err != nil {
+				b.Fatal(err)
+			}
+			b.ResetTimer()
+			for i := 0; i < b.N; i++ {
+				if !cond.Check(event) {
+					b.Fatal("no match")
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,187 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+// fileConfig is the configuration of values loaded from a file, used in
+// place of inline values by the in and network conditions.
+type fileConfig struct {
+	File   string `config:"file" validate:"required"`
+	Reload struct {
+		Enabled bool          `config:"enabled"`
+		Period  time.Duration `config:"period" validate:"positive,nonzero"`
+	} `config:"reload"`
+}
+
+// isFileConfig returns whether a condition value is a file configuration,
+// a map with a file path.
+func isFileConfig(value interface{}) bool {
+	m, ok := asMap(value)
+	if !ok {
+		return false
+	}
+	_, ok = m["file"].(string)
+	return ok
+}
+
+func unpackFileConfig(value interface{}) (fileConfig, error) {
+	c := fileConfig{}
+	c.Reload.Period = 10 * time.Second
+	cfg, err := config.NewConfigFrom(value)
+	if err != nil {
+		return c, err
+	}
+	err = cfg.Unpack(&c)
+	return c, err
+}
+
+// flattenFields flattens the nested maps of a condition configuration,
+// so that the keys are the field names. Maps with a file path are kept as
+// values when allowFiles is set.
+func flattenFields(fields map[string]interface{}, allowFiles bool) map[string]interface{} {
+	out := map[string]interface{}{}
+	var flatten func(prefix string, m map[string]interface{})
+	flatten = func(prefix string, m map[string]interface{}) {
+		for k, v := range m {
+			key := prefix + k
+			if inner, ok := asMap(v); ok && !(allowFiles && isFileConfig(v)) {
+				flatten(key+".", inner)
+				continue
+			}
+			out[key] = v
+		}
+	}
+	flatten("", fields)
+	return out
+}
+
+func asMap(value interface{}) (map[string]interface{}, bool) {
+	switch m := value.(type) {
+	case map[string]interface{}:
+		return m, true
+	case mapstr.M:
+		return m, true
+	default:
+		return nil, false
+	}
+}
+
+// listFile is a list of values loaded from a file, one per line. Empty
+// lines and lines starting with # are ignored. When reloading is enabled,
+// the file is checked for changes while the values are used, at most once
+// per period, and reloaded if it changed. The previous values are kept if
+// the file can't be reloaded.
+type listFile[T any] struct {
+	path   string
+	period time.Duration
+	parse  func([]string) (T, error)
+	log    *logp.Logger
+
+	values atomic.Pointer[T]
+
+	mu      sync.Mutex // Held while checking the file.
+	next    atomic.Int64
+	modTime time.Time
+	size    int64
+}
+
+func newListFile[T any](c fileConfig, parse func([]string) (T, error), log *logp.Logger) (*listFile[T], error) {
+	f := &listFile[T]{
+		path:  paths.Resolve(paths.Config, c.File),
+		parse: parse,
+		log:   log,
+	}
+	if c.Reload.Enabled {
+		f.period = c.Reload.Period
+	}
+	if err := f.load(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+// get returns the values of the file, reloading it first if needed.
+func (f *listFile[T]) get() T {
+	if f.period > 0 && time.Now().UnixNano() >= f.next.Load() && f.mu.TryLock() {
+		if time.Now().UnixNano() >= f.next.Load() {
+			if err := f.load(); err != nil {
+				f.log.Errorw("Failed to reload the values of a condition, keeping the previous values", "path", f.path, "error", err)
+			}
+		}
+		f.mu.Unlock()
+	}
+	return *f.values.Load()
+}
+
+// load reads and parses the file if it changed since it was last read.
+func (f *listFile[T]) load() error {
+	f.next.Store(time.Now().Add(f.period).UnixNano())
+
+	info, err := os.Stat(f.path)
+	if err != nil {
+		return err
+	}
+	if f.values.Load() != nil && info.ModTime().Equal(f.modTime) && info.Size() == f.size {
+		return nil
+	}
+
+	data, err := os.ReadFile(f.path)
+	if err != nil {
+		return err
+	}
+	var lines []string
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		lines = append(lines, line)
+	}
+	if err = scanner.Err(); err != nil {
+		return fmt.Errorf("failed to read %v: %w", f.path, err)
+	}
+	values, err := f.parse(lines)
+	if err != nil {
+		return fmt.Errorf("failed to parse %v: %w", f.path, err)
+	}
+
+	f.values.Store(&values)
+	f.modTime = info.ModTime()
+	f.size = info.Size()
+	return nil
+}
+
+func (f *listFile[T]) String() string {
+	return "file:" + f.path
+}
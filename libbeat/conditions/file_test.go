@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestFileConfig(t *testing.T) {
+	users := filepath.Join(t.TempDir(), "users.txt")
+	require.NoError(t, os.WriteFile(users, []byte("admin\n"), 0o600))
+	networks := filepath.Join(t.TempDir(), "networks.txt")
+	require.NoError(t, os.WriteFile(networks, []byte("10.0.0.0/8\n"), 0o600))
+
+	// Field names with dots are nested by the configuration.
+	var c Config
+	require.NoError(t, config.MustNewConfigFrom(mapstr.M{
+		"and": []mapstr.M{
+			{"in.user.name": mapstr.M{"file": users, "reload.enabled": true}},
+			{"network.source.ip": mapstr.M{"file": networks}},
+			{"starts_with.url.path": []string{"/admin", "/internal"}},
+		},
+	}).Unpack(&c))
+
+	cond, err := NewCondition(&c, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.True(t, cond.Check(&beat.Event{Fields: mapstr.M{
+		"user":   mapstr.M{"name": "admin"},
+		"source": mapstr.M{"ip": "10.1.2.3"},
+		"url":    mapstr.M{"path": "/internal/status"},
+	}}))
+
+	c = Config{}
+	require.NoError(t, config.MustNewConfigFrom(mapstr.M{
+		"in.user.name": mapstr.M{"file": users, "reload.period": 0},
+	}).Unpack(&c))
+	_, err = NewCondition(&c, logptest.NewTestingLogger(t, ""))
+	assert.Error(t, err)
+}
+
+func TestListFileReload(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "values.txt")
+	require.NoError(t, os.WriteFile(path, []byte("a\n"), 0o600))
+
+	c := fileConfig{File: path}
+	c.Reload.Enabled = true
+	c.Reload.Period = time.Millisecond
+	parse := func(lines []string) ([]string, error) {
+		if len(lines) > 2 {
+			return nil, assert.AnError
+		}
+		return lines, nil
+	}
+	f, err := newListFile(c, parse, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a"}, f.get())
+
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\n"), 0o600))
+	assert.Eventually(t, func() bool {
+		return len(f.get()) == 2
+	}, time.Second, time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, f.get())
+
+	// The values are kept when the file can't be parsed or read.
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\nc\n"), 0o600))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, f.get())
+	require.NoError(t, os.Remove(path))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, []string{"a", "b"}, f.get())
+
+	// Without reloading, the file is only read once.
+	c.Reload.Enabled = false
+	require.NoError(t, os.WriteFile(path, []byte("a\n"), 0o600))
+	f, err = newListFile(c, parse, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	require.NoError(t, os.WriteFile(path, []byte("a\nb\n"), 0o600))
+	time.Sleep(5 * time.Millisecond)
+	assert.Equal(t, []string{"a"}, f.get())
+}
@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// In is a Condition for testing whether a value is in a list of values.
+// The values are compared as strings, so that ints and bools match their
+// string representations.
+type In struct {
+	name       string
+	fields     map[string]valueSet
+	ignoreCase bool
+}
+
+// valueSet is a set of values, given inline or loaded from a file.
+type valueSet interface {
+	fmt.Stringer
+	set() map[string]struct{}
+}
+
+type inlineValueSet map[string]struct{}
+
+func (s inlineValueSet) set() map[string]struct{} { return s }
+func (s inlineValueSet) String() string {
+	values := make([]string, 0, len(s))
+	for v := range s {
+		values = append(values, v)
+	}
+	return "[" + strings.Join(values, " ") + "]"
+}
+
+type fileValueSet struct {
+	*listFile[map[string]struct{}]
+}
+
+func (s fileValueSet) set() map[string]struct{} { return s.get() }
+
+// NewInCondition builds a new In using the given configuration. The value
+// of each field is a list of values, or the configuration of a file with
+// one value per line. The comparison is case-insensitive when ignoreCase
+// is set.
+func NewInCondition(fields map[string]interface{}, ignoreCase bool, log *logp.Logger) (*In, error) {
+	c := &In{
+		name:       "in",
+		fields:     map[string]valueSet{},
+		ignoreCase: ignoreCase,
+	}
+	if ignoreCase {
+		c.name = "in_ignore_case"
+	}
+
+	for field, value := range flattenFields(fields, true) {
+		switch v := value.(type) {
+		case []interface{}:
+			set := inlineValueSet{}
+			for _, elem := range v {
+				s, ok := inValueString(elem)
+				if !ok {
+					return nil, fmt.Errorf("%v condition attempted to set '%v' -> '%v' and encountered unexpected type '%T', only strings, ints, and booleans are allowed", c.name, field, elem, elem)
+				}
+				set[c.normalize(s)] = struct{}{}
+			}
+			c.fields[field] = set
+		case map[string]interface{}, mapstr.M:
+			fc, err := unpackFileConfig(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %v condition file for '%v': %w", c.name, field, err)
+			}
+			f, err := newListFile(fc, c.parseValues, log.Named(logName))
+			if err != nil {
+				return nil, fmt.Errorf("failed to load %v condition values for '%v': %w", c.name, field, err)
+			}
+			c.fields[field] = fileValueSet{f}
+		default:
+			return nil, fmt.Errorf("%v condition attempted to set '%v' -> '%v' and encountered unexpected type '%T', only lists of values or files are allowed", c.name, field, value, value)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *In) parseValues(lines []string) (map[string]struct{}, error) {
+	set := make(map[string]struct{}, len(lines))
+	for _, line := range lines {
+		set[c.normalize(line)] = struct{}{}
+	}
+	return set, nil
+}
+
+func (c *In) normalize(s string) string {
+	if c.ignoreCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// inValueString returns the string representation of a value that can
+// be compared by the in condition.
+func inValueString(value interface{}) (string, bool) {
+	if s, err := ExtractString(value); err == nil {
+		return s, true
+	}
+	// ExtractInt converts to uint64, so signed values are formatted
+	// first to keep their sign.
+	switch i := value.(type) {
+	case int:
+		return strconv.FormatInt(int64(i), 10), true
+	case int8:
+		return strconv.FormatInt(int64(i), 10), true
+	case int16:
+		return strconv.FormatInt(int64(i), 10), true
+	case int32:
+		return strconv.FormatInt(int64(i), 10), true
+	case int64:
+		return strconv.FormatInt(i, 10), true
+	}
+	if i, err := ExtractInt(value); err == nil {
+		return strconv.FormatUint(i, 10), true
+	}
+	if b, err := ExtractBool(value); err == nil {
+		return strconv.FormatBool(b), true
+	}
+	return "", false
+}
+
+// Check determines whether the given event matches this condition. When a
+// field holds a list, it matches if any of its elements is in the list of
+// values.
+func (c *In) Check(event ValuesMap) bool {
+	for field, values := range c.fields {
+		value, err := event.GetValue(field)
+		if err != nil {
+			return false
+		}
+
+		set := values.set()
+		var found bool
+		switch v := value.(type) {
+		case []string:
+			found = slices.ContainsFunc(v, func(elem string) bool { return c.contains(set, elem) })
+		case []interface{}:
+			found = slices.ContainsFunc(v, func(elem interface{}) bool { return c.contains(set, elem) })
+		default:
+			found = c.contains(set, value)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *In) contains(set map[string]struct{}, value interface{}) bool {
+	s, ok := inValueString(value)
+	if !ok {
+		return false
+	}
+	_, found := set[c.normalize(s)]
+	return found
+}
+
+func (c *In) String() string {
+	return fmt.Sprintf("%v: %v", c.name, c.fields)
+}
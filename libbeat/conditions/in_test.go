@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestInCreate(t *testing.T) {
+	for name, fields := range map[string]map[string]interface{}{
+		"scalar":      {"type": "process"},
+		"float value": {"type": []interface{}{0.5}},
+		"no file":     {"type": map[string]interface{}{"file": "/does/not/exist"}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewCondition(&Config{In: fields}, logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestIn(t *testing.T) {
+	tests := map[string]struct {
+		config   Config
+		expected bool
+	}{
+		"string": {
+			config:   Config{In: map[string]interface{}{"proc.name": []interface{}{"sshd", "secd"}}},
+			expected: true,
+		},
+		"string no match": {
+			config:   Config{In: map[string]interface{}{"proc.name": []interface{}{"sshd", "SECD"}}},
+			expected: false,
+		},
+		"int": {
+			config:   Config{In: map[string]interface{}{"proc.pid": []interface{}{1, 305}}},
+			expected: true,
+		},
+		"bool": {
+			config:   Config{In: map[string]interface{}{"final": []interface{}{false}}},
+			expected: true,
+		},
+		"nested fields": {
+			config: Config{In: map[string]interface{}{"proc": map[string]interface{}{
+				"name":  []interface{}{"secd"},
+				"state": []interface{}{"running", "sleeping"},
+			}}},
+			expected: true,
+		},
+		"any element": {
+			config:   Config{In: map[string]interface{}{"tags": []interface{}{"dev", "prod"}}},
+			expected: true,
+		},
+		"any interface element": {
+			config:   Config{In: map[string]interface{}{"proc.keywords": []interface{}{"bar"}}},
+			expected: true,
+		},
+		"missing field": {
+			config:   Config{In: map[string]interface{}{"missing": []interface{}{"secd"}}},
+			expected: false,
+		},
+		"ignore case": {
+			config:   Config{InIgnoreCase: map[string]interface{}{"proc.name": []interface{}{"sshd", "SECD"}}},
+			expected: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			testConfig(t, tc.expected, secdTestEvent, &tc.config)
+		})
+	}
+}
+
+func TestInFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "users.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# Allowed users.\nalice\n\n  monica  \n"), 0o600))
+
+	testConfig(t, true, secdTestEvent, &Config{
+		In: map[string]interface{}{"proc.username": map[string]interface{}{"file": path}},
+	})
+	testConfig(t, false, secdTestEvent, &Config{
+		In: map[string]interface{}{"proc.name": map[string]interface{}{"file": path}},
+	})
+	testConfig(t, true, secdTestEvent, &Config{
+		InIgnoreCase: map[string]interface{}{"proc.username": map[string]interface{}{"file": path}},
+	})
+}
+
+func TestInFileNegativeNumbers(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "offsets.txt")
+	require.NoError(t, os.WriteFile(path, []byte("-5\n12\n"), 0o600))
+
+	event := &beat.Event{
+		Fields: mapstr.M{
+			"int":    -5,
+			"int64":  int64(-5),
+			"string": "-5",
+			"other":  int32(-12),
+		},
+	}
+	for _, field := range []string{"int", "int64", "string"} {
+		testConfig(t, true, event, &Config{
+			In: map[string]interface{}{field: map[string]interface{}{"file": path}},
+		})
+	}
+	testConfig(t, false, event, &Config{
+		In: map[string]interface{}{"other": map[string]interface{}{"file": path}},
+	})
+	testConfig(t, true, event, &Config{
+		In: map[string]interface{}{"string": []interface{}{-5}},
+	})
+}
@@ -95,6 +95,25 @@ func (m multiNetworkMatcher) String() string {
 	return strings.Join(names, " OR ")
 }
 
+// fileNetworkMatcher matches the networks of a file, one per line.
+type fileNetworkMatcher struct {
+	*listFile[multiNetworkMatcher]
+}
+
+func (m fileNetworkMatcher) Contains(ip net.IP) bool { return m.get().Contains(ip) }
+
+func parseNetworks(lines []string) (multiNetworkMatcher, error) {
+	matchers := make(multiNetworkMatcher, 0, len(lines))
+	for _, network := range lines {
+		m, err := makeMatcher(network)
+		if err != nil {
+			return nil, err
+		}
+		matchers = append(matchers, m)
+	}
+	return matchers, nil
+}
+
 func makeMatcher(network string) (networkMatcher, error) {
 	m := singleNetworkMatcher{name: network, netContainsFunc: namedNetworks[network]}
 	if m.netContainsFunc == nil {
@@ -110,7 +129,7 @@ func makeMatcher(network string) (networkMatcher, error) {
 func invalidTypeError(field string, value interface{}) error {
 	return fmt.Errorf("network condition attempted to set "+
 		"'%v' -> '%v' and encountered unexpected type '%T', only "+
-		"strings or []strings are allowed", field, value, value)
+		"strings, []strings or files are allowed", field, value, value)
 }
 
 // NewNetworkCondition builds a new Network using the given configuration.
@@ -120,7 +139,7 @@ func NewNetworkCondition(fields map[string]interface{}, logger *logp.Logger) (*N
 		log:    logger.Named(logName),
 	}
 
-	for field, value := range mapstr.M(fields).Flatten() {
+	for field, value := range flattenFields(fields, true) {
 		switch v := value.(type) {
 		case string:
 			m, err := makeMatcher(v)
@@ -142,6 +161,16 @@ func NewNetworkCondition(fields map[string]interface{}, logger *logp.Logger) (*N
 				matchers = append(matchers, m)
 			}
 			cond.fields[field] = matchers
+		case map[string]interface{}, mapstr.M:
+			fc, err := unpackFileConfig(v)
+			if err != nil {
+				return nil, fmt.Errorf("invalid network condition file for '%v': %w", field, err)
+			}
+			f, err := newListFile(fc, parseNetworks, cond.log)
+			if err != nil {
+				return nil, fmt.Errorf("failed to load network condition networks for '%v': %w", field, err)
+			}
+			cond.fields[field] = fileNetworkMatcher{f}
 		default:
 			return nil, invalidTypeError(field, value)
 		}
@@ -19,10 +19,13 @@ package conditions
 
 import (
 	"net"
+	"os"
+	"path/filepath"
 	"testing"
 	"time"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/elastic-agent-libs/config"
@@ -321,3 +324,21 @@ func BenchmarkNetworkCondition(b *testing.B) {
 		c.Check(event)
 	}
 }
+
+func TestNetworkFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "networks.txt")
+	require.NoError(t, os.WriteFile(path, []byte("# Internal networks.\n192.168.0.0/16\nloopback\n"), 0o600))
+
+	testConfig(t, true, httpResponseTestEvent, &Config{
+		Network: map[string]interface{}{"ip": map[string]interface{}{"file": path}},
+	})
+	testConfig(t, false, httpResponseEventIPList, &Config{
+		Network: map[string]interface{}{"host.ip": map[string]interface{}{"file": path}},
+	})
+
+	require.NoError(t, os.WriteFile(path, []byte("not-a-network\n"), 0o600))
+	_, err := NewCondition(&Config{
+		Network: map[string]interface{}{"ip": map[string]interface{}{"file": path}},
+	}, logptest.NewTestingLogger(t, ""))
+	assert.Error(t, err)
+}
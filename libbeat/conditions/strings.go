@@ -0,0 +1,132 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Strings is a Condition that compares string fields with strings, like
+// starts_with with strings.HasPrefix. A field matches if it matches any of
+// its strings. When a field holds a list, it matches if any of its
+// elements matches.
+type Strings struct {
+	name       string
+	fields     map[string][]string
+	compare    func(value, s string) bool
+	ignoreCase bool
+}
+
+// NewStringsCondition builds a new Strings with the given human name. The
+// value of each field is a string or a list of strings, which are compared
+// with the values of events by the compare function. The comparison is
+// case-insensitive when ignoreCase is set.
+func NewStringsCondition(
+	name string,
+	fields map[string]interface{},
+	compare func(value, s string) bool,
+	ignoreCase bool,
+) (*Strings, error) {
+	c := &Strings{
+		name:       name,
+		fields:     map[string][]string{},
+		compare:    compare,
+		ignoreCase: ignoreCase,
+	}
+
+	for field, value := range flattenFields(fields, false) {
+		switch v := value.(type) {
+		case string:
+			c.fields[field] = []string{c.normalize(v)}
+		case []interface{}:
+			list := make([]string, 0, len(v))
+			for _, elem := range v {
+				s, ok := elem.(string)
+				if !ok {
+					return nil, c.invalidTypeError(field, elem)
+				}
+				list = append(list, c.normalize(s))
+			}
+			c.fields[field] = list
+		default:
+			return nil, c.invalidTypeError(field, value)
+		}
+	}
+
+	return c, nil
+}
+
+func (c *Strings) invalidTypeError(field string, value interface{}) error {
+	return fmt.Errorf("%v condition attempted to set '%v' -> '%v' and encountered unexpected type '%T', only strings or []strings are allowed", c.name, field, value, value)
+}
+
+func (c *Strings) normalize(s string) string {
+	if c.ignoreCase {
+		return strings.ToLower(s)
+	}
+	return s
+}
+
+// Check determines whether the given event matches this condition.
+func (c *Strings) Check(event ValuesMap) bool {
+	for field, list := range c.fields {
+		value, err := event.GetValue(field)
+		if err != nil {
+			return false
+		}
+
+		var found bool
+		switch v := value.(type) {
+		case []string:
+			found = slices.ContainsFunc(v, func(elem string) bool { return c.matches(list, elem) })
+		case []interface{}:
+			found = slices.ContainsFunc(v, func(elem interface{}) bool { return c.matches(list, elem) })
+		default:
+			found = c.matches(list, value)
+		}
+		if !found {
+			return false
+		}
+	}
+
+	return true
+}
+
+func (c *Strings) matches(list []string, value interface{}) bool {
+	s, err := ExtractString(value)
+	if err != nil {
+		return false
+	}
+	s = c.normalize(s)
+	for _, elem := range list {
+		if c.compare(s, elem) {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *Strings) String() string {
+	return fmt.Sprintf("%v: %v", c.name, c.fields)
+}
+
+func stringEquals(value, s string) bool {
+	return value == s
+}
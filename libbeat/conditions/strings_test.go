@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package conditions
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+func TestStringsCreate(t *testing.T) {
+	for name, config := range map[string]Config{
+		"int":      {StartsWith: map[string]interface{}{"proc.name": 1}},
+		"int list": {EndsWith: map[string]interface{}{"proc.name": []interface{}{"a", 1}}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := NewCondition(&config, logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestStrings(t *testing.T) {
+	tests := map[string]struct {
+		config   Config
+		expected bool
+	}{
+		"starts_with": {
+			config:   Config{StartsWith: map[string]interface{}{"proc.cmdline": "/usr/libexec/"}},
+			expected: true,
+		},
+		"starts_with no match": {
+			config:   Config{StartsWith: map[string]interface{}{"proc.cmdline": "/usr/bin/"}},
+			expected: false,
+		},
+		"starts_with any": {
+			config:   Config{StartsWith: map[string]interface{}{"proc.cmdline": []interface{}{"/usr/bin/", "/usr/libexec/"}}},
+			expected: true,
+		},
+		"starts_with all fields": {
+			config: Config{StartsWith: map[string]interface{}{
+				"proc.cmdline": "/usr/libexec/",
+				"proc.name":    "ssh",
+			}},
+			expected: false,
+		},
+		"starts_with not a string": {
+			config:   Config{StartsWith: map[string]interface{}{"proc.pid": "3"}},
+			expected: false,
+		},
+		"starts_with_ignore_case": {
+			config:   Config{StartsWithIgnoreCase: map[string]interface{}{"proc.cmdline": "/USR/"}},
+			expected: true,
+		},
+		"ends_with": {
+			config:   Config{EndsWith: map[string]interface{}{"proc.cmdline": "/secd"}},
+			expected: true,
+		},
+		"ends_with any element": {
+			config:   Config{EndsWith: map[string]interface{}{"tags": "beat"}},
+			expected: true,
+		},
+		"ends_with any interface element": {
+			config:   Config{EndsWith: map[string]interface{}{"proc.keywords": "ar"}},
+			expected: true,
+		},
+		"ends_with_ignore_case": {
+			config:   Config{EndsWithIgnoreCase: map[string]interface{}{"proc.cmdline": "SECD"}},
+			expected: true,
+		},
+		"equals_ignore_case": {
+			config:   Config{EqualsIgnoreCase: map[string]interface{}{"type": "Process"}},
+			expected: true,
+		},
+		"equals_ignore_case no match": {
+			config:   Config{EqualsIgnoreCase: map[string]interface{}{"type": "Proc"}},
+			expected: false,
+		},
+		"contains_ignore_case": {
+			config:   Config{ContainsIgnoreCase: map[string]interface{}{"proc.cmdline": "LIBEXEC"}},
+			expected: true,
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			testConfig(t, tc.expected, secdTestEvent, &tc.config)
+		})
+	}
+}
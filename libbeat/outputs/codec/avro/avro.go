@@ -0,0 +1,137 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package avro provides an output codec that encodes events as Avro
+// records in the Confluent wire format: a magic byte and the schema ID,
+// followed by the record in the Avro binary encoding.
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+const (
+	// magicByte is the first byte of every message in the Confluent wire
+	// format.
+	magicByte = 0
+
+	metadataKey = "@metadata"
+)
+
+type Encoder struct {
+	values *codec.ValueEncoder
+	schema *schema
+	header []byte
+	writer valueWriter
+
+	unknownFields      string
+	unknownFieldsField string
+}
+
+func init() {
+	codec.RegisterType("avro", func(info beat.Info, cfg *config.C) (codec.Codec, error) {
+		config := defaultConfig()
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		id, definition, err := loadSchema(config)
+		if err != nil {
+			return nil, err
+		}
+		return New(info.Version, id, definition, config)
+	})
+}
+
+// New creates an Avro encoder for the schema with the given ID and
+// definition.
+func New(version string, schemaID int, definition []byte, config Config) (*Encoder, error) {
+	s, err := parseSchema(definition)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse Avro schema: %w", err)
+	}
+	if s.typ != typeRecord {
+		return nil, fmt.Errorf("the Avro schema must be a record, not %v", s.typ)
+	}
+	if config.UnknownFields == unknownFieldsCollect {
+		f := s.field(config.UnknownFieldsField)
+		if f == nil || !matches(f.schema, "", true) {
+			return nil, fmt.Errorf("unknown_fields_field '%v' must be a string field of the schema",
+				config.UnknownFieldsField)
+		}
+	}
+
+	header := make([]byte, 5)
+	header[0] = magicByte
+	binary.BigEndian.PutUint32(header[1:], uint32(schemaID))
+
+	return &Encoder{
+		values:             codec.NewValueEncoder(version, config.LocalTime),
+		schema:             s,
+		header:             header,
+		writer:             valueWriter{failUnknown: config.UnknownFields == unknownFieldsError},
+		unknownFields:      config.UnknownFields,
+		unknownFieldsField: config.UnknownFieldsField,
+	}, nil
+}
+
+func (e *Encoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	value, err := e.values.Encode(index, event)
+	if err != nil {
+		return nil, err
+	}
+
+	var override map[string]interface{}
+	if e.unknownFields == unknownFieldsCollect {
+		if override, err = e.collectUnknown(value); err != nil {
+			return nil, err
+		}
+	}
+
+	e.writer.buf = append(e.writer.buf[:0], e.header...)
+	if err := e.writer.writeRecord(e.schema, value, "", override); err != nil {
+		return nil, err
+	}
+	return e.writer.buf, nil
+}
+
+// collectUnknown returns the top-level event fields that are not in the
+// schema, encoded as a JSON object for the unknown_fields_field.
+func (e *Encoder) collectUnknown(value map[string]interface{}) (map[string]interface{}, error) {
+	unknown := map[string]interface{}{}
+	for key, v := range value {
+		if key != metadataKey && recordField(e.schema, key) == nil {
+			unknown[key] = v
+		}
+	}
+	if len(unknown) == 0 && nullable(e.schema.field(e.unknownFieldsField).schema) {
+		return nil, nil
+	}
+	data, err := json.Marshal(unknown)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode unknown fields: %w", err)
+	}
+	return map[string]interface{}{e.unknownFieldsField: string(data)}, nil
+}
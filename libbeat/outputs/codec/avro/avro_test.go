@@ -0,0 +1,497 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const testSchema = `{
+  "type": "record",
+  "name": "Event",
+  "namespace": "co.elastic.beats",
+  "fields": [
+    {"name": "timestamp", "type": {"type": "long", "logicalType": "timestamp-millis"}},
+    {"name": "message", "type": "string"},
+    {"name": "count", "type": ["null", "int"]},
+    {"name": "ratio", "type": "double", "default": 1.5},
+    {"name": "level", "type": {"type": "enum", "name": "Level", "symbols": ["debug", "info", "error"]}},
+    {"name": "host", "type": {"type": "record", "name": "Host", "fields": [
+      {"name": "name", "type": "string"},
+      {"name": "ip", "type": {"type": "array", "items": "string"}, "default": []}
+    ]}},
+    {"name": "labels", "type": ["null", {"type": "map", "values": "string"}], "default": null},
+    {"name": "extra", "type": ["null", "string"], "default": null}
+  ]
+}`
+
+var testTimestamp = time.Date(2024, 5, 17, 12, 34, 56, 789000000, time.UTC)
+
+func testEvent() *beat.Event {
+	return &beat.Event{
+		Timestamp: testTimestamp,
+		Meta:      mapstr.M{"pipeline": "logs"},
+		Fields: mapstr.M{
+			"message": "hello",
+			"count":   42,
+			"level":   "info",
+			"host":    mapstr.M{"name": "web-1", "ip": []string{"10.0.0.1", "::1"}},
+			"labels":  mapstr.M{"env": "prod"},
+		},
+	}
+}
+
+// decode reads a value of the schema from data, and returns the value and
+// the remaining data.
+func decode(t *testing.T, s *schema, data []byte) (interface{}, []byte) {
+	t.Helper()
+	readLong := func() int64 {
+		v, n := binary.Varint(data)
+		require.Positive(t, n, "invalid varint")
+		data = data[n:]
+		return v
+	}
+
+	switch s.typ {
+	case typeNull:
+		return nil, data
+	case typeBoolean:
+		return data[0] == 1, data[1:]
+	case typeInt, typeLong:
+		v := readLong()
+		return v, data
+	case typeFloat:
+		return float64(math.Float32frombits(binary.LittleEndian.Uint32(data))), data[4:]
+	case typeDouble:
+		return math.Float64frombits(binary.LittleEndian.Uint64(data)), data[8:]
+	case typeString, typeBytes:
+		n := readLong()
+		return string(data[:n]), data[n:]
+	case typeEnum:
+		return s.symbols[readLong()], data
+	case typeArray:
+		arr := []interface{}{}
+		for n := readLong(); n != 0; n = readLong() {
+			for i := int64(0); i < n; i++ {
+				var item interface{}
+				item, data = decode(t, s.items, data)
+				arr = append(arr, item)
+			}
+		}
+		return arr, data
+	case typeMap:
+		m := map[string]interface{}{}
+		for n := readLong(); n != 0; n = readLong() {
+			for i := int64(0); i < n; i++ {
+				l := readLong()
+				key := string(data[:l])
+				data = data[l:]
+				m[key], data = decode(t, s.values, data)
+			}
+		}
+		return m, data
+	case typeRecord:
+		m := map[string]interface{}{}
+		for _, f := range s.fields {
+			m[f.name], data = decode(t, f.schema, data)
+		}
+		return m, data
+	case typeUnion:
+		return decode(t, s.branches[readLong()], data)
+	}
+	t.Fatalf("unsupported type %v", s.typ)
+	return nil, nil
+}
+
+// decodeMessage checks the wire format header and decodes the record.
+func decodeMessage(t *testing.T, enc *Encoder, msg []byte) (int, map[string]interface{}) {
+	t.Helper()
+	require.GreaterOrEqual(t, len(msg), 5)
+	require.Equal(t, byte(magicByte), msg[0])
+	id := int(binary.BigEndian.Uint32(msg[1:5]))
+	v, rest := decode(t, enc.schema, msg[5:])
+	assert.Empty(t, rest)
+	return id, v.(map[string]interface{})
+}
+
+func TestEncode(t *testing.T) {
+	enc, err := New("1.2.3", 42, []byte(testSchema), defaultConfig())
+	require.NoError(t, err)
+
+	msg, err := enc.Encode("test", testEvent())
+	require.NoError(t, err)
+
+	id, record := decodeMessage(t, enc, msg)
+	assert.Equal(t, 42, id)
+	assert.Equal(t, map[string]interface{}{
+		"timestamp": testTimestamp.UnixMilli(),
+		"message":   "hello",
+		"count":     int64(42),
+		"ratio":     1.5,
+		"level":     "info",
+		"host": map[string]interface{}{
+			"name": "web-1",
+			"ip":   []interface{}{"10.0.0.1", "::1"},
+		},
+		"labels": map[string]interface{}{"env": "prod"},
+		"extra":  nil,
+	}, record)
+}
+
+func TestEncodeErrors(t *testing.T) {
+	tests := map[string]struct {
+		fields  mapstr.M
+		wantErr string
+	}{
+		"missing required field": {
+			fields:  mapstr.M{"level": "info", "host": mapstr.M{"name": "a"}},
+			wantErr: "field 'message': required field is missing",
+		},
+		"wrong type": {
+			fields:  mapstr.M{"message": 1, "level": "info", "host": mapstr.M{"name": "a"}},
+			wantErr: "field 'message': can't encode int64 as string",
+		},
+		"int out of range": {
+			fields:  mapstr.M{"message": "a", "count": int64(math.MaxInt64), "level": "info", "host": mapstr.M{"name": "a"}},
+			wantErr: "field 'count': int64 doesn't match any type of the union",
+		},
+		"unknown enum symbol": {
+			fields:  mapstr.M{"message": "a", "level": "warn", "host": mapstr.M{"name": "a"}},
+			wantErr: "field 'level': 'warn' is not a symbol of enum 'co.elastic.beats.Level'",
+		},
+		"nested": {
+			fields:  mapstr.M{"message": "a", "level": "info", "host": mapstr.M{"name": true}},
+			wantErr: "field 'host.name': can't encode bool as string",
+		},
+	}
+
+	enc, err := New("1.2.3", 1, []byte(testSchema), defaultConfig())
+	require.NoError(t, err)
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := enc.Encode("test", &beat.Event{Timestamp: testTimestamp, Fields: test.fields})
+			assert.EqualError(t, err, test.wantErr)
+		})
+	}
+}
+
+func TestAsInt(t *testing.T) {
+	tests := map[string]struct {
+		value interface{}
+		want  int64
+		ok    bool
+	}{
+		"max uint64 in range":  {value: uint64(math.MaxInt64), want: math.MaxInt64, ok: true},
+		"uint64 out of range":  {value: uint64(1 << 63), ok: false},
+		"uint out of range":    {value: uint(1 << 63), ok: false},
+		"float64 out of range": {value: float64(1 << 63), ok: false},
+		"float64 in range":     {value: float64(-1 << 63), want: math.MinInt64, ok: true},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := asInt(test.value)
+			assert.Equal(t, test.ok, ok)
+			if test.ok {
+				assert.Equal(t, test.want, got)
+			}
+		})
+	}
+}
+
+func TestUnknownFields(t *testing.T) {
+	event := testEvent()
+	event.Fields["user"] = mapstr.M{"name": "alice"}
+	event.Fields.Put("host.os", "linux")
+
+	tests := map[string]struct {
+		unknownFields string
+		field         string
+		wantErr       string
+		wantExtra     interface{}
+	}{
+		"ignore": {
+			unknownFields: unknownFieldsIgnore,
+		},
+		"error": {
+			unknownFields: unknownFieldsError,
+			wantErr:       "field 'user': field is not in the schema",
+		},
+		"collect": {
+			unknownFields: unknownFieldsCollect,
+			field:         "extra",
+			// Only top-level fields are collected.
+			wantExtra: `{"user":{"name":"alice"}}`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			cfg.UnknownFields = test.unknownFields
+			cfg.UnknownFieldsField = test.field
+			enc, err := New("1.2.3", 1, []byte(testSchema), cfg)
+			require.NoError(t, err)
+
+			msg, err := enc.Encode("test", event)
+			if test.wantErr != "" {
+				assert.EqualError(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			_, record := decodeMessage(t, enc, msg)
+			assert.Equal(t, test.wantExtra, record["extra"])
+		})
+	}
+
+	t.Run("collect requires a string field", func(t *testing.T) {
+		cfg := defaultConfig()
+		cfg.UnknownFields = unknownFieldsCollect
+		cfg.UnknownFieldsField = "count"
+		_, err := New("1.2.3", 1, []byte(testSchema), cfg)
+		assert.ErrorContains(t, err, "must be a string field")
+	})
+}
+
+func TestParseSchema(t *testing.T) {
+	tests := map[string]struct {
+		schema  string
+		wantErr string
+	}{
+		"recursive": {
+			schema: `{"type": "record", "name": "Node", "fields": [
+				{"name": "value", "type": "string"},
+				{"name": "children", "type": {"type": "array", "items": "Node"}}
+			]}`,
+		},
+		"namespaced reference": {
+			schema: `{"type": "record", "name": "a.Outer", "fields": [
+				{"name": "inner", "type": {"type": "fixed", "name": "Inner", "size": 4}},
+				{"name": "again", "type": "a.Inner"}
+			]}`,
+		},
+		"unknown type": {
+			schema:  `{"type": "record", "name": "R", "fields": [{"name": "f", "type": "Missing"}]}`,
+			wantErr: "record 'R': field 'f': unknown type 'Missing'",
+		},
+		"nested union": {
+			schema:  `["null", ["string"]]`,
+			wantErr: "unions can't contain other unions",
+		},
+		"duplicate name": {
+			schema: `{"type": "record", "name": "R", "fields": [
+				{"name": "a", "type": {"type": "enum", "name": "E", "symbols": ["x"]}},
+				{"name": "b", "type": {"type": "enum", "name": "E", "symbols": ["y"]}}
+			]}`,
+			wantErr: "record 'R': field 'b': type 'E' is defined more than once",
+		},
+		"invalid json": {
+			schema:  `{"type":`,
+			wantErr: "invalid schema JSON",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := parseSchema([]byte(test.schema))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
+
+// registryStub serves a single schema like a Confluent schema registry.
+type registryStub struct {
+	t          *testing.T
+	id         int
+	schema     string
+	registered []string
+}
+
+func (r *registryStub) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	user, pass, _ := req.BasicAuth()
+	if user != "beats" || pass != "secret" {
+		w.WriteHeader(http.StatusUnauthorized)
+		_, _ = w.Write([]byte(`{"error_code":401,"message":"Unauthorized"}`))
+		return
+	}
+
+	w.Header().Set("Content-Type", registryContentType)
+	switch {
+	case req.Method == http.MethodGet && req.URL.Path == "/subjects/beats-value/versions/latest",
+		req.Method == http.MethodGet && req.URL.Path == "/subjects/beats-value/versions/3":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{
+			"subject": "beats-value", "version": 3, "id": r.id, "schema": r.schema,
+		})
+	case req.Method == http.MethodGet && req.URL.Path == "/schemas/ids/7":
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"schema": r.schema})
+	case req.Method == http.MethodPost && req.URL.Path == "/subjects/beats-value/versions":
+		assert.Equal(r.t, registryContentType, req.Header.Get("Content-Type"))
+		var body registrySchema
+		data, _ := io.ReadAll(req.Body)
+		assert.NoError(r.t, json.Unmarshal(data, &body))
+		r.registered = append(r.registered, body.Schema)
+		_ = json.NewEncoder(w).Encode(map[string]interface{}{"id": r.id})
+	default:
+		w.WriteHeader(http.StatusNotFound)
+		_, _ = w.Write([]byte(`{"error_code":40401,"message":"Subject not found."}`))
+	}
+}
+
+func TestRegistry(t *testing.T) {
+	stub := &registryStub{t: t, id: 7, schema: testSchema}
+	server := httptest.NewServer(stub)
+	defer server.Close()
+
+	schemaFile := filepath.Join(t.TempDir(), "event.avsc")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(testSchema), 0o600))
+
+	tests := map[string]struct {
+		config       map[string]interface{}
+		wantErr      string
+		wantRegister bool
+	}{
+		"latest version of subject": {
+			config: map[string]interface{}{"registry.subject": "beats-value"},
+		},
+		"fixed version of subject": {
+			config: map[string]interface{}{"registry.subject": "beats-value", "registry.version": "3"},
+		},
+		"schema by id": {
+			config: map[string]interface{}{"schema.id": 7},
+		},
+		"register schema file": {
+			config:       map[string]interface{}{"schema.file": schemaFile, "registry.subject": "beats-value"},
+			wantRegister: true,
+		},
+		"unknown subject": {
+			config:  map[string]interface{}{"registry.subject": "other"},
+			wantErr: "failed to get version latest of subject 'other'",
+		},
+		"wrong credentials": {
+			config:  map[string]interface{}{"registry.subject": "beats-value", "registry.password": "wrong"},
+			wantErr: "failed with status 401",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			stub.registered = nil
+			cfg := config.MustNewConfigFrom(map[string]interface{}{
+				"registry.url":      server.URL,
+				"registry.username": "beats",
+				"registry.password": "secret",
+			})
+			require.NoError(t, cfg.Merge(test.config))
+
+			enc, err := codec.CreateEncoder(beat.Info{Version: "1.2.3"}, codec.Config{
+				Namespace: namespace(t, "avro", cfg),
+			})
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+
+			msg, err := enc.Encode("test", testEvent())
+			require.NoError(t, err)
+			id, record := decodeMessage(t, enc.(*Encoder), msg)
+			assert.Equal(t, 7, id)
+			assert.Equal(t, "hello", record["message"])
+
+			if test.wantRegister {
+				assert.Equal(t, []string{testSchema}, stub.registered)
+			} else {
+				assert.Empty(t, stub.registered)
+			}
+		})
+	}
+}
+
+func namespace(t *testing.T, name string, cfg *config.C) config.Namespace {
+	t.Helper()
+	var ns config.Namespace
+	require.NoError(t, config.MustNewConfigFrom(map[string]interface{}{name: cfg}).Unpack(&ns))
+	return ns
+}
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		input   map[string]interface{}
+		wantErr string
+	}{
+		"schema file with id": {
+			input: map[string]interface{}{"schema.file": "event.avsc", "schema.id": 1},
+		},
+		"registry subject": {
+			input: map[string]interface{}{"registry.url": "http://localhost:8081", "registry.subject": "s"},
+		},
+		"no schema": {
+			input:   map[string]interface{}{},
+			wantErr: "either schema.file or registry.url must be set",
+		},
+		"schema file without id": {
+			input:   map[string]interface{}{"schema.file": "event.avsc"},
+			wantErr: "requires schema.id",
+		},
+		"registry without subject": {
+			input:   map[string]interface{}{"registry.url": "http://localhost:8081"},
+			wantErr: "registry.subject or schema.id must be set",
+		},
+		"collect without field": {
+			input:   map[string]interface{}{"schema.file": "event.avsc", "schema.id": 1, "unknown_fields": "collect"},
+			wantErr: "requires unknown_fields_field",
+		},
+		"invalid unknown_fields": {
+			input:   map[string]interface{}{"schema.file": "event.avsc", "schema.id": 1, "unknown_fields": "keep"},
+			wantErr: "unsupported unknown_fields 'keep'",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := defaultConfig()
+			err := config.MustNewConfigFrom(test.input).Unpack(&cfg)
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			assert.NoError(t, err)
+		})
+	}
+}
@@ -0,0 +1,106 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	// unknownFieldsIgnore drops event fields that are not in the schema.
+	unknownFieldsIgnore = "ignore"
+	// unknownFieldsError fails encoding of events with fields that are not
+	// in the schema.
+	unknownFieldsError = "error"
+	// unknownFieldsCollect stores top-level event fields that are not in
+	// the schema as a JSON object in a string field of the schema.
+	unknownFieldsCollect = "collect"
+)
+
+type Config struct {
+	Schema   schemaConfig   `config:"schema"`
+	Registry registryConfig `config:"registry"`
+
+	UnknownFields      string `config:"unknown_fields"`
+	UnknownFieldsField string `config:"unknown_fields_field"`
+
+	LocalTime bool `config:"local_time"`
+}
+
+type schemaConfig struct {
+	// File is the path of a file containing the schema.
+	File string `config:"file"`
+	// ID is the schema ID written in front of every message. It is
+	// required if the schema is read from a file and is not registered in
+	// a schema registry.
+	ID int `config:"id" validate:"min=0"`
+}
+
+type registryConfig struct {
+	URL      string `config:"url"`
+	Subject  string `config:"subject"`
+	Version  string `config:"version"`
+	Username string `config:"username"`
+	Password string `config:"password"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+func defaultConfig() Config {
+	transport := httpcommon.DefaultHTTPTransportSettings()
+	transport.Timeout = 10 * time.Second
+	return Config{
+		Registry: registryConfig{
+			Version:   "latest",
+			Transport: transport,
+		},
+		UnknownFields: unknownFieldsIgnore,
+	}
+}
+
+func (c *Config) Validate() error {
+	switch c.UnknownFields {
+	case unknownFieldsIgnore, unknownFieldsError:
+		if c.UnknownFieldsField != "" {
+			return fmt.Errorf("unknown_fields_field requires unknown_fields: %v", unknownFieldsCollect)
+		}
+	case unknownFieldsCollect:
+		if c.UnknownFieldsField == "" {
+			return fmt.Errorf("unknown_fields: %v requires unknown_fields_field", unknownFieldsCollect)
+		}
+	default:
+		return fmt.Errorf("unsupported unknown_fields '%v', must be one of %v, %v or %v",
+			c.UnknownFields, unknownFieldsIgnore, unknownFieldsError, unknownFieldsCollect)
+	}
+
+	hasRegistry := c.Registry.URL != ""
+	switch {
+	case c.Schema.File == "" && !hasRegistry:
+		return errors.New("either schema.file or registry.url must be set")
+	case c.Schema.ID != 0:
+	case !hasRegistry:
+		return errors.New("a schema read from a file requires schema.id, or registry.subject to register the schema")
+	case c.Registry.Subject == "":
+		return errors.New("registry.subject or schema.id must be set to select the schema")
+	}
+	return nil
+}
@@ -0,0 +1,387 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"time"
+)
+
+// valueWriter writes values in the Avro binary encoding. Values are the
+// plain values created by codec.ValueEncoder, or values decoded from the
+// JSON defaults of the schema.
+type valueWriter struct {
+	buf []byte
+
+	// failUnknown makes writing records fail if the value has fields that
+	// are not in the schema.
+	failUnknown bool
+}
+
+// writeError is returned for values that don't match the schema. path
+// is the dotted path of the value in the event.
+type writeError struct {
+	path string
+	msg  string
+}
+
+func (e *writeError) Error() string {
+	if e.path == "" {
+		return e.msg
+	}
+	return fmt.Sprintf("field '%v': %v", e.path, e.msg)
+}
+
+func mismatch(path string, s *schema, v interface{}) error {
+	return &writeError{path: path, msg: fmt.Sprintf("can't encode %T as %v", v, s.typ)}
+}
+
+func (w *valueWriter) write(s *schema, v interface{}, path string) error {
+	switch s.typ {
+	case typeNull:
+		if v != nil {
+			return mismatch(path, s, v)
+		}
+		return nil
+	case typeBoolean:
+		b, ok := v.(bool)
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		if b {
+			w.buf = append(w.buf, 1)
+		} else {
+			w.buf = append(w.buf, 0)
+		}
+		return nil
+	case typeInt:
+		i, ok := asInt(v)
+		if !ok || i < math.MinInt32 || i > math.MaxInt32 {
+			return mismatch(path, s, v)
+		}
+		w.writeLong(i)
+		return nil
+	case typeLong:
+		i, ok := asLong(s, v)
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		w.writeLong(i)
+		return nil
+	case typeFloat:
+		f, ok := asFloat(v)
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		w.buf = binary.LittleEndian.AppendUint32(w.buf, math.Float32bits(float32(f)))
+		return nil
+	case typeDouble:
+		f, ok := asFloat(v)
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(f))
+		return nil
+	case typeBytes, typeString:
+		b, ok := asBytes(v)
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		w.writeLong(int64(len(b)))
+		w.buf = append(w.buf, b...)
+		return nil
+	case typeFixed:
+		b, ok := asBytes(v)
+		if !ok || len(b) != s.size {
+			return mismatch(path, s, v)
+		}
+		w.buf = append(w.buf, b...)
+		return nil
+	case typeEnum:
+		idx := enumIndex(s, v)
+		if idx < 0 {
+			return &writeError{path: path, msg: fmt.Sprintf("'%v' is not a symbol of enum '%v'", v, s.name)}
+		}
+		w.writeLong(int64(idx))
+		return nil
+	case typeArray:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		if len(arr) > 0 {
+			w.writeLong(int64(len(arr)))
+			for _, item := range arr {
+				if err := w.write(s.items, item, path); err != nil {
+					return err
+				}
+			}
+		}
+		w.writeLong(0)
+		return nil
+	case typeMap:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		if len(m) > 0 {
+			w.writeLong(int64(len(m)))
+			for key, value := range m {
+				w.writeLong(int64(len(key)))
+				w.buf = append(w.buf, key...)
+				if err := w.write(s.values, value, joinPath(path, key)); err != nil {
+					return err
+				}
+			}
+		}
+		w.writeLong(0)
+		return nil
+	case typeRecord:
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return mismatch(path, s, v)
+		}
+		return w.writeRecord(s, m, path, nil)
+	case typeUnion:
+		// Prefer branches that match the type of the value, before
+		// converting integral floats, for example from defaults, to ints.
+		for _, strict := range []bool{true, false} {
+			for i, branch := range s.branches {
+				if matches(branch, v, strict) {
+					w.writeLong(int64(i))
+					return w.write(branch, v, path)
+				}
+			}
+		}
+		return &writeError{path: path, msg: fmt.Sprintf("%T doesn't match any type of the union", v)}
+	default:
+		return &writeError{path: path, msg: fmt.Sprintf("unsupported type '%v'", s.typ)}
+	}
+}
+
+// writeRecord writes the fields of a record. Event fields are matched by
+// name, or by their name without a leading `@`, as Avro names can't
+// contain `@`. Fields that are missing in the event get their default
+// value, or null if they are nullable. If override is set, it contains
+// values that replace the ones in the event.
+func (w *valueWriter) writeRecord(s *schema, m map[string]interface{}, path string, override map[string]interface{}) error {
+	if w.failUnknown {
+		for key := range m {
+			if recordField(s, key) == nil && !(path == "" && key == metadataKey) {
+				return &writeError{path: joinPath(path, key), msg: "field is not in the schema"}
+			}
+		}
+	}
+
+	for i := range s.fields {
+		f := &s.fields[i]
+		fieldPath := joinPath(path, f.name)
+		v, ok := override[f.name]
+		if !ok {
+			v, ok = m[f.name]
+		}
+		if !ok {
+			v, ok = m["@"+f.name]
+		}
+		if !ok {
+			switch {
+			case f.hasDefault:
+				v = f.def
+			case nullable(f.schema):
+				v = nil
+			default:
+				return &writeError{path: fieldPath, msg: "required field is missing"}
+			}
+		}
+		if err := w.write(f.schema, v, fieldPath); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// writeLong writes a zig-zag encoded variable length integer.
+func (w *valueWriter) writeLong(i int64) {
+	w.buf = binary.AppendVarint(w.buf, i)
+}
+
+// recordField returns the schema field for an event field.
+func recordField(s *schema, key string) *schemaField {
+	if f := s.field(key); f != nil {
+		return f
+	}
+	if len(key) > 1 && key[0] == '@' {
+		return s.field(key[1:])
+	}
+	return nil
+}
+
+// matches reports whether v can be written with schema s. It is used to
+// select the branch of a union. If strict is set, floats don't match
+// integer types.
+func matches(s *schema, v interface{}, strict bool) bool {
+	if _, isFloat := v.(float64); isFloat && strict && (s.typ == typeInt || s.typ == typeLong) {
+		return false
+	}
+	switch s.typ {
+	case typeNull:
+		return v == nil
+	case typeBoolean:
+		_, ok := v.(bool)
+		return ok
+	case typeInt:
+		i, ok := asInt(v)
+		return ok && i >= math.MinInt32 && i <= math.MaxInt32
+	case typeLong:
+		_, ok := asLong(s, v)
+		return ok
+	case typeFloat, typeDouble:
+		_, ok := asFloat(v)
+		return ok
+	case typeBytes, typeString:
+		_, ok := asBytes(v)
+		return ok
+	case typeFixed:
+		b, ok := asBytes(v)
+		return ok && len(b) == s.size
+	case typeEnum:
+		return enumIndex(s, v) >= 0
+	case typeArray:
+		_, ok := v.([]interface{})
+		return ok
+	case typeMap, typeRecord:
+		_, ok := v.(map[string]interface{})
+		return ok
+	case typeUnion:
+		for _, branch := range s.branches {
+			if matches(branch, v, strict) {
+				return true
+			}
+		}
+		return false
+	default:
+		return false
+	}
+}
+
+func nullable(s *schema) bool {
+	if s.typ == typeNull {
+		return true
+	}
+	for _, b := range s.branches {
+		if b.typ == typeNull {
+			return true
+		}
+	}
+	return false
+}
+
+func asInt(v interface{}) (int64, bool) {
+	switch v := v.(type) {
+	case int:
+		return int64(v), true
+	case int8:
+		return int64(v), true
+	case int16:
+		return int64(v), true
+	case int32:
+		return int64(v), true
+	case int64:
+		return v, true
+	case uint:
+		return int64(v), uint64(v) < 1<<63
+	case uint8:
+		return int64(v), true
+	case uint16:
+		return int64(v), true
+	case uint32:
+		return int64(v), true
+	case uint64:
+		return int64(v), v < 1<<63
+	case float64:
+		// Defaults in the schema are decoded as float64.
+		return int64(v), v == math.Trunc(v) && v >= math.MinInt64 && v < 1<<63
+	default:
+		return 0, false
+	}
+}
+
+// asLong converts v to a long. Timestamps, which are formatted as strings
+// by the json codec, are converted for the timestamp logical types.
+func asLong(s *schema, v interface{}) (int64, bool) {
+	if str, ok := v.(string); ok {
+		if s.logical != logicalTimestampMillis && s.logical != logicalTimestampMicros {
+			return 0, false
+		}
+		t, err := time.Parse(time.RFC3339Nano, str)
+		if err != nil {
+			return 0, false
+		}
+		if s.logical == logicalTimestampMillis {
+			return t.UnixMilli(), true
+		}
+		return t.UnixMicro(), true
+	}
+	return asInt(v)
+}
+
+func asFloat(v interface{}) (float64, bool) {
+	switch v := v.(type) {
+	case float32:
+		return float64(v), true
+	case float64:
+		return v, true
+	}
+	if i, ok := asInt(v); ok {
+		return float64(i), true
+	}
+	return 0, false
+}
+
+func asBytes(v interface{}) ([]byte, bool) {
+	switch v := v.(type) {
+	case string:
+		return []byte(v), true
+	case []byte:
+		return v, true
+	default:
+		return nil, false
+	}
+}
+
+func enumIndex(s *schema, v interface{}) int {
+	str, ok := v.(string)
+	if !ok {
+		return -1
+	}
+	for i, sym := range s.symbols {
+		if sym == str {
+			return i
+		}
+	}
+	return -1
+}
+
+func joinPath(path, key string) string {
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
@@ -0,0 +1,166 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+)
+
+const registryContentType = "application/vnd.schemaregistry.v1+json"
+
+// registryClient talks to a schema registry that implements the
+// Confluent Schema Registry API.
+type registryClient struct {
+	url      string
+	username string
+	password string
+	http     *http.Client
+}
+
+type registrySchema struct {
+	ID     int    `json:"id"`
+	Schema string `json:"schema"`
+}
+
+func newRegistryClient(cfg registryConfig) (*registryClient, error) {
+	client, err := cfg.Transport.Client()
+	if err != nil {
+		return nil, err
+	}
+	return &registryClient{
+		url:      strings.TrimSuffix(cfg.URL, "/"),
+		username: cfg.Username,
+		password: cfg.Password,
+		http:     client,
+	}, nil
+}
+
+// schemaByID returns the schema with the given ID.
+func (c *registryClient) schemaByID(id int) (string, error) {
+	var resp registrySchema
+	if err := c.do(http.MethodGet, fmt.Sprintf("/schemas/ids/%d", id), nil, &resp); err != nil {
+		return "", err
+	}
+	return resp.Schema, nil
+}
+
+// schemaBySubject returns the ID and schema of a version of a subject.
+func (c *registryClient) schemaBySubject(subject, version string) (int, string, error) {
+	var resp registrySchema
+	path := fmt.Sprintf("/subjects/%s/versions/%s", url.PathEscape(subject), url.PathEscape(version))
+	if err := c.do(http.MethodGet, path, nil, &resp); err != nil {
+		return 0, "", err
+	}
+	return resp.ID, resp.Schema, nil
+}
+
+// register registers the schema for a subject and returns its ID. The
+// registry returns the existing ID if the schema is already registered.
+func (c *registryClient) register(subject, schema string) (int, error) {
+	body, err := json.Marshal(registrySchema{Schema: schema})
+	if err != nil {
+		return 0, err
+	}
+	var resp registrySchema
+	path := fmt.Sprintf("/subjects/%s/versions", url.PathEscape(subject))
+	if err := c.do(http.MethodPost, path, body, &resp); err != nil {
+		return 0, err
+	}
+	return resp.ID, nil
+}
+
+func (c *registryClient) do(method, path string, body []byte, result interface{}) error {
+	req, err := http.NewRequest(method, c.url+path, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", registryContentType)
+	if body != nil {
+		req.Header.Set("Content-Type", registryContentType)
+	}
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("schema registry request failed: %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return fmt.Errorf("failed to read schema registry response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("schema registry request %v %v failed with status %v: %s",
+			method, path, resp.StatusCode, bytes.TrimSpace(data))
+	}
+	if err := json.Unmarshal(data, result); err != nil {
+		return fmt.Errorf("invalid schema registry response: %w", err)
+	}
+	return nil
+}
+
+// loadSchema returns the ID and definition of the configured schema.
+func loadSchema(cfg Config) (int, []byte, error) {
+	var registry *registryClient
+	if cfg.Registry.URL != "" {
+		var err error
+		if registry, err = newRegistryClient(cfg.Registry); err != nil {
+			return 0, nil, err
+		}
+	}
+
+	if cfg.Schema.File != "" {
+		definition, err := os.ReadFile(cfg.Schema.File)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to read schema file: %w", err)
+		}
+		if cfg.Schema.ID != 0 {
+			return cfg.Schema.ID, definition, nil
+		}
+		id, err := registry.register(cfg.Registry.Subject, string(definition))
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to register schema for subject '%v': %w", cfg.Registry.Subject, err)
+		}
+		return id, definition, nil
+	}
+
+	if cfg.Schema.ID != 0 {
+		definition, err := registry.schemaByID(cfg.Schema.ID)
+		if err != nil {
+			return 0, nil, fmt.Errorf("failed to get schema %v: %w", cfg.Schema.ID, err)
+		}
+		return cfg.Schema.ID, []byte(definition), nil
+	}
+
+	id, definition, err := registry.schemaBySubject(cfg.Registry.Subject, cfg.Registry.Version)
+	if err != nil {
+		return 0, nil, fmt.Errorf("failed to get version %v of subject '%v': %w",
+			cfg.Registry.Version, cfg.Registry.Subject, err)
+	}
+	return id, []byte(definition), nil
+}
@@ -0,0 +1,265 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package avro
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Avro schema types, see https://avro.apache.org/docs/1.11.1/specification/
+const (
+	typeNull    = "null"
+	typeBoolean = "boolean"
+	typeInt     = "int"
+	typeLong    = "long"
+	typeFloat   = "float"
+	typeDouble  = "double"
+	typeBytes   = "bytes"
+	typeString  = "string"
+	typeRecord  = "record"
+	typeError   = "error"
+	typeEnum    = "enum"
+	typeArray   = "array"
+	typeMap     = "map"
+	typeFixed   = "fixed"
+	typeUnion   = "union"
+)
+
+const (
+	logicalTimestampMillis = "timestamp-millis"
+	logicalTimestampMicros = "timestamp-micros"
+)
+
+// schema is a parsed Avro schema. Named types that are referenced more
+// than once share the same schema value.
+type schema struct {
+	typ     string
+	name    string
+	logical string
+
+	fields   []schemaField // record
+	symbols  []string      // enum
+	items    *schema       // array
+	values   *schema       // map
+	size     int           // fixed
+	branches []*schema     // union
+}
+
+type schemaField struct {
+	name       string
+	schema     *schema
+	def        interface{}
+	hasDefault bool
+}
+
+// field returns the record field with the given name.
+func (s *schema) field(name string) *schemaField {
+	for i := range s.fields {
+		if s.fields[i].name == name {
+			return &s.fields[i]
+		}
+	}
+	return nil
+}
+
+// parseSchema parses an Avro schema in its JSON representation.
+func parseSchema(data []byte) (*schema, error) {
+	var raw interface{}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("invalid schema JSON: %w", err)
+	}
+	p := schemaParser{named: map[string]*schema{}}
+	return p.parse(raw, "")
+}
+
+type schemaParser struct {
+	named map[string]*schema
+}
+
+func (p *schemaParser) parse(raw interface{}, namespace string) (*schema, error) {
+	switch raw := raw.(type) {
+	case string:
+		return p.parseName(raw, namespace)
+	case []interface{}:
+		return p.parseUnion(raw, namespace)
+	case map[string]interface{}:
+		return p.parseObject(raw, namespace)
+	default:
+		return nil, fmt.Errorf("invalid schema %v", raw)
+	}
+}
+
+func (p *schemaParser) parseName(name, namespace string) (*schema, error) {
+	switch name {
+	case typeNull, typeBoolean, typeInt, typeLong, typeFloat, typeDouble, typeBytes, typeString:
+		return &schema{typ: name}, nil
+	}
+	if s, ok := p.named[fullName(name, namespace)]; ok {
+		return s, nil
+	}
+	if s, ok := p.named[name]; ok {
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown type '%v'", name)
+}
+
+func (p *schemaParser) parseUnion(raw []interface{}, namespace string) (*schema, error) {
+	s := &schema{typ: typeUnion}
+	for _, b := range raw {
+		branch, err := p.parse(b, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if branch.typ == typeUnion {
+			return nil, errors.New("unions can't contain other unions")
+		}
+		s.branches = append(s.branches, branch)
+	}
+	if len(s.branches) == 0 {
+		return nil, errors.New("unions must have at least one branch")
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseObject(raw map[string]interface{}, namespace string) (*schema, error) {
+	typ, ok := raw["type"].(string)
+	if !ok {
+		// The type of a field can be a complete schema.
+		if nested, ok := raw["type"]; ok {
+			return p.parse(nested, namespace)
+		}
+		return nil, errors.New("schema is missing a type")
+	}
+
+	switch typ {
+	case typeRecord, typeError, typeEnum, typeFixed:
+		return p.parseNamed(typ, raw, namespace)
+	case typeArray:
+		items, err := p.parse(raw["items"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("array items: %w", err)
+		}
+		return &schema{typ: typeArray, items: items}, nil
+	case typeMap:
+		values, err := p.parse(raw["values"], namespace)
+		if err != nil {
+			return nil, fmt.Errorf("map values: %w", err)
+		}
+		return &schema{typ: typeMap, values: values}, nil
+	default:
+		s, err := p.parseName(typ, namespace)
+		if err != nil {
+			return nil, err
+		}
+		if logical, ok := raw["logicalType"].(string); ok && s.typ == typeLong {
+			s = &schema{typ: s.typ, logical: logical}
+		}
+		return s, nil
+	}
+}
+
+func (p *schemaParser) parseNamed(typ string, raw map[string]interface{}, namespace string) (*schema, error) {
+	name, _ := raw["name"].(string)
+	if name == "" {
+		return nil, fmt.Errorf("%v is missing a name", typ)
+	}
+	if ns, ok := raw["namespace"].(string); ok {
+		namespace = ns
+	}
+	name = fullName(name, namespace)
+	if _, exists := p.named[name]; exists {
+		return nil, fmt.Errorf("type '%v' is defined more than once", name)
+	}
+	// Names in nested types are relative to the namespace of the type.
+	if i := strings.LastIndexByte(name, '.'); i >= 0 {
+		namespace = name[:i]
+	}
+
+	s := &schema{typ: typ, name: name}
+	if typ == typeError {
+		s.typ = typeRecord
+	}
+	// Register the type before parsing its fields, so recursive types can
+	// reference it.
+	p.named[name] = s
+
+	switch s.typ {
+	case typeRecord:
+		fields, ok := raw["fields"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("record '%v' is missing its fields", name)
+		}
+		for _, f := range fields {
+			field, err := p.parseField(f, namespace)
+			if err != nil {
+				return nil, fmt.Errorf("record '%v': %w", name, err)
+			}
+			s.fields = append(s.fields, field)
+		}
+	case typeEnum:
+		symbols, ok := raw["symbols"].([]interface{})
+		if !ok {
+			return nil, fmt.Errorf("enum '%v' is missing its symbols", name)
+		}
+		for _, sym := range symbols {
+			str, ok := sym.(string)
+			if !ok {
+				return nil, fmt.Errorf("enum '%v' has an invalid symbol %v", name, sym)
+			}
+			s.symbols = append(s.symbols, str)
+		}
+	case typeFixed:
+		size, ok := raw["size"].(float64)
+		if !ok || size < 0 {
+			return nil, fmt.Errorf("fixed '%v' has an invalid size", name)
+		}
+		s.size = int(size)
+	}
+	return s, nil
+}
+
+func (p *schemaParser) parseField(raw interface{}, namespace string) (schemaField, error) {
+	obj, ok := raw.(map[string]interface{})
+	if !ok {
+		return schemaField{}, fmt.Errorf("invalid field %v", raw)
+	}
+	name, _ := obj["name"].(string)
+	if name == "" {
+		return schemaField{}, errors.New("field is missing a name")
+	}
+	typ, ok := obj["type"]
+	if !ok {
+		return schemaField{}, fmt.Errorf("field '%v' is missing a type", name)
+	}
+	s, err := p.parse(typ, namespace)
+	if err != nil {
+		return schemaField{}, fmt.Errorf("field '%v': %w", name, err)
+	}
+	def, hasDefault := obj["default"]
+	return schemaField{name: name, schema: s, def: def, hasDefault: hasDefault}, nil
+}
+
+func fullName(name, namespace string) string {
+	if namespace == "" || strings.ContainsRune(name, '.') {
+		return name
+	}
+	return namespace + "." + name
+}
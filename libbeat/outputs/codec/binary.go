@@ -0,0 +1,81 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package codec
+
+import (
+	ugorjicodec "github.com/ugorji/go/codec"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// BinaryConfig is the configuration of the binary codecs, like cbor and msgpack.
+type BinaryConfig struct {
+	// Canonical sorts the keys of all maps, so the same event is always
+	// encoded to the same bytes.
+	Canonical bool `config:"canonical"`
+	// LocalTime formats the timestamp in the local timezone instead of UTC.
+	LocalTime bool `config:"local_time"`
+}
+
+// BinaryEncoder encodes events with a ValueEncoder, and serializes the
+// values with a github.com/ugorji/go/codec handle.
+type BinaryEncoder struct {
+	values  *ValueEncoder
+	encoder *ugorjicodec.Encoder
+	buf     []byte
+}
+
+// RegisterBinaryType registers a codec that is configured with a
+// BinaryConfig.
+func RegisterBinaryType(name string, gen func(version string, config BinaryConfig) Codec) {
+	RegisterType(name, func(info beat.Info, cfg *config.C) (Codec, error) {
+		var config BinaryConfig
+		if cfg != nil {
+			if err := cfg.Unpack(&config); err != nil {
+				return nil, err
+			}
+		}
+
+		return gen(info.Version, config), nil
+	})
+}
+
+// NewBinaryEncoder creates a BinaryEncoder that serializes events with
+// the given handle. Settings of the configuration that apply to the
+// serialization, like Canonical, must already be set in the handle.
+func NewBinaryEncoder(version string, config BinaryConfig, handle ugorjicodec.Handle) *BinaryEncoder {
+	e := &BinaryEncoder{values: NewValueEncoder(version, config.LocalTime)}
+	e.encoder = ugorjicodec.NewEncoderBytes(&e.buf, handle)
+	return e
+}
+
+// Encode serializes a beat event. The returned buffer is reused by the
+// next call.
+func (e *BinaryEncoder) Encode(index string, event *beat.Event) ([]byte, error) {
+	value, err := e.values.Encode(index, event)
+	if err != nil {
+		return nil, err
+	}
+
+	e.encoder.ResetBytes(&e.buf)
+	if err := e.encoder.Encode(value); err != nil {
+		return nil, err
+	}
+	return e.buf, nil
+}
@@ -0,0 +1,45 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package codec
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestRegisterBinaryType(t *testing.T) {
+	var got BinaryConfig
+	RegisterBinaryType("binary_test", func(_ string, config BinaryConfig) Codec {
+		got = config
+		return nil
+	})
+	t.Cleanup(func() { delete(codecs, "binary_test") })
+
+	var cfg Config
+	require.NoError(t, config.MustNewConfigFrom(map[string]interface{}{
+		"binary_test": map[string]interface{}{"canonical": true, "local_time": true},
+	}).Unpack(&cfg))
+	_, err := CreateEncoder(beat.Info{}, cfg)
+	require.NoError(t, err)
+	assert.Equal(t, BinaryConfig{Canonical: true, LocalTime: true}, got)
+}
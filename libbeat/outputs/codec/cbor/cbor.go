@@ -0,0 +1,42 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+// Package cbor provides an output codec that encodes events as CBOR
+// (RFC 8949) documents, with the same structure as the json codec.
+package cbor
+
+import (
+	ugorjicodec "github.com/ugorji/go/codec"
+
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+)
+
+// Config is used to pass encoding parameters to New.
+type Config = codec.BinaryConfig
+
+func init() {
+	codec.RegisterBinaryType("cbor", func(version string, config Config) codec.Codec {
+		return New(version, config)
+	})
+}
+
+// New creates a new cbor Encoder.
+func New(version string, config Config) *codec.BinaryEncoder {
+	var handle ugorjicodec.CborHandle
+	handle.Canonical = config.Canonical
+	return codec.NewBinaryEncoder(version, config, &handle)
+}
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package msgpack
+
+import (
+	"bytes"
+	stdjson "encoding/json"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	ugorjicodec "github.com/ugorji/go/codec"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func decode(t *testing.T, data []byte) interface{} {
+	t.Helper()
+	var h ugorjicodec.MsgpackHandle
+	h.MapType = reflect.TypeOf(map[string]interface{}(nil))
+	h.RawToString = true
+	var v interface{}
+	require.NoError(t, ugorjicodec.NewDecoderBytes(data, &h).Decode(&v))
+	return v
+}
+
+func TestRoundTripMatchesJSON(t *testing.T) {
+	ts := time.Date(2024, 5, 17, 12, 34, 56, 789000000, time.FixedZone("CEST", 2*60*60))
+	event := beat.Event{
+		Timestamp: ts,
+		Meta:      mapstr.M{"pipeline": "logs", "_id": "abc"},
+		Fields: mapstr.M{
+			"message": "<hello>world</hello>",
+			"count":   42,
+			"neg":     int64(-7),
+			"big":     uint64(math.MaxUint64),
+			"ratio":   0.25,
+			"nan":     math.NaN(),
+			"ok":      true,
+			"nothing": nil,
+			"tags":    []string{"a", "b"},
+			"ints":    []int{1, 2, 3},
+			"nested": mapstr.M{
+				"created": ts,
+				"legacy":  common.Time(ts),
+				"list":    []interface{}{"x", 1, mapstr.M{"y": false}},
+			},
+		},
+	}
+
+	tests := map[string]struct {
+		config     Config
+		jsonConfig json.Config
+	}{
+		"default":    {},
+		"local time": {config: Config{LocalTime: true}, jsonConfig: json.Config{LocalTime: true}},
+		"canonical":  {config: Config{Canonical: true}},
+		// pretty and escape_html only change the JSON text, not the
+		// decoded values.
+		"json pretty":      {jsonConfig: json.Config{Pretty: true}},
+		"json escape html": {jsonConfig: json.Config{EscapeHTML: true}},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			expected, err := json.New("1.2.3", test.jsonConfig).Encode("test", &event)
+			require.NoError(t, err)
+
+			encoded, err := New("1.2.3", test.config).Encode("test", &event)
+			require.NoError(t, err)
+
+			actual, err := stdjson.Marshal(decode(t, encoded))
+			require.NoError(t, err)
+			assert.JSONEq(t, string(expected), string(actual))
+		})
+	}
+}
+
+func TestEncoderReuse(t *testing.T) {
+	enc := New("1.2.3", Config{Canonical: true})
+
+	first, err := enc.Encode("test", &beat.Event{Fields: mapstr.M{"b": 1, "a": "first"}})
+	require.NoError(t, err)
+	first = bytes.Clone(first)
+
+	second, err := enc.Encode("test", &beat.Event{Fields: mapstr.M{"a": "second"}})
+	require.NoError(t, err)
+
+	assert.Equal(t, "first", decode(t, first).(map[string]interface{})["a"])
+	assert.Equal(t, "second", decode(t, second).(map[string]interface{})["a"])
+
+	// Canonical encoding is stable regardless of map iteration order.
+	again, err := enc.Encode("test", &beat.Event{Fields: mapstr.M{"b": 1, "a": "first"}})
+	require.NoError(t, err)
+	assert.Equal(t, first, again)
+}
@@ -0,0 +1,198 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package codec
+
+import (
+	"errors"
+	"math"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/go-structform"
+	"github.com/elastic/go-structform/gotype"
+)
+
+// ValueEncoder converts events into plain values (maps, slices, strings,
+// numbers and booleans) with the same structure as the json codec output:
+// the timestamp is formatted the same way, metadata is stored in
+// `@metadata`, and undefined float values like NaN are replaced by nil.
+// Codecs for other serialization formats use it to encode events exactly
+// like the json codec does.
+type ValueEncoder struct {
+	builder valueBuilder
+	folder  *gotype.Iterator
+	version string
+}
+
+type valueEvent struct {
+	Timestamp time.Time `struct:"@timestamp"`
+	Meta      valueMeta `struct:"@metadata"`
+	Fields    mapstr.M  `struct:",inline"`
+}
+
+type valueMeta struct {
+	Beat    string                 `struct:"beat"`
+	Type    string                 `struct:"type"`
+	Version string                 `struct:"version"`
+	Fields  map[string]interface{} `struct:",inline"`
+}
+
+// NewValueEncoder creates a ValueEncoder. If localTime is set, the
+// timestamp is formatted in the local timezone instead of UTC.
+func NewValueEncoder(version string, localTime bool) *ValueEncoder {
+	e := &ValueEncoder{version: version}
+	var err error
+	e.folder, err = gotype.NewIterator(&e.builder,
+		gotype.Folders(
+			MakeUTCOrLocalTimestampEncoder(localTime),
+			MakeBCTimestampEncoder(),
+		),
+	)
+	if err != nil {
+		panic(err)
+	}
+	return e
+}
+
+// Encode returns the event as a map of plain values.
+func (e *ValueEncoder) Encode(index string, event *beat.Event) (map[string]interface{}, error) {
+	e.builder.reset()
+	err := e.folder.Fold(valueEvent{
+		Timestamp: event.Timestamp,
+		Meta: valueMeta{
+			Beat:    index,
+			Version: e.version,
+			Type:    "_doc",
+			Fields:  event.Meta,
+		},
+		Fields: event.Fields,
+	})
+	if err != nil {
+		e.builder.reset()
+		return nil, err
+	}
+
+	m, ok := e.builder.value.(map[string]interface{})
+	if !ok {
+		return nil, errors.New("event was not encoded as an object")
+	}
+	return m, nil
+}
+
+// valueBuilder is a structform visitor that assembles the visited values.
+type valueBuilder struct {
+	stack []valueFrame
+	value interface{}
+}
+
+// valueFrame is an object or array that is still being visited.
+type valueFrame struct {
+	obj map[string]interface{}
+	arr []interface{}
+	key string
+}
+
+func (b *valueBuilder) reset() {
+	b.stack = b.stack[:0]
+	b.value = nil
+}
+
+func (b *valueBuilder) add(v interface{}) error {
+	if len(b.stack) == 0 {
+		b.value = v
+		return nil
+	}
+	top := &b.stack[len(b.stack)-1]
+	if top.obj != nil {
+		top.obj[top.key] = v
+	} else {
+		top.arr = append(top.arr, v)
+	}
+	return nil
+}
+
+func (b *valueBuilder) pop() valueFrame {
+	last := len(b.stack) - 1
+	f := b.stack[last]
+	b.stack[last] = valueFrame{}
+	b.stack = b.stack[:last]
+	return f
+}
+
+func (b *valueBuilder) OnObjectStart(l int, _ structform.BaseType) error {
+	b.stack = append(b.stack, valueFrame{obj: make(map[string]interface{}, max(l, 0))})
+	return nil
+}
+
+func (b *valueBuilder) OnObjectFinished() error {
+	return b.add(b.pop().obj)
+}
+
+func (b *valueBuilder) OnKey(s string) error {
+	b.stack[len(b.stack)-1].key = s
+	return nil
+}
+
+func (b *valueBuilder) OnKeyRef(s []byte) error {
+	return b.OnKey(string(s))
+}
+
+func (b *valueBuilder) OnArrayStart(l int, _ structform.BaseType) error {
+	b.stack = append(b.stack, valueFrame{arr: make([]interface{}, 0, max(l, 0))})
+	return nil
+}
+
+func (b *valueBuilder) OnArrayFinished() error {
+	return b.add(b.pop().arr)
+}
+
+func (b *valueBuilder) OnNil() error               { return b.add(nil) }
+func (b *valueBuilder) OnBool(v bool) error        { return b.add(v) }
+func (b *valueBuilder) OnString(s string) error    { return b.add(s) }
+func (b *valueBuilder) OnStringRef(s []byte) error { return b.add(string(s)) }
+func (b *valueBuilder) OnInt8(i int8) error        { return b.add(i) }
+func (b *valueBuilder) OnInt16(i int16) error      { return b.add(i) }
+func (b *valueBuilder) OnInt32(i int32) error      { return b.add(i) }
+func (b *valueBuilder) OnInt64(i int64) error      { return b.add(i) }
+func (b *valueBuilder) OnInt(i int) error          { return b.add(i) }
+func (b *valueBuilder) OnByte(u byte) error        { return b.add(u) }
+func (b *valueBuilder) OnUint8(u uint8) error      { return b.add(u) }
+func (b *valueBuilder) OnUint16(u uint16) error    { return b.add(u) }
+func (b *valueBuilder) OnUint32(u uint32) error    { return b.add(u) }
+func (b *valueBuilder) OnUint64(u uint64) error    { return b.add(u) }
+func (b *valueBuilder) OnUint(u uint) error        { return b.add(u) }
+
+// Undefined float values are replaced by nil, like in the json codec.
+func (b *valueBuilder) OnFloat32(f float32) error {
+	if isInvalidFloat(float64(f)) {
+		return b.add(nil)
+	}
+	return b.add(f)
+}
+
+func (b *valueBuilder) OnFloat64(f float64) error {
+	if isInvalidFloat(f) {
+		return b.add(nil)
+	}
+	return b.add(f)
+}
+
+func isInvalidFloat(f float64) bool {
+	return math.IsNaN(f) || math.IsInf(f, 0)
+}
@@ -61,6 +61,12 @@ type Client struct {
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
 
+	// If deadLetterFile is set, events with bulk-ingest errors that would
+	// be dropped are written to local files instead. The file is held open
+	// while the client is connected.
+	deadLetterFile     *deadLetterFile
+	deadLetterFileHeld bool
+
 	log                    *logp.Logger
 	pLogIndex              *periodic.Doer
 	pLogIndexTryDeadLetter *periodic.Doer
@@ -81,6 +87,10 @@ type clientSettings struct {
 	// If deadLetterIndex is set, events with bulk-ingest errors will be
 	// forwarded to this index. Otherwise, they will be dropped.
 	deadLetterIndex string
+
+	// If deadLetterFile is set, events with bulk-ingest errors that would
+	// be dropped are written to local files instead.
+	deadLetterFile *deadLetterFile
 }
 
 type bulkResultStats struct {
@@ -88,7 +98,7 @@ type bulkResultStats struct {
 	duplicates   int // number of events failed with `create` due to ID already being indexed
 	fails        int // number of events with retryable failures.
 	nonIndexable int // number of events with permanent failures.
-	deadLetter   int // number of failed events ingested to the dead letter index.
+	deadLetter   int // number of failed events ingested to the dead letter index or written to the dead letter file.
 	tooMany      int // number of events receiving HTTP 429 Too Many Requests
 }
 
@@ -192,6 +202,7 @@ func NewClient(
 		pipelineSelector: pipeline,
 		observer:         observer,
 		deadLetterIndex:  s.deadLetterIndex,
+		deadLetterFile:   s.deadLetterFile,
 
 		log:                    logger,
 		pLogDeadLetter:         pLogDeadLetter,
@@ -235,6 +246,7 @@ func (client *Client) Clone() *Client {
 			indexSelector:    client.indexSelector,
 			pipelineSelector: client.pipelineSelector,
 			deadLetterIndex:  client.deadLetterIndex,
+			deadLetterFile:   client.deadLetterFile,
 		},
 		nil, // XXX: do not pass connection callback?
 		client.log,
@@ -515,6 +527,10 @@ func (client *Client) applyItemStatus(
 	if itemStatus < 500 {
 		// hard failure, apply policy action
 		if encodedEvent.deadLetter {
+			if client.writeDeadLetterFile(encodedEvent, itemStatus, itemMessage) {
+				stats.deadLetter++
+				return false
+			}
 			// Fatal error while sending an already-failed event to the dead letter
 			// index, drop.
 			client.pLogDeadLetter.Add()
@@ -523,6 +539,10 @@ func (client *Client) applyItemStatus(
 			return false
 		}
 		if client.deadLetterIndex == "" {
+			if client.writeDeadLetterFile(encodedEvent, itemStatus, itemMessage) {
+				stats.deadLetter++
+				return false
+			}
 			// Fatal error and no dead letter index, drop.
 			client.pLogIndex.Add()
 			client.log.Warnw(fmt.Sprintf("Cannot index event '%s' (status=%v): %s, dropping event!", encodedEvent, itemStatus, itemMessage), logp.TypeKey, logp.EventType)
@@ -543,12 +563,36 @@ func (client *Client) applyItemStatus(
 	return true
 }
 
+// writeDeadLetterFile writes an event rejected by Elasticsearch to the dead
+// letter file, if one is configured. Returns true if the event was written.
+func (client *Client) writeDeadLetterFile(event *encodedEvent, itemStatus int, itemMessage []byte) bool {
+	if client.deadLetterFile == nil {
+		return false
+	}
+	record := newDeadLetterRecord(event, itemStatus, itemMessage, time.Now())
+	if err := client.deadLetterFile.write(record); err != nil {
+		client.log.Errorf("Failed to write event to dead letter file: %v", err)
+		return false
+	}
+	client.log.Warnw(fmt.Sprintf("Cannot index event '%s' (status=%v): %s, written to dead letter file", event, itemStatus, itemMessage), logp.TypeKey, logp.EventType)
+	return true
+}
+
 func (client *Client) Connect(ctx context.Context) error {
+	if client.deadLetterFile != nil && !client.deadLetterFileHeld {
+		client.deadLetterFile.acquire()
+		client.deadLetterFileHeld = true
+	}
 	return client.conn.Connect(ctx)
 }
 
 func (client *Client) Close() error {
-	return client.conn.Close()
+	err := client.conn.Close()
+	if client.deadLetterFileHeld {
+		client.deadLetterFileHeld = false
+		err = errors.Join(err, client.deadLetterFile.release())
+	}
+	return err
 }
 
 func (client *Client) String() string {
@@ -21,6 +21,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 
 	conf "github.com/elastic/elastic-agent-libs/config"
 )
@@ -98,6 +99,100 @@ non_indexable_policy.dead_letter_index:
 	}
 }
 
+func TestDeadLetterFilePolicyConfig(t *testing.T) {
+	config := `
+non_indexable_policy.dead_letter_file:
+    path: "/var/lib/dead_letter"
+    number_of_files: 3
+`
+	c := conf.MustNewConfigFrom(config)
+	elasticsearchOutputConfig, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can't create test configuration from valid input")
+	}
+	index, err := deadLetterIndexForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+	require.NoError(t, err)
+	assert.Equal(t, "", index, "dead letter index should be empty string")
+
+	fileConfig, err := deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+	require.NoError(t, err)
+	require.NotNil(t, fileConfig)
+	assert.Equal(t, "/var/lib/dead_letter", fileConfig.dir())
+	assert.Equal(t, "dead_letter", fileConfig.Name)
+	assert.Equal(t, uint(3), fileConfig.NumberOfFiles)
+	assert.Equal(t, uint(10*1024), fileConfig.RotateEveryKb)
+}
+
+func TestDeadLetterIndexPolicyFileConfig(t *testing.T) {
+	tests := map[string]struct {
+		config string
+		file   bool
+	}{
+		"without file": {
+			config: `
+non_indexable_policy.dead_letter_index:
+    index: "my-dead-letter-index"
+`,
+		},
+		"with file": {
+			config: `
+non_indexable_policy.dead_letter_index:
+    index: "my-dead-letter-index"
+    file.name: "rejected"
+`,
+			file: true,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			elasticsearchOutputConfig, err := readConfig(conf.MustNewConfigFrom(test.config))
+			require.NoError(t, err)
+
+			index, err := deadLetterIndexForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+			require.NoError(t, err)
+			assert.Equal(t, "my-dead-letter-index", index)
+
+			fileConfig, err := deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+			require.NoError(t, err)
+			if !test.file {
+				assert.Nil(t, fileConfig)
+				return
+			}
+			require.NotNil(t, fileConfig)
+			assert.Equal(t, "rejected", fileConfig.Name)
+		})
+	}
+}
+
+func TestInvalidDeadLetterFilePolicyConfig(t *testing.T) {
+	tests := map[string]string{
+		"too few files": `
+non_indexable_policy.dead_letter_file:
+    number_of_files: 1
+`,
+		"name with directory": `
+non_indexable_policy.dead_letter_file:
+    name: "../dead_letter"
+`,
+		"zero rotate_every_kb": `
+non_indexable_policy.dead_letter_index:
+    index: "my-dead-letter-index"
+    file.rotate_every_kb: 0
+`,
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			elasticsearchOutputConfig, err := readConfig(conf.MustNewConfigFrom(test))
+			require.NoError(t, err)
+
+			_, err = deadLetterFileForPolicy(elasticsearchOutputConfig.NonIndexablePolicy)
+			assert.Error(t, err)
+		})
+	}
+}
+
 func TestCompressionIsOnByDefault(t *testing.T) {
 	config := ""
 	c := conf.MustNewConfigFrom(config)
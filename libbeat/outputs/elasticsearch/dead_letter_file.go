@@ -0,0 +1,236 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/cfgwarn"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const (
+	dead_letter_file = "dead_letter_file"
+
+	deadLetterFileExtension = ".ndjson"
+)
+
+// deadLetterFileConfig configures the local files rejected documents are
+// written to.
+type deadLetterFileConfig struct {
+	Path          string `config:"path"`
+	Name          string `config:"name"`
+	RotateEveryKb uint   `config:"rotate_every_kb" validate:"min=1"`
+	NumberOfFiles uint   `config:"number_of_files"`
+	Permissions   uint32 `config:"permissions"`
+}
+
+func defaultDeadLetterFileConfig() deadLetterFileConfig {
+	return deadLetterFileConfig{
+		Name:          "dead_letter",
+		RotateEveryKb: 10 * 1024,
+		NumberOfFiles: 7,
+		Permissions:   0600,
+	}
+}
+
+func (c *deadLetterFileConfig) Validate() error {
+	if c.Name == "" || c.Name != filepath.Base(c.Name) {
+		return fmt.Errorf("invalid dead letter file name '%v'", c.Name)
+	}
+	if c.NumberOfFiles < 2 || c.NumberOfFiles > file.MaxBackupsLimit {
+		return fmt.Errorf("the number_of_files to keep should be between 2 and %v",
+			file.MaxBackupsLimit)
+	}
+	return nil
+}
+
+// dir returns the directory of the dead letter files, which defaults to the
+// dead_letter directory in the data path.
+func (c *deadLetterFileConfig) dir() string {
+	if c.Path == "" {
+		return paths.Resolve(paths.Data, "dead_letter")
+	}
+	return c.Path
+}
+
+// files returns the existing dead letter files, sorted by name.
+func (c *deadLetterFileConfig) files() ([]string, error) {
+	entries, err := os.ReadDir(c.dir())
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.Type().IsRegular() && strings.HasPrefix(name, c.Name+"-") && strings.HasSuffix(name, deadLetterFileExtension) {
+			names = append(names, filepath.Join(c.dir(), name))
+		}
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+func deadLetterFileForConfig(cfg *config.C) (*deadLetterFileConfig, error) {
+	fileConfig := defaultDeadLetterFileConfig()
+	if err := cfg.Unpack(&fileConfig); err != nil {
+		return nil, err
+	}
+	return &fileConfig, nil
+}
+
+// deadLetterFileForPolicy returns the dead letter file configuration of the
+// non-indexable policy, or nil if rejected documents are not written to
+// files. The dead_letter_file policy writes all rejected documents to
+// files, the dead_letter_index policy only writes the documents the dead
+// letter index rejects, if its `file` setting is set.
+func deadLetterFileForPolicy(configNamespace *config.Namespace) (*deadLetterFileConfig, error) {
+	if configNamespace == nil {
+		return nil, nil
+	}
+
+	switch configNamespace.Name() {
+	case dead_letter_file:
+		cfgwarn.Beta("The non_indexable_policy dead_letter_file is beta.")
+		return deadLetterFileForConfig(configNamespace.Config())
+	case dead_letter_index:
+		cfg := configNamespace.Config()
+		if !cfg.HasField("file") {
+			return nil, nil
+		}
+		fileCfg, err := cfg.Child("file", -1)
+		if err != nil {
+			return nil, err
+		}
+		return deadLetterFileForConfig(fileCfg)
+	default:
+		return nil, nil
+	}
+}
+
+// deadLetterRecord is a document rejected by Elasticsearch, as written to
+// dead letter files. Document holds the document as sent to Elasticsearch,
+// Error the error of the bulk response item.
+type deadLetterRecord struct {
+	Timestamp time.Time       `json:"@timestamp"`
+	Index     string          `json:"index"`
+	Pipeline  string          `json:"pipeline,omitempty"`
+	ID        string          `json:"id,omitempty"`
+	OpType    string          `json:"op_type,omitempty"`
+	Status    int             `json:"status"`
+	Error     json.RawMessage `json:"error,omitempty"`
+	Document  json.RawMessage `json:"document,omitempty"`
+}
+
+func newDeadLetterRecord(event *encodedEvent, status int, errMsg []byte, now time.Time) *deadLetterRecord {
+	record := &deadLetterRecord{
+		Timestamp: now.UTC(),
+		Index:     event.index,
+		Pipeline:  event.pipeline,
+		ID:        event.id,
+		OpType:    event.opType.String(),
+		Status:    status,
+		Document:  json.RawMessage(event.encoding),
+	}
+	if json.Valid(errMsg) {
+		record.Error = json.RawMessage(errMsg)
+	}
+	return record
+}
+
+// deadLetterFile writes rejected documents to rotating NDJSON files. It is
+// shared by all clients of an output, and closed once all clients are
+// closed.
+type deadLetterFile struct {
+	config *deadLetterFileConfig
+	log    *logp.Logger
+
+	mu      sync.Mutex
+	refs    int
+	rotator *file.Rotator
+}
+
+func newDeadLetterFile(config *deadLetterFileConfig, log *logp.Logger) *deadLetterFile {
+	return &deadLetterFile{config: config, log: log}
+}
+
+// acquire registers a client using the file.
+func (f *deadLetterFile) acquire() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refs++
+}
+
+// release unregisters a client, closing the file once it isn't used
+// anymore.
+func (f *deadLetterFile) release() error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.refs--
+	if f.refs > 0 || f.rotator == nil {
+		return nil
+	}
+	err := f.rotator.Close()
+	f.rotator = nil
+	return err
+}
+
+// write appends the records to the active file and flushes it to disk.
+func (f *deadLetterFile) write(records ...*deadLetterRecord) error {
+	var buf []byte
+	for _, record := range records {
+		line, err := json.Marshal(record)
+		if err != nil {
+			return fmt.Errorf("failed to encode dead letter record: %w", err)
+		}
+		buf = append(buf, line...)
+		buf = append(buf, '\n')
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.rotator == nil {
+		rotator, err := file.NewFileRotator(
+			filepath.Join(f.config.dir(), f.config.Name),
+			file.MaxSizeBytes(f.config.RotateEveryKb*1024),
+			file.MaxBackups(f.config.NumberOfFiles),
+			file.Permissions(os.FileMode(f.config.Permissions)),
+			file.WithLogger(f.log.Named("rotator").With(logp.Namespace("rotator"))),
+		)
+		if err != nil {
+			return fmt.Errorf("failed to open dead letter file: %w", err)
+		}
+		f.rotator = rotator
+	}
+
+	if _, err := f.rotator.Write(buf); err != nil {
+		return fmt.Errorf("failed to write dead letter file: %w", err)
+	}
+	return f.rotator.Sync()
+}
@@ -0,0 +1,168 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package elasticsearch
+
+import (
+	"bytes"
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const mappingErrorResponse = `
+{ "items": [
+  {"create": {"status": 200}},
+  {"create": {
+    "error": {"type": "mapper_parsing_exception", "reason": "failed to parse field [bar] of type [long]"},
+    "status": 400
+  }},
+  {"create": {"status": 200}}
+]}`
+
+func newDeadLetterFileClient(t *testing.T, deadLetterIndex string) (*Client, *deadLetterFileConfig) {
+	t.Helper()
+	logger := logptest.NewTestingLogger(t, "")
+	fileConfig := defaultDeadLetterFileConfig()
+	fileConfig.Path = t.TempDir()
+
+	client, err := NewClient(
+		clientSettings{
+			observer:        outputs.NewNilObserver(),
+			indexSelector:   testIndexSelector{},
+			deadLetterIndex: deadLetterIndex,
+			deadLetterFile:  newDeadLetterFile(&fileConfig, logger),
+		},
+		nil,
+		logger,
+	)
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = client.Close() })
+	return client, &fileConfig
+}
+
+func readDeadLetterFiles(t *testing.T, fileConfig *deadLetterFileConfig) []deadLetterRecord {
+	t.Helper()
+	files, err := fileConfig.files()
+	require.NoError(t, err)
+
+	var records []deadLetterRecord
+	for _, path := range files {
+		content, err := os.ReadFile(path)
+		require.NoError(t, err)
+		dec := json.NewDecoder(bytes.NewReader(content))
+		for dec.More() {
+			var record deadLetterRecord
+			require.NoError(t, dec.Decode(&record))
+			records = append(records, record)
+		}
+	}
+	return records
+}
+
+func TestCollectPublishFailDeadLetterFile(t *testing.T) {
+	client, fileConfig := newDeadLetterFileClient(t, "")
+
+	event := publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": 1}}}
+	eventFail := publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": "bar1"}}}
+	events := encodeEvents(client, []publisher.Event{event, eventFail, event})
+
+	res, stats := client.bulkCollectPublishFails(bulkResult{
+		events:   events,
+		status:   200,
+		response: []byte(mappingErrorResponse),
+	})
+	assert.Empty(t, res)
+	assert.Equal(t, bulkResultStats{acked: 2, deadLetter: 1}, stats)
+
+	records := readDeadLetterFiles(t, fileConfig)
+	require.Len(t, records, 1)
+	record := records[0]
+	assert.Equal(t, "test", record.Index)
+	assert.Equal(t, 400, record.Status)
+	assert.JSONEq(t, `{"type": "mapper_parsing_exception", "reason": "failed to parse field [bar] of type [long]"}`, string(record.Error))
+
+	var doc struct {
+		Bar string `json:"bar"`
+	}
+	require.NoError(t, json.Unmarshal(record.Document, &doc))
+	assert.Equal(t, "bar1", doc.Bar)
+}
+
+func TestCollectPublishFailDeadLetterIndexFile(t *testing.T) {
+	// Events the dead letter index rejects are written to the file, other
+	// events are still sent to the dead letter index first.
+	const deadLetterIndex = "dead_letter_index"
+	client, fileConfig := newDeadLetterFileClient(t, deadLetterIndex)
+
+	event := publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": 1}}}
+	eventFail := publisher.Event{Content: beat.Event{Fields: mapstr.M{"bar": "bar1"}}}
+	events := encodeEvents(client, []publisher.Event{event, eventFail, event})
+
+	res, stats := client.bulkCollectPublishFails(bulkResult{
+		events:   events,
+		status:   200,
+		response: []byte(mappingErrorResponse),
+	})
+	assert.Equal(t, bulkResultStats{acked: 2, fails: 1}, stats)
+	require.Len(t, res, 1)
+	assert.Empty(t, readDeadLetterFiles(t, fileConfig))
+
+	// The dead letter index rejects the event too.
+	res, stats = client.bulkCollectPublishFails(bulkResult{
+		events:   res,
+		status:   200,
+		response: []byte(`{"items": [{"create": {"status": 400, "error": {"type": "mapper_parsing_exception"}}}]}`),
+	})
+	assert.Empty(t, res)
+	assert.Equal(t, bulkResultStats{deadLetter: 1}, stats)
+
+	records := readDeadLetterFiles(t, fileConfig)
+	require.Len(t, records, 1)
+	assert.Equal(t, deadLetterIndex, records[0].Index)
+	assert.Contains(t, string(records[0].Document), "bar1")
+}
+
+func TestDeadLetterFileReleasedOnClose(t *testing.T) {
+	client, fileConfig := newDeadLetterFileClient(t, "")
+	deadLetter := client.deadLetterFile
+
+	// Reconnecting after a failure must not leak references.
+	for i := 0; i < 2; i++ {
+		_ = client.Connect(t.Context())
+		require.NoError(t, client.Close())
+	}
+	assert.Equal(t, 0, deadLetter.refs)
+
+	_ = client.Connect(t.Context())
+	require.NoError(t, deadLetter.write(&deadLetterRecord{Index: "test", Document: json.RawMessage(`{}`)}))
+	assert.NotNil(t, deadLetter.rotator)
+	require.NoError(t, client.Close())
+	assert.Nil(t, deadLetter.rotator)
+	assert.Len(t, readDeadLetterFiles(t, fileConfig), 1)
+}
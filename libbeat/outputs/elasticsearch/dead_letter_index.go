@@ -51,5 +51,8 @@ func deadLetterIndexForPolicy(configNamespace *config.Namespace) (string, error)
 		cfgwarn.Beta("The non_indexable_policy dead_letter_index is beta.")
 		return deadLetterIndexForConfig(configNamespace.Config())
 	}
+	if configNamespace.Name() == dead_letter_file {
+		return "", nil
+	}
 	return "", fmt.Errorf("no such policy type: %s", configNamespace.Name())
 }
@@ -72,6 +72,16 @@ func makeES(
 		return outputs.Fail(err)
 	}
 
+	var deadLetter *deadLetterFile
+	deadLetterFileConfig, err := deadLetterFileForPolicy(esConfig.NonIndexablePolicy)
+	if err != nil {
+		log.Errorf("error in non_indexable_policy: %v", err)
+		return outputs.Fail(err)
+	}
+	if deadLetterFileConfig != nil {
+		deadLetter = newDeadLetterFile(deadLetterFileConfig, log)
+	}
+
 	hosts, err := outputs.ReadHostList(cfg)
 	if err != nil {
 		return outputs.Fail(err)
@@ -120,6 +130,7 @@ func makeES(
 			pipelineSelector: pipelineSelector,
 			observer:         observer,
 			deadLetterIndex:  deadLetterIndex,
+			deadLetterFile:   deadLetter,
 		}, &connectCallbackRegistry, log)
 		if err != nil {
 			return outputs.Fail(err)
@@ -0,0 +1,281 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package elasticsearch
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/beat/events"
+	"github.com/elastic/beats/v7/libbeat/esleg/eslegclient"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// ReplayStats reports the outcome of replaying a dead letter file.
+type ReplayStats struct {
+	// Replayed is the number of documents indexed, or already present.
+	Replayed int
+	// Failed is the number of documents rejected again.
+	Failed int
+}
+
+// DeadLetterReplayer re-publishes the documents of dead letter files to
+// Elasticsearch.
+type DeadLetterReplayer struct {
+	client      *Client
+	bulkMaxSize int
+	deadLetter  *deadLetterFileConfig
+
+	// Index, if set, replaces the index of all replayed documents.
+	Index string
+}
+
+// NewDeadLetterReplayer connects to the Elasticsearch cluster configured by
+// the elasticsearch output settings in cfg.
+func NewDeadLetterReplayer(ctx context.Context, cfg *config.C, beatInfo beat.Info) (*DeadLetterReplayer, error) {
+	log := beatInfo.Logger.Named(logSelector)
+	esConfig := defaultConfig
+	if err := cfg.Unpack(&esConfig); err != nil {
+		return nil, err
+	}
+	deadLetter, err := deadLetterFileForPolicy(esConfig.NonIndexablePolicy)
+	if err != nil {
+		return nil, fmt.Errorf("error in non_indexable_policy: %w", err)
+	}
+
+	conn, err := eslegclient.NewConnectedClient(ctx, cfg, beatInfo.Beat, log)
+	if err != nil {
+		return nil, err
+	}
+
+	bulkMaxSize := esConfig.BulkMaxSize
+	if bulkMaxSize <= 0 {
+		bulkMaxSize = defaultBulkSize
+	}
+	return &DeadLetterReplayer{
+		client: &Client{
+			conn:     *conn,
+			observer: outputs.NewNilObserver(),
+			log:      log,
+		},
+		bulkMaxSize: bulkMaxSize,
+		deadLetter:  deadLetter,
+	}, nil
+}
+
+// Files returns the dead letter files of the configured non-indexable
+// policy.
+func (r *DeadLetterReplayer) Files() ([]string, error) {
+	if r.deadLetter == nil {
+		return nil, errors.New("no dead letter file is configured in non_indexable_policy")
+	}
+	return r.deadLetter.files()
+}
+
+// Close closes the connection to Elasticsearch.
+func (r *DeadLetterReplayer) Close() error {
+	return r.client.conn.Close()
+}
+
+// ReplayFile publishes the documents of the dead letter file at path, in
+// bulk requests of up to bulk_max_size documents. If remove is true, the
+// documents that were indexed are removed from the file, and the file is
+// removed once all documents were indexed. Documents that are rejected
+// again are kept, with the new error.
+func (r *DeadLetterReplayer) ReplayFile(ctx context.Context, path string, remove bool) (ReplayStats, error) {
+	var stats ReplayStats
+
+	f, err := os.Open(path)
+	if err != nil {
+		return stats, err
+	}
+	defer f.Close()
+
+	var failed []*deadLetterRecord
+	reader := bufio.NewReader(f)
+	for done := false; !done; {
+		var records []*deadLetterRecord
+		records, done, err = readDeadLetterRecords(reader, r.bulkMaxSize)
+		if err != nil {
+			return stats, fmt.Errorf("failed to read %v: %w", path, err)
+		}
+		if len(records) == 0 {
+			break
+		}
+
+		rejected, err := r.replay(ctx, records)
+		if err != nil {
+			return stats, err
+		}
+		stats.Replayed += len(records) - len(rejected)
+		stats.Failed += len(rejected)
+		failed = append(failed, rejected...)
+	}
+	f.Close()
+
+	if !remove {
+		return stats, nil
+	}
+	if len(failed) == 0 {
+		return stats, os.Remove(path)
+	}
+	return stats, rewriteDeadLetterFile(path, failed)
+}
+
+// replay sends the records in one bulk request and returns the records
+// that were rejected. Records that fail with a retryable error are
+// returned too, with their previous error.
+func (r *DeadLetterReplayer) replay(ctx context.Context, records []*deadLetterRecord) ([]*deadLetterRecord, error) {
+	data := make([]publisher.Event, len(records))
+	for i, record := range records {
+		if r.Index != "" {
+			record.Index = r.Index
+		}
+		data[i] = publisher.Event{EncodedEvent: record.encodedEvent()}
+	}
+
+	client := r.client
+	okEvents, bulkItems := client.bulkEncodePublishRequest(client.conn.GetVersion(), data)
+	if len(okEvents) != len(data) {
+		return nil, errors.New("failed to encode dead letter records")
+	}
+
+	status, response, err := client.conn.Bulk(ctx, "", "", bulkRequestParams, bulkItems)
+	if err != nil {
+		return nil, fmt.Errorf("failed to perform bulk request: %w", err)
+	}
+	if status != 200 {
+		return nil, fmt.Errorf("bulk request failed with status %v", status)
+	}
+
+	reader := newJSONReader(response)
+	if err := bulkReadToItems(reader); err != nil {
+		return nil, fmt.Errorf("failed to parse bulk response: %w", err)
+	}
+
+	var rejected []*deadLetterRecord
+	for i, record := range records {
+		itemStatus, itemMessage, err := bulkReadItemStatus(client.log, reader)
+		if err != nil {
+			return nil, fmt.Errorf("failed to parse bulk response: %w", err)
+		}
+		if itemStatus < 300 || itemStatus == 409 {
+			continue
+		}
+
+		client.log.Debugf("Bulk item replay failed (i=%v, status=%v): %s", i, itemStatus, itemMessage)
+		record.Status = itemStatus
+		if json.Valid(itemMessage) {
+			record.Error = json.RawMessage(itemMessage)
+		}
+		rejected = append(rejected, record)
+	}
+	return rejected, nil
+}
+
+// encodedEvent returns the event to send to Elasticsearch for the record.
+func (r *deadLetterRecord) encodedEvent() *encodedEvent {
+	opType := events.OpTypeDefault
+	switch r.OpType {
+	case events.OpTypeCreate.String():
+		opType = events.OpTypeCreate
+	case events.OpTypeIndex.String():
+		opType = events.OpTypeIndex
+	case events.OpTypeDelete.String():
+		opType = events.OpTypeDelete
+	}
+
+	return &encodedEvent{
+		id:       r.ID,
+		opType:   opType,
+		pipeline: r.Pipeline,
+		index:    r.Index,
+		encoding: r.Document,
+	}
+}
+
+// readDeadLetterRecords reads up to n records. done is true once the end of
+// the file is reached.
+func readDeadLetterRecords(reader *bufio.Reader, n int) (records []*deadLetterRecord, done bool, err error) {
+	for len(records) < n {
+		line, err := reader.ReadBytes('\n')
+		if err != nil && !errors.Is(err, io.EOF) {
+			return nil, false, err
+		}
+		if line = bytes.TrimSpace(line); len(line) > 0 {
+			record := &deadLetterRecord{}
+			if err := json.Unmarshal(line, record); err != nil {
+				return nil, false, fmt.Errorf("invalid dead letter record: %w", err)
+			}
+			records = append(records, record)
+		}
+		if errors.Is(err, io.EOF) {
+			return records, true, nil
+		}
+	}
+	return records, false, nil
+}
+
+// rewriteDeadLetterFile replaces the file at path with the given records.
+func rewriteDeadLetterFile(path string, records []*deadLetterRecord) error {
+	stat, err := os.Stat(path)
+	if err != nil {
+		return err
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+
+	w := bufio.NewWriter(tmp)
+	enc := json.NewEncoder(w)
+	for _, record := range records {
+		if err := enc.Encode(record); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := w.Flush(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(stat.Mode().Perm()); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,192 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package elasticsearch
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// bulkServer is a mock Elasticsearch that rejects the documents containing
+// reject, and records the bulk actions it receives.
+type bulkServer struct {
+	mu      sync.Mutex
+	reject  string
+	actions []map[string]map[string]interface{}
+}
+
+func (s *bulkServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if !strings.HasSuffix(r.URL.Path, "/_bulk") {
+		_, _ = w.Write([]byte(`{"version": {"number": "8.15.0"}}`))
+		return
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	var items []string
+	scanner := bufio.NewScanner(r.Body)
+	for scanner.Scan() {
+		var action map[string]map[string]interface{}
+		if err := json.Unmarshal(scanner.Bytes(), &action); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		s.actions = append(s.actions, action)
+		if _, ok := action["delete"]; ok {
+			items = append(items, `{"delete": {"status": 200}}`)
+			continue
+		}
+		scanner.Scan()
+		for kind := range action {
+			if s.reject != "" && strings.Contains(scanner.Text(), s.reject) {
+				items = append(items, fmt.Sprintf(`{%q: {"status": 400, "error": {"type": "mapper_parsing_exception"}}}`, kind))
+			} else {
+				items = append(items, fmt.Sprintf(`{%q: {"status": 201}}`, kind))
+			}
+		}
+	}
+	_, _ = fmt.Fprintf(w, `{"items": [%s]}`, strings.Join(items, ","))
+}
+
+func newTestReplayer(t *testing.T, server *bulkServer, settings mapstr.M) *DeadLetterReplayer {
+	t.Helper()
+	es := httptest.NewServer(server)
+	t.Cleanup(es.Close)
+
+	cfg := config.MustNewConfigFrom(mapstr.M{"hosts": []string{es.URL}})
+	require.NoError(t, cfg.Merge(settings))
+	replayer, err := NewDeadLetterReplayer(t.Context(), cfg, beat.Info{
+		Beat:   "testbeat",
+		Logger: logptest.NewTestingLogger(t, ""),
+	})
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = replayer.Close() })
+	return replayer
+}
+
+func writeTestDeadLetterFile(t *testing.T, path string, records ...deadLetterRecord) {
+	t.Helper()
+	f, err := os.Create(path)
+	require.NoError(t, err)
+	defer f.Close()
+	enc := json.NewEncoder(f)
+	for _, record := range records {
+		require.NoError(t, enc.Encode(record))
+	}
+}
+
+func TestReplayFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letter-20240506.ndjson")
+	writeTestDeadLetterFile(t, path,
+		deadLetterRecord{Index: "logs", OpType: "create", Status: 400, Document: json.RawMessage(`{"bar":1}`)},
+		deadLetterRecord{Index: "logs", OpType: "index", ID: "id-1", Status: 400, Document: json.RawMessage(`{"bar":"bar1"}`)},
+		deadLetterRecord{Index: "logs", Pipeline: "pipe", Status: 400, Document: json.RawMessage(`{"bar":2}`)},
+	)
+
+	server := &bulkServer{reject: "bar1"}
+	replayer := newTestReplayer(t, server, mapstr.M{"bulk_max_size": 2})
+
+	stats, err := replayer.ReplayFile(t.Context(), path, false)
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Replayed: 2, Failed: 1}, stats)
+
+	require.Len(t, server.actions, 3)
+	assert.Equal(t, map[string]interface{}{"_index": "logs"}, server.actions[0]["create"])
+	assert.Equal(t, map[string]interface{}{"_index": "logs", "_id": "id-1"}, server.actions[1]["index"])
+	assert.Equal(t, map[string]interface{}{"_index": "logs", "pipeline": "pipe"}, server.actions[2]["create"])
+
+	// Without remove, the file is kept as is.
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, 3, strings.Count(string(content), "\n"))
+}
+
+func TestReplayFileRemove(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "dead_letter-20240506.ndjson")
+	writeTestDeadLetterFile(t, path,
+		deadLetterRecord{Index: "logs", OpType: "create", Status: 400, Document: json.RawMessage(`{"bar":1}`)},
+		deadLetterRecord{Index: "logs", OpType: "create", Status: 409, Document: json.RawMessage(`{"bar":"bar1"}`)},
+	)
+
+	server := &bulkServer{reject: "bar1"}
+	replayer := newTestReplayer(t, server, nil)
+
+	// Documents rejected again are kept, with the new error.
+	stats, err := replayer.ReplayFile(t.Context(), path, true)
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Replayed: 1, Failed: 1}, stats)
+
+	reader, err := os.Open(path)
+	require.NoError(t, err)
+	records, done, err := readDeadLetterRecords(bufio.NewReader(reader), 10)
+	reader.Close()
+	require.NoError(t, err)
+	assert.True(t, done)
+	require.Len(t, records, 1)
+	assert.Equal(t, 400, records[0].Status)
+	assert.JSONEq(t, `{"type": "mapper_parsing_exception"}`, string(records[0].Error))
+	assert.JSONEq(t, `{"bar":"bar1"}`, string(records[0].Document))
+
+	// Once the mapping is fixed, the file is removed.
+	server.reject = ""
+	replayer.Index = "logs-fixed"
+	stats, err = replayer.ReplayFile(t.Context(), path, true)
+	require.NoError(t, err)
+	assert.Equal(t, ReplayStats{Replayed: 1}, stats)
+	assert.Equal(t, map[string]interface{}{"_index": "logs-fixed"}, server.actions[len(server.actions)-1]["create"])
+	assert.NoFileExists(t, path)
+}
+
+func TestReplayerFiles(t *testing.T) {
+	dir := t.TempDir()
+	for _, name := range []string{"dead_letter-20240506.ndjson", "dead_letter-20240506-1.ndjson", "other-20240506.ndjson", "dead_letter.txt"} {
+		require.NoError(t, os.WriteFile(filepath.Join(dir, name), nil, 0o600))
+	}
+
+	replayer := newTestReplayer(t, &bulkServer{}, mapstr.M{
+		"non_indexable_policy.dead_letter_file.path": dir,
+	})
+	files, err := replayer.Files()
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		filepath.Join(dir, "dead_letter-20240506-1.ndjson"),
+		filepath.Join(dir, "dead_letter-20240506.ndjson"),
+	}, files)
+
+	replayer = newTestReplayer(t, &bulkServer{}, nil)
+	_, err = replayer.Files()
+	assert.Error(t, err)
+}
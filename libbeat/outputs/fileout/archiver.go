@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/klauspost/compress/zstd"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+var compressionExtensions = map[string]string{
+	compressionGzip: ".gz",
+	compressionZstd: ".zst",
+}
+
+// archiver compresses rotated files and removes the oldest files once
+// there are more than the configured number of backups. The work is done
+// in the background, so that publishing isn't blocked by compressing
+// large files.
+type archiver struct {
+	log         *logp.Logger
+	compression string
+	maxBackups  uint
+	permissions os.FileMode
+
+	// pending holds the latest listing of every file set waiting to be
+	// archived, by base path. A newer listing of a set replaces the older
+	// one, so scheduling never blocks and the backlog is bounded by the
+	// number of file sets.
+	mu      sync.Mutex
+	pending map[string][]logFile
+	order   []string
+	closed  bool
+
+	wake chan struct{}
+	done chan struct{}
+}
+
+func newArchiver(log *logp.Logger, settings *rotateSettings) *archiver {
+	a := &archiver{
+		log:         log,
+		compression: settings.compression,
+		maxBackups:  settings.maxBackups,
+		permissions: settings.permissions,
+		pending:     map[string][]logFile{},
+		wake:        make(chan struct{}, 1),
+		done:        make(chan struct{}),
+	}
+	go a.run()
+	return a
+}
+
+// archive schedules the rotated files of the set with the given base,
+// oldest first, to be compressed and purged.
+func (a *archiver) archive(base string, files []logFile) {
+	if len(files) == 0 {
+		return
+	}
+	a.mu.Lock()
+	if _, ok := a.pending[base]; !ok {
+		a.order = append(a.order, base)
+	}
+	a.pending[base] = files
+	a.mu.Unlock()
+	a.notify()
+}
+
+// Close waits for all scheduled files to be archived.
+func (a *archiver) Close() {
+	a.mu.Lock()
+	a.closed = true
+	a.mu.Unlock()
+	a.notify()
+	<-a.done
+}
+
+func (a *archiver) notify() {
+	select {
+	case a.wake <- struct{}{}:
+	default:
+	}
+}
+
+// next returns the next scheduled files. ok is false if nothing is
+// scheduled, closed is true once the archiver is closed.
+func (a *archiver) next() (files []logFile, ok, closed bool) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if len(a.order) == 0 {
+		return nil, false, a.closed
+	}
+	base := a.order[0]
+	a.order = a.order[1:]
+	files = a.pending[base]
+	delete(a.pending, base)
+	return files, true, a.closed
+}
+
+func (a *archiver) run() {
+	defer close(a.done)
+	for {
+		files, ok, closed := a.next()
+		if !ok {
+			if closed {
+				return
+			}
+			<-a.wake
+			continue
+		}
+		a.process(files)
+	}
+}
+
+func (a *archiver) process(files []logFile) {
+	if uint(len(files)) > a.maxBackups {
+		purge := len(files) - int(a.maxBackups)
+		for _, f := range files[:purge] {
+			a.remove(f.plain)
+			a.remove(f.compressed)
+			if f.plain != "" && a.compression != compressionNone {
+				// The file might have been compressed since it was listed.
+				a.remove(f.plain + compressionExtensions[a.compression])
+			}
+		}
+		files = files[purge:]
+	}
+
+	if a.compression == compressionNone {
+		return
+	}
+	for _, f := range files {
+		if f.plain == "" {
+			continue
+		}
+		if err := a.compress(f.plain); err != nil {
+			a.log.Errorf("Failed to compress rotated file %v: %+v", f.plain, err)
+		}
+	}
+}
+
+func (a *archiver) remove(path string) {
+	if path == "" {
+		return
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		a.log.Errorf("Failed to delete %v during rotation: %+v", path, err)
+	}
+}
+
+// compress replaces the file at path with its compressed version. The
+// compressed file is written under a temporary name first, so that a
+// partially written file is never taken for a complete one.
+func (a *archiver) compress(path string) error {
+	in, err := os.Open(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		// Purged or compressed already.
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	target := path + compressionExtensions[a.compression]
+	tmp := target + ".tmp"
+	out, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, a.permissions)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp)
+
+	if err := a.copyCompressed(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Sync(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, target); err != nil {
+		return err
+	}
+	in.Close()
+	return os.Remove(path)
+}
+
+func (a *archiver) copyCompressed(out io.Writer, in io.Reader) error {
+	var w io.WriteCloser
+	switch a.compression {
+	case compressionGzip:
+		w = gzip.NewWriter(out)
+	case compressionZstd:
+		var err error
+		if w, err = zstd.NewWriter(out); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unsupported compression '%v'", a.compression)
+	}
+
+	if _, err := io.Copy(w, in); err != nil {
+		w.Close()
+		return err
+	}
+	return w.Close()
+}
@@ -18,8 +18,11 @@
 package fileout
 
 import (
+	"errors"
 	"fmt"
+	"time"
 
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/file"
@@ -33,9 +36,18 @@ type fileOutConfig struct {
 	Codec           codec.Config      `config:"codec"`
 	Permissions     uint32            `config:"permissions"`
 	RotateOnStartup bool              `config:"rotate_on_startup"`
+	RotateInterval  time.Duration     `config:"rotate_interval"`
+	Compression     string            `config:"compression"`
+	MaxOpenFiles    int               `config:"max_open_files" validate:"min=1"`
 	Queue           config.Namespace  `config:"queue"`
 }
 
+const (
+	compressionNone = "none"
+	compressionGzip = "gzip"
+	compressionZstd = "zstd"
+)
+
 func defaultConfig() fileOutConfig {
 	return fileOutConfig{
 		Path:            &PathFormatString{},
@@ -43,6 +55,8 @@ func defaultConfig() fileOutConfig {
 		RotateEveryKb:   10 * 1024,
 		Permissions:     0600,
 		RotateOnStartup: true,
+		Compression:     compressionNone,
+		MaxOpenFiles:    16,
 	}
 }
 
@@ -64,5 +78,19 @@ func (c *fileOutConfig) Validate() error {
 			file.MaxBackupsLimit)
 	}
 
+	if c.RotateInterval < 0 {
+		return errors.New("rotate_interval must not be negative")
+	}
+
+	switch c.Compression {
+	case compressionNone, compressionGzip, compressionZstd:
+	default:
+		return fmt.Errorf("unsupported compression '%v', must be one of none, gzip or zstd", c.Compression)
+	}
+
+	if _, err := fmtstr.CompileEvent(c.Filename); err != nil {
+		return fmt.Errorf("invalid filename: %w", err)
+	}
+
 	return nil
 }
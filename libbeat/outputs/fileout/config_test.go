@@ -42,6 +42,8 @@ func TestConfig(t *testing.T) {
 					RotateEveryKb:   10 * 1024,
 					Permissions:     0600,
 					RotateOnStartup: true,
+					Compression:     "none",
+					MaxOpenFiles:    16,
 				}
 
 				assert.Equal(t, expectedConfig, actual)
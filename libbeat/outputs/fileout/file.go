@@ -20,11 +20,14 @@ package fileout
 import (
 	"context"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/outputs/codec"
 	"github.com/elastic/beats/v7/libbeat/publisher"
@@ -40,10 +43,23 @@ func init() {
 type fileOutput struct {
 	log      *logp.Logger
 	filePath string
+	dir      string
+	filename *fmtstr.EventFormatString
 	beat     beat.Info
 	observer outputs.Observer
-	rotator  *file.Rotator
 	codec    codec.Codec
+
+	// rotator writes all events if the output only rotates by size, which
+	// the elastic-agent-libs file.Rotator does. Otherwise writers is used.
+	rotator *file.Rotator
+
+	// mu serializes the access to the writers between Publish and the
+	// archiving of expired files.
+	mu       sync.Mutex
+	writers  *writerPool
+	interval time.Duration
+	done     chan struct{}
+	wg       sync.WaitGroup
 }
 
 // makeFileout instantiates a new file output instance.
@@ -71,57 +87,111 @@ func makeFileout(
 }
 
 func (out *fileOutput) init(beat beat.Info, c fileOutConfig) error {
-	var path string
 	configPath, runErr := c.Path.Run(time.Now().UTC())
 	if runErr != nil {
 		return runErr
 	}
-	if c.Filename != "" {
-		path = filepath.Join(configPath, c.Filename)
-	} else {
-		path = filepath.Join(configPath, out.beat.Beat)
+	filename := c.Filename
+	if filename == "" {
+		filename = out.beat.Beat
 	}
 
-	out.filePath = path
-
 	var err error
-	out.rotator, err = file.NewFileRotator(
-		path,
-		file.MaxSizeBytes(c.RotateEveryKb*1024),
-		file.MaxBackups(c.NumberOfFiles),
-		file.Permissions(os.FileMode(c.Permissions)),
-		file.RotateOnStartup(c.RotateOnStartup),
-		file.WithLogger(beat.Logger.Named("rotator").With(logp.Namespace("rotator"))),
-	)
+	out.filename, err = fmtstr.CompileEvent(filename)
 	if err != nil {
 		return err
 	}
+	out.dir = configPath
+	out.filePath = filepath.Join(configPath, filename)
+
+	settings := &rotateSettings{
+		maxSizeBytes: c.RotateEveryKb * 1024,
+		maxBackups:   c.NumberOfFiles,
+		permissions:  os.FileMode(c.Permissions),
+		interval:     c.RotateInterval,
+		compression:  c.Compression,
+		now:          time.Now,
+	}
 
 	out.codec, err = codec.CreateEncoder(beat, c.Codec)
 	if err != nil {
 		return err
 	}
 
+	if c.RotateInterval == 0 && c.Compression == compressionNone && out.filename.IsConst() {
+		out.rotator, err = file.NewFileRotator(
+			out.filePath,
+			file.MaxSizeBytes(c.RotateEveryKb*1024),
+			file.MaxBackups(c.NumberOfFiles),
+			file.Permissions(os.FileMode(c.Permissions)),
+			file.RotateOnStartup(c.RotateOnStartup),
+			file.WithLogger(beat.Logger.Named("rotator").With(logp.Namespace("rotator"))),
+		)
+		if err != nil {
+			return err
+		}
+	} else {
+		out.writers = newWriterPool(beat.Logger.Named("rotator").With(logp.Namespace("rotator")),
+			settings, c.MaxOpenFiles, c.RotateOnStartup)
+	}
+	out.interval = c.RotateInterval
+	out.done = make(chan struct{})
+	if out.interval > 0 {
+		out.wg.Add(1)
+		go out.archiveExpired()
+	}
+
 	out.log.Infof("Initialized file output. "+
-		"path=%v max_size_bytes=%v max_backups=%v permissions=%v",
-		path, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions))
+		"path=%v max_size_bytes=%v max_backups=%v permissions=%v rotate_interval=%v compression=%v max_open_files=%v",
+		out.filePath, c.RotateEveryKb*1024, c.NumberOfFiles, os.FileMode(c.Permissions),
+		c.RotateInterval, c.Compression, c.MaxOpenFiles)
 
 	return nil
 }
 
+// archiveExpired closes the open files at the end of each rotation
+// interval, so that files that aren't written to anymore are rotated too.
+func (out *fileOutput) archiveExpired() {
+	defer out.wg.Done()
+	for {
+		next := nextIntervalStart(time.Now(), out.interval)
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-out.done:
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		out.mu.Lock()
+		out.writers.archiveExpired()
+		out.mu.Unlock()
+	}
+}
+
 // Implement Outputer
 func (out *fileOutput) Close() error {
-	return out.rotator.Close()
+	close(out.done)
+	out.wg.Wait()
+
+	out.mu.Lock()
+	defer out.mu.Unlock()
+	if out.rotator != nil {
+		return out.rotator.Close()
+	}
+	return out.writers.Close()
 }
 
 func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
-	defer batch.ACK()
-
 	st := out.observer
 	events := batch.Events()
 	st.NewBatch(len(events))
 
+	out.mu.Lock()
+	defer out.mu.Unlock()
+
 	dropped := 0
+	written := map[syncWriter]*writtenEvents{}
 
 	for i := range events {
 		event := &events[i]
@@ -140,8 +210,24 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 			continue
 		}
 
+		path, err := out.eventPath(&event.Content)
+		if err != nil {
+			if event.Guaranteed() {
+				out.log.Errorf("Failed to get the file name for the event: %+v", err)
+			} else {
+				out.log.Warnf("Failed to get the file name for the event: %+v", err)
+			}
+
+			dropped++
+			continue
+		}
+
 		begin := time.Now()
-		if _, err = out.rotator.Write(append(serializedEvent, '\n')); err != nil {
+		writer, err := out.writer(path)
+		if err == nil {
+			_, err = writer.Write(append(serializedEvent, '\n'))
+		}
+		if err != nil {
 			st.WriteError(err)
 
 			if event.Guaranteed() {
@@ -153,19 +239,78 @@ func (out *fileOutput) Publish(_ context.Context, batch publisher.Batch) error {
 			dropped++
 			continue
 		}
+		if written[writer] == nil {
+			written[writer] = &writtenEvents{path: path}
+		}
+		written[writer].indexes = append(written[writer].indexes, i)
 
 		st.WriteBytes(len(serializedEvent) + 1)
 		took := time.Since(begin)
 		st.ReportLatency(took)
 	}
 
-	st.PermanentErrors(dropped)
+	// Flush every file to stable storage before the batch is acknowledged.
+	// The events written to files that can't be flushed are retried.
+	var failed []publisher.Event
+	for writer, w := range written {
+		if err := writer.Sync(); err != nil {
+			st.WriteError(err)
+			out.log.Errorf("Failed to flush file %v: %+v", w.path, err)
+			for _, i := range w.indexes {
+				failed = append(failed, events[i])
+			}
+		}
+	}
 
-	st.AckedEvents(len(events) - dropped)
+	st.PermanentErrors(dropped)
+	st.AckedEvents(len(events) - dropped - len(failed))
+	if len(failed) > 0 {
+		st.RetryableErrors(len(failed))
+		batch.RetryEvents(failed)
+	} else {
+		batch.ACK()
+	}
 
 	return nil
 }
 
+// syncWriter is a file events are written to, that is flushed before the
+// events are acknowledged.
+type syncWriter interface {
+	io.Writer
+	Sync() error
+}
+
+// writtenEvents are the indexes of the events of a batch written to a file.
+type writtenEvents struct {
+	path    string
+	indexes []int
+}
+
+// writer returns the writer for the file set with the given base path.
+func (out *fileOutput) writer(path string) (syncWriter, error) {
+	if out.rotator != nil {
+		return out.rotator, nil
+	}
+	return out.writers.get(path)
+}
+
+// eventPath returns the base path of the files the event is written to.
+func (out *fileOutput) eventPath(event *beat.Event) (string, error) {
+	if out.filename.IsConst() {
+		return out.filePath, nil
+	}
+	filename, err := out.filename.Run(event)
+	if err != nil {
+		return "", err
+	}
+	// The file name must not escape the configured path.
+	if !filepath.IsLocal(filename) {
+		return "", fmt.Errorf("invalid file name '%v'", filename)
+	}
+	return filepath.Join(out.dir, filename), nil
+}
+
 func (out *fileOutput) String() string {
 	return "file(" + out.filePath + ")"
 }
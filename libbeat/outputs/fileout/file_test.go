@@ -18,3 +18,150 @@
 //go:build !integration
 
 package fileout
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/file"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestOutput(t *testing.T, settings mapstr.M) *fileOutput {
+	t.Helper()
+	cfg := config.MustNewConfigFrom(settings)
+	info := beat.Info{Beat: "testbeat", Version: "9.9.9", Logger: logptest.NewTestingLogger(t, "")}
+	group, err := makeFileout(nil, info, outputs.NewNilObserver(), cfg)
+	require.NoError(t, err)
+	out := group.Clients[0].(*fileOutput)
+	t.Cleanup(func() { _ = out.Close() })
+	return out
+}
+
+func testEvent(dataset string) beat.Event {
+	return beat.Event{
+		Timestamp: time.Date(2024, 1, 2, 3, 4, 5, 0, time.UTC),
+		Fields: mapstr.M{
+			"data_stream": mapstr.M{"dataset": dataset},
+			"message":     "hello " + dataset,
+		},
+	}
+}
+
+// readDir returns the contents of the plain files in dir by file name
+// prefix, ignoring the date part of the names.
+func readDir(t *testing.T, dir string) map[string]string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	contents := map[string]string{}
+	for _, entry := range entries {
+		data, err := os.ReadFile(filepath.Join(dir, entry.Name()))
+		require.NoError(t, err)
+		prefix, _, _ := strings.Cut(entry.Name(), "-")
+		contents[prefix] += string(data)
+	}
+	return contents
+}
+
+func TestPublishSizeRotationUsesFileRotator(t *testing.T) {
+	dir := t.TempDir()
+	out := newTestOutput(t, mapstr.M{
+		"path":        dir,
+		"filename":    "out",
+		"permissions": 0640,
+	})
+	require.NotNil(t, out.rotator)
+	assert.Nil(t, out.writers)
+
+	batch := outest.NewBatch(testEvent("nginx"))
+	require.NoError(t, out.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	name := filepath.Join(dir, "out-"+time.Now().Format(file.DateFormat)+".ndjson")
+	stat, err := os.Stat(name)
+	require.NoError(t, err)
+	if runtime.GOOS != "windows" {
+		assert.Equal(t, os.FileMode(0640), stat.Mode().Perm())
+	}
+	assert.Contains(t, readDir(t, dir)["out"], "hello nginx")
+}
+
+func TestPublishFilenameTemplate(t *testing.T) {
+	dir := t.TempDir()
+	out := newTestOutput(t, mapstr.M{
+		"path":     dir,
+		"filename": "%{[data_stream.dataset]}",
+	})
+
+	batch := outest.NewBatch(testEvent("nginx"), testEvent("system"), testEvent("nginx"), beat.Event{Fields: mapstr.M{}})
+	require.NoError(t, out.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+
+	contents := readDir(t, dir)
+	require.Len(t, contents, 2)
+	assert.Equal(t, 2, strings.Count(contents["nginx"], "hello nginx"))
+	assert.Equal(t, 1, strings.Count(contents["system"], "hello system"))
+}
+
+func TestPublishInvalidFilename(t *testing.T) {
+	dir := t.TempDir()
+	out := newTestOutput(t, mapstr.M{
+		"path":     filepath.Join(dir, "out"),
+		"filename": "%{[data_stream.dataset]}",
+	})
+
+	batch := outest.NewBatch(testEvent("../escaped"), testEvent("valid"))
+	require.NoError(t, out.Publish(context.Background(), batch))
+
+	_, err := os.Stat(filepath.Join(dir, "escaped"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+	assert.Equal(t, []string{"valid"}, keys(readDir(t, filepath.Join(dir, "out"))))
+}
+
+func TestPublishFlushesBeforeACK(t *testing.T) {
+	dir := t.TempDir()
+	out := newTestOutput(t, mapstr.M{
+		"path":           dir,
+		"filename":       "%{[data_stream.dataset]}",
+		"max_open_files": 1,
+	})
+
+	batch := outest.NewBatch(testEvent("a"), testEvent("b"), testEvent("c"))
+	batch.OnSignal = func(sig outest.BatchSignal) {
+		// All events are on disk once the batch is acknowledged, including
+		// the ones written to files that were closed to stay in the limit.
+		contents := readDir(t, dir)
+		for _, name := range []string{"a", "b", "c"} {
+			assert.Contains(t, contents[name], "hello "+name)
+		}
+	}
+	require.NoError(t, out.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	assert.Equal(t, 1, out.writers.lru.Len())
+}
+
+func keys(m map[string]string) []string {
+	var keys []string
+	for k := range m {
+		keys = append(keys, k)
+	}
+	return keys
+}
@@ -0,0 +1,127 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"container/list"
+	"errors"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// writerPool keeps a bounded number of files open. When the limit is
+// reached, the least recently used file is closed. It is not safe for
+// concurrent use.
+type writerPool struct {
+	log      *logp.Logger
+	settings *rotateSettings
+	archiver *archiver
+	maxOpen  int
+
+	writers map[string]*list.Element
+	lru     *list.List
+
+	// rotateBefore is the time before which a file set must have been last
+	// written to for it to be rotated on startup. Files written since
+	// startup are newer, so a file set closed to stay within maxOpen is
+	// appended to when it is opened again.
+	rotateBefore time.Time
+}
+
+// startupRotationGrace is how long before startup a file set must have been
+// last written to for it to be rotated on startup.
+const startupRotationGrace = time.Second
+
+func newWriterPool(log *logp.Logger, settings *rotateSettings, maxOpen int, rotateOnStartup bool) *writerPool {
+	p := &writerPool{
+		log:      log,
+		settings: settings,
+		archiver: newArchiver(log, settings),
+		maxOpen:  maxOpen,
+		writers:  map[string]*list.Element{},
+		lru:      list.New(),
+	}
+	if rotateOnStartup {
+		// Modification times are taken from the file system clock, which
+		// can be behind time.Now. Files written right before startup are
+		// appended to rather than risking to rotate files written since.
+		p.rotateBefore = time.Now().Add(-startupRotationGrace)
+	}
+	return p
+}
+
+// get returns the writer for the file set with the given base path,
+// opening it if needed.
+func (p *writerPool) get(base string) (*rotatingFile, error) {
+	if elem, ok := p.writers[base]; ok {
+		p.lru.MoveToFront(elem)
+		return elem.Value.(*rotatingFile), nil
+	}
+
+	w := newRotatingFile(base, p.settings, p.archiver)
+	if err := w.open(p.rotateBefore); err != nil {
+		return nil, err
+	}
+
+	for p.lru.Len() >= p.maxOpen {
+		p.evict(p.lru.Back())
+	}
+	p.writers[base] = p.lru.PushFront(w)
+	return w, nil
+}
+
+// evict removes a writer from the pool. Errors flushing its file are
+// reported by the next call to Sync on the writer.
+func (p *writerPool) evict(elem *list.Element) {
+	w := p.lru.Remove(elem).(*rotatingFile)
+	delete(p.writers, w.base)
+	w.close()
+}
+
+// archiveExpired closes the files whose interval ended, so that they are
+// archived even if nothing is written to them anymore.
+func (p *writerPool) archiveExpired() {
+	now := p.settings.now()
+	for elem := p.lru.Front(); elem != nil; {
+		next := elem.Next()
+		w := elem.Value.(*rotatingFile)
+		if w.expired(now) {
+			p.evict(elem)
+			if err := w.archive(); err != nil {
+				p.log.Errorf("Failed to archive file set %v: %+v", w.base, err)
+			}
+			if err := w.Sync(); err != nil {
+				p.log.Errorf("Failed to flush file set %v: %+v", w.base, err)
+			}
+		}
+		elem = next
+	}
+}
+
+// Close closes all files and waits for the rotated files to be archived.
+func (p *writerPool) Close() error {
+	var errs []error
+	for elem := p.lru.Front(); elem != nil; elem = elem.Next() {
+		errs = append(errs, elem.Value.(*rotatingFile).Close())
+	}
+	p.writers = map[string]*list.Element{}
+	p.lru.Init()
+	p.archiver.Close()
+	return errors.Join(errs...)
+}
@@ -0,0 +1,356 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package fileout
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/elastic/elastic-agent-libs/file"
+)
+
+const fileExtension = ".ndjson"
+
+// rotateSettings are the settings shared by all files of the output.
+type rotateSettings struct {
+	maxSizeBytes uint
+	maxBackups   uint
+	permissions  os.FileMode
+	interval     time.Duration
+	compression  string
+	now          func() time.Time
+}
+
+// rotatingFile writes to a set of files that is rotated by size and on
+// wall-clock intervals. The files are named like the files of the
+// elastic-agent-libs file.Rotator, {base}-{yyyyMMdd}[-N].ndjson, with an
+// additional extension once they are compressed. rotatingFile is not safe
+// for concurrent use.
+type rotatingFile struct {
+	base     string
+	settings *rotateSettings
+	archiver *archiver
+
+	file   *os.File
+	size   uint
+	opened time.Time
+
+	// err records the failure to flush a file that was closed since the
+	// last call to Sync.
+	err error
+}
+
+func newRotatingFile(base string, settings *rotateSettings, archiver *archiver) *rotatingFile {
+	return &rotatingFile{base: base, settings: settings, archiver: archiver}
+}
+
+// open opens the newest file of the set for appending, or creates a new
+// file if the newest file must be rotated first. The newest file is always
+// rotated if it was last modified before rotateBefore.
+func (f *rotatingFile) open(rotateBefore time.Time) error {
+	if err := os.MkdirAll(filepath.Dir(f.base), dirMode(f.settings.permissions)); err != nil {
+		return fmt.Errorf("failed to make directories for new file: %w", err)
+	}
+
+	files, err := listFiles(f.base)
+	if err != nil {
+		return err
+	}
+
+	now := f.settings.now()
+	if n := len(files); n > 0 && files[n-1].plain != "" {
+		active := files[n-1].plain
+		stat, err := os.Lstat(active)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			// Archived in the meantime.
+		case err != nil:
+			return err
+		// To avoid symlink following attacks, symlinks are never appended to.
+		case !stat.ModTime().Before(rotateBefore) && stat.Mode()&fs.ModeSymlink == 0 && !f.newInterval(stat.ModTime(), now):
+			f.file, err = os.OpenFile(active, os.O_WRONLY|os.O_APPEND, f.settings.permissions)
+			if err != nil {
+				return fmt.Errorf("failed to append to existing file: %w", err)
+			}
+			f.size = uint(stat.Size())
+			f.opened = stat.ModTime()
+			return nil
+		}
+	}
+
+	return f.create(files, now)
+}
+
+// create creates a new file and hands the existing files of the set over
+// to the archiver.
+func (f *rotatingFile) create(files []logFile, now time.Time) error {
+	name := nextFileName(f.base, files, now)
+	file, err := os.OpenFile(name, os.O_EXCL|os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.settings.permissions)
+	if err != nil {
+		return fmt.Errorf("failed to open new file '%s': %w", name, err)
+	}
+	f.file = file
+	f.size = 0
+	f.opened = now
+
+	f.archiver.archive(f.base, files)
+	return nil
+}
+
+// Write writes data to the active file. The file is rotated before the
+// write if it would exceed the maximum size, or if a new interval started.
+func (f *rotatingFile) Write(data []byte) (int, error) {
+	dataLen := uint(len(data))
+	if dataLen > f.settings.maxSizeBytes {
+		return 0, fmt.Errorf("data size (%d bytes) is greater than "+
+			"the max file size (%d bytes)", dataLen, f.settings.maxSizeBytes)
+	}
+
+	switch {
+	case f.file == nil:
+		if err := f.open(time.Time{}); err != nil {
+			return 0, err
+		}
+	case f.size+dataLen > f.settings.maxSizeBytes || f.expired(f.settings.now()):
+		if err := f.rotate(); err != nil {
+			return 0, fmt.Errorf("failed to rotate file: %w", err)
+		}
+	}
+
+	n, err := f.file.Write(data)
+	f.size += uint(n)
+	if err != nil {
+		return n, fmt.Errorf("failed to write to file: %w", err)
+	}
+	return n, nil
+}
+
+func (f *rotatingFile) rotate() error {
+	f.close()
+	files, err := listFiles(f.base)
+	if err != nil {
+		return err
+	}
+	return f.create(files, f.settings.now())
+}
+
+// Sync commits the written data to stable storage. It also reports
+// failures to flush files that were rotated or closed since the last call.
+func (f *rotatingFile) Sync() error {
+	err := f.err
+	f.err = nil
+	if f.file != nil {
+		if syncErr := f.file.Sync(); syncErr != nil {
+			err = errors.Join(err, syncErr)
+		}
+	}
+	return err
+}
+
+// Close flushes and closes the active file.
+func (f *rotatingFile) Close() error {
+	f.close()
+	return f.Sync()
+}
+
+// expired reports whether the active file belongs to an interval that
+// ended before now.
+func (f *rotatingFile) expired(now time.Time) bool {
+	return f.file != nil && f.newInterval(f.opened, now)
+}
+
+// archive closes the active file and hands it over to the archiver. The
+// next write creates a new file.
+func (f *rotatingFile) archive() error {
+	f.close()
+	files, err := listFiles(f.base)
+	if err != nil {
+		return err
+	}
+	f.archiver.archive(f.base, files)
+	return nil
+}
+
+func (f *rotatingFile) close() {
+	if f.file == nil {
+		return
+	}
+	if err := f.file.Sync(); err != nil {
+		f.err = errors.Join(f.err, err)
+	}
+	if err := f.file.Close(); err != nil {
+		f.err = errors.Join(f.err, err)
+	}
+	f.file = nil
+}
+
+func (f *rotatingFile) newInterval(last, now time.Time) bool {
+	interval := f.settings.interval
+	return interval > 0 && !intervalStart(last, interval).Equal(intervalStart(now, interval))
+}
+
+// intervalStart returns the start of the interval t belongs to. Hourly and
+// daily intervals follow the local wall clock, other intervals are
+// multiples of the interval since the Unix epoch.
+func intervalStart(t time.Time, interval time.Duration) time.Time {
+	year, month, day := t.Date()
+	switch interval {
+	case time.Hour:
+		return time.Date(year, month, day, t.Hour(), 0, 0, 0, t.Location())
+	case 24 * time.Hour:
+		return time.Date(year, month, day, 0, 0, 0, 0, t.Location())
+	default:
+		return t.Truncate(interval)
+	}
+}
+
+// nextIntervalStart returns the start of the interval following the one t
+// belongs to.
+func nextIntervalStart(t time.Time, interval time.Duration) time.Time {
+	start := intervalStart(t, interval)
+	if interval == 24*time.Hour {
+		return start.AddDate(0, 0, 1)
+	}
+	return start.Add(interval)
+}
+
+// logFile is a file of a rotating file set. A file that is being
+// compressed can exist both with and without the compression extension.
+type logFile struct {
+	date       time.Time
+	index      int
+	plain      string
+	compressed string
+}
+
+func (l logFile) before(other logFile) bool {
+	if l.date.Equal(other.date) {
+		return l.index < other.index
+	}
+	return l.date.Before(other.date)
+}
+
+// listFiles returns the files of the set with the given base, oldest
+// first.
+func listFiles(base string) ([]logFile, error) {
+	dir := filepath.Dir(base)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list existing files: %w", err)
+	}
+
+	prefix := filepath.Base(base) + "-"
+	byOrder := map[logFile]*logFile{}
+	var files []*logFile
+	for _, entry := range entries {
+		name := entry.Name()
+		if !strings.HasPrefix(name, prefix) {
+			continue
+		}
+		date, index, compressed, ok := parseFileName(name[len(prefix):])
+		if !ok {
+			continue
+		}
+
+		key := logFile{date: date, index: index}
+		f, exists := byOrder[key]
+		if !exists {
+			f = &logFile{date: date, index: index}
+			byOrder[key] = f
+			files = append(files, f)
+		}
+		if compressed {
+			f.compressed = filepath.Join(dir, name)
+		} else {
+			f.plain = filepath.Join(dir, name)
+		}
+	}
+
+	sort.Slice(files, func(i, j int) bool { return files[i].before(*files[j]) })
+	sorted := make([]logFile, len(files))
+	for i, f := range files {
+		sorted[i] = *f
+	}
+	return sorted, nil
+}
+
+// parseFileName parses the {yyyyMMdd}[-N].ndjson[.gz|.zst] part of a file
+// name.
+func parseFileName(name string) (date time.Time, index int, compressed bool, ok bool) {
+	for _, ext := range compressionExtensions {
+		if strings.HasSuffix(name, ext) {
+			name = strings.TrimSuffix(name, ext)
+			compressed = true
+			break
+		}
+	}
+	name, ok = strings.CutSuffix(name, fileExtension)
+	if !ok || len(name) < len(file.DateFormat) {
+		return time.Time{}, 0, false, false
+	}
+
+	date, err := time.Parse(file.DateFormat, name[:len(file.DateFormat)])
+	if err != nil {
+		return time.Time{}, 0, false, false
+	}
+	if rest := name[len(file.DateFormat):]; rest != "" {
+		if rest[0] != '-' {
+			return time.Time{}, 0, false, false
+		}
+		if index, err = strconv.Atoi(rest[1:]); err != nil || index < 1 {
+			return time.Time{}, 0, false, false
+		}
+	}
+	return date, index, compressed, true
+}
+
+// nextFileName returns the name of the next file of the set, starting a
+// new index if a file of the same day exists already.
+func nextFileName(base string, files []logFile, now time.Time) string {
+	prefix := base + "-" + now.Format(file.DateFormat)
+	date, _ := time.Parse(file.DateFormat, now.Format(file.DateFormat))
+
+	index := -1
+	for _, f := range files {
+		if f.date.Equal(date) && f.index > index {
+			index = f.index
+		}
+	}
+	if index < 0 {
+		return prefix + fileExtension
+	}
+	return prefix + "-" + strconv.Itoa(index+1) + fileExtension
+}
+
+func dirMode(permissions os.FileMode) os.FileMode {
+	mode := os.FileMode(0700)
+	if permissions&0070 > 0 {
+		mode |= 0050
+	}
+	if permissions&0007 > 0 {
+		mode |= 0005
+	}
+	return mode
+}
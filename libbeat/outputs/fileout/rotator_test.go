@@ -0,0 +1,227 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+//go:build !integration
+
+package fileout
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/zstd"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+)
+
+type testClock struct {
+	now time.Time
+}
+
+func (c *testClock) Now() time.Time {
+	return c.now
+}
+
+func newTestPool(t *testing.T, clock *testClock, settings rotateSettings, maxOpen int) *writerPool {
+	t.Helper()
+	settings.now = clock.Now
+	if settings.maxSizeBytes == 0 {
+		settings.maxSizeBytes = 1024
+	}
+	if settings.maxBackups == 0 {
+		settings.maxBackups = 7
+	}
+	if settings.compression == "" {
+		settings.compression = compressionNone
+	}
+	settings.permissions = 0600
+	return newWriterPool(logptest.NewTestingLogger(t, ""), &settings, maxOpen, true)
+}
+
+func fileNames(t *testing.T, dir string) []string {
+	t.Helper()
+	entries, err := os.ReadDir(dir)
+	require.NoError(t, err)
+	var names []string
+	for _, entry := range entries {
+		names = append(names, entry.Name())
+	}
+	sort.Strings(names)
+	return names
+}
+
+func write(t *testing.T, p *writerPool, base, data string) {
+	t.Helper()
+	w, err := p.get(base)
+	require.NoError(t, err)
+	_, err = w.Write([]byte(data))
+	require.NoError(t, err)
+	require.NoError(t, w.Sync())
+}
+
+func TestRotateBySize(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)}
+	p := newTestPool(t, clock, rotateSettings{maxSizeBytes: 10, maxBackups: 2}, 4)
+
+	base := filepath.Join(dir, "out")
+	for _, data := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+		write(t, p, base, data)
+	}
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"out-20240102-1.ndjson", "out-20240102-2.ndjson", "out-20240102-3.ndjson"}, fileNames(t, dir))
+}
+
+func TestRotateOnInterval(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{now: time.Date(2024, 1, 2, 23, 59, 0, 0, time.Local)}
+	p := newTestPool(t, clock, rotateSettings{interval: time.Hour}, 4)
+
+	base := filepath.Join(dir, "out")
+	write(t, p, base, "a\n")
+	clock.now = clock.now.Add(30 * time.Second)
+	write(t, p, base, "b\n")
+	clock.now = clock.now.Add(time.Minute)
+	write(t, p, base, "c\n")
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"out-20240102.ndjson", "out-20240103.ndjson"}, fileNames(t, dir))
+	data, err := os.ReadFile(filepath.Join(dir, "out-20240102.ndjson"))
+	require.NoError(t, err)
+	assert.Equal(t, "a\nb\n", string(data))
+}
+
+func TestArchiveExpired(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{now: time.Date(2024, 1, 2, 10, 30, 0, 0, time.Local)}
+	p := newTestPool(t, clock, rotateSettings{interval: time.Hour, compression: compressionGzip}, 4)
+
+	base := filepath.Join(dir, "out")
+	write(t, p, base, "a\n")
+	p.archiveExpired()
+	assert.Equal(t, 1, p.lru.Len(), "file closed before the end of its interval")
+
+	clock.now = clock.now.Add(time.Hour)
+	p.archiveExpired()
+	assert.Equal(t, 0, p.lru.Len())
+
+	write(t, p, base, "b\n")
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"out-20240102-1.ndjson", "out-20240102.ndjson.gz"}, fileNames(t, dir))
+}
+
+func TestCompression(t *testing.T) {
+	readers := map[string]func(io.Reader) (io.Reader, error){
+		compressionGzip: func(r io.Reader) (io.Reader, error) { return gzip.NewReader(r) },
+		compressionZstd: func(r io.Reader) (io.Reader, error) { return zstd.NewReader(r) },
+	}
+
+	for compression, newReader := range readers {
+		t.Run(compression, func(t *testing.T) {
+			dir := t.TempDir()
+			clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)}
+			p := newTestPool(t, clock, rotateSettings{maxSizeBytes: 10, maxBackups: 2, compression: compression}, 4)
+
+			base := filepath.Join(dir, "out")
+			for _, data := range []string{"aaaaaa\n", "bbbbbb\n", "cccccc\n", "dddddd\n"} {
+				write(t, p, base, data)
+			}
+			require.NoError(t, p.Close())
+
+			ext := compressionExtensions[compression]
+			assert.Equal(t, []string{
+				"out-20240102-1.ndjson" + ext,
+				"out-20240102-2.ndjson" + ext,
+				"out-20240102-3.ndjson",
+			}, fileNames(t, dir))
+
+			f, err := os.Open(filepath.Join(dir, "out-20240102-2.ndjson"+ext))
+			require.NoError(t, err)
+			defer f.Close()
+			r, err := newReader(f)
+			require.NoError(t, err)
+			data, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "cccccc\n", string(data))
+		})
+	}
+}
+
+func TestRotateOnStartup(t *testing.T) {
+	dir := t.TempDir()
+	clock := &testClock{now: time.Date(2024, 1, 2, 3, 4, 5, 0, time.Local)}
+	base := filepath.Join(dir, "out")
+
+	p := newTestPool(t, clock, rotateSettings{}, 1)
+	write(t, p, base, "a\n")
+	require.NoError(t, p.Close())
+	// The file was written by a previous run of the beat.
+	lastRun := time.Now().Add(-time.Minute)
+	require.NoError(t, os.Chtimes(filepath.Join(dir, "out-20240102.ndjson"), lastRun, lastRun))
+
+	// Reopening a file that was closed to stay within the limit appends
+	// to it, only the first open after startup rotates.
+	p = newTestPool(t, clock, rotateSettings{}, 1)
+	write(t, p, base, "b\n")
+	write(t, p, filepath.Join(dir, "other"), "c\n")
+	write(t, p, base, "d\n")
+	require.NoError(t, p.Close())
+
+	assert.Equal(t, []string{"other-20240102.ndjson", "out-20240102-1.ndjson", "out-20240102.ndjson"}, fileNames(t, dir))
+	data, err := os.ReadFile(filepath.Join(dir, "out-20240102-1.ndjson"))
+	require.NoError(t, err)
+	assert.Equal(t, "b\nd\n", string(data))
+}
+
+func TestParseFileName(t *testing.T) {
+	date := time.Date(2024, 1, 2, 0, 0, 0, 0, time.UTC)
+	for name, test := range map[string]struct {
+		index      int
+		compressed bool
+		invalid    bool
+	}{
+		"20240102.ndjson":          {},
+		"20240102-3.ndjson":        {index: 3},
+		"20240102-3.ndjson.gz":     {index: 3, compressed: true},
+		"20240102.ndjson.zst":      {compressed: true},
+		"20240102-3.ndjson.gz.tmp": {invalid: true},
+		"20240102-x.ndjson":        {invalid: true},
+		"2024010.ndjson":           {invalid: true},
+		"20240102.log":             {invalid: true},
+	} {
+		t.Run(name, func(t *testing.T) {
+			d, index, compressed, ok := parseFileName(name)
+			if test.invalid {
+				assert.False(t, ok)
+				return
+			}
+			require.True(t, ok)
+			assert.Equal(t, date, d)
+			assert.Equal(t, test.index, index)
+			assert.Equal(t, test.compressed, compressed)
+		})
+	}
+}
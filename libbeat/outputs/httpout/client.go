@@ -0,0 +1,343 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/version"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+	"github.com/elastic/elastic-agent-libs/useragent"
+)
+
+var errTooMany = errors.New("HTTP endpoint returned error 429 Too Many Requests, throttling connection")
+
+// maxErrorBodySize limits how much of an error response is read for logging.
+const maxErrorBodySize = 1024
+
+type client struct {
+	clientSettings
+
+	http *http.Client
+	log  *logp.Logger
+}
+
+type clientSettings struct {
+	url              string
+	path             *fmtstr.EventFormatString
+	method           string
+	params           url.Values
+	headers          map[string]string
+	username         string
+	password         string
+	bearerToken      string
+	batchFormat      string
+	compressionLevel int
+	codec            codec.Codec
+	index            string
+	statusPolicy     statusPolicy
+	transport        httpcommon.HTTPTransportSettings
+	userAgent        string
+
+	// The metrics observer, or a no-op placeholder if none is provided.
+	observer outputs.Observer
+}
+
+// request collects the encoded events to be sent to one rendered path.
+type request struct {
+	path   string
+	events []publisher.Event
+	body   bytes.Buffer
+}
+
+type publishStats struct {
+	acked   int // number of events acknowledged by the endpoint
+	fails   int // number of events with retryable failures
+	dropped int // number of events dropped due to the status policy
+	tooMany int // number of events receiving HTTP 429 Too Many Requests
+}
+
+func newClient(s clientSettings, log *logp.Logger) (*client, error) {
+	if s.observer == nil {
+		s.observer = outputs.NewNilObserver()
+	}
+	if s.userAgent == "" {
+		s.userAgent = useragent.UserAgent("Libbeat", version.GetDefaultVersion(), version.Commit(), version.BuildTime().String())
+	}
+	if _, err := url.Parse(s.url); err != nil {
+		return nil, fmt.Errorf("invalid url '%v': %w", s.url, err)
+	}
+	return &client{clientSettings: s, log: log}, nil
+}
+
+// Connect prepares the HTTP client. No request is sent to the endpoint, so
+// connection errors are only reported once a batch is published.
+func (c *client) Connect(_ context.Context) error {
+	if c.http != nil {
+		return nil
+	}
+
+	httpClient, err := c.transport.Client(
+		httpcommon.WithLogger(c.log),
+		httpcommon.WithIOStats(c.observer),
+		httpcommon.WithKeepaliveSettings{IdleConnTimeout: c.transport.IdleConnTimeout},
+		httpcommon.WithHeaderRoundTripper(map[string]string{"User-Agent": c.userAgent}),
+	)
+	if err != nil {
+		return err
+	}
+	c.http = httpClient
+	return nil
+}
+
+func (c *client) Close() error {
+	if c.http != nil {
+		c.http.CloseIdleConnections()
+		c.http = nil
+	}
+	return nil
+}
+
+func (c *client) String() string {
+	return "http(" + c.url + ")"
+}
+
+func (c *client) Publish(ctx context.Context, batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	requests, dropped := c.encodeRequests(events)
+	c.observer.PermanentErrors(dropped)
+
+	var (
+		stats   publishStats
+		retry   []publisher.Event
+		connErr error
+	)
+	for i, req := range requests {
+		status, err := c.send(ctx, req)
+		if err != nil {
+			// The endpoint could not be reached. Retry this request and all
+			// requests not attempted yet, the pipeline will reconnect.
+			c.log.Errorf("Failed to publish events: %v", err)
+			for _, pending := range requests[i:] {
+				retry = append(retry, pending.events...)
+				stats.fails += len(pending.events)
+			}
+			connErr = err
+			break
+		}
+
+		switch c.statusPolicy.action(status) {
+		case actionACK:
+			stats.acked += len(req.events)
+		case actionRetry:
+			if status == http.StatusTooManyRequests {
+				stats.tooMany += len(req.events)
+			}
+			stats.fails += len(req.events)
+			retry = append(retry, req.events...)
+		case actionDrop:
+			stats.dropped += len(req.events)
+		}
+	}
+
+	c.observer.AckedEvents(stats.acked)
+	c.observer.RetryableErrors(stats.fails)
+	c.observer.PermanentErrors(stats.dropped)
+	c.observer.ErrTooMany(stats.tooMany)
+
+	if len(retry) > 0 {
+		batch.RetryEvents(retry)
+	} else {
+		batch.ACK()
+	}
+
+	if connErr != nil {
+		return connErr
+	}
+	if stats.tooMany > 0 {
+		// We're being throttled, return an error so the connection is
+		// retried with exponential backoff.
+		return errTooMany
+	}
+	return nil
+}
+
+// encodeRequests encodes the events into one request body per rendered path,
+// keeping the order in which the paths first appear in the batch. It returns
+// the number of events that could not be encoded and have been dropped.
+func (c *client) encodeRequests(events []publisher.Event) ([]*request, int) {
+	var (
+		requests []*request
+		byPath   = map[string]*request{}
+		dropped  int
+	)
+
+	for i := range events {
+		event := &events[i]
+
+		path := ""
+		if c.path != nil {
+			var err error
+			path, err = c.path.Run(&event.Content)
+			if err != nil {
+				c.log.Errorf("Failed to render request path, dropping event: %v", err)
+				dropped++
+				continue
+			}
+		}
+
+		serialized, err := c.codec.Encode(c.index, &event.Content)
+		if err != nil {
+			c.log.Errorf("Failed to encode event, dropping event: %v", err)
+			dropped++
+			continue
+		}
+
+		req := byPath[path]
+		if req == nil {
+			req = &request{path: path}
+			byPath[path] = req
+			requests = append(requests, req)
+		}
+		c.appendEvent(req, serialized)
+		req.events = append(req.events, *event)
+	}
+
+	for _, req := range requests {
+		if c.batchFormat == batchFormatJSONArray {
+			req.body.WriteByte(']')
+		}
+	}
+	return requests, dropped
+}
+
+func (c *client) appendEvent(req *request, serialized []byte) {
+	switch c.batchFormat {
+	case batchFormatNDJSON:
+		req.body.Write(serialized)
+		req.body.WriteByte('\n')
+	default:
+		if req.body.Len() == 0 {
+			req.body.WriteByte('[')
+		} else {
+			req.body.WriteByte(',')
+		}
+		req.body.Write(serialized)
+	}
+}
+
+// send executes a request and returns the response status. An error is only
+// returned if the endpoint could not be reached or did not respond.
+func (c *client) send(ctx context.Context, req *request) (int, error) {
+	if c.http == nil {
+		return 0, errors.New("http client is not connected")
+	}
+
+	body, err := c.requestBody(req)
+	if err != nil {
+		return 0, err
+	}
+
+	reqURL := common.EncodeURLParams(c.url+req.path, c.params)
+	httpReq, err := http.NewRequestWithContext(ctx, c.method, reqURL, body)
+	if err != nil {
+		return 0, err
+	}
+	c.setHeaders(httpReq)
+
+	begin := time.Now()
+	resp, err := c.http.Do(httpReq)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 300 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, maxErrorBodySize))
+		c.log.Warnf("Request to %v with %d events failed (status=%v): %s",
+			req.path, len(req.events), resp.StatusCode, msg)
+	}
+	// Drain the body, so the connection can be reused.
+	_, _ = io.Copy(io.Discard, resp.Body)
+
+	duration := time.Since(begin)
+	c.observer.ReportLatency(duration)
+	c.log.Debugf("%d events have been sent to %v in %v (status=%v).",
+		len(req.events), reqURL, duration, resp.StatusCode)
+	return resp.StatusCode, nil
+}
+
+func (c *client) requestBody(req *request) (io.Reader, error) {
+	if c.compressionLevel == 0 {
+		return bytes.NewReader(req.body.Bytes()), nil
+	}
+
+	var buf bytes.Buffer
+	w, err := gzip.NewWriterLevel(&buf, c.compressionLevel)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(req.body.Bytes()); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return &buf, nil
+}
+
+func (c *client) setHeaders(req *http.Request) {
+	switch c.batchFormat {
+	case batchFormatNDJSON:
+		req.Header.Set("Content-Type", "application/x-ndjson")
+	default:
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if c.compressionLevel > 0 {
+		req.Header.Set("Content-Encoding", "gzip")
+	}
+
+	if c.username != "" || c.password != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	if c.bearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+c.bearerToken)
+	}
+
+	// User configured headers can override any of the defaults above.
+	for k, v := range c.headers {
+		req.Header.Set(k, v)
+	}
+}
@@ -0,0 +1,321 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/klauspost/compress/gzip"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+
+	_ "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+)
+
+type recordedRequest struct {
+	path    string
+	headers http.Header
+	events  []mapstr.M
+}
+
+type mockEndpoint struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	requests []recordedRequest
+	status   func(path string) int
+}
+
+func newMockEndpoint(t *testing.T, status func(path string) int) *mockEndpoint {
+	m := &mockEndpoint{status: status}
+	m.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body io.Reader = r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			require.NoError(t, err)
+			body = gz
+		}
+
+		var events []mapstr.M
+		if r.Header.Get("Content-Type") == "application/x-ndjson" {
+			scanner := bufio.NewScanner(body)
+			for scanner.Scan() {
+				var event mapstr.M
+				require.NoError(t, json.Unmarshal(scanner.Bytes(), &event))
+				events = append(events, event)
+			}
+		} else {
+			require.NoError(t, json.NewDecoder(body).Decode(&events))
+		}
+
+		m.mu.Lock()
+		m.requests = append(m.requests, recordedRequest{
+			path:    r.URL.Path,
+			headers: r.Header.Clone(),
+			events:  events,
+		})
+		m.mu.Unlock()
+
+		w.WriteHeader(m.status(r.URL.Path))
+	}))
+	t.Cleanup(m.Close)
+	return m
+}
+
+func (m *mockEndpoint) recorded() []recordedRequest {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return append([]recordedRequest(nil), m.requests...)
+}
+
+func newTestClient(t *testing.T, url string, modify func(*clientSettings)) *client {
+	enc, err := codec.CreateEncoder(beat.Info{Version: "9.9.9"}, codec.Config{})
+	require.NoError(t, err)
+
+	policy, err := newStatusPolicy(statusPolicyConfig{})
+	require.NoError(t, err)
+
+	settings := clientSettings{
+		url:          url,
+		method:       http.MethodPost,
+		batchFormat:  batchFormatJSONArray,
+		codec:        enc,
+		index:        "testbeat",
+		statusPolicy: policy,
+		transport:    httpcommon.DefaultHTTPTransportSettings(),
+	}
+	if modify != nil {
+		modify(&settings)
+	}
+
+	c, err := newClient(settings, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	require.NoError(t, c.Connect(context.Background()))
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func testEvents(datasets ...string) []beat.Event {
+	events := make([]beat.Event, len(datasets))
+	for i, dataset := range datasets {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields: mapstr.M{
+				"message":     "hello",
+				"data_stream": mapstr.M{"dataset": dataset},
+				"seq":         i,
+			},
+		}
+	}
+	return events
+}
+
+func TestPublishBatchFormats(t *testing.T) {
+	for _, format := range []string{batchFormatJSONArray, batchFormatNDJSON} {
+		for _, level := range []int{0, 5} {
+			endpoint := newMockEndpoint(t, func(string) int { return http.StatusOK })
+			client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+				s.batchFormat = format
+				s.compressionLevel = level
+			})
+
+			batch := outest.NewBatch(testEvents("a", "b", "c")...)
+			require.NoError(t, client.Publish(context.Background(), batch))
+
+			requests := endpoint.recorded()
+			require.Len(t, requests, 1, "format=%v level=%v", format, level)
+			assert.Len(t, requests[0].events, 3)
+			assert.Equal(t, "hello", requests[0].events[0]["message"])
+			assert.Contains(t, requests[0].events[0], "@metadata")
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+		}
+	}
+}
+
+func TestPublishTemplatedPath(t *testing.T) {
+	endpoint := newMockEndpoint(t, func(string) int { return http.StatusOK })
+	client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+		s.path = fmtstr.MustCompileEvent("/ingest/%{[data_stream.dataset]}")
+	})
+
+	batch := outest.NewBatch(testEvents("nginx", "system", "nginx")...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	requests := endpoint.recorded()
+	require.Len(t, requests, 2)
+	assert.Equal(t, "/ingest/nginx", requests[0].path)
+	assert.Len(t, requests[0].events, 2)
+	assert.Equal(t, "/ingest/system", requests[1].path)
+	assert.Len(t, requests[1].events, 1)
+}
+
+func TestPublishAuthHeaders(t *testing.T) {
+	endpoint := newMockEndpoint(t, func(string) int { return http.StatusOK })
+
+	t.Run("basic auth", func(t *testing.T) {
+		client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+			s.username = "beat"
+			s.password = "secret"
+			s.headers = map[string]string{"X-Custom": "value"}
+		})
+		require.NoError(t, client.Publish(context.Background(), outest.NewBatch(testEvents("a")...)))
+
+		requests := endpoint.recorded()
+		last := requests[len(requests)-1]
+		assert.Equal(t, "Basic YmVhdDpzZWNyZXQ=", last.headers.Get("Authorization"))
+		assert.Equal(t, "value", last.headers.Get("X-Custom"))
+	})
+
+	t.Run("bearer token", func(t *testing.T) {
+		client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+			s.bearerToken = "token"
+		})
+		require.NoError(t, client.Publish(context.Background(), outest.NewBatch(testEvents("a")...)))
+
+		requests := endpoint.recorded()
+		last := requests[len(requests)-1]
+		assert.Equal(t, "Bearer token", last.headers.Get("Authorization"))
+	})
+}
+
+func TestPublishStatusPolicy(t *testing.T) {
+	tests := map[string]struct {
+		status     int
+		policy     statusPolicyConfig
+		wantSignal outest.BatchSignalTag
+		wantErr    error
+	}{
+		"2xx is acked": {
+			status:     http.StatusAccepted,
+			wantSignal: outest.BatchACK,
+		},
+		"5xx is retried by default": {
+			status:     http.StatusServiceUnavailable,
+			wantSignal: outest.BatchRetryEvents,
+		},
+		"429 is retried and throttles": {
+			status:     http.StatusTooManyRequests,
+			wantSignal: outest.BatchRetryEvents,
+			wantErr:    errTooMany,
+		},
+		"4xx is dropped by default": {
+			status:     http.StatusBadRequest,
+			wantSignal: outest.BatchACK,
+		},
+		"exact code overrides class": {
+			status:     http.StatusNotImplemented,
+			policy:     statusPolicyConfig{Drop: []string{"501"}, Retry: []string{"5xx"}},
+			wantSignal: outest.BatchACK,
+		},
+		"configured retry on 4xx": {
+			status:     http.StatusConflict,
+			policy:     statusPolicyConfig{Retry: []string{"409"}},
+			wantSignal: outest.BatchRetryEvents,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			endpoint := newMockEndpoint(t, func(string) int { return test.status })
+			policy, err := newStatusPolicy(test.policy)
+			require.NoError(t, err)
+			client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+				s.statusPolicy = policy
+			})
+
+			batch := outest.NewBatch(testEvents("a", "b")...)
+			err = client.Publish(context.Background(), batch)
+			assert.Equal(t, test.wantErr, err)
+
+			require.Len(t, batch.Signals, 1)
+			assert.Equal(t, test.wantSignal, batch.Signals[0].Tag)
+			if test.wantSignal == outest.BatchRetryEvents {
+				assert.Len(t, batch.Signals[0].Events, 2)
+			}
+		})
+	}
+}
+
+func TestPublishRetriesOnlyFailedPaths(t *testing.T) {
+	endpoint := newMockEndpoint(t, func(path string) int {
+		if path == "/fail" {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+		s.path = fmtstr.MustCompileEvent("/%{[data_stream.dataset]}")
+	})
+
+	batch := outest.NewBatch(testEvents("ok", "fail", "ok", "fail")...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	require.Len(t, batch.Signals[0].Events, 2)
+	for _, event := range batch.Signals[0].Events {
+		dataset, _ := event.Content.GetValue("data_stream.dataset")
+		assert.Equal(t, "fail", dataset)
+	}
+}
+
+func TestPublishConnectionError(t *testing.T) {
+	endpoint := newMockEndpoint(t, func(string) int { return http.StatusOK })
+	client := newTestClient(t, endpoint.URL, nil)
+	endpoint.Close()
+
+	batch := outest.NewBatch(testEvents("a", "b")...)
+	err := client.Publish(context.Background(), batch)
+	require.Error(t, err)
+
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 2)
+}
+
+func TestPublishDropsUnencodableEvents(t *testing.T) {
+	endpoint := newMockEndpoint(t, func(string) int { return http.StatusOK })
+	client := newTestClient(t, endpoint.URL, func(s *clientSettings) {
+		s.path = fmtstr.MustCompileEvent("/%{[missing.field]}")
+	})
+
+	batch := outest.NewBatch(testEvents("a")...)
+	require.NoError(t, client.Publish(context.Background(), batch))
+
+	assert.Empty(t, endpoint.recorded())
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+}
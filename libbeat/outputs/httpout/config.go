@@ -0,0 +1,120 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/common/fmtstr"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/transport/httpcommon"
+)
+
+const (
+	batchFormatJSONArray = "json_array"
+	batchFormatNDJSON    = "ndjson"
+)
+
+type httpConfig struct {
+	Protocol         string                    `config:"protocol"`
+	Path             *fmtstr.EventFormatString `config:"path"`
+	Method           string                    `config:"method"`
+	Params           map[string]string         `config:"parameters"`
+	Headers          map[string]string         `config:"headers"`
+	Username         string                    `config:"username"`
+	Password         string                    `config:"password"`
+	BearerToken      string                    `config:"bearer_token"`
+	BatchFormat      string                    `config:"batch_format"`
+	CompressionLevel int                       `config:"compression_level" validate:"min=0, max=9"`
+	Codec            codec.Config              `config:"codec"`
+	LoadBalance      bool                      `config:"loadbalance"`
+	BulkMaxSize      int                       `config:"bulk_max_size"`
+	MaxRetries       int                       `config:"max_retries"`
+	Backoff          backoff                   `config:"backoff"`
+	StatusPolicy     statusPolicyConfig        `config:"status_policy"`
+	Queue            config.Namespace          `config:"queue"`
+
+	Transport httpcommon.HTTPTransportSettings `config:",inline"`
+}
+
+type backoff struct {
+	Init time.Duration
+	Max  time.Duration
+}
+
+// statusPolicyConfig lists the HTTP status codes that decide what happens to
+// the events of a request. Entries are either a status code (`503`) or a
+// status class (`5xx`).
+type statusPolicyConfig struct {
+	ACK   []string `config:"ack"`
+	Retry []string `config:"retry"`
+	Drop  []string `config:"drop"`
+}
+
+const (
+	defaultBulkMaxSize = 1600
+)
+
+var defaultConfig = httpConfig{
+	Method:           http.MethodPost,
+	BatchFormat:      batchFormatJSONArray,
+	CompressionLevel: 0,
+	LoadBalance:      true,
+	BulkMaxSize:      defaultBulkMaxSize,
+	MaxRetries:       3,
+	Backoff: backoff{
+		Init: 1 * time.Second,
+		Max:  60 * time.Second,
+	},
+	Transport: httpcommon.DefaultHTTPTransportSettings(),
+}
+
+func (c *httpConfig) Validate() error {
+	switch c.BatchFormat {
+	case batchFormatJSONArray, batchFormatNDJSON:
+	default:
+		return fmt.Errorf("unsupported batch_format '%v', must be one of %v or %v",
+			c.BatchFormat, batchFormatJSONArray, batchFormatNDJSON)
+	}
+
+	switch strings.ToUpper(c.Method) {
+	case http.MethodPost, http.MethodPut, http.MethodPatch:
+	default:
+		return fmt.Errorf("unsupported method '%v', must be one of POST, PUT or PATCH", c.Method)
+	}
+
+	// The request body frames the encoded events as JSON.
+	if name := c.Codec.Namespace.Name(); name != "" && name != "json" {
+		return fmt.Errorf("unsupported codec '%v', the http output requires the json codec", name)
+	}
+
+	if c.BearerToken != "" && (c.Username != "" || c.Password != "") {
+		return errors.New("cannot set both bearer_token and username/password")
+	}
+
+	if _, err := newStatusPolicy(c.StatusPolicy); err != nil {
+		return err
+	}
+
+	return nil
+}
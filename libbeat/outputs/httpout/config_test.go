@@ -0,0 +1,125 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+func TestConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		input   map[string]interface{}
+		wantErr string
+	}{
+		"defaults": {
+			input: map[string]interface{}{},
+		},
+		"ndjson with gzip": {
+			input: map[string]interface{}{
+				"batch_format":      "ndjson",
+				"compression_level": 3,
+			},
+		},
+		"status policy with codes and classes": {
+			input: map[string]interface{}{
+				"status_policy.retry": []interface{}{503, "429"},
+				"status_policy.drop":  []interface{}{"5xx"},
+				"status_policy.ack":   []interface{}{409},
+			},
+		},
+		"unknown batch format": {
+			input:   map[string]interface{}{"batch_format": "csv"},
+			wantErr: "unsupported batch_format",
+		},
+		"unsupported method": {
+			input:   map[string]interface{}{"method": "GET"},
+			wantErr: "unsupported method",
+		},
+		"json codec": {
+			input: map[string]interface{}{"codec.json.pretty": false},
+		},
+		"non-json codec": {
+			input:   map[string]interface{}{"codec.format.string": "%{[message]}"},
+			wantErr: "unsupported codec 'format'",
+		},
+		"bearer token and basic auth": {
+			input: map[string]interface{}{
+				"bearer_token": "token",
+				"username":     "user",
+			},
+			wantErr: "cannot set both bearer_token and username/password",
+		},
+		"invalid status code": {
+			input:   map[string]interface{}{"status_policy.retry": []interface{}{"600"}},
+			wantErr: "invalid status code",
+		},
+		"invalid status class": {
+			input:   map[string]interface{}{"status_policy.drop": []interface{}{"9xx"}},
+			wantErr: "invalid status class",
+		},
+		"conflicting status rules": {
+			input: map[string]interface{}{
+				"status_policy.retry": []interface{}{"503"},
+				"status_policy.drop":  []interface{}{"503"},
+			},
+			wantErr: "configured for both",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			cfg := config.MustNewConfigFrom(test.input)
+			c := defaultConfig
+			err := cfg.Unpack(&c)
+			if test.wantErr == "" {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorContains(t, err, test.wantErr)
+			}
+		})
+	}
+}
+
+func TestStatusPolicyAction(t *testing.T) {
+	policy, err := newStatusPolicy(statusPolicyConfig{
+		ACK:   []string{"409"},
+		Retry: []string{"4xx"},
+		Drop:  []string{"503", "413"},
+	})
+	require.NoError(t, err)
+
+	tests := map[int]statusAction{
+		200: actionACK,
+		204: actionACK,
+		409: actionACK,
+		400: actionRetry,
+		413: actionDrop,
+		429: actionRetry,
+		500: actionRetry,
+		503: actionDrop,
+		301: actionDrop,
+	}
+	for status, want := range tests {
+		assert.Equal(t, want, policy.action(status), "status %v", status)
+	}
+}
@@ -0,0 +1,124 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package httpout
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// statusAction is the action taken on the events of a request once the
+// server has answered with a given status code.
+type statusAction uint8
+
+const (
+	actionACK statusAction = iota
+	actionRetry
+	actionDrop
+)
+
+func (a statusAction) String() string {
+	switch a {
+	case actionACK:
+		return "ack"
+	case actionRetry:
+		return "retry"
+	default:
+		return "drop"
+	}
+}
+
+// statusPolicy maps response status codes to actions. Exact status codes take
+// precedence over status classes, so `drop: [503]` together with
+// `retry: [5xx]` only drops 503 responses. Codes not matched by any configured
+// rule fall back to the defaults: 2xx is acknowledged, 408, 429 and 5xx are
+// retried and everything else is dropped.
+type statusPolicy struct {
+	codes   map[int]statusAction
+	classes map[int]statusAction
+}
+
+func newStatusPolicy(cfg statusPolicyConfig) (statusPolicy, error) {
+	p := statusPolicy{
+		codes:   map[int]statusAction{},
+		classes: map[int]statusAction{},
+	}
+
+	rules := []struct {
+		action  statusAction
+		entries []string
+	}{
+		{actionACK, cfg.ACK},
+		{actionRetry, cfg.Retry},
+		{actionDrop, cfg.Drop},
+	}
+	for _, rule := range rules {
+		for _, entry := range rule.entries {
+			if err := p.add(entry, rule.action); err != nil {
+				return statusPolicy{}, err
+			}
+		}
+	}
+	return p, nil
+}
+
+func (p *statusPolicy) add(entry string, action statusAction) error {
+	entry = strings.ToLower(strings.TrimSpace(entry))
+
+	table, key := p.codes, 0
+	if len(entry) == 3 && strings.HasSuffix(entry, "xx") {
+		table = p.classes
+		class, err := strconv.Atoi(entry[:1])
+		if err != nil || class < 1 || class > 5 {
+			return fmt.Errorf("invalid status class '%v' in status_policy", entry)
+		}
+		key = class
+	} else {
+		code, err := strconv.Atoi(entry)
+		if err != nil || code < 100 || code > 599 {
+			return fmt.Errorf("invalid status code '%v' in status_policy", entry)
+		}
+		key = code
+	}
+
+	if prev, exists := table[key]; exists && prev != action {
+		return fmt.Errorf("status '%v' is configured for both '%v' and '%v' in status_policy", entry, prev, action)
+	}
+	table[key] = action
+	return nil
+}
+
+// action returns the action to apply for a response status code.
+func (p *statusPolicy) action(status int) statusAction {
+	if action, exists := p.codes[status]; exists {
+		return action
+	}
+	if action, exists := p.classes[status/100]; exists {
+		return action
+	}
+	switch {
+	case status >= 200 && status < 300:
+		return actionACK
+	case status == http.StatusRequestTimeout, status == http.StatusTooManyRequests, status >= 500:
+		return actionRetry
+	default:
+		return actionDrop
+	}
+}
@@ -66,6 +66,10 @@ type msgRef struct {
 	failed []publisher.Event
 	batch  publisher.Batch
 
+	// txnDone is closed once all messages of a transaction have been
+	// produced. The batch is signaled when the transaction ends.
+	txnDone chan struct{}
+
 	err error
 }
 
@@ -169,6 +173,10 @@ func (c *client) Close() error {
 }
 
 func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
+	if c.producer.IsTransactional() {
+		return c.publishTransaction(batch)
+	}
+
 	events := batch.Events()
 	c.observer.NewBatch(len(events))
 
@@ -199,6 +207,89 @@ func (c *client) Publish(_ context.Context, batch publisher.Batch) error {
 	return nil
 }
 
+// publishTransaction publishes the events of the batch in a transaction,
+// and waits for the transaction to be committed. If any message of the
+// transaction fails, the transaction is aborted and the events are
+// retried, so that consumers reading committed messages see each event
+// only once.
+func (c *client) publishTransaction(batch publisher.Batch) error {
+	events := batch.Events()
+	c.observer.NewBatch(len(events))
+
+	if err := c.producer.BeginTxn(); err != nil {
+		c.observer.RetryableErrors(len(events))
+		batch.Retry()
+		return fmt.Errorf("failed to begin kafka transaction: %w", err)
+	}
+
+	ref := &msgRef{
+		client:  c,
+		count:   int32(len(events)), //nolint:gosec //keep old behavior
+		total:   len(events),
+		batch:   batch,
+		txnDone: make(chan struct{}),
+	}
+	if len(events) == 0 {
+		close(ref.txnDone)
+	}
+
+	sent := make([]*message, 0, len(events))
+	ch := c.producer.Input()
+	for i := range events {
+		d := &events[i]
+		msg, err := c.getEventMessage(d)
+		if err != nil {
+			c.log.Errorf("Dropping event: %+v", err)
+			ref.done()
+			c.observer.PermanentErrors(1)
+			continue
+		}
+
+		msg.ref = ref
+		msg.initProducerMessage()
+		sent = append(sent, msg)
+		ch <- &msg.msg
+	}
+
+	<-ref.txnDone
+
+	err := ref.err
+	if err == nil && len(ref.failed) > 0 {
+		// Messages rejected by the open circuit breaker are added to the
+		// failed list without setting an error.
+		err = breaker.ErrBreakerOpen
+	}
+	if err == nil && !anyDropped(sent) {
+		if err = c.producer.CommitTxn(); err == nil {
+			batch.ACK()
+			c.observer.AckedEvents(len(sent))
+			return nil
+		}
+	}
+	if err == nil {
+		err = errors.New("messages were dropped")
+	}
+
+	// Events that were dropped for permanent errors are not retried.
+	var retry []publisher.Event
+	for _, msg := range sent {
+		if !msg.dropped {
+			retry = append(retry, msg.data)
+		}
+	}
+	batch.RetryEvents(retry)
+	c.observer.RetryableErrors(len(retry))
+	c.observer.TransactionAborted()
+	c.log.Errorf("Aborting kafka transaction: %+v", err)
+
+	if abortErr := c.producer.AbortTxn(); abortErr != nil {
+		// The producer can't be used anymore. Returning the error makes
+		// the pipeline reconnect, which creates a new producer.
+		return fmt.Errorf("failed to abort kafka transaction: %w", abortErr)
+	}
+	return nil
+}
+
 func (c *client) String() string {
 	return "kafka(" + strings.Join(c.hosts, ",") + ")"
 }
@@ -385,16 +476,19 @@ func (r *msgRef) fail(msg *message, err error) {
 	case errors.Is(err, sarama.ErrInvalidMessage):
 		r.client.log.Errorf("Kafka (topic=%v): dropping invalid message", msg.topic)
 		r.client.observer.PermanentErrors(1)
+		msg.dropped = true
 
 	case errors.Is(err, sarama.ErrMessageSizeTooLarge) || errors.Is(err, sarama.ErrInvalidMessageSize):
 		r.client.log.Errorf("Kafka (topic=%v): dropping too large message of size %v.",
 			msg.topic,
 			len(msg.key)+len(msg.value))
 		r.client.observer.PermanentErrors(1)
+		msg.dropped = true
 
 	case isAuthError(err):
 		r.client.log.Errorf("Kafka (topic=%v): authorisation error: %s", msg.topic, err)
 		r.client.observer.PermanentErrors(1)
+		msg.dropped = true
 
 	case errors.Is(err, breaker.ErrBreakerOpen):
 		// Add this message to the failed list, but don't overwrite r.err since
@@ -418,6 +512,11 @@ func (r *msgRef) dec() {
 		return
 	}
 
+	if r.txnDone != nil {
+		close(r.txnDone)
+		return
+	}
+
 	r.client.log.Debug("finished kafka batch")
 	stats := r.client.observer
 
@@ -439,6 +538,17 @@ func (r *msgRef) dec() {
 	}
 }
 
+// anyDropped reports whether any of the messages was dropped for a
+// permanent error.
+func anyDropped(msgs []*message) bool {
+	for _, msg := range msgs {
+		if msg.dropped {
+			return true
+		}
+	}
+	return false
+}
+
 func (c *client) Test(d testing.Driver) {
 	if c.config.Net.TLS.Enable {
 		d.Warn("TLS", "Kafka output doesn't support TLS testing")
@@ -0,0 +1,321 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package kafka
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/eapache/go-resiliency/breaker"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/outputs/outest"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/sarama"
+	"github.com/elastic/sarama/mocks"
+)
+
+const (
+	testTopic           = "test-topic"
+	testTransactionalID = "test-txn"
+)
+
+// newMockBroker returns a broker that accepts the requests of idempotent
+// and transactional producers. produce is the response to produce
+// requests.
+func newMockBroker(t *testing.T, produce sarama.MockResponse) *sarama.MockBroker {
+	broker := sarama.NewMockBroker(t, 1)
+	t.Cleanup(broker.Close)
+
+	broker.SetHandlerByMap(map[string]sarama.MockResponse{
+		"MetadataRequest": sarama.NewMockMetadataResponse(t).
+			SetController(broker.BrokerID()).
+			SetBroker(broker.Addr(), broker.BrokerID()).
+			SetLeader(testTopic, 0, broker.BrokerID()),
+		"FindCoordinatorRequest": sarama.NewMockFindCoordinatorResponse(t).
+			SetCoordinator(sarama.CoordinatorTransaction, testTransactionalID, broker),
+		"InitProducerIDRequest": sarama.NewMockInitProducerIDResponse(t).
+			SetProducerID(1),
+		"AddPartitionsToTxnRequest": sarama.NewMockWrapper(&sarama.AddPartitionsToTxnResponse{
+			Errors: map[string][]*sarama.PartitionError{
+				testTopic: {{Partition: 0, Err: sarama.ErrNoError}},
+			},
+		}),
+		"EndTxnRequest":  sarama.NewMockWrapper(&sarama.EndTxnResponse{Err: sarama.ErrNoError}),
+		"ProduceRequest": produce,
+	})
+	return broker
+}
+
+func newTestClient(t *testing.T, broker *sarama.MockBroker, settings mapstr.M) (*client, *monitoring.Registry) {
+	t.Helper()
+	c, reg := newUnconnectedTestClient(t, broker.Addr(), settings)
+	require.NoError(t, c.Connect(context.Background()))
+	t.Cleanup(func() { _ = c.Close() })
+	return c, reg
+}
+
+func newUnconnectedTestClient(t *testing.T, host string, settings mapstr.M) (*client, *monitoring.Registry) {
+	t.Helper()
+	logger := logptest.NewTestingLogger(t, "")
+
+	cfg := config.MustNewConfigFrom(mapstr.M{
+		"hosts":       []string{host},
+		"topic":       testTopic,
+		"max_retries": 1,
+		"backoff":     mapstr.M{"init": "1ms", "max": "10ms"},
+		"metadata":    mapstr.M{"retry": mapstr.M{"backoff": "1ms"}},
+	})
+	require.NoError(t, cfg.Merge(settings))
+
+	kConfig, err := readConfig(cfg)
+	require.NoError(t, err)
+	libCfg, err := newSaramaConfig(logger, kConfig)
+	require.NoError(t, err)
+	libCfg.Producer.Transaction.Retry.Backoff = time.Millisecond
+
+	topic, err := buildTopicSelector(cfg)
+	require.NoError(t, err)
+
+	reg := monitoring.NewRegistry()
+	c, err := newKafkaClient(outputs.NewStats(reg), kConfig.Hosts, "testbeat", nil, topic, nil,
+		json.New("1.2.3", json.Config{}), libCfg, logger)
+	require.NoError(t, err)
+	return c, reg
+}
+
+// connectMockProducer makes the client publish to a mock producer.
+func connectMockProducer(t *testing.T, c *client) *mocks.AsyncProducer {
+	t.Helper()
+	producer := mocks.NewAsyncProducer(t, &c.config)
+	c.producer = producer
+	c.wg.Add(2)
+	go c.successWorker(producer.Successes())
+	go c.errorWorker(producer.Errors())
+	t.Cleanup(func() { _ = c.Close() })
+	return producer
+}
+
+func testEvents(n int) []beat.Event {
+	events := make([]beat.Event, n)
+	for i := range events {
+		events[i] = beat.Event{
+			Timestamp: time.Now(),
+			Fields:    mapstr.M{"message": randString(10)},
+		}
+	}
+	return events
+}
+
+// signals returns a channel that receives the signals of the batch, as
+// the non-transactional producer signals batches asynchronously.
+func signals(batch *outest.Batch) <-chan outest.BatchSignal {
+	ch := make(chan outest.BatchSignal, 1)
+	batch.OnSignal = func(sig outest.BatchSignal) { ch <- sig }
+	return ch
+}
+
+func waitForSignal(t *testing.T, signals <-chan outest.BatchSignal) outest.BatchSignal {
+	t.Helper()
+	select {
+	case sig := <-signals:
+		return sig
+	case <-time.After(10 * time.Second):
+		t.Fatal("timeout waiting for batch to be signaled")
+		return outest.BatchSignal{}
+	}
+}
+
+func initProducerIDCount(broker *sarama.MockBroker) int {
+	count := 0
+	for _, rr := range broker.History() {
+		if _, ok := rr.Request.(*sarama.InitProducerIDRequest); ok {
+			count++
+		}
+	}
+	return count
+}
+
+func endTxnResults(broker *sarama.MockBroker) []bool {
+	var results []bool
+	for _, rr := range broker.History() {
+		if req, ok := rr.Request.(*sarama.EndTxnRequest); ok {
+			results = append(results, req.TransactionResult)
+		}
+	}
+	return results
+}
+
+func TestIdempotentProducer(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t))
+	c, _ := newTestClient(t, broker, mapstr.M{"idempotent": true})
+
+	assert.True(t, c.config.Producer.Idempotent)
+	assert.Equal(t, sarama.WaitForAll, c.config.Producer.RequiredAcks)
+	assert.False(t, c.producer.IsTransactional())
+
+	batch := outest.NewBatch(testEvents(3)...)
+	batchSignals := signals(batch)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	assert.Equal(t, outest.BatchACK, waitForSignal(t, batchSignals).Tag)
+	assert.Equal(t, 1, initProducerIDCount(broker))
+}
+
+func TestTransactionCommit(t *testing.T) {
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t))
+	c, reg := newTestClient(t, broker, mapstr.M{"transactional_id": testTransactionalID})
+	require.True(t, c.producer.IsTransactional())
+
+	for i := 0; i < 2; i++ {
+		batch := outest.NewBatch(testEvents(5)...)
+		require.NoError(t, c.Publish(context.Background(), batch))
+		require.Len(t, batch.Signals, 1)
+		assert.Equal(t, outest.BatchACK, batch.Signals[0].Tag)
+	}
+
+	assert.Equal(t, []bool{true, true}, endTxnResults(broker))
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(10), snapshot.Ints["events.acked"])
+	assert.Equal(t, int64(0), snapshot.Ints["transactions.aborted"])
+}
+
+func TestTransactionAbort(t *testing.T) {
+	// The first batch fails with an error that is not retried by Sarama.
+	// Its transaction is aborted and the events are retried by the
+	// pipeline, in a new transaction.
+	produce := sarama.NewMockSequence(
+		sarama.NewMockProduceResponse(t).SetError(testTopic, 0, sarama.ErrUnknown),
+		sarama.NewMockProduceResponse(t),
+	)
+	broker := newMockBroker(t, produce)
+	c, reg := newTestClient(t, broker, mapstr.M{
+		"transactional_id": testTransactionalID,
+		// Send each batch in a single request, so that the failure affects
+		// all of its events.
+		"bulk_flush_frequency": "50ms",
+	})
+
+	batch := outest.NewBatch(testEvents(5)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 5)
+
+	retry := outest.NewBatch(eventContents(batch.Signals[0].Events)...)
+	require.NoError(t, c.Publish(context.Background(), retry))
+	require.Len(t, retry.Signals, 1)
+	assert.Equal(t, outest.BatchACK, retry.Signals[0].Tag)
+
+	assert.Equal(t, []bool{false, true}, endTxnResults(broker))
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(1), snapshot.Ints["transactions.aborted"])
+	assert.Equal(t, int64(5), snapshot.Ints["events.failed"])
+	assert.Equal(t, int64(5), snapshot.Ints["events.acked"])
+}
+
+func TestTransactionDropsInvalidMessages(t *testing.T) {
+	// Messages that fail with a permanent error abort the transaction, but
+	// they are dropped instead of retried.
+	produce := sarama.NewMockProduceResponse(t).SetError(testTopic, 0, sarama.ErrMessageSizeTooLarge)
+	broker := newMockBroker(t, produce)
+	c, reg := newTestClient(t, broker, mapstr.M{"transactional_id": testTransactionalID})
+
+	batch := outest.NewBatch(testEvents(3)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Empty(t, batch.Signals[0].Events)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(1), snapshot.Ints["transactions.aborted"])
+	assert.Equal(t, int64(3), snapshot.Ints["events.dropped"])
+}
+
+func TestTransactionAbortsWhenBreakerIsOpen(t *testing.T) {
+	// Messages for an unknown topic fail to be partitioned, and after 3
+	// failures Sarama's circuit breaker rejects the next messages for the
+	// topic with breaker.ErrBreakerOpen. The transaction of those messages
+	// must not be committed.
+	broker := newMockBroker(t, sarama.NewMockProduceResponse(t))
+	c, reg := newTestClient(t, broker, mapstr.M{
+		"transactional_id": testTransactionalID,
+		"topic":            "%{[topic]}",
+	})
+
+	unknownTopicEvents := func(n int) []beat.Event {
+		events := testEvents(n)
+		for i := range events {
+			events[i].Fields["topic"] = "unknown-topic"
+		}
+		return events
+	}
+
+	batch := outest.NewBatch(unknownTopicEvents(3)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 3)
+
+	batch = outest.NewBatch(unknownTopicEvents(1)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 1)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(2), snapshot.Ints["transactions.aborted"])
+	assert.Equal(t, int64(0), snapshot.Ints["events.acked"])
+}
+
+func TestTransactionAbortsOnBreakerErrors(t *testing.T) {
+	// The mock producer commits transactions even if messages failed, so
+	// the client has to detect the failures reported with
+	// breaker.ErrBreakerOpen itself.
+	c, reg := newUnconnectedTestClient(t, "localhost:9092", mapstr.M{"transactional_id": testTransactionalID})
+	producer := connectMockProducer(t, c)
+	producer.ExpectInputAndSucceed()
+	producer.ExpectInputAndFail(breaker.ErrBreakerOpen)
+	producer.ExpectInputAndSucceed()
+
+	batch := outest.NewBatch(testEvents(3)...)
+	require.NoError(t, c.Publish(context.Background(), batch))
+	require.Len(t, batch.Signals, 1)
+	assert.Equal(t, outest.BatchRetryEvents, batch.Signals[0].Tag)
+	assert.Len(t, batch.Signals[0].Events, 3)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(1), snapshot.Ints["transactions.aborted"])
+	assert.Equal(t, int64(0), snapshot.Ints["events.acked"])
+}
+
+func eventContents(events []publisher.Event) []beat.Event {
+	contents := make([]beat.Event, len(events))
+	for i, event := range events {
+		contents[i] = event.Content
+	}
+	return contents
+}
@@ -76,6 +76,9 @@ type kafkaConfig struct {
 	Codec              codec.Config              `config:"codec"`
 	Sasl               kafka.SaslConfig          `config:"sasl"`
 	EnableFAST         bool                      `config:"enable_krb5_fast"`
+	Idempotent         bool                      `config:"idempotent"`
+	TransactionalID    string                    `config:"transactional_id"`
+	TransactionTimeout time.Duration             `config:"transaction_timeout" validate:"min=1"`
 	Queue              config.Namespace          `config:"queue"`
 
 	// Currently only used for validation. Those values are later
@@ -142,10 +145,11 @@ func defaultConfig() kafkaConfig {
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
 		},
-		ClientID:       "beats",
-		ChanBufferSize: 256,
-		Username:       "",
-		Password:       "",
+		ClientID:           "beats",
+		ChanBufferSize:     256,
+		Username:           "",
+		Password:           "",
+		TransactionTimeout: 1 * time.Minute,
 	}
 }
 
@@ -181,6 +185,15 @@ func (c *kafkaConfig) Validate() error {
 		}
 	}
 
+	if c.idempotent() {
+		if c.RequiredACKs != nil && sarama.RequiredAcks(*c.RequiredACKs) != sarama.WaitForAll {
+			return errors.New("the idempotent producer requires required_acks to be -1")
+		}
+		if version, ok := c.Version.Get(); ok && !version.IsAtLeast(sarama.V0_11_0_0) {
+			return errors.New("the idempotent producer requires Kafka version 0.11.0 or newer")
+		}
+	}
+
 	if c.Topic == "" && len(c.Topics) == 0 {
 		return errors.New("either 'topic' or 'topics' must be defined")
 	}
@@ -197,6 +210,12 @@ func (c *kafkaConfig) Validate() error {
 	return nil
 }
 
+// idempotent reports whether the idempotent producer is enabled. It is
+// always enabled for the transactional producer.
+func (c *kafkaConfig) idempotent() bool {
+	return c.Idempotent || c.TransactionalID != ""
+}
+
 func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, error) {
 	partitioner, err := makePartitioner(log, config.Partition)
 	if err != nil {
@@ -269,6 +288,19 @@ func newSaramaConfig(log *logp.Logger, config *kafkaConfig) (*sarama.Config, err
 		k.Producer.RequiredAcks = sarama.RequiredAcks(*config.RequiredACKs)
 	}
 
+	// The idempotent producer makes the brokers discard duplicates of
+	// messages that Sarama retries, and the transactional producer commits
+	// the messages of each batch at once.
+	if config.idempotent() {
+		k.Producer.Idempotent = true
+		k.Producer.RequiredAcks = sarama.WaitForAll
+		k.Net.MaxOpenRequests = 1
+	}
+	if config.TransactionalID != "" {
+		k.Producer.Transaction.ID = config.TransactionalID
+		k.Producer.Transaction.Timeout = config.TransactionTimeout
+	}
+
 	compressionMode, ok := compressionModes[strings.ToLower(config.Compression)]
 	if !ok {
 		return nil, fmt.Errorf("Unknown compression mode: '%v'", config.Compression)
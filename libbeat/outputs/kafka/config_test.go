@@ -29,6 +29,7 @@ import (
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
 	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/sarama"
 )
 
 func TestConfigAcceptValid(t *testing.T) {
@@ -76,6 +77,16 @@ func TestConfigInvalid(t *testing.T) {
 		},
 		// The default config does not set `topic` nor `topics`.
 		"No topics or topic provided": mapstr.M{},
+		"idempotent producer without acks from all replicas": mapstr.M{
+			"topic":         "foo",
+			"idempotent":    true,
+			"required_acks": 1,
+		},
+		"transactional producer with old version": mapstr.M{
+			"topic":            "foo",
+			"transactional_id": "beats",
+			"version":          "0.10.2",
+		},
 	}
 
 	for name, test := range tests {
@@ -93,6 +104,36 @@ func TestConfigInvalid(t *testing.T) {
 	}
 }
 
+func TestConfigTransactional(t *testing.T) {
+	c := config.MustNewConfigFrom(mapstr.M{
+		"hosts":               []string{"localhost"},
+		"topic":               "foo",
+		"transactional_id":    "beats",
+		"transaction_timeout": "30s",
+	})
+	cfg, err := readConfig(c)
+	if err != nil {
+		t.Fatalf("Can not create test configuration: %v", err)
+	}
+	libCfg, err := newSaramaConfig(logptest.NewTestingLogger(t, ""), cfg)
+	if err != nil {
+		t.Fatalf("Failure creating sarama config: %v", err)
+	}
+
+	if !libCfg.Producer.Idempotent {
+		t.Error("the transactional producer must be idempotent")
+	}
+	if libCfg.Producer.RequiredAcks != sarama.WaitForAll {
+		t.Errorf("unexpected required acks: %v", libCfg.Producer.RequiredAcks)
+	}
+	if libCfg.Net.MaxOpenRequests != 1 {
+		t.Errorf("unexpected max open requests: %v", libCfg.Net.MaxOpenRequests)
+	}
+	if libCfg.Producer.Transaction.ID != "beats" || libCfg.Producer.Transaction.Timeout != 30*time.Second {
+		t.Errorf("unexpected transaction config: %+v", libCfg.Producer.Transaction)
+	}
+}
+
 func TestConfigUnderElasticAgent(t *testing.T) {
 	oldUnderAgent := management.UnderAgent()
 	t.Cleanup(func() {
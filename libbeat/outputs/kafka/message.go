@@ -37,6 +37,10 @@ type message struct {
 	partition int32
 
 	data publisher.Event
+
+	// dropped is set if producing the message failed with a permanent
+	// error.
+	dropped bool
 }
 
 func (m *message) initProducerMessage() {
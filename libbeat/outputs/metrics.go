@@ -68,6 +68,10 @@ type Stats struct {
 	// Number of times a batch was split for being too large
 	batchesSplit *monitoring.Uint
 
+	// Number of transactions that were aborted, for outputs that publish
+	// each batch in a transaction
+	transactionsAborted *monitoring.Uint
+
 	//
 	// Output network connection stats
 	//
@@ -97,6 +101,8 @@ func NewStats(reg *monitoring.Registry) *Stats {
 
 		batchesSplit: monitoring.NewUint(reg, "batches.split"),
 
+		transactionsAborted: monitoring.NewUint(reg, "transactions.aborted"),
+
 		writeBytes:  monitoring.NewUint(reg, "write.bytes"),
 		writeErrors: monitoring.NewUint(reg, "write.errors"),
 
@@ -171,6 +177,13 @@ func (s *Stats) BatchSplit() {
 	}
 }
 
+// TransactionAborted increases the number of aborted transactions.
+func (s *Stats) TransactionAborted() {
+	if s != nil {
+		s.transactionsAborted.Inc()
+	}
+}
+
 // ErrTooMany updates the number of Too Many Requests responses reported by the output.
 func (s *Stats) ErrTooMany(n int) {
 	if s != nil {
@@ -31,7 +31,8 @@ type Observer interface {
 	AckedEvents(int)      // report number of acked events
 	ErrTooMany(int)       // report too many requests response
 
-	BatchSplit() // report a batch was split for being too large to ingest
+	BatchSplit()         // report a batch was split for being too large to ingest
+	TransactionAborted() // report a transaction was aborted and its batch retried
 
 	WriteError(error) // report an I/O error on write
 	WriteBytes(int)   // report number of bytes being written
@@ -58,6 +59,7 @@ func (*emptyObserver) DuplicateEvents(int)           {}
 func (*emptyObserver) RetryableErrors(int)           {}
 func (*emptyObserver) PermanentErrors(int)           {}
 func (*emptyObserver) BatchSplit()                   {}
+func (*emptyObserver) TransactionAborted()           {}
 func (*emptyObserver) WriteError(error)              {}
 func (*emptyObserver) WriteBytes(int)                {}
 func (*emptyObserver) ReadError(error)               {}
@@ -59,6 +59,7 @@ type client struct {
 	publish  publishFn
 	codec    codec.Codec
 	timeout  time.Duration
+	stream   streamConfig
 }
 
 type redisDataType uint16
@@ -66,6 +67,7 @@ type redisDataType uint16
 const (
 	redisListType redisDataType = iota
 	redisChannelType
+	redisStreamType
 )
 
 func newClient(
@@ -74,7 +76,7 @@ func newClient(
 	timeout time.Duration,
 	pass string,
 	db int, key outil.Selector, dt redisDataType,
-	index string, codec codec.Codec,
+	index string, codec codec.Codec, stream streamConfig,
 	logger *logp.Logger,
 ) *client {
 	return &client{
@@ -88,6 +90,7 @@ func newClient(
 		dataType: dt,
 		key:      key,
 		codec:    codec,
+		stream:   stream,
 	}
 }
 
@@ -165,10 +168,14 @@ func (c *client) String() string {
 func (c *client) makePublish(
 	conn redis.Conn,
 ) (publishFn, error) {
-	if c.dataType == redisChannelType {
+	switch c.dataType {
+	case redisChannelType:
 		return c.makePublishPUBLISH(conn)
+	case redisStreamType:
+		return c.makePublishXADD(conn)
+	default:
+		return c.makePublishRPUSH(conn)
 	}
-	return c.makePublishRPUSH(conn)
 }
 
 func (c *client) makePublishRPUSH(conn redis.Conn) (publishFn, error) {
@@ -177,27 +184,7 @@ func (c *client) makePublishRPUSH(conn redis.Conn) (publishFn, error) {
 		return c.publishEventsPipeline(conn, "RPUSH"), nil
 	}
 
-	var major, minor int
-	var versionRaw [][]byte
-
-	respRaw, err := conn.Do("INFO")
-	resp, err := redis.Bytes(respRaw, err)
-	if err != nil {
-		return nil, err
-	}
-
-	versionRaw = versionRegex.FindSubmatch(resp)
-	if versionRaw == nil {
-		err = errors.New("unable to read redis_version")
-		return nil, err
-	}
-
-	major, err = strconv.Atoi(string(versionRaw[1]))
-	if err != nil {
-		return nil, err
-	}
-
-	minor, err = strconv.Atoi(string(versionRaw[2]))
+	major, minor, err := redisVersion(conn)
 	if err != nil {
 		return nil, err
 	}
@@ -218,6 +205,31 @@ func (c *client) makePublishRPUSH(conn redis.Conn) (publishFn, error) {
 	return c.publishEventsPipeline(conn, "RPUSH"), nil
 }
 
+// redisVersion returns the major and minor version of the Redis server.
+func redisVersion(conn redis.Conn) (major, minor int, err error) {
+	respRaw, err := conn.Do("INFO")
+	resp, err := redis.Bytes(respRaw, err)
+	if err != nil {
+		return 0, 0, err
+	}
+
+	versionRaw := versionRegex.FindSubmatch(resp)
+	if versionRaw == nil {
+		return 0, 0, errors.New("unable to read redis_version")
+	}
+
+	major, err = strconv.Atoi(string(versionRaw[1]))
+	if err != nil {
+		return 0, 0, err
+	}
+
+	minor, err = strconv.Atoi(string(versionRaw[2]))
+	if err != nil {
+		return 0, 0, err
+	}
+	return major, minor, nil
+}
+
 func (c *client) makePublishPUBLISH(conn redis.Conn) (publishFn, error) {
 	return c.publishEventsPipeline(conn, "PUBLISH"), nil
 }
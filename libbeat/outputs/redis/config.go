@@ -18,6 +18,7 @@
 package redis
 
 import (
+	"errors"
 	"fmt"
 	"time"
 
@@ -40,10 +41,31 @@ type redisConfig struct {
 	Codec       codec.Config          `config:"codec"`
 	Db          int                   `config:"db"`
 	DataType    string                `config:"datatype"`
+	Stream      streamConfig          `config:"stream"`
 	Backoff     backoff               `config:"backoff"`
 	Queue       config.Namespace      `config:"queue"`
 }
 
+// streamConfig configures how events are added to streams when the
+// stream data type is used.
+type streamConfig struct {
+	// Layout is either "json", storing the encoded event in a single field,
+	// or "flattened", storing each top-level field of the event in its own
+	// stream entry field.
+	Layout string `config:"layout"`
+	Field  string `config:"field"`
+
+	// MaxLen and MaxAge trim the stream, using approximate trimming, to the
+	// given number of entries or to the entries added within the given time.
+	MaxLen int64         `config:"max_len" validate:"min=0"`
+	MaxAge time.Duration `config:"max_age" validate:"min=0"`
+}
+
+const (
+	streamLayoutJSON      = "json"
+	streamLayoutFlattened = "flattened"
+)
+
 type backoff struct {
 	Init time.Duration
 	Max  time.Duration
@@ -58,6 +80,10 @@ var (
 		TLS:         nil,
 		Db:          0,
 		DataType:    "list",
+		Stream: streamConfig{
+			Layout: streamLayoutJSON,
+			Field:  "event",
+		},
 		Backoff: backoff{
 			Init: 1 * time.Second,
 			Max:  60 * time.Second,
@@ -67,10 +93,31 @@ var (
 
 func (c *redisConfig) Validate() error {
 	switch c.DataType {
-	case "", "list", "channel":
+	case "", "list", "channel", "stream":
 	default:
 		return fmt.Errorf("redis data type %v not supported", c.DataType)
 	}
 
+	if c.DataType == "stream" {
+		return c.Stream.Validate()
+	}
+	return nil
+}
+
+func (c *streamConfig) Validate() error {
+	switch c.Layout {
+	case streamLayoutJSON:
+		if c.Field == "" {
+			return errors.New("stream field must be set when using the json layout")
+		}
+	case streamLayoutFlattened:
+	default:
+		return fmt.Errorf("redis stream layout %v not supported", c.Layout)
+	}
+
+	if c.MaxLen > 0 && c.MaxAge > 0 {
+		return errors.New("only one of stream max_len and max_age can be set")
+	}
+
 	return nil
 }
@@ -19,6 +19,7 @@ package redis
 
 import (
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 )
@@ -37,6 +38,12 @@ func TestValidate(t *testing.T) {
 		{"Invalid Datatype", redisConfig{Key: "test", DataType: "something"}, false},
 		{"List Datatype", redisConfig{Key: "test", DataType: "list"}, true},
 		{"Channel Datatype", redisConfig{Key: "test", DataType: "channel"}, true},
+		{"Stream Datatype", redisConfig{Key: "test", DataType: "stream", Stream: defaultConfig.Stream}, true},
+		{"Stream flattened", redisConfig{Key: "test", DataType: "stream", Stream: streamConfig{Layout: "flattened"}}, true},
+		{"Stream invalid layout", redisConfig{Key: "test", DataType: "stream", Stream: streamConfig{Layout: "something"}}, false},
+		{"Stream json without field", redisConfig{Key: "test", DataType: "stream", Stream: streamConfig{Layout: "json"}}, false},
+		{"Stream max_len", redisConfig{Key: "test", DataType: "stream", Stream: streamConfig{Layout: "json", Field: "event", MaxLen: 1000}}, true},
+		{"Stream max_len and max_age", redisConfig{Key: "test", DataType: "stream", Stream: streamConfig{Layout: "json", Field: "event", MaxLen: 1000, MaxAge: time.Hour}}, false},
 	}
 
 	for _, test := range tests {
@@ -86,6 +86,8 @@ func makeRedis(
 		dataType = redisListType
 	case "channel":
 		dataType = redisChannelType
+	case "stream":
+		dataType = redisStreamType
 	default:
 		return outputs.Fail(errors.New("Bad Redis data type")) //nolint:staticcheck //Keep old behavior
 	}
@@ -161,7 +163,7 @@ func makeRedis(
 		}
 
 		client := newClient(conn, observer, rConfig.Timeout,
-			pass, rConfig.Db, key, dataType, rConfig.Index, enc, beat.Logger)
+			pass, rConfig.Db, key, dataType, rConfig.Index, enc, rConfig.Stream, beat.Logger)
 		clients[i] = newBackoffClient(client, rConfig.Backoff.Init, rConfig.Backoff.Max)
 	}
 
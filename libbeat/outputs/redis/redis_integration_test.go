@@ -320,6 +320,76 @@ func testPublishChannel(t *testing.T, cfg map[string]interface{}) {
 	}
 }
 
+func TestPublishStreamTCP(t *testing.T) {
+	key := "test_publish_stream_tcp"
+	cfg := map[string]interface{}{
+		"hosts":    []string{getRedisAddr()},
+		"key":      key,
+		"datatype": "stream",
+		"timeout":  "5s",
+	}
+
+	conn, err := redis.Dial("tcp", getRedisAddr())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Do("DEL", key)
+	require.NoError(t, err)
+
+	batches, batchSize := 10, 100
+	out := newRedisTestingOutput(t, cfg)
+	require.NoError(t, sendTestEvents(out, batches, batchSize))
+
+	entries, err := redis.Values(conn.Do("XRANGE", key, "-", "+"))
+	require.NoError(t, err)
+	require.Len(t, entries, batches*batchSize)
+	for i, entry := range entries {
+		values, err := redis.Values(entry, nil)
+		require.NoError(t, err)
+		fields, err := redis.StringMap(values[1], nil)
+		require.NoError(t, err)
+
+		evt := struct{ Message int }{}
+		require.NoError(t, json.Unmarshal([]byte(fields["event"]), &evt))
+		assert.Equal(t, i+1, evt.Message)
+		validateMeta(t, []byte(fields["event"]))
+	}
+}
+
+func TestPublishStreamMaxLen(t *testing.T) {
+	key := "test_publish_stream_maxlen"
+	cfg := map[string]interface{}{
+		"hosts":          []string{getRedisAddr()},
+		"key":            key,
+		"datatype":       "stream",
+		"timeout":        "5s",
+		"stream.layout":  "flattened",
+		"stream.max_len": 100,
+	}
+
+	conn, err := redis.Dial("tcp", getRedisAddr())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = conn.Do("DEL", key)
+	require.NoError(t, err)
+
+	out := newRedisTestingOutput(t, cfg)
+	require.NoError(t, sendTestEvents(out, 10, 1000))
+
+	// Trimming is approximate, the stream is trimmed in whole macro nodes.
+	length, err := redis.Int(conn.Do("XLEN", key))
+	require.NoError(t, err)
+	assert.Less(t, length, 10000)
+
+	entries, err := redis.Values(conn.Do("XREVRANGE", key, "+", "-", "COUNT", 1))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	values, err := redis.Values(entries[0], nil)
+	require.NoError(t, err)
+	fields, err := redis.StringMap(values[1], nil)
+	require.NoError(t, err)
+	assert.Equal(t, "10000", fields["message"])
+}
+
 func getEnv(name, or string) string {
 	if x := os.Getenv(name); x != "" {
 		return x
@@ -0,0 +1,184 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redis
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs/outil"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// timestampFormat is the format used by the JSON codec for @timestamp.
+const timestampFormat = "2006-01-02T15:04:05.000Z"
+
+func (c *client) makePublishXADD(conn redis.Conn) (publishFn, error) {
+	// Streams require Redis 5.0, trimming by ID requires Redis 6.2.
+	major, minor, err := redisVersion(conn)
+	if err != nil {
+		return nil, err
+	}
+	if major < 5 {
+		return nil, fmt.Errorf("redis streams require redis 5.0 or newer, found %d.%d", major, minor)
+	}
+	if c.stream.MaxAge > 0 && (major < 6 || (major == 6 && minor < 2)) {
+		return nil, fmt.Errorf("stream max_age requires redis 6.2 or newer, found %d.%d", major, minor)
+	}
+
+	return c.publishEventsXADD(conn), nil
+}
+
+// publishEventsXADD adds each event as a new entry to the stream selected
+// for the event. The commands are pipelined.
+func (c *client) publishEventsXADD(conn redis.Conn) publishFn {
+	return func(key outil.Selector, data []publisher.Event) ([]publisher.Event, error) {
+		now := time.Now()
+		okEvents := data[:0]
+		dropped := 0
+		for i := range data {
+			event := &data[i]
+			streamKey, err := key.Select(&event.Content)
+			if err != nil {
+				c.log.Errorf("Failed to set redis key: %+v", err)
+				dropped++
+				continue
+			}
+
+			fields, err := c.streamFields(event)
+			if err != nil {
+				c.log.Errorf("Encoding event failed with error: %+v. Look at the event log file to view the event", err)
+				c.log.Errorw(fmt.Sprintf("Failed event: %v", event.Content), logp.TypeKey, logp.EventType)
+				dropped++
+				continue
+			}
+
+			args := streamArgs(streamKey, &c.stream, now, fields)
+			if err := conn.Send("XADD", args...); err != nil {
+				c.log.Errorf("Failed to execute XADD: %+v", err)
+				c.observer.PermanentErrors(dropped)
+				return append(okEvents, data[i:]...), err
+			}
+			okEvents = append(okEvents, *event)
+		}
+		c.observer.PermanentErrors(dropped)
+		if len(okEvents) == 0 {
+			return nil, nil
+		}
+
+		start := time.Now()
+		if err := conn.Flush(); err != nil {
+			return okEvents, err
+		}
+
+		var failed []publisher.Event
+		var lastErr error
+		for i := range okEvents {
+			_, err := conn.Receive()
+			if err != nil {
+				if _, ok := err.(redis.Error); ok { //nolint:errorlint //this line checks against a type, not an instance of an error
+					c.log.Errorf("Failed to XADD event to stream with %+v", err)
+					failed = append(failed, okEvents[i])
+					lastErr = err
+				} else {
+					c.log.Errorf("Failed to XADD multiple events to stream with %+v", err)
+					failed = append(failed, okEvents[i:]...)
+					lastErr = err
+					break
+				}
+			}
+		}
+		c.observer.ReportLatency(time.Since(start))
+
+		c.observer.AckedEvents(len(okEvents) - len(failed))
+		return failed, lastErr
+	}
+}
+
+// streamFields returns the field-value pairs of the stream entry for the
+// event.
+func (c *client) streamFields(event *publisher.Event) ([]interface{}, error) {
+	if c.stream.Layout == streamLayoutFlattened {
+		return flattenEvent(&event.Content)
+	}
+
+	serialized, err := c.codec.Encode(c.index, &event.Content)
+	if err != nil {
+		return nil, err
+	}
+	buf := make([]byte, len(serialized))
+	copy(buf, serialized)
+	return []interface{}{c.stream.Field, buf}, nil
+}
+
+// flattenEvent returns the timestamp and the top-level fields of the event
+// as field-value pairs. String values are stored as is, all other values
+// are JSON encoded. Fields are sorted by name, so that entries of the same
+// kind of event have the same field order.
+func flattenEvent(event *beat.Event) ([]interface{}, error) {
+	names := make([]string, 0, len(event.Fields))
+	for name := range event.Fields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	fields := make([]interface{}, 0, 2*len(names)+2)
+	fields = append(fields, "@timestamp", event.Timestamp.UTC().Format(timestampFormat))
+	for _, name := range names {
+		if name == "@timestamp" {
+			continue
+		}
+
+		switch v := event.Fields[name].(type) {
+		case string:
+			fields = append(fields, name, v)
+		case []byte:
+			fields = append(fields, name, v)
+		default:
+			encoded, err := json.Marshal(v)
+			if err != nil {
+				return nil, fmt.Errorf("failed to encode field %v: %w", name, err)
+			}
+			fields = append(fields, name, encoded)
+		}
+	}
+	return fields, nil
+}
+
+// streamArgs returns the arguments of the XADD command adding an entry with
+// the given fields to the stream. Entry IDs are generated by Redis.
+func streamArgs(key string, cfg *streamConfig, now time.Time, fields []interface{}) []interface{} {
+	args := make([]interface{}, 0, len(fields)+5)
+	args = append(args, key)
+	switch {
+	case cfg.MaxLen > 0:
+		args = append(args, "MAXLEN", "~", cfg.MaxLen)
+	case cfg.MaxAge > 0:
+		minID := now.Add(-cfg.MaxAge).UnixMilli()
+		args = append(args, "MINID", "~", strconv.FormatInt(minID, 10))
+	}
+	args = append(args, "*")
+	return append(args, fields...)
+}
@@ -0,0 +1,196 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redis
+
+import (
+	"encoding/json"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/gomodule/redigo/redis"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	jsoncodec "github.com/elastic/beats/v7/libbeat/outputs/codec/json"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// recordingConn is a redis.Conn that records the pipelined commands and
+// replies with the configured errors.
+type recordingConn struct {
+	redis.Conn
+
+	commands [][]interface{}
+	replies  []error
+}
+
+func (c *recordingConn) Send(command string, args ...interface{}) error {
+	c.commands = append(c.commands, append([]interface{}{command}, args...))
+	return nil
+}
+
+func (c *recordingConn) Flush() error { return nil }
+
+func (c *recordingConn) Receive() (interface{}, error) {
+	var err error
+	if len(c.replies) > 0 {
+		err, c.replies = c.replies[0], c.replies[1:]
+	}
+	if err != nil {
+		return nil, err
+	}
+	return []byte("1-0"), nil
+}
+
+func newStreamClient(t *testing.T, settings mapstr.M) *client {
+	t.Helper()
+	cfg := config.MustNewConfigFrom(settings)
+	rConfig := defaultConfig
+	require.NoError(t, cfg.Unpack(&rConfig))
+	key, err := buildKeySelector(cfg)
+	require.NoError(t, err)
+
+	return newClient(nil, outputs.NewNilObserver(), rConfig.Timeout, "", 0, key,
+		redisStreamType, "test", jsoncodec.New("1.2.3", jsoncodec.Config{}), rConfig.Stream,
+		logptest.NewTestingLogger(t, ""))
+}
+
+func streamEvents(events ...beat.Event) []publisher.Event {
+	data := make([]publisher.Event, len(events))
+	for i, event := range events {
+		data[i] = publisher.Event{Content: event}
+	}
+	return data
+}
+
+func TestPublishStreamJSON(t *testing.T) {
+	c := newStreamClient(t, mapstr.M{"key": "events-%{[service]}", "datatype": "stream"})
+	conn := &recordingConn{}
+
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	failed, err := c.publishEventsXADD(conn)(c.key, streamEvents(
+		beat.Event{Timestamp: ts, Fields: mapstr.M{"service": "a", "message": "first"}},
+		beat.Event{Timestamp: ts, Fields: mapstr.M{"service": "b", "message": "second"}},
+	))
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+
+	require.Len(t, conn.commands, 2)
+	for i, want := range []struct{ key, message string }{{"events-a", "first"}, {"events-b", "second"}} {
+		cmd := conn.commands[i]
+		require.Len(t, cmd, 5)
+		assert.Equal(t, []interface{}{"XADD", want.key, "*", "event"}, cmd[:4])
+
+		var doc struct {
+			Timestamp string `json:"@timestamp"`
+			Message   string `json:"message"`
+		}
+		require.NoError(t, json.Unmarshal(cmd[4].([]byte), &doc))
+		assert.Equal(t, want.message, doc.Message)
+		assert.Equal(t, "2024-05-06T07:08:09.000Z", doc.Timestamp)
+	}
+}
+
+func TestPublishStreamFlattened(t *testing.T) {
+	c := newStreamClient(t, mapstr.M{
+		"key":           "events",
+		"datatype":      "stream",
+		"stream.layout": "flattened",
+	})
+	conn := &recordingConn{}
+
+	ts := time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC)
+	failed, err := c.publishEventsXADD(conn)(c.key, streamEvents(beat.Event{
+		Timestamp: ts,
+		Fields: mapstr.M{
+			"message": "hello",
+			"count":   42,
+			"host":    mapstr.M{"name": "test"},
+		},
+	}))
+	require.NoError(t, err)
+	assert.Empty(t, failed)
+
+	require.Len(t, conn.commands, 1)
+	assert.Equal(t, []interface{}{
+		"XADD", "events", "*",
+		"@timestamp", "2024-05-06T07:08:09.000Z",
+		"count", []byte("42"),
+		"host", []byte(`{"name":"test"}`),
+		"message", "hello",
+	}, conn.commands[0])
+}
+
+func TestPublishStreamTrimming(t *testing.T) {
+	now := time.Now()
+	cases := map[string]struct {
+		stream streamConfig
+		want   []interface{}
+	}{
+		"no trimming": {
+			want: []interface{}{"events", "*", "f", "v"},
+		},
+		"max_len": {
+			stream: streamConfig{MaxLen: 1000},
+			want:   []interface{}{"events", "MAXLEN", "~", int64(1000), "*", "f", "v"},
+		},
+		"max_age": {
+			stream: streamConfig{MaxAge: time.Hour},
+			want: []interface{}{
+				"events", "MINID", "~", strconv.FormatInt(now.Add(-time.Hour).UnixMilli(), 10),
+				"*", "f", "v",
+			},
+		},
+	}
+
+	for name, test := range cases {
+		t.Run(name, func(t *testing.T) {
+			got := streamArgs("events", &test.stream, now, []interface{}{"f", "v"})
+			assert.Equal(t, test.want, got)
+		})
+	}
+}
+
+func TestPublishStreamFailures(t *testing.T) {
+	c := newStreamClient(t, mapstr.M{
+		"key":           "events",
+		"datatype":      "stream",
+		"stream.layout": "flattened",
+	})
+	conn := &recordingConn{replies: []error{nil, redis.Error("OOM command not allowed")}}
+
+	events := streamEvents(
+		beat.Event{Fields: mapstr.M{"message": "1"}},
+		beat.Event{Fields: mapstr.M{"message": "unencodable", "value": make(chan int)}},
+		beat.Event{Fields: mapstr.M{"message": "2"}},
+	)
+	failed, err := c.publishEventsXADD(conn)(c.key, events)
+	require.Error(t, err)
+
+	// The event that can't be encoded is dropped, the event rejected by
+	// redis is retried.
+	assert.Len(t, conn.commands, 2)
+	require.Len(t, failed, 1)
+	assert.Equal(t, "2", failed[0].Content.Fields["message"])
+}
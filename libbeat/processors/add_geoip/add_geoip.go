@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/netip"
+	"strings"
+	"sync"
+	"time"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const processorName = "add_geoip"
+
+func init() {
+	// This is not a JS plugin, as it holds the databases open until it is
+	// closed.
+	processors.RegisterPlugin(processorName, New)
+}
+
+type addGeoIP struct {
+	config    config
+	log       *logp.Logger
+	databases []*database
+
+	// cache holds the results of recent lookups. It is purged when a
+	// database is reloaded.
+	cache *lru.Cache[netip.Addr, *result]
+	// generation is incremented when a database is reloaded, so that the
+	// results of lookups that raced with the reload are not cached.
+	generation uint64
+	// cacheMu protects generation, so that checking it and adding to the
+	// cache can't interleave with a reload incrementing it and purging the
+	// cache.
+	cacheMu sync.Mutex
+
+	done chan struct{}
+	wg   sync.WaitGroup
+}
+
+// New constructs a new add_geoip processor. The processor must be closed to
+// release the databases.
+func New(c *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	p := &addGeoIP{
+		config: config,
+		log:    log.Named(processorName),
+		done:   make(chan struct{}),
+	}
+	for _, path := range config.Databases {
+		db, err := openDatabase(paths.Resolve(paths.Config, path))
+		if err != nil {
+			p.closeDatabases()
+			return nil, err
+		}
+		p.databases = append(p.databases, db)
+	}
+	if config.CacheSize > 0 {
+		// The size is positive, so this can't fail.
+		p.cache, _ = lru.New[netip.Addr, *result](config.CacheSize)
+	}
+
+	if config.ReloadInterval > 0 {
+		p.wg.Add(1)
+		go p.reloadLoop()
+	}
+	return p, nil
+}
+
+// reloadLoop periodically reloads the databases whose files changed.
+func (p *addGeoIP) reloadLoop() {
+	defer p.wg.Done()
+	ticker := time.NewTicker(p.config.ReloadInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-p.done:
+			return
+		case <-ticker.C:
+			p.reload()
+		}
+	}
+}
+
+func (p *addGeoIP) reload() {
+	for _, db := range p.databases {
+		reloaded, err := db.reload()
+		if err != nil {
+			p.log.Warnw("Failed to reload GeoIP database, the previous version is kept.", "path", db.path, "error", err)
+			continue
+		}
+		if reloaded {
+			p.log.Infow("Reloaded GeoIP database.", "path", db.path)
+			p.cacheMu.Lock()
+			p.generation++
+			if p.cache != nil {
+				p.cache.Purge()
+			}
+			p.cacheMu.Unlock()
+		}
+	}
+}
+
+// Run adds the geo and AS fields for the IP addresses of the configured
+// source fields. Fields that are missing or don't contain an IP address are
+// ignored.
+func (p *addGeoIP) Run(event *beat.Event) (*beat.Event, error) {
+	var errs []error
+	for _, f := range p.config.Fields {
+		v, err := event.GetValue(f.Source)
+		if err != nil {
+			continue
+		}
+		res, err := p.lookupValue(v)
+		if err != nil {
+			errs = append(errs, err)
+			continue
+		}
+		if res == nil || res.empty() {
+			continue
+		}
+		if len(res.geo) > 0 {
+			_, _ = event.PutValue(f.Target+".geo", res.geo.Clone())
+		}
+		if len(res.as) > 0 {
+			_, _ = event.PutValue(f.Target+".as", res.as.Clone())
+		}
+	}
+	return event, errors.Join(errs...)
+}
+
+// lookupValue returns the result for the IP address in v. For lists of
+// addresses, the result of the first address that has one is returned.
+func (p *addGeoIP) lookupValue(v interface{}) (*result, error) {
+	switch v := v.(type) {
+	case string:
+		return p.lookupString(v)
+	case []string:
+		for _, s := range v {
+			if res, err := p.lookupString(s); res != nil || err != nil {
+				return res, err
+			}
+		}
+	case []interface{}:
+		for _, s := range v {
+			s, ok := s.(string)
+			if !ok {
+				continue
+			}
+			if res, err := p.lookupString(s); res != nil || err != nil {
+				return res, err
+			}
+		}
+	}
+	return nil, nil
+}
+
+// lookupString returns the result for the IP address in s, or nil if s is
+// not an IP address or no database has a record for it.
+func (p *addGeoIP) lookupString(s string) (*result, error) {
+	addr, err := netip.ParseAddr(s)
+	if err != nil {
+		return nil, nil //nolint:nilerr // not an IP address
+	}
+	addr = addr.Unmap()
+
+	if p.cache != nil {
+		if res, ok := p.cache.Get(addr); ok {
+			return nonEmpty(res), nil
+		}
+	}
+
+	p.cacheMu.Lock()
+	generation := p.generation
+	p.cacheMu.Unlock()
+
+	res := &result{}
+	ip := net.IP(addr.AsSlice())
+	for _, db := range p.databases {
+		if err := db.lookup(ip, p.config.Language, res); err != nil {
+			return nil, err
+		}
+	}
+	if p.cache != nil {
+		p.cacheMu.Lock()
+		if p.generation == generation {
+			p.cache.Add(addr, res)
+		}
+		p.cacheMu.Unlock()
+	}
+	return nonEmpty(res), nil
+}
+
+func nonEmpty(res *result) *result {
+	if res.empty() {
+		return nil
+	}
+	return res
+}
+
+func (p *addGeoIP) Close() error {
+	close(p.done)
+	p.wg.Wait()
+	return p.closeDatabases()
+}
+
+func (p *addGeoIP) closeDatabases() error {
+	var errs []error
+	for _, db := range p.databases {
+		errs = append(errs, db.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (p *addGeoIP) String() string {
+	sources := make([]string, len(p.config.Fields))
+	for i, f := range p.config.Fields {
+		sources[i] = f.Source + "->" + f.Target
+	}
+	return fmt.Sprintf("%v=[databases=[%v], fields=[%v]]", processorName,
+		strings.Join(p.config.Databases, ", "), strings.Join(sources, ", "))
+}
@@ -0,0 +1,277 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestProcessor(t testing.TB, c map[string]interface{}) beat.Processor {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(c), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	t.Cleanup(func() { assert.NoError(t, processors.Close(p)) })
+	return p
+}
+
+var (
+	londonGeo = mapstr.M{
+		"continent_code":   "EU",
+		"continent_name":   "Europe",
+		"country_iso_code": "GB",
+		"country_name":     "United Kingdom",
+		"region_iso_code":  "GB-ENG",
+		"region_name":      "England",
+		"city_name":        "London",
+		"postal_code":      "EC2V",
+		"timezone":         "Europe/London",
+		"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+	}
+	londonAS = mapstr.M{
+		"number":       int64(20712),
+		"organization": mapstr.M{"name": "Andrews & Arnold Ltd"},
+	}
+)
+
+func TestAddGeoIP(t *testing.T) {
+	city, asn := writeTestDatabases(t, t.TempDir())
+
+	tests := map[string]struct {
+		config map[string]interface{}
+		input  mapstr.M
+		want   mapstr.M
+	}{
+		"city and asn": {
+			input: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}},
+			want: mapstr.M{"source": mapstr.M{
+				"ip":  "81.2.69.142",
+				"geo": londonGeo,
+				"as":  londonAS,
+			}},
+		},
+		"several fields": {
+			input: mapstr.M{
+				"source":      mapstr.M{"ip": "81.2.69.142"},
+				"destination": mapstr.M{"ip": "2001:db8::1"},
+			},
+			want: mapstr.M{
+				"source": mapstr.M{"ip": "81.2.69.142", "geo": londonGeo, "as": londonAS},
+				"destination": mapstr.M{
+					"ip": "2001:db8::1",
+					"geo": mapstr.M{
+						"continent_code":   "NA",
+						"continent_name":   "North America",
+						"country_iso_code": "US",
+						"country_name":     "United States",
+					},
+				},
+			},
+		},
+		"IPv4-mapped IPv6 address": {
+			input: mapstr.M{"client": mapstr.M{"ip": "::ffff:81.2.69.142"}},
+			want: mapstr.M{"client": mapstr.M{
+				"ip":  "::ffff:81.2.69.142",
+				"geo": londonGeo,
+				"as":  londonAS,
+			}},
+		},
+		"list of addresses": {
+			config: map[string]interface{}{
+				"fields": []map[string]interface{}{{"source": "related.ip", "target": "related"}},
+			},
+			input: mapstr.M{"related": mapstr.M{"ip": []interface{}{"10.0.0.1", "81.2.69.142"}}},
+			want: mapstr.M{"related": mapstr.M{
+				"ip":  []interface{}{"10.0.0.1", "81.2.69.142"},
+				"geo": londonGeo,
+				"as":  londonAS,
+			}},
+		},
+		"language": {
+			config: map[string]interface{}{
+				"language": "de",
+				"fields":   []map[string]interface{}{{"source": "ip", "target": "location"}},
+			},
+			input: mapstr.M{"ip": "81.2.69.142"},
+			want: mapstr.M{
+				"ip": "81.2.69.142",
+				"location": mapstr.M{
+					"geo": mapstr.M{
+						"continent_code":   "EU",
+						"continent_name":   "Europa",
+						"country_iso_code": "GB",
+						"country_name":     "Vereinigtes Königreich",
+						"region_iso_code":  "GB-ENG",
+						"city_name":        "London",
+						"postal_code":      "EC2V",
+						"timezone":         "Europe/London",
+						"location":         mapstr.M{"lat": 51.5142, "lon": -0.0931},
+					},
+					"as": londonAS,
+				},
+			},
+		},
+		"no record": {
+			input: mapstr.M{"source": mapstr.M{"ip": "10.0.0.1"}},
+			want:  mapstr.M{"source": mapstr.M{"ip": "10.0.0.1"}},
+		},
+		"not an address": {
+			input: mapstr.M{"source": mapstr.M{"ip": "example.com"}},
+			want:  mapstr.M{"source": mapstr.M{"ip": "example.com"}},
+		},
+		"missing field": {
+			input: mapstr.M{"message": "hello"},
+			want:  mapstr.M{"message": "hello"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			c := map[string]interface{}{"databases": []string{city, asn}}
+			for k, v := range test.config {
+				c[k] = v
+			}
+			p := newTestProcessor(t, c)
+
+			// The second run is served from the cache.
+			for i := 0; i < 2; i++ {
+				event, err := p.Run(&beat.Event{Fields: test.input.Clone()})
+				require.NoError(t, err)
+				assert.Equal(t, test.want, event.Fields)
+			}
+		})
+	}
+}
+
+func TestResultsAreNotShared(t *testing.T) {
+	city, _ := writeTestDatabases(t, t.TempDir())
+	p := newTestProcessor(t, map[string]interface{}{"databases": []string{city}})
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}}})
+	require.NoError(t, err)
+	_, err = event.PutValue("source.geo.city_name", "changed")
+	require.NoError(t, err)
+
+	event, err = p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}}})
+	require.NoError(t, err)
+	cityName, err := event.GetValue("source.geo.city_name")
+	require.NoError(t, err)
+	assert.Equal(t, "London", cityName)
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeMMDB(t, path, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"81.2.69.0/24": {"autonomous_system_number": uint32(1)},
+	})
+
+	p := newTestProcessor(t, map[string]interface{}{
+		"databases":       []string{path},
+		"reload_interval": "10ms",
+	})
+	asNumber := func() interface{} {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}}})
+		require.NoError(t, err)
+		v, _ := event.GetValue("source.as.number")
+		return v
+	}
+	require.Equal(t, int64(1), asNumber())
+
+	// An invalid file is ignored, and the previous database kept.
+	require.NoError(t, os.WriteFile(path+".tmp", []byte("invalid"), 0o600))
+	require.NoError(t, os.Rename(path+".tmp", path))
+	time.Sleep(50 * time.Millisecond)
+	require.Equal(t, int64(1), asNumber())
+
+	writeMMDB(t, path, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"81.2.69.0/24": {"autonomous_system_number": uint32(2)},
+	})
+	assert.Eventually(t, func() bool { return asNumber() == int64(2) }, 10*time.Second, 10*time.Millisecond)
+}
+
+func TestNewErrors(t *testing.T) {
+	dir := t.TempDir()
+	city, _ := writeTestDatabases(t, dir)
+	unsupported := filepath.Join(dir, "GeoIP2-Domain.mmdb")
+	writeMMDB(t, unsupported, "GeoIP2-Domain", map[string]map[string]interface{}{
+		"81.2.69.0/24": {"domain": "example.com"},
+	})
+
+	tests := map[string]struct {
+		config map[string]interface{}
+		err    string
+	}{
+		"no databases": {
+			config: map[string]interface{}{},
+			err:    "missing required field",
+		},
+		"missing database": {
+			config: map[string]interface{}{"databases": []string{filepath.Join(dir, "missing.mmdb")}},
+			err:    "no such file or directory",
+		},
+		"unsupported database": {
+			config: map[string]interface{}{"databases": []string{city, unsupported}},
+			err:    `unsupported database type "GeoIP2-Domain"`,
+		},
+		"source without target": {
+			config: map[string]interface{}{
+				"databases": []string{city},
+				"fields":    []map[string]interface{}{{"source": "ip"}},
+			},
+			err: `target is required for source field "ip"`,
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(test.config), logptest.NewTestingLogger(t, ""))
+			assert.ErrorContains(t, err, test.err)
+		})
+	}
+}
+
+func BenchmarkAddGeoIP(b *testing.B) {
+	city, asn := writeTestDatabases(b, b.TempDir())
+
+	for name, cacheSize := range map[string]int{"cache": 10000, "no cache": 0} {
+		b.Run(name, func(b *testing.B) {
+			p := newTestProcessor(b, map[string]interface{}{
+				"databases":  []string{city, asn},
+				"cache_size": cacheSize,
+			})
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.Run(&beat.Event{Fields: mapstr.M{"source": mapstr.M{"ip": "81.2.69.142"}}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
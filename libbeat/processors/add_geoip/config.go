@@ -0,0 +1,73 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+)
+
+type config struct {
+	Databases      []string      `config:"databases" validate:"required"`
+	Fields         []fieldConfig `config:"fields"`
+	Language       string        `config:"language"`
+	ReloadInterval time.Duration `config:"reload_interval" validate:"min=0"`
+	CacheSize      int           `config:"cache_size" validate:"min=0"`
+}
+
+// fieldConfig maps a field that contains an IP address to the field the
+// geo and AS fields are added to.
+type fieldConfig struct {
+	Source string `config:"source" validate:"required"`
+	Target string `config:"target"`
+}
+
+func defaultConfig() config {
+	return config{
+		Fields: []fieldConfig{
+			{Source: "source.ip"},
+			{Source: "destination.ip"},
+			{Source: "client.ip"},
+			{Source: "server.ip"},
+		},
+		Language:       "en",
+		ReloadInterval: time.Minute,
+		CacheSize:      10000,
+	}
+}
+
+func (c *config) Validate() error {
+	if len(c.Fields) == 0 {
+		return errors.New("no fields configured")
+	}
+	for i := range c.Fields {
+		f := &c.Fields[i]
+		if f.Target != "" {
+			continue
+		}
+		// Default to the parent of the source, like source for source.ip.
+		idx := strings.LastIndexByte(f.Source, '.')
+		if idx <= 0 {
+			return fmt.Errorf("target is required for source field %q", f.Source)
+		}
+		f.Target = f.Source[:idx]
+	}
+	return nil
+}
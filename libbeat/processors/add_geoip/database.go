@@ -0,0 +1,258 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+type databaseKind uint8
+
+const (
+	kindCity databaseKind = iota
+	kindCountry
+	kindASN
+)
+
+func (k databaseKind) String() string {
+	switch k {
+	case kindCity:
+		return "City"
+	case kindCountry:
+		return "Country"
+	case kindASN:
+		return "ASN"
+	default:
+		return "unknown"
+	}
+}
+
+// kindOf returns the kind of a database from its type in the database
+// metadata, like GeoLite2-City or GeoIP2-Country.
+func kindOf(databaseType string) (databaseKind, error) {
+	switch {
+	case strings.Contains(databaseType, "ASN"):
+		return kindASN, nil
+	case strings.Contains(databaseType, "City"):
+		return kindCity, nil
+	case strings.Contains(databaseType, "Country"):
+		return kindCountry, nil
+	default:
+		return 0, fmt.Errorf("unsupported database type %q", databaseType)
+	}
+}
+
+// database is a MaxMind DB file. The file is memory mapped, so it must be
+// replaced by renaming a new file over it rather than by writing to it.
+type database struct {
+	path string
+
+	mu      sync.RWMutex
+	reader  *maxminddb.Reader
+	kind    databaseKind
+	modTime time.Time
+	size    int64
+}
+
+func openDatabase(path string) (*database, error) {
+	db := &database{path: path}
+	if _, err := db.reload(); err != nil {
+		return nil, err
+	}
+	return db, nil
+}
+
+// reload opens the database file again if it changed since it was opened.
+// It returns whether the database was replaced. On errors, the current
+// database is kept.
+func (db *database) reload() (bool, error) {
+	info, err := os.Stat(db.path)
+	if err != nil {
+		return false, err
+	}
+	db.mu.RLock()
+	unchanged := db.reader != nil && info.ModTime().Equal(db.modTime) && info.Size() == db.size
+	db.mu.RUnlock()
+	if unchanged {
+		return false, nil
+	}
+
+	reader, err := maxminddb.Open(db.path)
+	if err != nil {
+		return false, fmt.Errorf("failed to open database %v: %w", db.path, err)
+	}
+	kind, err := kindOf(reader.Metadata.DatabaseType)
+	if err != nil {
+		reader.Close()
+		return false, fmt.Errorf("failed to open database %v: %w", db.path, err)
+	}
+
+	db.mu.Lock()
+	old := db.reader
+	db.reader, db.kind = reader, kind
+	db.modTime, db.size = info.ModTime(), info.Size()
+	db.mu.Unlock()
+
+	if old != nil {
+		// No lookups use the old reader anymore, so it can be unmapped.
+		old.Close()
+	}
+	return true, nil
+}
+
+// lookup adds the fields for ip to res.
+func (db *database) lookup(ip net.IP, language string, res *result) error {
+	db.mu.RLock()
+	defer db.mu.RUnlock()
+	if db.reader == nil {
+		return fmt.Errorf("database %v is closed", db.path)
+	}
+
+	switch db.kind {
+	case kindASN:
+		var rec asnRecord
+		if ok, err := db.lookupRecord(ip, &rec); !ok || err != nil {
+			return err
+		}
+		res.addAS(&rec)
+	default:
+		var rec cityRecord
+		if ok, err := db.lookupRecord(ip, &rec); !ok || err != nil {
+			return err
+		}
+		res.addGeo(&rec, language)
+	}
+	return nil
+}
+
+func (db *database) lookupRecord(ip net.IP, rec interface{}) (bool, error) {
+	_, ok, err := db.reader.LookupNetwork(ip, rec)
+	if err != nil {
+		return false, fmt.Errorf("failed to look up %v in database %v: %w", ip, db.path, err)
+	}
+	return ok, nil
+}
+
+func (db *database) Close() error {
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	if db.reader == nil {
+		return nil
+	}
+	err := db.reader.Close()
+	db.reader = nil
+	return err
+}
+
+// cityRecord contains the fields of the City and Country databases that are
+// mapped to ECS geo fields. Country databases lack the city, subdivision,
+// postal and most location fields.
+type cityRecord struct {
+	City struct {
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"city"`
+	Continent struct {
+		Code  string            `maxminddb:"code"`
+		Names map[string]string `maxminddb:"names"`
+	} `maxminddb:"continent"`
+	Country struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"country"`
+	Subdivisions []struct {
+		IsoCode string            `maxminddb:"iso_code"`
+		Names   map[string]string `maxminddb:"names"`
+	} `maxminddb:"subdivisions"`
+	Location struct {
+		Latitude  *float64 `maxminddb:"latitude"`
+		Longitude *float64 `maxminddb:"longitude"`
+		TimeZone  string   `maxminddb:"time_zone"`
+	} `maxminddb:"location"`
+	Postal struct {
+		Code string `maxminddb:"code"`
+	} `maxminddb:"postal"`
+}
+
+type asnRecord struct {
+	Number       uint   `maxminddb:"autonomous_system_number"`
+	Organization string `maxminddb:"autonomous_system_organization"`
+}
+
+// result contains the ECS fields for an IP address.
+type result struct {
+	geo mapstr.M
+	as  mapstr.M
+}
+
+func (r *result) empty() bool {
+	return len(r.geo) == 0 && len(r.as) == 0
+}
+
+func (r *result) addGeo(rec *cityRecord, language string) {
+	if r.geo == nil {
+		r.geo = mapstr.M{}
+	}
+	putString(r.geo, "continent_code", rec.Continent.Code)
+	putString(r.geo, "continent_name", rec.Continent.Names[language])
+	putString(r.geo, "country_iso_code", rec.Country.IsoCode)
+	putString(r.geo, "country_name", rec.Country.Names[language])
+	if len(rec.Subdivisions) > 0 {
+		// The first subdivision is the largest one, like the state.
+		sub := rec.Subdivisions[0]
+		if sub.IsoCode != "" && rec.Country.IsoCode != "" {
+			r.geo["region_iso_code"] = rec.Country.IsoCode + "-" + sub.IsoCode
+		}
+		putString(r.geo, "region_name", sub.Names[language])
+	}
+	putString(r.geo, "city_name", rec.City.Names[language])
+	putString(r.geo, "postal_code", rec.Postal.Code)
+	putString(r.geo, "timezone", rec.Location.TimeZone)
+	if rec.Location.Latitude != nil && rec.Location.Longitude != nil {
+		r.geo["location"] = mapstr.M{
+			"lat": *rec.Location.Latitude,
+			"lon": *rec.Location.Longitude,
+		}
+	}
+}
+
+func (r *result) addAS(rec *asnRecord) {
+	if r.as == nil {
+		r.as = mapstr.M{}
+	}
+	if rec.Number != 0 {
+		r.as["number"] = int64(rec.Number)
+	}
+	if rec.Organization != "" {
+		r.as["organization"] = mapstr.M{"name": rec.Organization}
+	}
+}
+
+func putString(m mapstr.M, key, value string) {
+	if value != "" {
+		m[key] = value
+	}
+}
@@ -0,0 +1,255 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package add_geoip
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"math"
+	"net/netip"
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"github.com/stretchr/testify/require"
+)
+
+// writeMMDB writes a MaxMind DB file of the given type to path, containing
+// the data for the given networks. The file is written to a temporary file
+// first and renamed, like database updates should be. Networks must not
+// overlap.
+func writeMMDB(t testing.TB, path, databaseType string, networks map[string]map[string]interface{}) {
+	t.Helper()
+
+	root := &mmdbNode{}
+	var data bytes.Buffer
+	for cidr, record := range networks {
+		prefix := netip.MustParsePrefix(cidr)
+		offset := data.Len()
+		encodeMMDB(&data, record)
+		root.insert(mmdbBits(prefix), offset)
+	}
+
+	// Number the nodes breadth first, the root being node 0.
+	var nodes []*mmdbNode
+	queue := []*mmdbNode{root}
+	for len(queue) > 0 {
+		n := queue[0]
+		queue = queue[1:]
+		n.index = len(nodes)
+		nodes = append(nodes, n)
+		for _, c := range n.children {
+			if c != nil && c.offset < 0 {
+				queue = append(queue, c)
+			}
+		}
+	}
+	nodeCount := uint32(len(nodes))
+
+	var buf bytes.Buffer
+	for _, n := range nodes {
+		for _, c := range n.children {
+			var record uint32
+			switch {
+			case c == nil:
+				record = nodeCount
+			case c.offset >= 0:
+				record = nodeCount + 16 + uint32(c.offset)
+			default:
+				record = uint32(c.index)
+			}
+			buf.Write([]byte{byte(record >> 16), byte(record >> 8), byte(record)})
+		}
+	}
+	buf.Write(make([]byte, 16))
+	buf.Write(data.Bytes())
+	buf.WriteString("\xAB\xCD\xEFMaxMind.com")
+	encodeMMDB(&buf, map[string]interface{}{
+		"binary_format_major_version": uint32(2),
+		"binary_format_minor_version": uint32(0),
+		"build_epoch":                 uint64(time.Now().Unix()),
+		"database_type":               databaseType,
+		"description":                 map[string]interface{}{"en": "Test database"},
+		"ip_version":                  uint32(6),
+		"languages":                   []interface{}{"en"},
+		"node_count":                  nodeCount,
+		"record_size":                 uint32(24),
+	})
+
+	tmp := path + ".tmp"
+	require.NoError(t, os.WriteFile(tmp, buf.Bytes(), 0o600))
+	require.NoError(t, os.Rename(tmp, path))
+
+	reader, err := maxminddb.Open(path)
+	require.NoError(t, err)
+	defer reader.Close()
+	require.NoError(t, reader.Verify())
+}
+
+type mmdbNode struct {
+	children [2]*mmdbNode
+	// offset is the offset of the data of a leaf in the data section, or
+	// -1 for inner nodes.
+	offset int
+	index  int
+}
+
+func (n *mmdbNode) insert(bits []byte, offset int) {
+	n.offset = -1
+	if len(bits) == 1 {
+		n.children[bits[0]] = &mmdbNode{offset: offset}
+		return
+	}
+	c := n.children[bits[0]]
+	if c == nil {
+		c = &mmdbNode{}
+		n.children[bits[0]] = c
+	}
+	c.insert(bits[1:], offset)
+}
+
+// mmdbBits returns the bits of the prefix in an IPv6 tree, where IPv4
+// addresses are stored in ::/96.
+func mmdbBits(prefix netip.Prefix) []byte {
+	addr := prefix.Addr().As16()
+	n := prefix.Bits()
+	if prefix.Addr().Is4() {
+		addr = [16]byte{}
+		v4 := prefix.Addr().As4()
+		copy(addr[12:], v4[:])
+		n += 96
+	}
+	bits := make([]byte, n)
+	for i := range bits {
+		bits[i] = (addr[i/8] >> (7 - i%8)) & 1
+	}
+	return bits
+}
+
+// encodeMMDB appends the encoding of v in the MaxMind DB data section format
+// to buf.
+func encodeMMDB(buf *bytes.Buffer, v interface{}) {
+	switch v := v.(type) {
+	case string:
+		mmdbControl(buf, 2, len(v))
+		buf.WriteString(v)
+	case float64:
+		mmdbControl(buf, 3, 8)
+		_ = binary.Write(buf, binary.BigEndian, math.Float64bits(v))
+	case uint32:
+		mmdbUint(buf, 6, uint64(v))
+	case uint64:
+		mmdbUint(buf, 9, v)
+	case bool:
+		size := 0
+		if v {
+			size = 1
+		}
+		mmdbControl(buf, 14, size)
+	case map[string]interface{}:
+		mmdbControl(buf, 7, len(v))
+		keys := make([]string, 0, len(v))
+		for k := range v {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			encodeMMDB(buf, k)
+			encodeMMDB(buf, v[k])
+		}
+	case []interface{}:
+		mmdbControl(buf, 11, len(v))
+		for _, e := range v {
+			encodeMMDB(buf, e)
+		}
+	default:
+		panic(fmt.Sprintf("unsupported type %T", v))
+	}
+}
+
+func mmdbUint(buf *bytes.Buffer, typ int, v uint64) {
+	var b []byte
+	for ; v > 0; v >>= 8 {
+		b = append([]byte{byte(v)}, b...)
+	}
+	mmdbControl(buf, typ, len(b))
+	buf.Write(b)
+}
+
+func mmdbControl(buf *bytes.Buffer, typ, size int) {
+	var sizeBytes []byte
+	switch {
+	case size < 29:
+	case size < 29+256:
+		sizeBytes = []byte{byte(size - 29)}
+		size = 29
+	case size < 285+65536:
+		size -= 285
+		sizeBytes = []byte{byte(size >> 8), byte(size)}
+		size = 30
+	default:
+		size -= 65821
+		sizeBytes = []byte{byte(size >> 16), byte(size >> 8), byte(size)}
+		size = 31
+	}
+	if typ <= 7 {
+		buf.WriteByte(byte(typ<<5 | size))
+	} else {
+		buf.WriteByte(byte(size))
+		buf.WriteByte(byte(typ - 7))
+	}
+	buf.Write(sizeBytes)
+}
+
+func writeTestDatabases(t testing.TB, dir string) (city, asn string) {
+	t.Helper()
+	city = filepath.Join(dir, "GeoLite2-City.mmdb")
+	writeMMDB(t, city, "GeoLite2-City", map[string]map[string]interface{}{
+		"81.2.69.0/24": {
+			"city":      map[string]interface{}{"names": map[string]interface{}{"en": "London", "de": "London"}},
+			"continent": map[string]interface{}{"code": "EU", "names": map[string]interface{}{"en": "Europe", "de": "Europa"}},
+			"country":   map[string]interface{}{"iso_code": "GB", "names": map[string]interface{}{"en": "United Kingdom", "de": "Vereinigtes Königreich"}},
+			"location": map[string]interface{}{
+				"latitude":  51.5142,
+				"longitude": -0.0931,
+				"time_zone": "Europe/London",
+			},
+			"postal": map[string]interface{}{"code": "EC2V"},
+			"subdivisions": []interface{}{
+				map[string]interface{}{"iso_code": "ENG", "names": map[string]interface{}{"en": "England"}},
+			},
+		},
+		"2001:db8::/32": {
+			"continent": map[string]interface{}{"code": "NA", "names": map[string]interface{}{"en": "North America"}},
+			"country":   map[string]interface{}{"iso_code": "US", "names": map[string]interface{}{"en": "United States"}},
+		},
+	})
+
+	asn = filepath.Join(dir, "GeoLite2-ASN.mmdb")
+	writeMMDB(t, asn, "GeoLite2-ASN", map[string]map[string]interface{}{
+		"81.2.69.0/24": {
+			"autonomous_system_number":       uint32(20712),
+			"autonomous_system_organization": "Andrews & Arnold Ltd",
+		},
+	})
+	return city, asn
+}
@@ -109,6 +109,22 @@ func getStoreFor(cfg config, log *logp.Logger) (Store, context.CancelFunc, error
 	}
 }
 
+// BackendConfig is the configuration of a store, as in the backend setting
+// of the cache processor.
+type BackendConfig = storeConfig
+
+// OpenStore returns the store configured by backend for other processors.
+// Stores are shared with all processors using the same backend ID, and
+// values put into them expire after ttl, unless the TTL of the store was
+// set by a previous put configuration. The returned context.CancelFunc
+// releases the store and must be called when it is no longer required.
+func OpenStore(backend BackendConfig, ttl time.Duration, log *logp.Logger) (Store, context.CancelFunc, error) {
+	return getStoreFor(config{
+		Put:   &putConfig{TTL: &ttl},
+		Store: &backend,
+	}, log)
+}
+
 // noop is a no-op context.CancelFunc.
 func noop() {}
 
@@ -158,6 +158,9 @@ func (c *memStore) Get(key string) (any, error) {
 		return nil, ErrNoData
 	}
 	if time.Now().After(v.Expires) {
+		// Remove the expiry entry too, so that its eviction doesn't
+		// delete a later entry for the same key.
+		heap.Remove(&c.expiries, v.index)
 		delete(c.cache, key)
 		return nil, ErrNoData
 	}
@@ -465,6 +465,29 @@ func TestMemStore(t *testing.T) {
 	}
 }
 
+func TestMemStoreGetExpired(t *testing.T) {
+	store := newMemStore(config{}, "test")
+	store.add(config{Put: &putConfig{TTL: ptrTo(10 * time.Millisecond)}, Store: &storeConfig{}})
+
+	store.Put("a", 1)
+	time.Sleep(20 * time.Millisecond)
+	if _, err := store.Get("a"); err != ErrNoData {
+		t.Fatalf("unexpected error getting expired entry: %v", err)
+	}
+
+	// Putting another entry evicts the expired entries, which must not
+	// include the new entry of the key.
+	store.Put("a", 2)
+	store.Put("b", 3)
+	got, err := store.Get("a")
+	if err != nil {
+		t.Fatalf("unexpected error getting entry: %v", err)
+	}
+	if got != 2 {
+		t.Errorf("unexpected value: got:%v want:2", got)
+	}
+}
+
 // add adds the store to the set. It is used only for testing.
 func (s *memStoreSet) add(store *memStore) {
 	s.mu.Lock()
@@ -72,6 +72,19 @@ func (r *WhenProcessor) Run(event *beat.Event) (*beat.Event, error) {
 	return r.p.Run(event)
 }
 
+// FansOut reports whether the processor can return several events.
+func (r *WhenProcessor) FansOut() bool {
+	return FansOut(r.p)
+}
+
+// RunFanOut executes this WhenProcessor, which may return several events.
+func (r *WhenProcessor) RunFanOut(event *beat.Event) ([]*beat.Event, error) {
+	if !(r.condition).Check(event) {
+		return []*beat.Event{event}, nil
+	}
+	return RunFanOut(r.p, event)
+}
+
 func (r *WhenProcessor) String() string {
 	return fmt.Sprintf("%v, condition=%v", r.p.String(), r.condition.String())
 }
@@ -160,6 +173,23 @@ func (p *IfThenElseProcessor) Run(event *beat.Event) (*beat.Event, error) {
 	return event, nil
 }
 
+// FansOut reports whether the processors of the then or the else statement
+// can return several events.
+func (p *IfThenElseProcessor) FansOut() bool {
+	return p.then.FansOut() || (p.els != nil && p.els.FansOut())
+}
+
+// RunFanOut is like Run, but returns all events resulting from processors
+// replacing events with several events.
+func (p *IfThenElseProcessor) RunFanOut(event *beat.Event) ([]*beat.Event, error) {
+	if p.cond.Check(event) {
+		return p.then.RunFanOut(event)
+	} else if p.els != nil {
+		return p.els.RunFanOut(event)
+	}
+	return []*beat.Event{event}, nil
+}
+
 func (p *IfThenElseProcessor) String() string {
 	var sb strings.Builder
 	sb.WriteString("if ")
@@ -0,0 +1,65 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"fmt"
+	"regexp"
+)
+
+type config struct {
+	Field         string   `config:"field"`
+	TargetField   string   `config:"target_field"`
+	FieldSplit    string   `config:"field_split" validate:"required"`
+	ValueSplit    string   `config:"value_split" validate:"required"`
+	IncludeKeys   []string `config:"include_keys"`
+	ExcludeKeys   []string `config:"exclude_keys"`
+	Prefix        string   `config:"prefix"`
+	TrimKey       string   `config:"trim_key"`
+	TrimValue     string   `config:"trim_value"`
+	StripBrackets bool     `config:"strip_brackets"`
+	QuoteChars    string   `config:"quote_chars"`
+	IgnoreMissing bool     `config:"ignore_missing"`
+	IgnoreFailure bool     `config:"ignore_failure"`
+}
+
+func defaultConfig() config {
+	return config{
+		Field:      "message",
+		FieldSplit: " ",
+		ValueSplit: "=",
+	}
+}
+
+func (c *config) Validate() error {
+	for name, expr := range map[string]string{"field_split": c.FieldSplit, "value_split": c.ValueSplit} {
+		re, err := regexp.Compile(expr)
+		if err != nil {
+			return fmt.Errorf("invalid %v: %w", name, err)
+		}
+		if re.MatchString("") {
+			return fmt.Errorf("%v must not match the empty string", name)
+		}
+	}
+	for _, r := range c.QuoteChars {
+		if r > 127 || r == '\\' {
+			return fmt.Errorf("invalid quote character %q", r)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,294 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const procName = "decode_kv"
+
+var errFieldIsNotString = errors.New("field value is not a string")
+
+// Characters removed from the start and the end of values when
+// strip_brackets is enabled.
+const (
+	openingBrackets = `([<"'`
+	closingBrackets = `)]>"'`
+)
+
+type decodeKV struct {
+	config
+
+	fieldSplit *regexp.Regexp
+	valueSplit *regexp.Regexp
+	include    map[string]struct{}
+	exclude    map[string]struct{}
+}
+
+// pair is a decoded key-value pair.
+type pair struct {
+	key, value string
+}
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"field", "target_field",
+				"field_split", "value_split",
+				"include_keys", "exclude_keys",
+				"prefix", "trim_key", "trim_value",
+				"strip_brackets", "quote_chars",
+				"ignore_missing", "ignore_failure",
+				"when",
+			)))
+	jsprocessor.RegisterPlugin("DecodeKV", New)
+}
+
+// New constructs a new decode_kv processor.
+func New(c *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+	return newDecodeKV(config)
+}
+
+func newDecodeKV(config config) (*decodeKV, error) {
+	fieldSplit, err := regexp.Compile(config.FieldSplit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid field_split: %w", err)
+	}
+	valueSplit, err := regexp.Compile(config.ValueSplit)
+	if err != nil {
+		return nil, fmt.Errorf("invalid value_split: %w", err)
+	}
+	return &decodeKV{
+		config:     config,
+		fieldSplit: fieldSplit,
+		valueSplit: valueSplit,
+		include:    keySet(config.IncludeKeys),
+		exclude:    keySet(config.ExcludeKeys),
+	}, nil
+}
+
+func keySet(keys []string) map[string]struct{} {
+	if len(keys) == 0 {
+		return nil
+	}
+	set := make(map[string]struct{}, len(keys))
+	for _, k := range keys {
+		set[k] = struct{}{}
+	}
+	return set
+}
+
+func (p *decodeKV) Run(event *beat.Event) (*beat.Event, error) {
+	if err := p.run(event); err != nil && !p.IgnoreFailure {
+		err = fmt.Errorf("failed in %s on the %q field: %w", procName, p.Field, err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+func (p *decodeKV) run(event *beat.Event) error {
+	data, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	text, ok := data.(string)
+	if !ok {
+		return errFieldIsNotString
+	}
+
+	pairs, err := p.decode(text)
+	if err != nil {
+		return err
+	}
+
+	for _, kv := range pairs {
+		if err := appendValue(event, p.path(kv.key), kv.value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decode splits text into the key-value pairs to add to the event, in order.
+// Pairs are separated by field_split, and keys are separated from values by
+// the first match of value_split. Like the Elasticsearch kv processor, a
+// non-empty pair without value_split is an error.
+func (p *decodeKV) decode(text string) ([]pair, error) {
+	var pairs []pair
+	for rest := text; rest != ""; {
+		part, next := rest, ""
+		if loc := p.fieldSplit.FindStringIndex(rest); loc != nil {
+			part, next = rest[:loc[0]], rest[loc[1]:]
+		}
+		if part == "" {
+			rest = next
+			continue
+		}
+
+		loc := p.valueSplit.FindStringIndex(part)
+		if loc == nil {
+			return nil, fmt.Errorf("%q does not contain value_split %q", part, p.ValueSplit)
+		}
+		key, value := part[:loc[0]], part[loc[1]:]
+		if quoted := rest[loc[1]:]; quoted != "" && strings.IndexByte(p.QuoteChars, quoted[0]) >= 0 {
+			// A quoted value can contain field separators, so the value
+			// ends with the closing quote rather than the next separator.
+			if unquoted, n, ok := unquote(quoted); ok {
+				value, next = unquoted, ""
+				after := quoted[n:]
+				if loc := p.fieldSplit.FindStringIndex(after); loc != nil {
+					value += after[:loc[0]]
+					next = after[loc[1]:]
+				} else {
+					value += after
+				}
+			}
+		}
+		rest = next
+
+		key = strings.Trim(key, p.TrimKey)
+		if !p.keep(key) {
+			continue
+		}
+		if key == "" {
+			return nil, fmt.Errorf("empty key in %q", part)
+		}
+		if p.StripBrackets {
+			value = stripBrackets(value)
+		}
+		pairs = append(pairs, pair{key: key, value: strings.Trim(value, p.TrimValue)})
+	}
+	return pairs, nil
+}
+
+func (p *decodeKV) keep(key string) bool {
+	if p.include != nil {
+		if _, ok := p.include[key]; !ok {
+			return false
+		}
+	}
+	_, excluded := p.exclude[key]
+	return !excluded
+}
+
+func (p *decodeKV) path(key string) string {
+	key = p.Prefix + key
+	if p.TargetField == "" {
+		return key
+	}
+	return p.TargetField + "." + key
+}
+
+// stripBrackets removes a leading opening bracket or quote and a trailing
+// closing bracket or quote from value. The characters don't need to match.
+func stripBrackets(value string) string {
+	if value != "" && strings.IndexByte(openingBrackets, value[0]) >= 0 {
+		value = value[1:]
+	}
+	if value != "" && strings.IndexByte(closingBrackets, value[len(value)-1]) >= 0 {
+		value = value[:len(value)-1]
+	}
+	return value
+}
+
+// unquote returns the content of the quoted string at the start of s, and
+// the number of bytes up to and including the closing quote. A backslash
+// escapes the quote character and itself, \n, \r and \t are unescaped to
+// the control characters, and other escape sequences are kept as is. ok is
+// false if the closing quote is missing.
+func unquote(s string) (value string, n int, ok bool) {
+	quote := s[0]
+	var b strings.Builder
+	for i := 1; i < len(s); i++ {
+		switch c := s[i]; {
+		case c == quote:
+			return b.String(), i + 1, true
+		case c == '\\' && i+1 < len(s):
+			i++
+			switch esc := s[i]; esc {
+			case quote, '\\':
+				b.WriteByte(esc)
+			case 'n':
+				b.WriteByte('\n')
+			case 'r':
+				b.WriteByte('\r')
+			case 't':
+				b.WriteByte('\t')
+			default:
+				b.WriteByte('\\')
+				b.WriteByte(esc)
+			}
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return "", 0, false
+}
+
+// appendValue adds value to the field at path. Like the Elasticsearch kv
+// processor, a field that exists already, because the key is repeated or
+// because it is set in the event, is turned into a list of values.
+func appendValue(event *beat.Event, path string, value string) error {
+	var v interface{} = value
+	switch existing, err := event.GetValue(path); {
+	case errors.Is(err, mapstr.ErrKeyNotFound):
+	case err != nil:
+		return fmt.Errorf("failed to read field %q: %w", path, err)
+	default:
+		switch existing := existing.(type) {
+		case []interface{}:
+			v = append(existing, value)
+		case []string:
+			v = append(existing, value)
+		default:
+			v = []interface{}{existing, value}
+		}
+	}
+	if _, err := event.PutValue(path, v); err != nil {
+		return fmt.Errorf("failed to put value into field %q: %w", path, err)
+	}
+	return nil
+}
+
+func (p *decodeKV) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
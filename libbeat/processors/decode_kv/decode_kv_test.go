@@ -0,0 +1,264 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package decode_kv
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestDecodeKV(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		input  mapstr.M
+		want   mapstr.M
+		err    string
+	}{
+		"target field": {
+			config: map[string]interface{}{"target_field": "kv"},
+			input:  mapstr.M{"message": "first=hello second=world"},
+			want: mapstr.M{
+				"message": "first=hello second=world",
+				"kv":      mapstr.M{"first": "hello", "second": "world"},
+			},
+		},
+		"root target": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "first=hello second=world"},
+			want:   mapstr.M{"message": "first=hello second=world", "first": "hello", "second": "world"},
+		},
+		"repeated keys": {
+			config: map[string]interface{}{"target_field": "kv"},
+			input:  mapstr.M{"message": "first=hello second=world second=universe second=!"},
+			want: mapstr.M{
+				"message": "first=hello second=world second=universe second=!",
+				"kv": mapstr.M{
+					"first":  "hello",
+					"second": []interface{}{"world", "universe", "!"},
+				},
+			},
+		},
+		"existing field": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "tags=b", "tags": []string{"a"}},
+			want:   mapstr.M{"message": "tags=b", "tags": []string{"a", "b"}},
+		},
+		"nested keys": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "source.ip=10.0.0.1 source.port=53"},
+			want: mapstr.M{
+				"message": "source.ip=10.0.0.1 source.port=53",
+				"source":  mapstr.M{"ip": "10.0.0.1", "port": "53"},
+			},
+		},
+		"regexp separators": {
+			config: map[string]interface{}{"field_split": `[&;]\s*`, "value_split": `:\s*`},
+			input:  mapstr.M{"message": "a: 1&b:2; c:  3"},
+			want:   mapstr.M{"message": "a: 1&b:2; c:  3", "a": "1", "b": "2", "c": "3"},
+		},
+		"value split in value": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "url=/search?q=1"},
+			want:   mapstr.M{"message": "url=/search?q=1", "url": "/search?q=1"},
+		},
+		"empty pairs": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "  a=1   b= "},
+			want:   mapstr.M{"message": "  a=1   b= ", "a": "1", "b": ""},
+		},
+		"include keys": {
+			config: map[string]interface{}{"include_keys": []string{"first", "third"}},
+			input:  mapstr.M{"message": "first=1 second=2 third=3"},
+			want:   mapstr.M{"message": "first=1 second=2 third=3", "first": "1", "third": "3"},
+		},
+		"exclude keys": {
+			config: map[string]interface{}{"exclude_keys": []string{"second"}},
+			input:  mapstr.M{"message": "first=1 second=2 third=3"},
+			want:   mapstr.M{"message": "first=1 second=2 third=3", "first": "1", "third": "3"},
+		},
+		"include and exclude keys": {
+			config: map[string]interface{}{
+				"include_keys": []string{"first", "second"},
+				"exclude_keys": []string{"second"},
+			},
+			input: mapstr.M{"message": "first=1 second=2 third=3"},
+			want:  mapstr.M{"message": "first=1 second=2 third=3", "first": "1"},
+		},
+		"prefix": {
+			config: map[string]interface{}{"prefix": "arg_", "target_field": "kv"},
+			input:  mapstr.M{"message": "first=1 second=2"},
+			want: mapstr.M{
+				"message": "first=1 second=2",
+				"kv":      mapstr.M{"arg_first": "1", "arg_second": "2"},
+			},
+		},
+		"trim key and value": {
+			config: map[string]interface{}{"field_split": "&", "trim_key": " ", "trim_value": ` "`},
+			input:  mapstr.M{"message": ` first = "1" & second=2 `},
+			want:   mapstr.M{"message": ` first = "1" & second=2 `, "first": "1", "second": "2"},
+		},
+		"strip brackets": {
+			config: map[string]interface{}{"strip_brackets": true, "target_field": "kv"},
+			input:  mapstr.M{"message": `a=(1) b=[2] c=<3> d="4" e='5' f=(6" g=7`},
+			want: mapstr.M{
+				"message": `a=(1) b=[2] c=<3> d="4" e='5' f=(6" g=7`,
+				"kv": mapstr.M{
+					"a": "1", "b": "2", "c": "3", "d": "4", "e": "5", "f": "6", "g": "7",
+				},
+			},
+		},
+		"quotes are kept by default": {
+			config: map[string]interface{}{"target_field": "kv"},
+			input:  mapstr.M{"message": `a="x" b=y`},
+			want: mapstr.M{
+				"message": `a="x" b=y`,
+				"kv":      mapstr.M{"a": `"x"`, "b": "y"},
+			},
+		},
+		"quoted values": {
+			config: map[string]interface{}{"quote_chars": `"'`, "target_field": "kv"},
+			input:  mapstr.M{"message": `level=info msg="hello \"big\" world" path='C:\\temp' empty="" tail="x"y nl="a\nb" other="\d"`},
+			want: mapstr.M{
+				"message": `level=info msg="hello \"big\" world" path='C:\\temp' empty="" tail="x"y nl="a\nb" other="\d"`,
+				"kv": mapstr.M{
+					"level": "info",
+					"msg":   `hello "big" world`,
+					"path":  `C:\temp`,
+					"empty": "",
+					"tail":  "xy",
+					"nl":    "a\nb",
+					"other": `\d`,
+				},
+			},
+		},
+		"unterminated quote": {
+			config: map[string]interface{}{"quote_chars": `"`, "target_field": "kv"},
+			input:  mapstr.M{"message": `a="x b=y`},
+			want: mapstr.M{
+				"message": `a="x b=y`,
+				"kv":      mapstr.M{"a": `"x`, "b": "y"},
+			},
+		},
+		"missing value split": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "first=1 this is not kv"},
+			want: mapstr.M{
+				"message": "first=1 this is not kv",
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: "this" does not contain value_split "="`},
+			},
+			err: `does not contain value_split`,
+		},
+		"ignore failure": {
+			config: map[string]interface{}{"ignore_failure": true},
+			input:  mapstr.M{"message": "this is not kv"},
+			want:   mapstr.M{"message": "this is not kv"},
+		},
+		"empty key": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "=1"},
+			want: mapstr.M{
+				"message": "=1",
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: empty key in "=1"`},
+			},
+			err: "empty key",
+		},
+		"missing field": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"other": "a=1"},
+			want: mapstr.M{
+				"other": "a=1",
+				"error": mapstr.M{"message": `failed in decode_kv on the "message" field: key not found`},
+			},
+			err: "key not found",
+		},
+		"ignore missing": {
+			config: map[string]interface{}{"ignore_missing": true},
+			input:  mapstr.M{"other": "a=1"},
+			want:   mapstr.M{"other": "a=1"},
+		},
+		"not a string": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": 1},
+			want: mapstr.M{
+				"message": 1,
+				"error":   mapstr.M{"message": `failed in decode_kv on the "message" field: field value is not a string`},
+			},
+			err: "not a string",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(test.config), logptest.NewTestingLogger(t, ""))
+			require.NoError(t, err)
+
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestConfigErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"invalid field_split":   {"field_split": "("},
+		"empty field_split":     {"field_split": ""},
+		"empty match":           {"value_split": "=*"},
+		"backslash quote":       {"quote_chars": `\`},
+		"non-ASCII quote chars": {"quote_chars": "«"},
+	}
+
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(c), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func BenchmarkDecodeKV(b *testing.B) {
+	const message = `date=2024-01-02 time=03:04:05 devname="FW-01" devid="FG100F" logid="0000000013" type="traffic" subtype="forward" level="notice" srcip=10.1.1.10 srcport=52000 dstip=93.184.216.34 dstport=443 action="accept" msg="allowed"`
+
+	for name, quotes := range map[string]string{"unquoted": "", "quoted": `"`} {
+		b.Run(name, func(b *testing.B) {
+			p, err := New(conf.MustNewConfigFrom(map[string]interface{}{
+				"target_field": "kv",
+				"quote_chars":  quotes,
+			}), logptest.NewTestingLogger(b, ""))
+			require.NoError(b, err)
+
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.Run(&beat.Event{Fields: mapstr.M{"message": message}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/processors/cache"
+)
+
+const (
+	actionDrop = "drop"
+	actionTag  = "tag"
+)
+
+type config struct {
+	// KeyField is the field containing the key of events.
+	KeyField string `config:"key_field"`
+
+	// Fields are the fields the key of events is computed from, with the
+	// hashing of the fingerprint processor.
+	Fields   []string `config:"fields"`
+	Method   string   `config:"method"`
+	Encoding string   `config:"encoding"`
+
+	// TTL is the time window in which events with the same key are
+	// duplicates.
+	TTL time.Duration `config:"ttl" validate:"positive"`
+
+	Action string `config:"action"`
+	Tag    string `config:"tag"`
+
+	Store *cache.BackendConfig `config:"backend" validate:"required"`
+
+	// IgnoreMissing passes events without key through.
+	IgnoreMissing bool `config:"ignore_missing"`
+}
+
+func defaultConfig() config {
+	return config{
+		Method:   "sha256",
+		Encoding: "hex",
+		TTL:      10 * time.Minute,
+		Action:   actionDrop,
+		Tag:      "duplicate",
+	}
+}
+
+func (c *config) Validate() error {
+	switch {
+	case c.KeyField == "" && len(c.Fields) == 0:
+		return errors.New("must specify one of key_field or fields")
+	case c.KeyField != "" && len(c.Fields) != 0:
+		return errors.New("cannot specify both key_field and fields")
+	}
+	switch c.Action {
+	case actionDrop:
+	case actionTag:
+		if c.Tag == "" {
+			return errors.New("tag must not be empty with the tag action")
+		}
+	default:
+		return fmt.Errorf("unknown action %q, must be %v or %v", c.Action, actionDrop, actionTag)
+	}
+	return nil
+}
@@ -0,0 +1,189 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"sync/atomic"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/cache"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+const (
+	procName = "deduplicate"
+	logName  = "processor." + procName
+)
+
+func init() {
+	// We cannot use this as a JS plugin as it is stateful and includes a Close method.
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"key_field", "fields", "method", "encoding", "ttl", "action",
+				"tag", "backend", "ignore_missing", "when",
+			)))
+}
+
+type metrics struct {
+	dropped *monitoring.Int
+	tagged  *monitoring.Int
+}
+
+type deduplicate struct {
+	config
+	key     func(*beat.Event) (string, error)
+	store   cache.Store
+	cancel  context.CancelFunc
+	metrics metrics
+	log     *logp.Logger
+
+	// mu makes the lookup and the insertion of keys atomic, so that
+	// concurrent duplicates are not all considered as new.
+	mu sync.Mutex
+}
+
+// New constructs a new deduplicate processor. The processor implements
+// Close to release its store.
+func New(cfg *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %s configuration: %w", procName, err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id  = int(instanceID.Add(1))
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+	return newDeduplicate(config, reg, log.Named(logName).With("instance_id", id))
+}
+
+func newDeduplicate(config config, reg *monitoring.Registry, log *logp.Logger) (*deduplicate, error) {
+	p := &deduplicate{
+		config: config,
+		metrics: metrics{
+			dropped: monitoring.NewInt(reg, "dropped"),
+			tagged:  monitoring.NewInt(reg, "tagged"),
+		},
+		log: log,
+	}
+
+	if len(config.Fields) != 0 {
+		var err error
+		p.key, err = fingerprint.NewFingerprinter(config.Fields, config.Method, config.Encoding)
+		if err != nil {
+			return nil, fmt.Errorf("failed to configure the key of %s: %w", procName, err)
+		}
+	} else {
+		p.key = p.keyFromField
+	}
+
+	var err error
+	p.store, p.cancel, err = cache.OpenStore(*config.Store, config.TTL, log)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get the store for %s: %w", procName, err)
+	}
+	return p, nil
+}
+
+// Run drops or tags the event if an event with the same key was seen
+// within the TTL. The first event of a key starts the window, which isn't
+// extended by the duplicates.
+func (p *deduplicate) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.key(event)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, fmt.Errorf("failed to get the key of the event in %s: %w", procName, err)
+	}
+
+	duplicate, err := p.seen(key)
+	if err != nil {
+		return event, fmt.Errorf("failed to store key in %s: %w", procName, err)
+	}
+	if !duplicate {
+		return event, nil
+	}
+
+	if p.Action == actionTag {
+		p.metrics.tagged.Inc()
+		if err := mapstr.AddTags(event.Fields, []string{p.Tag}); err != nil {
+			return event, fmt.Errorf("failed to tag duplicate event in %s: %w", procName, err)
+		}
+		return event, nil
+	}
+	p.log.Debugw("dropped duplicate event", "key", key)
+	p.metrics.dropped.Inc()
+	return nil, nil
+}
+
+// seen reports whether the key is in the store, and puts it into the store
+// otherwise.
+func (p *deduplicate) seen(key string) (bool, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.store.Get(key); err == nil {
+		return true, nil
+	}
+	return false, p.store.Put(key, true)
+}
+
+func (p *deduplicate) keyFromField(event *beat.Event) (string, error) {
+	v, err := event.GetValue(p.KeyField)
+	if err != nil {
+		return "", err
+	}
+	switch v := v.(type) {
+	case string:
+		return v, nil
+	case int, int32, int64, uint, uint32, uint64:
+		return fmt.Sprint(v), nil
+	default:
+		return "", fmt.Errorf("key field '%s' not a string: %T", p.KeyField, v)
+	}
+}
+
+func (p *deduplicate) Close() error {
+	p.cancel()
+	return nil
+}
+
+// String returns the processor representation formatted as a string
+func (p *deduplicate) String() string {
+	key := "key_field=" + p.KeyField
+	if len(p.Fields) != 0 {
+		key = fmt.Sprintf("fields=%v, method=%s", p.Fields, p.Method)
+	}
+	return fmt.Sprintf("%s=[%s, store_id=%s, ttl=%v, action=%s]", procName, key, p.store, p.TTL, p.Action)
+}
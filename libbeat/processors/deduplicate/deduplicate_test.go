@@ -0,0 +1,211 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package deduplicate
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+func newTestDeduplicate(t *testing.T, settings mapstr.M) (*deduplicate, *monitoring.Registry) {
+	t.Helper()
+	config := defaultConfig()
+	require.NoError(t, conf.MustNewConfigFrom(settings).Unpack(&config))
+	reg := monitoring.NewRegistry()
+	p, err := newDeduplicate(config, reg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return p, reg
+}
+
+func newEvent(fields mapstr.M) *beat.Event {
+	return &beat.Event{Timestamp: time.Now(), Fields: fields}
+}
+
+func TestDeduplicate(t *testing.T) {
+	tests := map[string]struct {
+		settings mapstr.M
+		events   []mapstr.M
+		want     []bool // want reports whether each event is a duplicate.
+	}{
+		"key field": {
+			settings: mapstr.M{"key_field": "event.id"},
+			events: []mapstr.M{
+				{"event": mapstr.M{"id": "a"}, "message": "first"},
+				{"event": mapstr.M{"id": "b"}, "message": "first"},
+				{"event": mapstr.M{"id": "a"}, "message": "second"},
+			},
+			want: []bool{false, false, true},
+		},
+		"fields": {
+			settings: mapstr.M{"fields": []string{"message", "host.name"}},
+			events: []mapstr.M{
+				{"message": "hello", "host": mapstr.M{"name": "a"}},
+				{"message": "hello", "host": mapstr.M{"name": "b"}},
+				{"message": "hello", "host": mapstr.M{"name": "a"}, "other": 1},
+			},
+			want: []bool{false, false, true},
+		},
+		"missing key": {
+			settings: mapstr.M{"fields": []string{"message"}, "ignore_missing": true},
+			events: []mapstr.M{
+				{"other": "hello"},
+				{"other": "hello"},
+			},
+			want: []bool{false, false},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			tc.settings["backend"] = mapstr.M{"memory.id": t.Name()}
+			p, reg := newTestDeduplicate(t, tc.settings)
+			defer p.Close()
+
+			var dropped int64
+			for i, fields := range tc.events {
+				got, err := p.Run(newEvent(fields))
+				require.NoError(t, err)
+				if tc.want[i] {
+					assert.Nil(t, got, "event %d", i)
+					dropped++
+				} else {
+					assert.NotNil(t, got, "event %d", i)
+				}
+			}
+
+			snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+			assert.Equal(t, dropped, snapshot.Ints["dropped"])
+		})
+	}
+}
+
+func TestTagAction(t *testing.T) {
+	p, reg := newTestDeduplicate(t, mapstr.M{
+		"key_field": "event.id",
+		"action":    "tag",
+		"backend":   mapstr.M{"memory.id": t.Name()},
+	})
+	defer p.Close()
+
+	first, err := p.Run(newEvent(mapstr.M{"event.id": "a"}))
+	require.NoError(t, err)
+	assert.NotContains(t, first.Fields, "tags")
+
+	second, err := p.Run(newEvent(mapstr.M{"event.id": "a", "tags": []string{"syslog"}}))
+	require.NoError(t, err)
+	assert.Equal(t, []string{"syslog", "duplicate"}, second.Fields["tags"])
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(1), snapshot.Ints["tagged"])
+	assert.Equal(t, int64(0), snapshot.Ints["dropped"])
+}
+
+func TestTTL(t *testing.T) {
+	p, _ := newTestDeduplicate(t, mapstr.M{
+		"key_field": "event.id",
+		"ttl":       "100ms",
+		"backend":   mapstr.M{"memory.id": t.Name()},
+	})
+	defer p.Close()
+
+	run := func() *beat.Event {
+		event, err := p.Run(newEvent(mapstr.M{"event.id": "a"}))
+		require.NoError(t, err)
+		return event
+	}
+	require.NotNil(t, run())
+	require.Nil(t, run())
+
+	// Duplicates don't extend the window.
+	time.Sleep(150 * time.Millisecond)
+	assert.NotNil(t, run())
+	assert.Nil(t, run())
+}
+
+func TestFileBackend(t *testing.T) {
+	dataPath := paths.Paths.Data
+	paths.Paths.Data = t.TempDir()
+	defer func() { paths.Paths.Data = dataPath }()
+
+	settings := mapstr.M{
+		"key_field": "event.id",
+		"backend":   mapstr.M{"file.id": t.Name()},
+	}
+	p, _ := newTestDeduplicate(t, settings)
+	event, err := p.Run(newEvent(mapstr.M{"event.id": "a"}))
+	require.NoError(t, err)
+	require.NotNil(t, event)
+	require.NoError(t, p.Close())
+
+	// Keys are restored from the file after a restart.
+	p, _ = newTestDeduplicate(t, settings)
+	defer p.Close()
+	event, err = p.Run(newEvent(mapstr.M{"event.id": "a"}))
+	require.NoError(t, err)
+	assert.Nil(t, event)
+}
+
+func TestErrors(t *testing.T) {
+	t.Run("missing key", func(t *testing.T) {
+		p, _ := newTestDeduplicate(t, mapstr.M{
+			"key_field": "event.id",
+			"backend":   mapstr.M{"memory.id": t.Name()},
+		})
+		defer p.Close()
+		event, err := p.Run(newEvent(mapstr.M{"message": "hello"}))
+		assert.Error(t, err)
+		assert.NotNil(t, event)
+	})
+
+	t.Run("non-scalar key", func(t *testing.T) {
+		p, _ := newTestDeduplicate(t, mapstr.M{
+			"key_field": "event",
+			"backend":   mapstr.M{"memory.id": t.Name()},
+		})
+		defer p.Close()
+		_, err := p.Run(newEvent(mapstr.M{"event.id": "a"}))
+		assert.Error(t, err)
+	})
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"no key":         {"backend.memory.id": "a"},
+		"two keys":       {"backend.memory.id": "a", "key_field": "a", "fields": []string{"b"}},
+		"no backend":     {"key_field": "a"},
+		"unknown action": {"backend.memory.id": "a", "key_field": "a", "action": "delete"},
+		"unknown method": {"backend.memory.id": "a", "fields": []string{"b"}, "method": "crc32"},
+		"negative ttl":   {"backend.memory.id": "a", "key_field": "a", "ttl": "-1s"},
+	}
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(settings), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
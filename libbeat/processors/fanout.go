@@ -0,0 +1,70 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package processors
+
+import (
+	"errors"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+)
+
+// ErrFanOutUnsupported is returned by processors that replace events with
+// several events, when they are run where only a single event can be
+// returned.
+var ErrFanOutUnsupported = errors.New("processor returns several events, which is not supported here")
+
+// fanOutWrapper is implemented by processors that wrap other processors.
+// They implement beat.FanOutProcessor, but only fan out if one of the
+// wrapped processors does.
+type fanOutWrapper interface {
+	FansOut() bool
+}
+
+// FansOut reports whether the processor can replace events with several
+// events.
+func FansOut(p beat.Processor) bool {
+	if w, ok := p.(fanOutWrapper); ok {
+		return w.FansOut()
+	}
+	_, ok := p.(beat.FanOutProcessor)
+	return ok
+}
+
+// RunFanOut runs the processor on the event and returns the resulting
+// events. Processors that don't implement beat.FanOutProcessor return at
+// most one event.
+func RunFanOut(p beat.Processor, event *beat.Event) ([]*beat.Event, error) {
+	if f, ok := p.(beat.FanOutProcessor); ok {
+		return f.RunFanOut(event)
+	}
+	event, err := p.Run(event)
+	if event == nil {
+		return nil, err
+	}
+	return []*beat.Event{event}, err
+}
+
+// anyFansOut reports whether one of the processors fans out.
+func anyFansOut(list []beat.Processor) bool {
+	for _, p := range list {
+		if p != nil && FansOut(p) {
+			return true
+		}
+	}
+	return false
+}
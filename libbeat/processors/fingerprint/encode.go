@@ -54,3 +54,13 @@ func (e *namedEncodingMethod) Unpack(str string) error {
 	*e = m
 	return nil
 }
+
+// Encoding returns the encoding function with the given name, as accepted
+// by the encoding setting of the processor.
+func Encoding(name string) (func([]byte) string, error) {
+	var e namedEncodingMethod
+	if err := e.Unpack(name); err != nil {
+		return nil, err
+	}
+	return e.Encode, nil
+}
@@ -68,16 +68,37 @@ func New(cfg *config.C, log *logp.Logger) (beat.Processor, error) {
 	return p, nil
 }
 
+// NewFingerprinter returns a function that computes the fingerprint of the
+// given fields of events, like the processor does. method and encoding are
+// the names accepted by the method and encoding settings of the processor.
+// The function returns an error when a field is missing.
+func NewFingerprinter(fields []string, method, encoding string) (func(*beat.Event) (string, error), error) {
+	if len(fields) == 0 {
+		return nil, errNoFields
+	}
+	config := defaultConfig()
+	config.Fields = fields
+	if err := config.Method.Unpack(method); err != nil {
+		return nil, err
+	}
+	if err := config.Encoding.Unpack(encoding); err != nil {
+		return nil, err
+	}
+	p := &fingerprint{
+		config: config,
+		hash:   config.Method.Hash,
+		fields: common.MakeStringSet(fields...).ToSlice(),
+	}
+	return p.fingerprint, nil
+}
+
 // Run enriches the given event with a fingerprint.
 func (p *fingerprint) Run(event *beat.Event) (*beat.Event, error) {
-	hashFn := p.hash()
-
-	if err := p.writeFields(hashFn, event); err != nil {
+	encodedHash, err := p.fingerprint(event)
+	if err != nil {
 		return nil, makeErrComputeFingerprint(err)
 	}
 
-	encodedHash := p.config.Encoding.Encode(hashFn.Sum(nil))
-
 	if _, err := event.PutValue(p.config.TargetField, encodedHash); err != nil {
 		return nil, makeErrComputeFingerprint(err)
 	}
@@ -85,6 +106,15 @@ func (p *fingerprint) Run(event *beat.Event) (*beat.Event, error) {
 	return event, nil
 }
 
+// fingerprint returns the encoded hash of the fields of the event.
+func (p *fingerprint) fingerprint(event *beat.Event) (string, error) {
+	hashFn := p.hash()
+	if err := p.writeFields(hashFn, event); err != nil {
+		return "", err
+	}
+	return p.config.Encoding.Encode(hashFn.Sum(nil)), nil
+}
+
 func (p *fingerprint) String() string {
 	json, _ := json.Marshal(&p.config)
 	return procName + "=" + string(json)
@@ -245,6 +245,21 @@ func TestEncoding(t *testing.T) {
 	}
 }
 
+func TestNamedMethods(t *testing.T) {
+	hash, err := HashMethod("SHA256")
+	require.NoError(t, err)
+	encode, err := Encoding("hex")
+	require.NoError(t, err)
+	h := hash()
+	h.Write([]byte("foo"))
+	assert.Equal(t, "2c26b46b68ffc68ff99b453c1d30413413422d706483bfa0f98a5e886266e7ae", encode(h.Sum(nil)))
+
+	_, err = HashMethod("crc32")
+	assert.Error(t, err)
+	_, err = Encoding("base16")
+	assert.Error(t, err)
+}
+
 func TestConsistentHashingTimeFields(t *testing.T) {
 	tzUTC := time.UTC
 	tzPST := time.FixedZone("Pacific Standard Time", int((-8 * time.Hour).Seconds()))
@@ -0,0 +1,288 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"bufio"
+	"embed"
+	"fmt"
+	"io"
+	"io/fs"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+//go:embed patterns
+var bundledPatternFiles embed.FS
+
+// bundledPatterns contains the pattern library shipped with the processor.
+var bundledPatterns = sync.OnceValues(func() (map[string]string, error) {
+	defs := map[string]string{}
+	err := fs.WalkDir(bundledPatternFiles, "patterns", func(path string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() {
+			return err
+		}
+		f, err := bundledPatternFiles.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return readPatterns(f, defs)
+	})
+	return defs, err
+})
+
+// readPatterns reads pattern definitions in the format used by Logstash and
+// Elasticsearch, one `NAME pattern` definition per line, into defs.
+// Empty lines and lines starting with '#' are ignored.
+func readPatterns(r io.Reader, defs map[string]string) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(nil, 1024*1024)
+	for line := 1; scanner.Scan(); line++ {
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" || text[0] == '#' {
+			continue
+		}
+		name, pattern, ok := strings.Cut(text, " ")
+		if !ok || !patternNameRegexp.MatchString(name) {
+			return fmt.Errorf("invalid pattern definition on line %d: %q", line, text)
+		}
+		defs[name] = strings.TrimSpace(pattern)
+	}
+	return scanner.Err()
+}
+
+var (
+	// patternRefRegexp matches %{SYNTAX}, %{SYNTAX:SEMANTIC} and
+	// %{SYNTAX:SEMANTIC:TYPE} pattern references.
+	patternRefRegexp = regexp.MustCompile(`%\{(\w+)(?::([\w@.\-]+))?(?::(\w+))?\}`)
+
+	patternNameRegexp = regexp.MustCompile(`^\w+$`)
+)
+
+type captureType uint8
+
+const (
+	typeString captureType = iota
+	typeInt
+	typeLong
+	typeFloat
+	typeDouble
+	typeBoolean
+)
+
+var captureTypes = map[string]captureType{
+	"string":  typeString,
+	"int":     typeInt,
+	"long":    typeLong,
+	"float":   typeFloat,
+	"double":  typeDouble,
+	"boolean": typeBoolean,
+}
+
+func (t captureType) convert(value string) (interface{}, error) {
+	switch t {
+	case typeInt:
+		i, err := strconv.ParseInt(value, 10, 32)
+		return int32(i), err
+	case typeLong:
+		return strconv.ParseInt(value, 10, 64)
+	case typeFloat:
+		f, err := strconv.ParseFloat(value, 32)
+		return float32(f), err
+	case typeDouble:
+		return strconv.ParseFloat(value, 64)
+	case typeBoolean:
+		return strconv.ParseBool(value)
+	default:
+		return value, nil
+	}
+}
+
+// capture is a named capture of a pattern, extracted to field.
+type capture struct {
+	field string
+	typ   captureType
+	group int
+}
+
+// grok is a compiled grok pattern.
+type grok struct {
+	raw      string
+	re       *regexp.Regexp
+	captures []capture
+}
+
+// compile expands the pattern references of pattern, using the given
+// pattern definitions, and compiles the resulting regular expression.
+// Pattern references with a semantic are extracted, as are named groups of
+// the pattern.
+func compile(pattern string, defs map[string]string) (*grok, error) {
+	c := &compiler{defs: defs}
+	expanded, err := c.expand(pattern, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	re, err := compileCached(expanded)
+	if err != nil {
+		return nil, fmt.Errorf("failed to compile pattern %q: %w", pattern, err)
+	}
+
+	g := &grok{raw: pattern, re: re}
+	for i, name := range re.SubexpNames() {
+		if name == "" {
+			continue
+		}
+		if idx, ok := syntheticGroupIndex(name); ok {
+			c.captures[idx].group = i
+			continue
+		}
+		// A named group of the pattern itself.
+		g.captures = append(g.captures, capture{field: name, typ: typeString, group: i})
+	}
+	g.captures = append(c.captures, g.captures...)
+	return g, nil
+}
+
+// match matches s against the pattern, returning the extracted fields. If
+// a field is captured by several groups, the first group that participated
+// in the match is used.
+func (g *grok) match(s string) (map[string]interface{}, bool, error) {
+	loc := g.re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil, false, nil
+	}
+
+	fields := make(map[string]interface{}, len(g.captures))
+	for _, c := range g.captures {
+		start, end := loc[2*c.group], loc[2*c.group+1]
+		if start < 0 {
+			continue
+		}
+		if _, exists := fields[c.field]; exists {
+			continue
+		}
+		value, err := c.typ.convert(s[start:end])
+		if err != nil {
+			return nil, true, fmt.Errorf("failed to convert field %v: %w", c.field, err)
+		}
+		fields[c.field] = value
+	}
+	return fields, true, nil
+}
+
+type compiler struct {
+	defs     map[string]string
+	captures []capture
+}
+
+func (c *compiler) expand(pattern string, stack []string) (string, error) {
+	matches := patternRefRegexp.FindAllStringSubmatchIndex(pattern, -1)
+	if len(matches) == 0 {
+		return pattern, nil
+	}
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		b.WriteString(pattern[last:m[0]])
+		last = m[1]
+
+		name := pattern[m[2]:m[3]]
+		def, ok := c.defs[name]
+		if !ok {
+			return "", fmt.Errorf("pattern %v is not defined", name)
+		}
+		for _, parent := range stack {
+			if parent == name {
+				return "", fmt.Errorf("pattern %v references itself", name)
+			}
+		}
+		expanded, err := c.expand(def, append(stack, name))
+		if err != nil {
+			return "", err
+		}
+
+		if m[4] < 0 {
+			b.WriteString("(?:")
+			b.WriteString(expanded)
+			b.WriteString(")")
+			continue
+		}
+
+		typ := typeString
+		if m[6] >= 0 {
+			typeName := pattern[m[6]:m[7]]
+			if typ, ok = captureTypes[typeName]; !ok {
+				return "", fmt.Errorf("unsupported type %v for field %v", typeName, pattern[m[4]:m[5]])
+			}
+		}
+		fmt.Fprintf(&b, "(?P<%s%d>%s)", syntheticGroupPrefix, len(c.captures), expanded)
+		c.captures = append(c.captures, capture{field: pattern[m[4]:m[5]], typ: typ})
+	}
+	b.WriteString(pattern[last:])
+	return b.String(), nil
+}
+
+// syntheticGroupPrefix prefixes the names of the groups capturing pattern
+// references. Field names can't be used as group names, as they can
+// contain characters that are not allowed in group names.
+const syntheticGroupPrefix = "_grok_"
+
+func syntheticGroupIndex(name string) (int, bool) {
+	suffix, ok := strings.CutPrefix(name, syntheticGroupPrefix)
+	if !ok {
+		return 0, false
+	}
+	idx, err := strconv.Atoi(suffix)
+	return idx, err == nil
+}
+
+// maxCachedRegexps limits the size of the regexp cache. The cache is
+// cleared once the limit is reached.
+const maxCachedRegexps = 1024
+
+// regexpCache shares the compiled regular expressions between processor
+// instances, so that the same patterns, used by many inputs or loaded again
+// on config reloads, are only compiled once. Compiled expressions are safe
+// for concurrent use.
+var regexpCache = struct {
+	sync.Mutex
+	entries map[string]*regexp.Regexp
+}{entries: map[string]*regexp.Regexp{}}
+
+func compileCached(expr string) (*regexp.Regexp, error) {
+	regexpCache.Lock()
+	defer regexpCache.Unlock()
+	if re, ok := regexpCache.entries[expr]; ok {
+		return re, nil
+	}
+
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return nil, err
+	}
+	if len(regexpCache.entries) >= maxCachedRegexps {
+		clear(regexpCache.entries)
+	}
+	regexpCache.entries[expr] = re
+	return re, nil
+}
@@ -0,0 +1,251 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCompile(t *testing.T) {
+	defs := map[string]string{
+		"WORD":   `\b\w+\b`,
+		"INT":    `[+-]?\d+`,
+		"NUMBER": `[+-]?\d+(?:\.\d+)?`,
+		"PAIR":   `%{WORD:key}=%{INT:value:int}`,
+		"A":      `%{B}`,
+		"B":      `%{A}`,
+		"SELF":   `x%{SELF}`,
+	}
+
+	tests := map[string]struct {
+		pattern string
+		input   string
+		want    map[string]interface{}
+		matched bool
+		err     string
+	}{
+		"plain regexp": {
+			pattern: `^hello$`,
+			input:   "hello",
+			want:    map[string]interface{}{},
+			matched: true,
+		},
+		"semantic": {
+			pattern: `%{WORD:greeting} %{WORD:name}`,
+			input:   "hello world",
+			want:    map[string]interface{}{"greeting": "hello", "name": "world"},
+			matched: true,
+		},
+		"nested field": {
+			pattern: `%{WORD:http.request.method}`,
+			input:   "GET",
+			want:    map[string]interface{}{"http.request.method": "GET"},
+			matched: true,
+		},
+		"unnamed references are not captured": {
+			pattern: `%{WORD} %{WORD:name}`,
+			input:   "hello world",
+			want:    map[string]interface{}{"name": "world"},
+			matched: true,
+		},
+		"nested references": {
+			pattern: `^%{PAIR}$`,
+			input:   "answer=42",
+			want:    map[string]interface{}{"key": "answer", "value": int32(42)},
+			matched: true,
+		},
+		"types": {
+			pattern: `%{INT:int:int} %{INT:long:long} %{NUMBER:float:float} %{NUMBER:double:double} %{WORD:bool:boolean} %{INT:string:string}`,
+			input:   "1 8589934592 1.5 2.25 true 7",
+			want: map[string]interface{}{
+				"int":    int32(1),
+				"long":   int64(8589934592),
+				"float":  float32(1.5),
+				"double": float64(2.25),
+				"bool":   true,
+				"string": "7",
+			},
+			matched: true,
+		},
+		"named groups": {
+			pattern: `(?P<first>\w+) %{WORD:second}`,
+			input:   "hello world",
+			want:    map[string]interface{}{"first": "hello", "second": "world"},
+			matched: true,
+		},
+		"alternatives use the first participating group": {
+			pattern: `(?:%{INT:value:int}|%{WORD:value})`,
+			input:   "abc",
+			want:    map[string]interface{}{"value": "abc"},
+			matched: true,
+		},
+		"no match": {
+			pattern: `^%{INT:value}$`,
+			input:   "abc",
+		},
+		"conversion failure": {
+			pattern: `%{WORD:value:int}`,
+			input:   "abc",
+			matched: true,
+			err:     "failed to convert field value",
+		},
+		"int overflow": {
+			pattern: `%{INT:value:int}`,
+			input:   "8589934592",
+			matched: true,
+			err:     "failed to convert field value",
+		},
+		"undefined pattern": {
+			pattern: `%{UNDEFINED:value}`,
+			err:     "pattern UNDEFINED is not defined",
+		},
+		"unknown type": {
+			pattern: `%{INT:value:integer}`,
+			err:     "unsupported type integer",
+		},
+		"recursive patterns": {
+			pattern: `%{A}`,
+			err:     "references itself",
+		},
+		"self reference": {
+			pattern: `%{SELF}`,
+			err:     "references itself",
+		},
+		"invalid regexp": {
+			pattern: `%{WORD:value}(`,
+			err:     "failed to compile pattern",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			g, err := compile(test.pattern, defs)
+			if err != nil {
+				require.NotEmpty(t, test.err, "unexpected error: %v", err)
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+
+			fields, matched, err := g.match(test.input)
+			assert.Equal(t, test.matched, matched)
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+				return
+			}
+			require.NoError(t, err)
+			if test.matched {
+				assert.Equal(t, test.want, fields)
+			}
+		})
+	}
+}
+
+func TestBundledPatterns(t *testing.T) {
+	defs, err := bundledPatterns()
+	require.NoError(t, err)
+
+	tests := map[string]struct {
+		pattern string
+		input   string
+		want    map[string]interface{}
+	}{
+		"COMBINEDAPACHELOG": {
+			pattern: `%{COMBINEDAPACHELOG}`,
+			input:   `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326 "http://www.example.com/start.html" "Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			want: map[string]interface{}{
+				"clientip":    "127.0.0.1",
+				"ident":       "-",
+				"auth":        "frank",
+				"timestamp":   "10/Oct/2000:13:55:36 -0700",
+				"verb":        "GET",
+				"request":     "/apache_pb.gif",
+				"httpversion": "1.0",
+				"response":    "200",
+				"bytes":       "2326",
+				"referrer":    `"http://www.example.com/start.html"`,
+				"agent":       `"Mozilla/4.08 [en] (Win98; I ;Nav)"`,
+			},
+		},
+		"SYSLOGLINE": {
+			pattern: `%{SYSLOGLINE}`,
+			input:   `Mar  4 12:00:01 host1 sshd[4242]: Accepted publickey for root`,
+			want: map[string]interface{}{
+				"timestamp": "Mar  4 12:00:01",
+				"logsource": "host1",
+				"program":   "sshd",
+				"pid":       "4242",
+				"message":   "Accepted publickey for root",
+			},
+		},
+		"IP": {
+			pattern: `^%{IP:ip}$`,
+			input:   "2001:db8::1",
+			want:    map[string]interface{}{"ip": "2001:db8::1"},
+		},
+		"TIMESTAMP_ISO8601": {
+			pattern: `^%{TIMESTAMP_ISO8601:ts} %{LOGLEVEL:level}`,
+			input:   "2024-01-02T03:04:05.678Z ERROR failure",
+			want:    map[string]interface{}{"ts": "2024-01-02T03:04:05.678Z", "level": "ERROR"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			g, err := compile(test.pattern, defs)
+			require.NoError(t, err)
+			fields, matched, err := g.match(test.input)
+			require.NoError(t, err)
+			require.True(t, matched)
+			for k, v := range test.want {
+				assert.Equal(t, v, fields[k], "field %v", k)
+			}
+		})
+	}
+
+	t.Run("all patterns compile", func(t *testing.T) {
+		for name := range defs {
+			_, err := compile("%{"+name+"}", defs)
+			assert.NoError(t, err, "pattern %v", name)
+		}
+	})
+}
+
+func TestReadPatterns(t *testing.T) {
+	defs := map[string]string{"WORD": `\w+`}
+	err := readPatterns(strings.NewReader("# comment\n\nGREETING hello|hi\nWORD [a-z]+\n"), defs)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"WORD": "[a-z]+", "GREETING": "hello|hi"}, defs)
+
+	err = readPatterns(strings.NewReader("INVALID-NAME x\n"), defs)
+	assert.ErrorContains(t, err, "invalid pattern definition on line 1")
+}
+
+func TestCompileCached(t *testing.T) {
+	re1, err := compileCached(`^cached\d+$`)
+	require.NoError(t, err)
+	re2, err := compileCached(`^cached\d+$`)
+	require.NoError(t, err)
+	assert.Same(t, re1, re2)
+
+	_, err = compileCached(`(`)
+	assert.Error(t, err)
+}
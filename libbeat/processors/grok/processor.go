@@ -0,0 +1,194 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"strings"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	cfg "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const (
+	processorName    = "grok"
+	flagParsingError = "grok_parsing_error"
+)
+
+var errNoMatch = errors.New("no pattern matched")
+
+type processor struct {
+	config config
+	groks  []*grok
+}
+
+func init() {
+	processors.RegisterPlugin(processorName, New)
+	jsprocessor.RegisterPlugin("Grok", New)
+}
+
+// New constructs a new grok processor.
+func New(c *cfg.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the %v configuration: %w", processorName, err)
+	}
+
+	defs, err := patternDefinitions(&config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load %v pattern definitions: %w", processorName, err)
+	}
+
+	p := &processor{config: config}
+	for _, pattern := range config.Patterns {
+		g, err := compile(pattern, defs)
+		if err != nil {
+			return nil, fmt.Errorf("failed to compile %v pattern: %w", processorName, err)
+		}
+		p.groks = append(p.groks, g)
+	}
+	return p, nil
+}
+
+// patternDefinitions returns the bundled pattern definitions, overridden by
+// the definitions of the pattern files and the pattern_definitions setting,
+// in that order.
+func patternDefinitions(config *config) (map[string]string, error) {
+	bundled, err := bundledPatterns()
+	if err != nil {
+		return nil, err
+	}
+	if len(config.PatternFiles) == 0 && len(config.PatternDefinitions) == 0 {
+		return bundled, nil
+	}
+
+	defs := maps.Clone(bundled)
+	for _, path := range config.PatternFiles {
+		if err := readPatternFile(paths.Resolve(paths.Config, path), defs); err != nil {
+			return nil, err
+		}
+	}
+	for name, pattern := range config.PatternDefinitions {
+		if !patternNameRegexp.MatchString(name) {
+			return nil, fmt.Errorf("invalid pattern name %q", name)
+		}
+		defs[name] = pattern
+	}
+	return defs, nil
+}
+
+func readPatternFile(path string, defs map[string]string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := readPatterns(f, defs); err != nil {
+		return fmt.Errorf("failed to read %v: %w", path, err)
+	}
+	return nil
+}
+
+// Run matches the configured field against the patterns, in order, and
+// extracts the captures of the first matching pattern.
+func (p *processor) Run(event *beat.Event) (*beat.Event, error) {
+	v, err := event.GetValue(p.config.Field)
+	if err != nil {
+		if p.config.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return event, nil
+		}
+		return event, p.fail(event, fmt.Errorf("could not fetch value for key: %s, Error: %w", p.config.Field, err))
+	}
+
+	s, ok := v.(string)
+	if !ok {
+		return event, p.fail(event, fmt.Errorf("field is not a string, value: `%v`, field: `%s`", v, p.config.Field))
+	}
+
+	for _, g := range p.groks {
+		fields, matched, err := g.match(s)
+		if err != nil {
+			return event, p.fail(event, err)
+		}
+		if !matched {
+			continue
+		}
+
+		backup := event.Clone()
+		if err := p.mapper(event, fields); err != nil {
+			return backup, p.fail(backup, err)
+		}
+		return event, nil
+	}
+	return event, p.fail(event, errNoMatch)
+}
+
+// fail flags the event with the parsing error flag, and returns the error
+// unless failures are ignored.
+func (p *processor) fail(event *beat.Event, err error) error {
+	if err := mapstr.AddTagsWithKey(
+		event.Fields,
+		beat.FlagField,
+		[]string{flagParsingError},
+	); err != nil {
+		return fmt.Errorf("cannot add new flag the event: %w", err)
+	}
+	if p.config.IgnoreFailure {
+		return nil
+	}
+	return err
+}
+
+func (p *processor) mapper(event *beat.Event, fields map[string]interface{}) error {
+	prefix := ""
+	if p.config.TargetPrefix != "" {
+		prefix = p.config.TargetPrefix + "."
+	}
+	for k, v := range fields {
+		key := prefix + k
+		if _, err := event.GetValue(key); errors.Is(err, mapstr.ErrKeyNotFound) || p.config.OverwriteKeys {
+			if _, err := event.PutValue(key, v); err != nil {
+				return fmt.Errorf("cannot set key `%s`: %w", key, err)
+			}
+		} else {
+			if err != nil {
+				return fmt.Errorf("cannot override existing key with `%s`: %w", key, err)
+			}
+			return fmt.Errorf("cannot override existing key with `%s`", key)
+		}
+	}
+	return nil
+}
+
+func (p *processor) String() string {
+	patterns := make([]string, len(p.groks))
+	for i, g := range p.groks {
+		patterns[i] = g.raw
+	}
+	return processorName + "=[patterns=[" + strings.Join(patterns, ", ") +
+		"],field=" + p.config.Field +
+		",target_prefix=" + p.config.TargetPrefix + "]"
+}
@@ -0,0 +1,240 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package grok
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors/dissect"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestProcessor(t testing.TB, c map[string]interface{}) beat.Processor {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(c), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return p
+}
+
+func TestProcessor(t *testing.T) {
+	tests := map[string]struct {
+		config map[string]interface{}
+		fields mapstr.M
+		want   mapstr.M
+		err    bool
+	}{
+		"first matching pattern": {
+			config: map[string]interface{}{
+				"patterns": []string{`^%{INT:id:int}$`, `^%{WORD:verb} %{INT:status:int}$`, `^%{WORD:verb}`},
+			},
+			fields: mapstr.M{"message": "GET 200"},
+			want:   mapstr.M{"message": "GET 200", "verb": "GET", "status": int32(200)},
+		},
+		"target prefix and nested fields": {
+			config: map[string]interface{}{
+				"patterns":      []string{`%{WORD:http.request.method} %{NUMBER:http.response.status_code:long}`},
+				"field":         "event.original",
+				"target_prefix": "parsed",
+			},
+			fields: mapstr.M{"event": mapstr.M{"original": "GET 200"}},
+			want: mapstr.M{
+				"event": mapstr.M{"original": "GET 200"},
+				"parsed": mapstr.M{
+					"http": mapstr.M{
+						"request":  mapstr.M{"method": "GET"},
+						"response": mapstr.M{"status_code": int64(200)},
+					},
+				},
+			},
+		},
+		"pattern definitions": {
+			config: map[string]interface{}{
+				"patterns":            []string{`%{LEVEL:level}`},
+				"pattern_definitions": map[string]string{"LEVEL": `INFO|WARN|ERROR`},
+			},
+			fields: mapstr.M{"message": "[WARN] disk"},
+			want:   mapstr.M{"message": "[WARN] disk", "level": "WARN"},
+		},
+		"no match": {
+			config: map[string]interface{}{"patterns": []string{`^%{INT:id}$`}},
+			fields: mapstr.M{"message": "abc"},
+			want: mapstr.M{
+				"message": "abc",
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+			err: true,
+		},
+		"no match ignore failure": {
+			config: map[string]interface{}{
+				"patterns":       []string{`^%{INT:id}$`},
+				"ignore_failure": true,
+			},
+			fields: mapstr.M{"message": "abc"},
+			want: mapstr.M{
+				"message": "abc",
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+		},
+		"conversion failure": {
+			config: map[string]interface{}{"patterns": []string{`%{WORD:id:int}`}},
+			fields: mapstr.M{"message": "abc"},
+			want: mapstr.M{
+				"message": "abc",
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+			err: true,
+		},
+		"missing field": {
+			config: map[string]interface{}{"patterns": []string{`%{WORD:id}`}},
+			fields: mapstr.M{"other": "abc"},
+			want: mapstr.M{
+				"other": "abc",
+				"log":   mapstr.M{"flags": []string{flagParsingError}},
+			},
+			err: true,
+		},
+		"missing field ignore missing": {
+			config: map[string]interface{}{
+				"patterns":       []string{`%{WORD:id}`},
+				"ignore_missing": true,
+			},
+			fields: mapstr.M{"other": "abc"},
+			want:   mapstr.M{"other": "abc"},
+		},
+		"field is not a string": {
+			config: map[string]interface{}{"patterns": []string{`%{WORD:id}`}},
+			fields: mapstr.M{"message": 42},
+			want: mapstr.M{
+				"message": 42,
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+			err: true,
+		},
+		"existing key": {
+			config: map[string]interface{}{"patterns": []string{`%{WORD:a} %{WORD:b}`}},
+			fields: mapstr.M{"message": "x y", "b": "old"},
+			want: mapstr.M{
+				"message": "x y",
+				"b":       "old",
+				"log":     mapstr.M{"flags": []string{flagParsingError}},
+			},
+			err: true,
+		},
+		"overwrite keys": {
+			config: map[string]interface{}{
+				"patterns":       []string{`%{WORD:a} %{WORD:b}`},
+				"overwrite_keys": true,
+			},
+			fields: mapstr.M{"message": "x y", "b": "old"},
+			want:   mapstr.M{"message": "x y", "a": "x", "b": "y"},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newTestProcessor(t, test.config)
+			event, err := p.Run(&beat.Event{Fields: test.fields})
+			if test.err {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestPatternFiles(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "custom")
+	require.NoError(t, os.WriteFile(path, []byte("# custom patterns\nLEVEL INFO|WARN|ERROR\nENTRY \\[%{LEVEL:level}\\] %{GREEDYDATA:text}\n"), 0o600))
+
+	p := newTestProcessor(t, map[string]interface{}{
+		"patterns":      []string{`%{ENTRY}`},
+		"pattern_files": []string{path},
+		// Inline definitions take precedence over the pattern files.
+		"pattern_definitions": map[string]string{"LEVEL": `WARN`},
+	})
+
+	event, err := p.Run(&beat.Event{Fields: mapstr.M{"message": "[WARN] disk full"}})
+	require.NoError(t, err)
+	assert.Equal(t, mapstr.M{"message": "[WARN] disk full", "level": "WARN", "text": "disk full"}, event.Fields)
+
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"message": "[INFO] started"}})
+	assert.ErrorIs(t, err, errNoMatch)
+}
+
+func TestNewErrors(t *testing.T) {
+	tests := map[string]map[string]interface{}{
+		"no patterns":        {"field": "message"},
+		"empty pattern":      {"patterns": []string{""}},
+		"undefined pattern":  {"patterns": []string{`%{UNDEFINED}`}},
+		"missing file":       {"patterns": []string{`%{WORD}`}, "pattern_files": []string{"/does/not/exist"}},
+		"invalid definition": {"patterns": []string{`%{WORD}`}, "pattern_definitions": map[string]string{"A-B": "x"}},
+	}
+
+	for name, c := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(c), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func BenchmarkProcessor(b *testing.B) {
+	const message = `127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /apache_pb.gif HTTP/1.0" 200 2326`
+
+	benchmarks := map[string]beat.Processor{
+		"grok": newTestProcessor(b, map[string]interface{}{
+			"patterns":      []string{`%{COMMONAPACHELOG}`},
+			"target_prefix": "grok",
+		}),
+		"grok simple": newTestProcessor(b, map[string]interface{}{
+			"patterns":      []string{`^%{IP:clientip} %{NOTSPACE:ident} %{NOTSPACE:auth} \[%{DATA:timestamp}\] "%{WORD:verb} %{NOTSPACE:request} HTTP/%{NUMBER:httpversion}" %{INT:response} %{INT:bytes}$`},
+			"target_prefix": "grok",
+		}),
+		"dissect": newDissect(b, map[string]interface{}{
+			"tokenizer": `%{clientip} %{ident} %{auth} [%{timestamp}] "%{verb} %{request} HTTP/%{httpversion}" %{response} %{bytes}`,
+		}),
+	}
+
+	for name, p := range benchmarks {
+		b.Run(name, func(b *testing.B) {
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.Run(&beat.Event{Fields: mapstr.M{"message": message}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func newDissect(b *testing.B, c map[string]interface{}) beat.Processor {
+	p, err := dissect.NewProcessor(conf.MustNewConfigFrom(c), logptest.NewTestingLogger(b, ""))
+	require.NoError(b, err)
+	return p
+}
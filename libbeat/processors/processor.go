@@ -178,6 +178,36 @@ func (procs *Processors) Run(event *beat.Event) (*beat.Event, error) {
 	return event, nil
 }
 
+// FansOut reports whether one of the processors can replace events with
+// several events.
+func (procs *Processors) FansOut() bool {
+	return procs != nil && anyFansOut(procs.List)
+}
+
+// RunFanOut executes all processors serially like Run, and returns all
+// events resulting from processors replacing events with several events.
+// On error, processing stops, and the events processed so far are returned
+// with the error.
+func (procs *Processors) RunFanOut(event *beat.Event) ([]*beat.Event, error) {
+	events := []*beat.Event{event}
+	for _, p := range procs.List {
+		var next []*beat.Event
+		for i, event := range events {
+			out, err := RunFanOut(p, event)
+			next = append(next, out...)
+			if err != nil {
+				return append(next, events[i+1:]...), fmt.Errorf("failed applying processor %v: %w", p, err)
+			}
+		}
+		if len(next) == 0 {
+			// Drop.
+			return nil, nil
+		}
+		events = next
+	}
+	return events, nil
+}
+
 func (procs Processors) String() string {
 	var s []string
 	for _, p := range procs.List {
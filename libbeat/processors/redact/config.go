@@ -0,0 +1,135 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"errors"
+	"fmt"
+	"unicode/utf8"
+)
+
+const (
+	actionMask    = "mask"
+	actionHash    = "hash"
+	actionPartial = "partial"
+)
+
+type config struct {
+	Fields        []string         `config:"fields"`
+	ExcludeFields []string         `config:"exclude_fields"`
+	Detectors     []detectorConfig `config:"detectors" validate:"required"`
+	Action        string           `config:"action"`
+	Mask          string           `config:"mask"`
+	Hash          hashConfig       `config:"hash"`
+	Partial       partialConfig    `config:"partial"`
+}
+
+type detectorConfig struct {
+	Type    string `config:"type" validate:"required"`
+	Name    string `config:"name"`
+	Pattern string `config:"pattern"`
+	Action  string `config:"action"`
+}
+
+// hashConfig configures the keyed HMAC that replaces matches with the hash
+// action.
+type hashConfig struct {
+	Key      string `config:"key"`
+	Method   string `config:"method"`
+	Encoding string `config:"encoding"`
+}
+
+// partialConfig configures the partial action, which keeps the first and
+// the last characters of matches and masks the others.
+type partialConfig struct {
+	KeepFirst int    `config:"keep_first" validate:"min=0"`
+	KeepLast  int    `config:"keep_last" validate:"min=0"`
+	Char      string `config:"char"`
+}
+
+func defaultConfig() config {
+	return config{
+		Action: actionMask,
+		Mask:   "[REDACTED]",
+		Hash: hashConfig{
+			Method:   "sha256",
+			Encoding: "hex",
+		},
+		Partial: partialConfig{
+			KeepLast: 4,
+			Char:     "*",
+		},
+	}
+}
+
+func (c *config) Validate() error {
+	if err := validateAction(c.Action); err != nil {
+		return err
+	}
+	usesHash := c.Action == actionHash
+	names := map[string]struct{}{}
+	for _, d := range c.Detectors {
+		name := d.name()
+		if _, exists := names[name]; exists {
+			return fmt.Errorf("duplicate detector %q, custom detectors need a unique name", name)
+		}
+		names[name] = struct{}{}
+
+		switch d.Type {
+		case detectorRegex:
+			if d.Name == "" || d.Pattern == "" {
+				return errors.New("regex detectors require a name and a pattern")
+			}
+		default:
+			if _, ok := builtinDetectors[d.Type]; !ok {
+				return fmt.Errorf("unknown detector type %q", d.Type)
+			}
+		}
+		if d.Action != "" {
+			if err := validateAction(d.Action); err != nil {
+				return err
+			}
+			usesHash = usesHash || d.Action == actionHash
+		}
+	}
+	if usesHash && c.Hash.Key == "" {
+		return errors.New("hash.key is required by the hash action")
+	}
+	if utf8.RuneCountInString(c.Partial.Char) != 1 {
+		return errors.New("partial.char must be a single character")
+	}
+	return nil
+}
+
+func validateAction(action string) error {
+	switch action {
+	case actionMask, actionHash, actionPartial:
+		return nil
+	default:
+		return fmt.Errorf("unknown action %q, must be one of %v, %v or %v", action, actionMask, actionHash, actionPartial)
+	}
+}
+
+// name returns the name of the detector in metrics, which defaults to its
+// type.
+func (d *detectorConfig) name() string {
+	if d.Name != "" {
+		return d.Name
+	}
+	return d.Type
+}
@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"net/netip"
+	"regexp"
+	"strings"
+)
+
+const detectorRegex = "regex"
+
+// detector finds sensitive values in strings.
+type detector struct {
+	name string
+	re   *regexp.Regexp
+	// valid filters the matches of re. It receives the whole string, so
+	// that it can check the context of the match.
+	valid func(s string, start, end int) bool
+}
+
+// find returns the locations of the sensitive values in s.
+func (d *detector) find(s string) [][]int {
+	locs := d.re.FindAllStringIndex(s, -1)
+	if d.valid == nil {
+		return locs
+	}
+	valid := locs[:0]
+	for _, loc := range locs {
+		if d.valid(s, loc[0], loc[1]) {
+			valid = append(valid, loc)
+		}
+	}
+	return valid
+}
+
+// builtinDetectors are the detectors that can be selected by type.
+var builtinDetectors = map[string]func() *detector{
+	"email": func() *detector {
+		return &detector{
+			re: regexp.MustCompile(`[A-Za-z0-9._%+\-]+@[A-Za-z0-9\-]+(?:\.[A-Za-z0-9\-]+)*\.[A-Za-z]{2,}`),
+		}
+	},
+	"credit_card": func() *detector {
+		return &detector{
+			re:    regexp.MustCompile(`\b\d(?:[ \-]?\d){12,18}\b`),
+			valid: validCreditCard,
+		}
+	},
+	"iban": func() *detector {
+		return &detector{
+			re:    regexp.MustCompile(`\b[A-Z]{2}\d{2}(?: ?[A-Z0-9]{4}){2,7}(?: ?[A-Z0-9]{1,4})?\b`),
+			valid: validIBAN,
+		}
+	},
+	"ip": func() *detector {
+		return &detector{
+			re:    regexp.MustCompile(`(?:\d{1,3}\.){3}\d{1,3}|(?:[0-9A-Fa-f]{0,4}:){2,7}(?:(?:\d{1,3}\.){3}\d{1,3}|[0-9A-Fa-f]{1,4})?`),
+			valid: validIP,
+		}
+	},
+}
+
+// validCreditCard checks the length and the Luhn checksum of card numbers.
+func validCreditCard(s string, start, end int) bool {
+	var digits []byte
+	for i := start; i < end; i++ {
+		if c := s[i]; c >= '0' && c <= '9' {
+			digits = append(digits, c-'0')
+		}
+	}
+	if len(digits) < 13 || len(digits) > 19 {
+		return false
+	}
+	sum := 0
+	for i := range digits {
+		d := int(digits[len(digits)-1-i])
+		if i%2 == 1 {
+			d *= 2
+			if d > 9 {
+				d -= 9
+			}
+		}
+		sum += d
+	}
+	return sum%10 == 0
+}
+
+// validIBAN checks the length and the ISO 7064 mod 97-10 checksum of IBANs.
+func validIBAN(s string, start, end int) bool {
+	iban := strings.ReplaceAll(s[start:end], " ", "")
+	if len(iban) < 15 || len(iban) > 34 {
+		return false
+	}
+	// The checksum is computed on the IBAN with the first four characters
+	// moved to the end and letters replaced by numbers, A being 10.
+	rem := 0
+	for _, c := range iban[4:] + iban[:4] {
+		switch {
+		case c >= '0' && c <= '9':
+			rem = (rem*10 + int(c-'0')) % 97
+		case c >= 'A' && c <= 'Z':
+			rem = (rem*100 + int(c-'A'+10)) % 97
+		default:
+			return false
+		}
+	}
+	return rem == 1
+}
+
+// validIP checks that the match is an IP address that is not part of a
+// longer token, like a version number.
+func validIP(s string, start, end int) bool {
+	if start > 0 && isAddressChar(s[start-1]) {
+		return false
+	}
+	if end < len(s) {
+		next := s[end]
+		switch {
+		case next == '.':
+			// Allow a dot ending a sentence.
+			if end+1 < len(s) && isAddressChar(s[end+1]) {
+				return false
+			}
+		case next == ':':
+			// Allow the port following an IPv4 address.
+			if strings.Contains(s[start:end], ":") {
+				return false
+			}
+		case isAddressChar(next):
+			return false
+		}
+	}
+	_, err := netip.ParseAddr(s[start:end])
+	return err == nil
+}
+
+func isAddressChar(c byte) bool {
+	return c >= '0' && c <= '9' || c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c == '_' || c == ':' || c == '.'
+}
@@ -0,0 +1,323 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"errors"
+	"fmt"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"unicode/utf8"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	"github.com/elastic/beats/v7/libbeat/processors/fingerprint"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+const (
+	procName = "redact"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"fields", "exclude_fields", "detectors", "action", "mask",
+				"hash", "partial", "when",
+			)))
+	jsprocessor.RegisterPlugin("Redact", New)
+}
+
+// rule is a detector with the action applied to its matches.
+type rule struct {
+	*detector
+	replace  func(string) string
+	redacted *monitoring.Int
+}
+
+type redact struct {
+	config
+	rules   []rule
+	exclude map[string]struct{}
+	log     *logp.Logger
+}
+
+// match is the location of a sensitive value and the rule that found it.
+type match struct {
+	start, end int
+	rule       *rule
+}
+
+// New constructs a new redact processor.
+func New(c *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+
+	id := int(instanceID.Add(1))
+	reg := monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	return newRedact(config, reg, log.Named(logName).With("instance_id", id))
+}
+
+func newRedact(config config, reg *monitoring.Registry, log *logp.Logger) (*redact, error) {
+	p := &redact{
+		config:  config,
+		exclude: make(map[string]struct{}, len(config.ExcludeFields)),
+		log:     log,
+	}
+	for _, field := range config.ExcludeFields {
+		p.exclude[field] = struct{}{}
+	}
+
+	actions := map[string]func(string) string{}
+	for _, dc := range config.Detectors {
+		action := dc.Action
+		if action == "" {
+			action = config.Action
+		}
+		replace, ok := actions[action]
+		if !ok {
+			var err error
+			if replace, err = newAction(action, &config); err != nil {
+				return nil, err
+			}
+			actions[action] = replace
+		}
+
+		var d *detector
+		if dc.Type == detectorRegex {
+			re, err := regexp.Compile(dc.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("failed to compile the pattern of detector %q: %w", dc.Name, err)
+			}
+			d = &detector{re: re}
+		} else {
+			d = builtinDetectors[dc.Type]()
+		}
+		d.name = dc.name()
+
+		p.rules = append(p.rules, rule{
+			detector: d,
+			replace:  replace,
+			redacted: monitoring.NewInt(reg, "redactions."+d.name),
+		})
+	}
+	return p, nil
+}
+
+// newAction returns the function that replaces the matches of detectors
+// with the given action.
+func newAction(action string, config *config) (func(string) string, error) {
+	switch action {
+	case actionMask:
+		mask := config.Mask
+		return func(string) string { return mask }, nil
+
+	case actionHash:
+		if strings.EqualFold(config.Hash.Method, "xxhash") {
+			return nil, errors.New("xxhash is not a cryptographic hash and can't be used by the hash action")
+		}
+		method, err := fingerprint.HashMethod(config.Hash.Method)
+		if err != nil {
+			return nil, err
+		}
+		encode, err := fingerprint.Encoding(config.Hash.Encoding)
+		if err != nil {
+			return nil, err
+		}
+		key := []byte(config.Hash.Key)
+		return func(s string) string {
+			mac := hmac.New(method, key)
+			mac.Write([]byte(s))
+			return encode(mac.Sum(nil))
+		}, nil
+
+	case actionPartial:
+		keepFirst, keepLast := config.Partial.KeepFirst, config.Partial.KeepLast
+		char, _ := utf8.DecodeRuneInString(config.Partial.Char)
+		return func(s string) string {
+			runes := []rune(s)
+			if len(runes) <= keepFirst+keepLast {
+				// Keeping the characters would reveal the whole value.
+				return strings.Repeat(string(char), len(runes))
+			}
+			for i := keepFirst; i < len(runes)-keepLast; i++ {
+				runes[i] = char
+			}
+			return string(runes)
+		}, nil
+
+	default:
+		return nil, fmt.Errorf("unknown action %q", action)
+	}
+}
+
+func (p *redact) Run(event *beat.Event) (*beat.Event, error) {
+	if len(p.Fields) == 0 {
+		p.redactMap("", event.Fields)
+		return event, nil
+	}
+
+	for _, field := range p.Fields {
+		if p.excluded(field) {
+			continue
+		}
+		value, err := event.GetValue(field)
+		if err != nil {
+			if errors.Is(err, mapstr.ErrKeyNotFound) {
+				continue
+			}
+			return event, fmt.Errorf("failed in %s on the %q field: %w", procName, field, err)
+		}
+		if redacted, changed := p.redactValue(field, value); changed {
+			if _, err := event.PutValue(field, redacted); err != nil {
+				return event, fmt.Errorf("failed in %s on the %q field: %w", procName, field, err)
+			}
+		}
+	}
+	return event, nil
+}
+
+// redactValue redacts the strings in value, which can be a string, a map or
+// a slice. Maps are updated in place, while redacted strings and slices
+// are returned, as slices might be shared between events.
+func (p *redact) redactValue(path string, value interface{}) (interface{}, bool) {
+	switch v := value.(type) {
+	case string:
+		return p.redactString(v)
+	case mapstr.M:
+		p.redactMap(path, v)
+	case map[string]interface{}:
+		p.redactMap(path, v)
+	case []string:
+		var redacted []string
+		for i, s := range v {
+			if r, changed := p.redactString(s); changed {
+				if redacted == nil {
+					redacted = append([]string(nil), v...)
+				}
+				redacted[i] = r
+			}
+		}
+		if redacted != nil {
+			return redacted, true
+		}
+	case []interface{}:
+		var redacted []interface{}
+		for i, elem := range v {
+			if r, changed := p.redactValue(path, elem); changed {
+				if redacted == nil {
+					redacted = append([]interface{}(nil), v...)
+				}
+				redacted[i] = r
+			}
+		}
+		if redacted != nil {
+			return redacted, true
+		}
+	}
+	return value, false
+}
+
+func (p *redact) redactMap(path string, m map[string]interface{}) {
+	for k, v := range m {
+		field := k
+		if path != "" {
+			field = path + "." + k
+		}
+		if p.excluded(field) {
+			continue
+		}
+		if redacted, changed := p.redactValue(field, v); changed {
+			m[k] = redacted
+		}
+	}
+}
+
+// excluded reports whether field or one of its parents is excluded.
+func (p *redact) excluded(field string) bool {
+	for {
+		if _, ok := p.exclude[field]; ok {
+			return true
+		}
+		i := strings.LastIndexByte(field, '.')
+		if i < 0 {
+			return false
+		}
+		field = field[:i]
+	}
+}
+
+// redactString replaces the sensitive values found in s. When the matches
+// of detectors overlap, the match that starts first, then the longest
+// match, is redacted.
+func (p *redact) redactString(s string) (string, bool) {
+	var matches []match
+	for i := range p.rules {
+		r := &p.rules[i]
+		for _, loc := range r.find(s) {
+			matches = append(matches, match{start: loc[0], end: loc[1], rule: r})
+		}
+	}
+	if len(matches) == 0 {
+		return s, false
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].start != matches[j].start {
+			return matches[i].start < matches[j].start
+		}
+		return matches[i].end > matches[j].end
+	})
+
+	var b strings.Builder
+	last := 0
+	for _, m := range matches {
+		if m.start < last {
+			continue
+		}
+		b.WriteString(s[last:m.start])
+		b.WriteString(m.rule.replace(s[m.start:m.end]))
+		m.rule.redacted.Inc()
+		last = m.end
+	}
+	b.WriteString(s[last:])
+	return b.String(), true
+}
+
+func (p *redact) String() string {
+	names := make([]string, len(p.rules))
+	for i, r := range p.rules {
+		names[i] = r.name
+	}
+	return fmt.Sprintf("%v=[detectors=%v, fields=%v, action=%v]", procName, names, p.Fields, p.Action)
+}
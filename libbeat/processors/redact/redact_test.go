@@ -0,0 +1,277 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package redact
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func newTestRedact(t *testing.T, settings mapstr.M) (*redact, *monitoring.Registry) {
+	t.Helper()
+	config := defaultConfig()
+	require.NoError(t, conf.MustNewConfigFrom(settings).Unpack(&config))
+	reg := monitoring.NewRegistry()
+	p, err := newRedact(config, reg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return p, reg
+}
+
+func TestDetectors(t *testing.T) {
+	tests := map[string]struct {
+		detector string
+		input    string
+		want     string
+	}{
+		"email": {
+			detector: "email",
+			input:    "mail from john.doe+tag@mail.example.com, bounced",
+			want:     "mail from [REDACTED], bounced",
+		},
+		"credit card": {
+			detector: "credit_card",
+			input:    "paid with 4111 1111 1111 1111 and 5500-0000-0000-0004",
+			want:     "paid with [REDACTED] and [REDACTED]",
+		},
+		"credit card failing the Luhn check": {
+			detector: "credit_card",
+			input:    "order 4111111111111112",
+			want:     "order 4111111111111112",
+		},
+		"iban": {
+			detector: "iban",
+			input:    "to DE89 3704 0044 0532 0130 00 and GB82WEST12345698765432.",
+			want:     "to [REDACTED] and [REDACTED].",
+		},
+		"iban with a wrong checksum": {
+			detector: "iban",
+			input:    "to DE88 3704 0044 0532 0130 00",
+			want:     "to DE88 3704 0044 0532 0130 00",
+		},
+		"ipv4": {
+			detector: "ip",
+			input:    "connection from 10.1.2.3:8080 to 192.168.0.1.",
+			want:     "connection from [REDACTED]:8080 to [REDACTED].",
+		},
+		"ipv6": {
+			detector: "ip",
+			input:    "client 2001:db8::1 and ::ffff:10.0.0.1 connected",
+			want:     "client [REDACTED] and [REDACTED] connected",
+		},
+		"not an ip": {
+			detector: "ip",
+			input:    "version 1.2.3.4.5 at 12:30:45 and 999.1.1.1",
+			want:     "version 1.2.3.4.5 at 12:30:45 and 999.1.1.1",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, _ := newTestRedact(t, mapstr.M{
+				"detectors": []mapstr.M{{"type": tc.detector}},
+			})
+			got, _ := p.redactString(tc.input)
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestActions(t *testing.T) {
+	mac := hmac.New(sha256.New, []byte("secret"))
+	mac.Write([]byte("jane@example.com"))
+	hashed := hex.EncodeToString(mac.Sum(nil))
+
+	tests := map[string]struct {
+		settings mapstr.M
+		want     string
+	}{
+		"mask": {
+			settings: mapstr.M{"action": "mask", "mask": "***"},
+			want:     "user *** card ***",
+		},
+		"hash": {
+			settings: mapstr.M{
+				"action":    "partial",
+				"detectors": []mapstr.M{{"type": "email", "action": "hash"}, {"type": "credit_card"}},
+				"hash":      mapstr.M{"key": "secret"},
+			},
+			want: "user " + hashed + " card ***************1111",
+		},
+		"partial": {
+			settings: mapstr.M{
+				"action":  "partial",
+				"partial": mapstr.M{"keep_first": 2, "keep_last": 3, "char": "#"},
+			},
+			want: "user ja###########com card 41##############111",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings := mapstr.M{
+				"detectors": []mapstr.M{{"type": "email"}, {"type": "credit_card"}},
+			}
+			settings.DeepUpdate(tc.settings)
+			p, _ := newTestRedact(t, settings)
+			got, _ := p.redactString("user jane@example.com card 4111-1111-1111-1111")
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestPartialShortValue(t *testing.T) {
+	p, _ := newTestRedact(t, mapstr.M{
+		"action":    "partial",
+		"detectors": []mapstr.M{{"type": "regex", "name": "pin", "pattern": `\bpin=\d+`}},
+		"partial":   mapstr.M{"keep_first": 4, "keep_last": 4},
+	})
+	got, _ := p.redactString("pin=123")
+	assert.Equal(t, "*******", got)
+}
+
+func TestOverlappingMatches(t *testing.T) {
+	// The user detector matches within the email address, which starts
+	// first and is redacted as a whole.
+	p, reg := newTestRedact(t, mapstr.M{
+		"detectors": []mapstr.M{
+			{"type": "regex", "name": "user", "pattern": `\bjdoe\b`},
+			{"type": "email"},
+		},
+	})
+	got, _ := p.redactString("jdoe@example.com logged in as jdoe")
+	assert.Equal(t, "[REDACTED] logged in as [REDACTED]", got)
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(1), snapshot.Ints["redactions.user"])
+	assert.Equal(t, int64(1), snapshot.Ints["redactions.email"])
+}
+
+func TestRun(t *testing.T) {
+	newEvent := func() *beat.Event {
+		return &beat.Event{Fields: mapstr.M{
+			"message": "login by jane@example.com from 10.0.0.1",
+			"user": mapstr.M{
+				"email": "jane@example.com",
+				"roles": []string{"admin", "ops@example.com"},
+			},
+			"source": mapstr.M{"ip": "10.0.0.1"},
+			"tags":   []interface{}{"a", mapstr.M{"owner": "bob@example.com"}},
+			"count":  3,
+		}}
+	}
+
+	t.Run("whole event", func(t *testing.T) {
+		p, reg := newTestRedact(t, mapstr.M{
+			"detectors":      []mapstr.M{{"type": "email"}, {"type": "ip"}},
+			"exclude_fields": []string{"source"},
+		})
+		event := newEvent()
+		roles := event.Fields["user"].(mapstr.M)["roles"].([]string)
+
+		_, err := p.Run(event)
+		require.NoError(t, err)
+		assert.Equal(t, mapstr.M{
+			"message": "login by [REDACTED] from [REDACTED]",
+			"user": mapstr.M{
+				"email": "[REDACTED]",
+				"roles": []string{"admin", "[REDACTED]"},
+			},
+			"source": mapstr.M{"ip": "10.0.0.1"},
+			"tags":   []interface{}{"a", mapstr.M{"owner": "[REDACTED]"}},
+			"count":  3,
+		}, event.Fields)
+		// Slices are copied, as they might be shared with other events.
+		assert.Equal(t, "ops@example.com", roles[1])
+
+		snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+		assert.Equal(t, int64(4), snapshot.Ints["redactions.email"])
+		assert.Equal(t, int64(1), snapshot.Ints["redactions.ip"])
+	})
+
+	t.Run("fields", func(t *testing.T) {
+		p, _ := newTestRedact(t, mapstr.M{
+			"detectors":      []mapstr.M{{"type": "email"}, {"type": "ip"}},
+			"fields":         []string{"message", "user", "missing"},
+			"exclude_fields": []string{"user.roles"},
+		})
+		event := newEvent()
+		_, err := p.Run(event)
+		require.NoError(t, err)
+
+		want := newEvent().Fields
+		want["message"] = "login by [REDACTED] from [REDACTED]"
+		want["user"].(mapstr.M)["email"] = "[REDACTED]"
+		assert.Equal(t, want, event.Fields)
+	})
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"no detectors":        {},
+		"unknown detector":    {"detectors": []mapstr.M{{"type": "ssn"}}},
+		"regex without name":  {"detectors": []mapstr.M{{"type": "regex", "pattern": "x"}}},
+		"duplicate detectors": {"detectors": []mapstr.M{{"type": "ip"}, {"type": "ip"}}},
+		"unknown action":      {"detectors": []mapstr.M{{"type": "ip"}}, "action": "drop"},
+		"hash without key":    {"detectors": []mapstr.M{{"type": "ip", "action": "hash"}}},
+		"long partial char":   {"detectors": []mapstr.M{{"type": "ip"}}, "partial.char": "**"},
+	}
+
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(settings), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+
+	t.Run("non-cryptographic hash", func(t *testing.T) {
+		_, err := New(conf.MustNewConfigFrom(mapstr.M{
+			"detectors": []mapstr.M{{"type": "ip"}},
+			"action":    "hash",
+			"hash":      mapstr.M{"key": "secret", "method": "xxhash"},
+		}), logptest.NewTestingLogger(t, ""))
+		assert.ErrorContains(t, err, "xxhash")
+	})
+}
+
+func BenchmarkRedact(b *testing.B) {
+	config := defaultConfig()
+	require.NoError(b, conf.MustNewConfigFrom(mapstr.M{
+		"detectors": []mapstr.M{{"type": "email"}, {"type": "credit_card"}, {"type": "iban"}, {"type": "ip"}},
+	}).Unpack(&config))
+	p, err := newRedact(config, monitoring.NewRegistry(), logptest.NewTestingLogger(b, ""))
+	require.NoError(b, err)
+
+	message := `2024-01-02T03:04:05Z INFO payment accepted for jane@example.com from 192.168.1.10, card 4111 1111 1111 1111, order 1234`
+	for b.Loop() {
+		event := &beat.Event{Fields: mapstr.M{"message": message}}
+		if _, err := p.Run(event); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
@@ -0,0 +1,112 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+)
+
+// overflowKey is the key shared by the keys seen once max_keys keys were
+// seen in an interval.
+const overflowKey = "\x00overflow"
+
+// adaptiveSampler computes sample rates per key that keep the total
+// throughput within a budget. The events of each key are counted over an
+// interval, and the counts of the previous interval determine the rates of
+// the current one. Keys that are rare enough to fit in their share of the
+// budget, and keys that were not seen in the previous interval, are not
+// sampled.
+type adaptiveSampler struct {
+	budget   float64 // budget is the number of events kept per interval.
+	interval time.Duration
+	maxKeys  int
+	clock    clockwork.Clock
+
+	mu     sync.Mutex
+	end    time.Time
+	counts map[string]int
+	rates  map[string]float64
+}
+
+func newAdaptiveSampler(eventsPerSecond float64, interval time.Duration, maxKeys int, clock clockwork.Clock) *adaptiveSampler {
+	return &adaptiveSampler{
+		budget:   eventsPerSecond * interval.Seconds(),
+		interval: interval,
+		maxKeys:  maxKeys,
+		clock:    clock,
+		end:      clock.Now().Add(interval),
+		counts:   map[string]int{},
+		rates:    map[string]float64{},
+	}
+}
+
+// rate counts an event of the key and returns the rate the event is
+// sampled at.
+func (s *adaptiveSampler) rate(key string) float64 {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if now := s.clock.Now(); !now.Before(s.end) {
+		s.rates = computeRates(s.counts, s.budget)
+		// Reuse the size of the previous interval as capacity hint.
+		s.counts = make(map[string]int, len(s.counts))
+		s.end = now.Add(s.interval)
+	}
+
+	if _, ok := s.counts[key]; !ok && len(s.counts) >= s.maxKeys {
+		key = overflowKey
+	}
+	s.counts[key]++
+
+	if rate, ok := s.rates[key]; ok {
+		return rate
+	}
+	return 1
+}
+
+// computeRates shares the budget between keys with the given counts. Keys
+// are served from the least to the most frequent. Each key is offered an
+// equal share of the remaining budget, and keys whose count is within
+// their share are kept completely, leaving the rest of the share to the
+// more frequent keys.
+func computeRates(counts map[string]int, budget float64) map[string]float64 {
+	keys := make([]string, 0, len(counts))
+	for k := range counts {
+		keys = append(keys, k)
+	}
+	sort.Slice(keys, func(i, j int) bool { return counts[keys[i]] < counts[keys[j]] })
+
+	rates := make(map[string]float64, len(keys))
+	remaining := budget
+	for i, k := range keys {
+		share := remaining / float64(len(keys)-i)
+		count := float64(counts[k])
+		if count <= share {
+			rates[k] = 1
+			remaining -= count
+			continue
+		}
+		rates[k] = share / count
+		remaining -= share
+	}
+	return rates
+}
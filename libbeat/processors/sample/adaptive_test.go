@@ -0,0 +1,77 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestComputeRates(t *testing.T) {
+	tests := map[string]struct {
+		counts map[string]int
+		budget float64
+		want   map[string]float64
+	}{
+		"within budget": {
+			counts: map[string]int{"a": 10, "b": 20},
+			budget: 100,
+			want:   map[string]float64{"a": 1, "b": 1},
+		},
+		"rare keys are kept": {
+			counts: map[string]int{"a": 1, "b": 5, "c": 500, "d": 1000},
+			budget: 100,
+			// a and b use 6 events, c and d share the 94 others.
+			want: map[string]float64{"a": 1, "b": 1, "c": 47.0 / 500, "d": 47.0 / 1000},
+		},
+		"budget smaller than keys": {
+			counts: map[string]int{"a": 4, "b": 4},
+			budget: 2,
+			want:   map[string]float64{"a": 0.25, "b": 0.25},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got := computeRates(tc.counts, tc.budget)
+			assert.Len(t, got, len(tc.want))
+			for k, want := range tc.want {
+				assert.InDelta(t, want, got[k], 1e-9, k)
+			}
+		})
+	}
+}
+
+func TestAdaptiveSamplerMaxKeys(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	s := newAdaptiveSampler(1, time.Second, 2, clock)
+	for _, key := range []string{"a", "b", "c", "d", "d"} {
+		s.rate(key)
+	}
+	assert.Equal(t, map[string]int{"a": 1, "b": 1, overflowKey: 3}, s.counts)
+
+	// Keys beyond the limit share the rate of the overflow key.
+	clock.Advance(time.Second)
+	s.rate("a")
+	s.rate("b")
+	assert.Equal(t, s.rates[overflowKey], s.rate("e"))
+	assert.Less(t, s.rate("e"), 1.0)
+}
@@ -0,0 +1,80 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+const (
+	modeHash     = "hash"
+	modeAdaptive = "adaptive"
+)
+
+type config struct {
+	Mode string `config:"mode"`
+
+	// KeyFields are the fields whose values form the sampling key.
+	KeyFields []string `config:"key_fields"`
+
+	// Rate is the share of keys kept in hash mode.
+	Rate float64 `config:"rate"`
+
+	// EventsPerSecond is the budget of the adaptive mode, and Interval
+	// the period over which the sample rates of keys are adjusted.
+	EventsPerSecond float64       `config:"events_per_second"`
+	Interval        time.Duration `config:"interval"`
+	MaxKeys         int           `config:"max_keys" validate:"min=1"`
+
+	// TargetField is the field the effective sample rate is written to.
+	TargetField string `config:"target_field"`
+}
+
+func defaultConfig() config {
+	return config{
+		Mode:        modeHash,
+		Rate:        1,
+		Interval:    30 * time.Second,
+		MaxKeys:     10000,
+		TargetField: "sample.rate",
+	}
+}
+
+func (c *config) Validate() error {
+	switch c.Mode {
+	case modeHash:
+		if len(c.KeyFields) == 0 {
+			return errors.New("key_fields are required by the hash mode")
+		}
+		if c.Rate <= 0 || c.Rate > 1 {
+			return fmt.Errorf("rate must be greater than 0 and at most 1, got %v", c.Rate)
+		}
+	case modeAdaptive:
+		if c.EventsPerSecond <= 0 {
+			return errors.New("events_per_second must be greater than 0 with the adaptive mode")
+		}
+		if c.Interval <= 0 {
+			return errors.New("interval must be greater than 0")
+		}
+	default:
+		return fmt.Errorf("unknown mode %q, must be %v or %v", c.Mode, modeHash, modeAdaptive)
+	}
+	return nil
+}
@@ -0,0 +1,177 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"errors"
+	"fmt"
+	"math/rand/v2"
+	"strconv"
+	"strings"
+	"sync/atomic"
+
+	"github.com/cespare/xxhash/v2"
+	"github.com/jonboulle/clockwork"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// instanceID is used to assign each instance a unique monitoring namespace.
+var instanceID atomic.Uint32
+
+const (
+	procName = "sample"
+	logName  = "processor." + procName
+)
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"mode", "key_fields", "rate", "events_per_second", "interval",
+				"max_keys", "target_field", "when",
+			)))
+}
+
+type metrics struct {
+	kept    *monitoring.Int
+	dropped *monitoring.Int
+}
+
+type sample struct {
+	config
+	adaptive *adaptiveSampler
+	// random returns a number in [0, 1) to sample events in adaptive mode.
+	random func() float64
+
+	metrics metrics
+	log     *logp.Logger
+}
+
+// New constructs a new sample processor.
+func New(cfg *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := cfg.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("failed to unpack the %s configuration: %w", procName, err)
+	}
+
+	// Logging and metrics (each processor instance has a unique ID).
+	var (
+		id  = int(instanceID.Add(1))
+		reg = monitoring.Default.NewRegistry(logName+"."+strconv.Itoa(id), monitoring.DoNotReport)
+	)
+	return newSample(config, reg, clockwork.NewRealClock(), log.Named(logName).With("instance_id", id)), nil
+}
+
+func newSample(config config, reg *monitoring.Registry, clock clockwork.Clock, log *logp.Logger) *sample {
+	p := &sample{
+		config: config,
+		random: rand.Float64,
+		metrics: metrics{
+			kept:    monitoring.NewInt(reg, "kept"),
+			dropped: monitoring.NewInt(reg, "dropped"),
+		},
+		log: log,
+	}
+	if config.Mode == modeAdaptive {
+		p.adaptive = newAdaptiveSampler(config.EventsPerSecond, config.Interval, config.MaxKeys, clock)
+	}
+	return p
+}
+
+// Run keeps or drops the event. Kept events get the effective rate they
+// were sampled at, multiplied by the rate of previous samplings.
+func (p *sample) Run(event *beat.Event) (*beat.Event, error) {
+	key, err := p.makeKey(event)
+	if err != nil {
+		return event, fmt.Errorf("could not make key: %w", err)
+	}
+
+	var keep bool
+	rate := p.Rate
+	if p.adaptive != nil {
+		rate = p.adaptive.rate(key)
+		keep = rate >= 1 || p.random() < rate
+	} else {
+		keep = keepHash(key, rate)
+	}
+	if !keep {
+		p.metrics.dropped.Inc()
+		return nil, nil
+	}
+	p.metrics.kept.Inc()
+
+	if p.TargetField == "" {
+		return event, nil
+	}
+	if v, err := event.GetValue(p.TargetField); err == nil {
+		if previous, ok := v.(float64); ok {
+			rate *= previous
+		}
+	}
+	if _, err := event.PutValue(p.TargetField, rate); err != nil {
+		return event, fmt.Errorf("failed to put the sample rate into field %q: %w", p.TargetField, err)
+	}
+	return event, nil
+}
+
+// makeKey returns the values of the key fields of the event. Missing
+// fields have an empty value.
+func (p *sample) makeKey(event *beat.Event) (string, error) {
+	var b strings.Builder
+	for i, field := range p.KeyFields {
+		if i > 0 {
+			b.WriteByte(0)
+		}
+		value, err := event.GetValue(field)
+		if err != nil {
+			if !errors.Is(err, mapstr.ErrKeyNotFound) {
+				return "", fmt.Errorf("error getting value of field '%v': %w", field, err)
+			}
+			continue
+		}
+		fmt.Fprint(&b, value)
+	}
+	return b.String(), nil
+}
+
+// keepHash reports whether the events with the key are kept when sampling
+// at the given rate. The decision only depends on the key, so that all
+// events of a key are kept or dropped together, by all Beats.
+func keepHash(key string, rate float64) bool {
+	if rate >= 1 {
+		return true
+	}
+	// Compare the 53 high bits of the hash, which a float64 represents
+	// exactly.
+	return float64(xxhash.Sum64String(key)>>11) < rate*(1<<53)
+}
+
+func (p *sample) String() string {
+	if p.adaptive != nil {
+		return fmt.Sprintf("%v=[mode=%v, key_fields=%v, events_per_second=%v, interval=%v]",
+			procName, p.Mode, p.KeyFields, p.EventsPerSecond, p.Interval)
+	}
+	return fmt.Sprintf("%v=[mode=%v, key_fields=%v, rate=%v]", procName, p.Mode, p.KeyFields, p.Rate)
+}
@@ -0,0 +1,178 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package sample
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/jonboulle/clockwork"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func newTestSample(t *testing.T, settings mapstr.M, clock clockwork.Clock) (*sample, *monitoring.Registry) {
+	t.Helper()
+	config := defaultConfig()
+	require.NoError(t, conf.MustNewConfigFrom(settings).Unpack(&config))
+	reg := monitoring.NewRegistry()
+	return newSample(config, reg, clock, logptest.NewTestingLogger(t, "")), reg
+}
+
+func traceEvent(id string) *beat.Event {
+	return &beat.Event{
+		Timestamp: time.Now(),
+		Fields:    mapstr.M{"trace": mapstr.M{"id": id}},
+	}
+}
+
+func TestHashSampling(t *testing.T) {
+	p, reg := newTestSample(t, mapstr.M{
+		"key_fields": []string{"trace.id"},
+		"rate":       0.25,
+	}, clockwork.NewRealClock())
+
+	const traces = 10000
+	decisions := map[string]bool{}
+	kept := 0
+	for i := 0; i < traces; i++ {
+		id := strconv.Itoa(i)
+		event, err := p.Run(traceEvent(id))
+		require.NoError(t, err)
+		decisions[id] = event != nil
+		if event != nil {
+			kept++
+			assert.Equal(t, 0.25, event.Fields["sample"].(mapstr.M)["rate"])
+		}
+	}
+	assert.InDelta(t, 0.25, float64(kept)/traces, 0.02)
+
+	// All events of a trace get the same decision.
+	for i := 0; i < 100; i++ {
+		id := strconv.Itoa(i)
+		event, err := p.Run(traceEvent(id))
+		require.NoError(t, err)
+		assert.Equal(t, decisions[id], event != nil, "trace %s", id)
+	}
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, traces+100, int(snapshot.Ints["kept"]+snapshot.Ints["dropped"]))
+}
+
+func TestHashSamplingIsStable(t *testing.T) {
+	// The decisions must not change between releases, so that Beats of
+	// different versions sample the same traces.
+	for key, want := range map[string]bool{
+		"4bf92f3577b34da6a3ce929d0e0e4736": true,
+		"a3ce929d0e0e47364bf92f3577b34da6": true,
+		"0af7651916cd43dd8448eb211c80319c": false,
+		"8448eb211c80319c0af7651916cd43dd": false,
+	} {
+		assert.Equal(t, want, keepHash(key, 0.5), key)
+	}
+}
+
+func TestChainedSampleRate(t *testing.T) {
+	p, _ := newTestSample(t, mapstr.M{
+		"key_fields": []string{"trace.id"},
+		"rate":       0.5,
+	}, clockwork.NewRealClock())
+
+	// Find a kept trace.
+	for i := 0; ; i++ {
+		id := strconv.Itoa(i)
+		if !keepHash(id, 0.5) {
+			continue
+		}
+		event := traceEvent(id)
+		event.Fields["sample"] = mapstr.M{"rate": 0.1}
+		_, err := p.Run(event)
+		require.NoError(t, err)
+		assert.InDelta(t, 0.05, event.Fields["sample"].(mapstr.M)["rate"], 1e-9)
+		return
+	}
+}
+
+func TestAdaptiveSampling(t *testing.T) {
+	clock := clockwork.NewFakeClock()
+	p, reg := newTestSample(t, mapstr.M{
+		"mode":              "adaptive",
+		"key_fields":        []string{"service.name"},
+		"events_per_second": 10,
+		"interval":          "10s",
+	}, clock)
+	random := 0.0
+	p.random = func() float64 { return random }
+
+	run := func(service string) *beat.Event {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"service": mapstr.M{"name": service}}})
+		require.NoError(t, err)
+		return event
+	}
+
+	// The first interval is not sampled.
+	for i := 0; i < 1000; i++ {
+		require.NotNil(t, run("busy"))
+	}
+	for i := 0; i < 10; i++ {
+		require.NotNil(t, run("quiet"))
+	}
+	clock.Advance(10 * time.Second)
+
+	// The budget of 100 events is shared between the rare and the busy
+	// key, so that the busy key is sampled at 90/1000.
+	event := run("quiet")
+	require.NotNil(t, event)
+	assert.Equal(t, 1.0, event.Fields["sample"].(mapstr.M)["rate"])
+
+	event = run("busy")
+	require.NotNil(t, event)
+	assert.InDelta(t, 0.09, event.Fields["sample"].(mapstr.M)["rate"], 1e-9)
+	random = 0.5
+	assert.Nil(t, run("busy"))
+
+	// New keys are not sampled.
+	assert.NotNil(t, run("new"))
+
+	snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+	assert.Equal(t, int64(1), snapshot.Ints["dropped"])
+}
+
+func TestConfigValidation(t *testing.T) {
+	tests := map[string]mapstr.M{
+		"unknown mode":      {"mode": "random", "key_fields": []string{"a"}},
+		"hash without keys": {"rate": 0.5},
+		"zero rate":         {"key_fields": []string{"a"}, "rate": 0},
+		"rate above 1":      {"key_fields": []string{"a"}, "rate": 2},
+		"adaptive budget":   {"mode": "adaptive"},
+		"zero interval":     {"mode": "adaptive", "events_per_second": 1, "interval": 0},
+	}
+	for name, settings := range tests {
+		t.Run(name, func(t *testing.T) {
+			_, err := New(conf.MustNewConfigFrom(settings), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+}
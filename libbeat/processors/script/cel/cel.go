@@ -0,0 +1,337 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cel
+
+import (
+	"fmt"
+	"os"
+	"time"
+
+	"github.com/elastic/mito/lib"
+	"github.com/google/cel-go/cel"
+	"github.com/google/cel-go/common/decls"
+	"github.com/google/cel-go/common/types"
+	"github.com/google/cel-go/common/types/ref"
+	"github.com/google/cel-go/common/types/traits"
+	"github.com/rcrowley/go-metrics"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+	"github.com/elastic/elastic-agent-libs/monitoring/adapter"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const (
+	logName = "processor.cel"
+
+	// Names of the variables available to programs.
+	eventVar  = "event"
+	paramsVar = "params"
+)
+
+type celProcessor struct {
+	Config
+	prg        cel.Program
+	ast        *cel.Ast
+	params     map[string]interface{}
+	sourceFile string
+	stats      *processorStats
+}
+
+// New constructs a new CEL processor.
+func New(c *config.C, log *logp.Logger) (beat.Processor, error) {
+	conf := defaultConfig()
+	if err := c.Unpack(&conf); err != nil {
+		return nil, err
+	}
+
+	return NewFromConfig(conf, monitoring.Default)
+}
+
+// NewFromConfig constructs a new CEL processor from the given config
+// object. It loads the source and compiles the program.
+func NewFromConfig(c Config, reg *monitoring.Registry) (beat.Processor, error) {
+	err := c.Validate()
+	if err != nil {
+		return nil, err
+	}
+
+	sourceFile := "inline.cel"
+	source := c.Source
+	if c.File != "" {
+		sourceFile, source, err = loadSource(c.File)
+		if err != nil {
+			return nil, annotateError(c.Tag, err)
+		}
+	}
+
+	prg, ast, err := newProgram(source, c.MaxCost)
+	if err != nil {
+		return nil, annotateError(c.Tag, err)
+	}
+
+	params := c.Params
+	if params == nil {
+		params = map[string]interface{}{}
+	}
+	return &celProcessor{
+		Config:     c,
+		prg:        prg,
+		ast:        ast,
+		params:     params,
+		sourceFile: sourceFile,
+		stats:      getStats(c.Tag, reg),
+	}, nil
+}
+
+// loadSource loads the CEL source from a file.
+func loadSource(path string) (string, string, error) {
+	path = paths.Resolve(paths.Config, path)
+	if common.IsStrictPerms() {
+		if err := common.OwnerHasExclusiveWritePerms(path); err != nil {
+			return "", "", err
+		}
+	}
+	source, err := os.ReadFile(path)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read file %v: %w", path, err)
+	}
+	return path, string(source), nil
+}
+
+// newProgram compiles the source with the extensions of the mito library
+// that have no side effects. The network and file system are not
+// available to programs.
+func newProgram(source string, maxCost uint64) (cel.Program, *cel.Ast, error) {
+	env, err := cel.NewEnv(
+		cel.VariableDecls(
+			decls.NewVariable(eventVar, types.DynType),
+			decls.NewVariable(paramsVar, types.DynType),
+		),
+		cel.OptionalTypes(cel.OptionalTypesVersion(lib.OptionalTypesVersion)),
+		lib.Collections(),
+		lib.Crypto(),
+		lib.JSON(nil),
+		lib.Printf(),
+		lib.Strings(),
+		lib.Time(),
+		lib.Try(),
+	)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to create env: %w", err)
+	}
+
+	ast, iss := env.Compile(source)
+	if iss.Err() != nil {
+		return nil, nil, fmt.Errorf("failed compilation: %w", iss.Err())
+	}
+
+	prg, err := env.Program(ast, cel.CostLimit(maxCost))
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed program instantiation: %w", err)
+	}
+	return prg, ast, nil
+}
+
+func annotateError(id string, err error) error {
+	if err == nil {
+		return nil
+	}
+	if id != "" {
+		return fmt.Errorf("failed in processor.cel with id=%v: %w", id, err)
+	}
+	return fmt.Errorf("failed in processor.cel: %w", err)
+}
+
+// Run evaluates the program against the event. The event is replaced
+// by the map returned by the program, or dropped if the program returns
+// false or null. The event is kept unchanged if the program returns true.
+func (p *celProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	start := time.Now()
+	rtn, err := p.eval(event, start)
+	if p.stats != nil {
+		p.stats.processTime.Update(int64(time.Since(start)))
+	}
+	if err != nil {
+		if p.stats != nil {
+			p.stats.exceptions.Inc()
+		}
+		if p.TagOnException != "" {
+			_ = mapstr.AddTags(event.Fields, []string{p.TagOnException})
+		}
+		err = fmt.Errorf("failed eval: %w", err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return event, annotateError(p.Tag, err)
+	}
+	return rtn, nil
+}
+
+func (p *celProcessor) eval(event *beat.Event, now time.Time) (*beat.Event, error) {
+	out, _, err := p.prg.Eval(map[string]interface{}{
+		// Replace the "now" global of the time extension, which is static
+		// from the instantiation of the program, with the current time.
+		"now":     now,
+		eventVar:  eventMap(event),
+		paramsVar: p.params,
+	})
+	if err != nil {
+		return nil, lib.DecoratedError{AST: p.ast, Err: err}
+	}
+
+	switch out := out.(type) {
+	case types.Bool:
+		if out {
+			return event, nil
+		}
+		return nil, nil
+	case types.Null:
+		return nil, nil
+	case traits.Mapper:
+		fields, err := toMap(out)
+		if err != nil {
+			return nil, err
+		}
+		if err = setEvent(event, fields); err != nil {
+			return nil, err
+		}
+		return event, nil
+	default:
+		return nil, fmt.Errorf("unexpected result type %s, the program must return a map, a bool or null", out.Type().TypeName())
+	}
+}
+
+// eventMap returns the event as a map, with the timestamp and metadata in
+// the @timestamp and @metadata fields, like in published events.
+func eventMap(event *beat.Event) map[string]interface{} {
+	m := make(map[string]interface{}, len(event.Fields)+2)
+	for k, v := range event.Fields {
+		m[k] = v
+	}
+	m["@timestamp"] = event.Timestamp
+	if event.Meta != nil {
+		m["@metadata"] = event.Meta
+	}
+	return m
+}
+
+// setEvent replaces the event with the fields returned by a program. The
+// timestamp is kept when the fields have no @timestamp.
+func setEvent(event *beat.Event, fields mapstr.M) error {
+	var ts time.Time
+	if v, ok := fields["@timestamp"]; ok {
+		ts, ok = v.(time.Time)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for the @timestamp field", v)
+		}
+		delete(fields, "@timestamp")
+	}
+	var meta mapstr.M
+	if v, ok := fields["@metadata"]; ok {
+		meta, ok = v.(mapstr.M)
+		if !ok {
+			return fmt.Errorf("unexpected type %T for the @metadata field", v)
+		}
+		delete(fields, "@metadata")
+	}
+
+	if !ts.IsZero() {
+		event.Timestamp = ts
+	}
+	event.Meta = meta
+	event.Fields = fields
+	return nil
+}
+
+// toNative converts a CEL value to the values used in events. Maps are
+// converted to mapstr.M and lists to []interface{}.
+func toNative(v ref.Val) (interface{}, error) {
+	switch v := v.(type) {
+	case traits.Mapper:
+		return toMap(v)
+	case traits.Lister:
+		var list []interface{}
+		for it := v.Iterator(); it.HasNext() == types.True; {
+			elem, err := toNative(it.Next())
+			if err != nil {
+				return nil, err
+			}
+			list = append(list, elem)
+		}
+		return list, nil
+	case types.Null:
+		return nil, nil
+	case *types.Err:
+		return nil, v
+	default:
+		return v.Value(), nil
+	}
+}
+
+func toMap(m traits.Mapper) (mapstr.M, error) {
+	out := make(mapstr.M)
+	for it := m.Iterator(); it.HasNext() == types.True; {
+		k := it.Next()
+		key, ok := k.(types.String)
+		if !ok {
+			return nil, fmt.Errorf("unexpected key type %s", k.Type().TypeName())
+		}
+		v, err := toNative(m.Get(k))
+		if err != nil {
+			return nil, fmt.Errorf("failed to convert %q: %w", string(key), err)
+		}
+		out[string(key)] = v
+	}
+	return out, nil
+}
+
+func (p *celProcessor) String() string {
+	return "script=[type=cel, id=" + p.Tag + ", sources=" + p.sourceFile + "]"
+}
+
+type processorStats struct {
+	exceptions  *monitoring.Int
+	processTime metrics.Sample
+}
+
+func getStats(id string, reg *monitoring.Registry) *processorStats {
+	if id == "" || reg == nil {
+		return nil
+	}
+
+	namespace := logName + "." + id
+	processorReg := reg.GetRegistry(namespace)
+	if processorReg != nil {
+		// If a module is reloaded then the namespace could already exist.
+		_ = processorReg.Clear()
+	} else {
+		processorReg = reg.NewRegistry(namespace, monitoring.DoNotReport)
+	}
+
+	stats := &processorStats{
+		exceptions:  monitoring.NewInt(processorReg, "exceptions"),
+		processTime: metrics.NewUniformSample(2048),
+	}
+	_ = adapter.NewGoMetrics(processorReg, "histogram", adapter.Accept).
+		Register("process_time", metrics.NewHistogram(stats.processTime))
+
+	return stats
+}
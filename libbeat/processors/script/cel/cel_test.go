@@ -0,0 +1,176 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package cel
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func testEvent() *beat.Event {
+	return &beat.Event{
+		Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+		Meta:      mapstr.M{"_id": "abc"},
+		Fields: mapstr.M{
+			"message": "hello world",
+			"event":   mapstr.M{"code": 4624},
+			"tags":    []string{"a"},
+		},
+	}
+}
+
+func TestCEL(t *testing.T) {
+	tests := map[string]struct {
+		source   string
+		params   map[string]interface{}
+		want     *beat.Event
+		wantDrop bool
+	}{
+		"keep": {
+			source: `true`,
+			want:   testEvent(),
+		},
+		"drop": {
+			source:   `event.event.code == 4624 ? false : true`,
+			wantDrop: true,
+		},
+		"drop null": {
+			source:   `null`,
+			wantDrop: true,
+		},
+		"modify": {
+			source: `event.with({
+				"event": event.event.with({"action": event.event.code == 4624 ? "logged-in" : "other"}),
+				"words": event.message.split(" "),
+			}).drop("tags")`,
+			want: &beat.Event{
+				Timestamp: time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC),
+				Meta:      mapstr.M{"_id": "abc"},
+				Fields: mapstr.M{
+					"message": "hello world",
+					"event":   mapstr.M{"code": int64(4624), "action": "logged-in"},
+					"words":   []interface{}{"hello", "world"},
+				},
+			},
+		},
+		"replace": {
+			source: `{
+				"@timestamp": timestamp("2025-02-03T04:05:06Z"),
+				"message": event.message.to_upper(),
+				"threshold": params.threshold,
+			}`,
+			params: map[string]interface{}{"threshold": 15},
+			want: &beat.Event{
+				Timestamp: time.Date(2025, 2, 3, 4, 5, 6, 0, time.UTC),
+				Fields: mapstr.M{
+					"message":   "HELLO WORLD",
+					"threshold": int64(15),
+				},
+			},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := NewFromConfig(Config{Source: tc.source, Params: tc.params, MaxCost: 1000}, nil)
+			require.NoError(t, err)
+
+			got, err := p.Run(testEvent())
+			require.NoError(t, err)
+			if tc.wantDrop {
+				assert.Nil(t, got)
+				return
+			}
+			require.NotNil(t, got)
+			assert.Equal(t, tc.want.Timestamp, got.Timestamp)
+			assert.Equal(t, tc.want.Meta, got.Meta)
+			assert.Equal(t, tc.want.Fields, got.Fields)
+		})
+	}
+}
+
+func TestCELErrors(t *testing.T) {
+	tests := map[string]struct {
+		source  string
+		wantErr string
+	}{
+		"missing field": {
+			source:  `event.missing == 1`,
+			wantErr: "no such key: missing",
+		},
+		"cost limit": {
+			source:  `[1, 2, 3, 4, 5, 6, 7, 8, 9, 10].map(i, [1, 2, 3, 4, 5, 6, 7, 8, 9, 10].map(j, i * j)).size() > 0`,
+			wantErr: "cost limit exceeded",
+		},
+		"result type": {
+			source:  `1`,
+			wantErr: "unexpected result type int",
+		},
+		"timestamp type": {
+			source:  `{"@timestamp": "now"}`,
+			wantErr: "unexpected type string for the @timestamp field",
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			reg := monitoring.NewRegistry()
+			p, err := NewFromConfig(Config{Tag: "test", Source: tc.source, MaxCost: 100, TagOnException: "_cel_exception"}, reg)
+			require.NoError(t, err)
+
+			event := testEvent()
+			got, err := p.Run(event)
+			require.ErrorContains(t, err, tc.wantErr)
+			require.Same(t, event, got)
+			assert.Equal(t, []string{"a", "_cel_exception"}, got.Fields["tags"])
+			msg, _ := got.GetValue("error.message")
+			assert.Contains(t, msg, tc.wantErr)
+
+			snapshot := monitoring.CollectFlatSnapshot(reg, monitoring.Full, true)
+			assert.Equal(t, int64(1), snapshot.Ints["processor.cel.test.exceptions"])
+		})
+	}
+}
+
+func TestCELConfig(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "process.cel")
+	require.NoError(t, os.WriteFile(path, []byte(`event.with({"file": true})`), 0o600))
+
+	p, err := NewFromConfig(Config{File: path, MaxCost: 100}, nil)
+	require.NoError(t, err)
+	got, err := p.Run(testEvent())
+	require.NoError(t, err)
+	assert.Equal(t, true, got.Fields["file"])
+
+	_, err = NewFromConfig(Config{Source: `event.`, MaxCost: 100}, nil)
+	assert.ErrorContains(t, err, "failed compilation")
+	_, err = NewFromConfig(Config{Source: `true`, File: path, MaxCost: 100}, nil)
+	assert.Error(t, err)
+	_, err = NewFromConfig(Config{Source: `true`}, nil)
+	assert.ErrorContains(t, err, "max_cost")
+}
@@ -23,6 +23,7 @@ import (
 
 	"github.com/elastic/beats/v7/libbeat/beat"
 	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/script/cel"
 	"github.com/elastic/beats/v7/libbeat/processors/script/javascript"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
@@ -47,7 +48,9 @@ func New(c *config.C, log *logp.Logger) (beat.Processor, error) {
 	switch strings.ToLower(config.Lang) {
 	case "javascript", "js":
 		return javascript.New(c, log)
+	case "cel":
+		return cel.New(c, log)
 	default:
-		return nil, fmt.Errorf("script type must be declared (e.g. type: javascript)")
+		return nil, fmt.Errorf("script type must be declared (e.g. lang: javascript or lang: cel)")
 	}
 }
@@ -0,0 +1,79 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package script
+
+import (
+	"testing"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+// BenchmarkScript compares the javascript and cel processors running
+// the same logic.
+func BenchmarkScript(b *testing.B) {
+	benchmarks := map[string]map[string]mapstr.M{
+		"modify": {
+			"javascript": {"source": `
+				function process(event) {
+					if (event.Get("event.code") === 4624) {
+						event.Put("event.action", "logged-in");
+					}
+					event.Put("words", event.Get("message").split(" "));
+				}`},
+			"cel": {"source": `
+				event.with({
+					"event": event.event.code == 4624 ? event.event.with({"action": "logged-in"}) : event.event,
+					"words": event.message.split(" "),
+				})`},
+		},
+		"drop": {
+			"javascript": {"source": `
+				function process(event) {
+					if (event.Get("event.code") === 4624) {
+						event.Cancel();
+					}
+				}`},
+			"cel": {"source": `event.event.code != 4624`},
+		},
+	}
+
+	for name, langs := range benchmarks {
+		for lang, settings := range langs {
+			b.Run(name+"/"+lang, func(b *testing.B) {
+				settings["lang"] = lang
+				p, err := New(conf.MustNewConfigFrom(settings), logptest.NewTestingLogger(b, ""))
+				if err != nil {
+					b.Fatal(err)
+				}
+				for b.Loop() {
+					_, err := p.Run(&beat.Event{Fields: mapstr.M{
+						"message": "user logged in",
+						"event":   mapstr.M{"code": 4624, "provider": "Security"},
+						"host":    mapstr.M{"name": "host"},
+					}})
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		}
+	}
+}
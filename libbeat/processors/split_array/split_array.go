@@ -0,0 +1,140 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package split_array
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+const procName = "split_array"
+
+var errNotArray = errors.New("field value is not an array")
+
+type config struct {
+	Field         string `config:"field" validate:"required"`
+	TargetField   string `config:"target_field"`
+	IndexField    string `config:"index_field"`
+	IgnoreMissing bool   `config:"ignore_missing"`
+	IgnoreFailure bool   `config:"ignore_failure"`
+	KeepEmpty     bool   `config:"keep_empty"`
+}
+
+type splitArray struct {
+	config
+}
+
+func init() {
+	// The processor can't be used in scripts, which expect a single event.
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.RequireFields("field"),
+			checks.AllowedFields(
+				"field", "target_field", "index_field", "ignore_missing",
+				"ignore_failure", "keep_empty", "when",
+			)))
+}
+
+// New constructs a new split_array processor.
+func New(c *conf.C, log *logp.Logger) (beat.Processor, error) {
+	var config config
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+	if config.TargetField == "" {
+		config.TargetField = config.Field
+	}
+	return &splitArray{config: config}, nil
+}
+
+// Run fails, as the processor returns an event for each element of the
+// array, which is only supported by the publisher pipeline.
+func (p *splitArray) Run(event *beat.Event) (*beat.Event, error) {
+	return event, fmt.Errorf("failed in %s: %w", procName, processors.ErrFanOutUnsupported)
+}
+
+// RunFanOut returns an event for each element of the array. The events
+// are copies of the event, with the element in the target field.
+func (p *splitArray) RunFanOut(event *beat.Event) ([]*beat.Event, error) {
+	events, err := p.split(event)
+	if err != nil {
+		if p.IgnoreFailure || (p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound)) {
+			return []*beat.Event{event}, nil
+		}
+		err = fmt.Errorf("failed in %s on the %q field: %w", procName, p.Field, err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return []*beat.Event{event}, err
+	}
+	return events, nil
+}
+
+func (p *splitArray) split(event *beat.Event) ([]*beat.Event, error) {
+	value, err := event.GetValue(p.Field)
+	if err != nil {
+		return nil, err
+	}
+	array := reflect.ValueOf(value)
+	if array.Kind() != reflect.Slice {
+		return nil, errNotArray
+	}
+	if array.Len() == 0 {
+		if p.KeepEmpty {
+			return []*beat.Event{event}, nil
+		}
+		return nil, nil
+	}
+
+	// The array is removed before copying the event, so that it is not
+	// copied for every element.
+	template := event.Clone()
+	if err := template.Delete(p.Field); err != nil {
+		return nil, err
+	}
+
+	events := make([]*beat.Event, array.Len())
+	for i := range events {
+		child := template
+		if i < len(events)-1 {
+			child = template.Clone()
+		}
+		if _, err := child.PutValue(p.TargetField, array.Index(i).Interface()); err != nil {
+			return nil, fmt.Errorf("failed to put element %d into field %q: %w", i, p.TargetField, err)
+		}
+		if p.IndexField != "" {
+			if _, err := child.PutValue(p.IndexField, i); err != nil {
+				return nil, fmt.Errorf("failed to put index into field %q: %w", p.IndexField, err)
+			}
+		}
+		events[i] = child
+	}
+	return events, nil
+}
+
+func (p *splitArray) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
@@ -0,0 +1,157 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package split_array
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	_ "github.com/elastic/beats/v7/libbeat/processors/actions"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func TestSplitArray(t *testing.T) {
+	ts := time.Now()
+	tests := map[string]struct {
+		settings mapstr.M
+		input    mapstr.M
+		want     []mapstr.M
+		wantErr  bool
+	}{
+		"split": {
+			settings: mapstr.M{"field": "records"},
+			input:    mapstr.M{"records": []interface{}{mapstr.M{"a": 1}, mapstr.M{"a": 2}}, "x": "y"},
+			want: []mapstr.M{
+				{"records": mapstr.M{"a": 1}, "x": "y"},
+				{"records": mapstr.M{"a": 2}, "x": "y"},
+			},
+		},
+		"target and index": {
+			settings: mapstr.M{"field": "json.items", "target_field": "item", "index_field": "item_index"},
+			input:    mapstr.M{"json": mapstr.M{"items": []string{"a", "b"}, "id": 1}},
+			want: []mapstr.M{
+				{"json": mapstr.M{"id": 1}, "item": "a", "item_index": 0},
+				{"json": mapstr.M{"id": 1}, "item": "b", "item_index": 1},
+			},
+		},
+		"empty array": {
+			settings: mapstr.M{"field": "records"},
+			input:    mapstr.M{"records": []interface{}{}},
+			want:     nil,
+		},
+		"keep empty array": {
+			settings: mapstr.M{"field": "records", "keep_empty": true},
+			input:    mapstr.M{"records": []interface{}{}},
+			want:     []mapstr.M{{"records": []interface{}{}}},
+		},
+		"missing field": {
+			settings: mapstr.M{"field": "records", "ignore_missing": true},
+			input:    mapstr.M{"x": "y"},
+			want:     []mapstr.M{{"x": "y"}},
+		},
+		"not an array": {
+			settings: mapstr.M{"field": "records"},
+			input:    mapstr.M{"records": "a"},
+			want: []mapstr.M{{
+				"records": "a",
+				"error":   mapstr.M{"message": `failed in split_array on the "records" field: field value is not an array`},
+			}},
+			wantErr: true,
+		},
+		"ignore failure": {
+			settings: mapstr.M{"field": "records", "ignore_failure": true},
+			input:    mapstr.M{"records": "a"},
+			want:     []mapstr.M{{"records": "a"}},
+		},
+	}
+
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			p, err := New(conf.MustNewConfigFrom(tc.settings), logptest.NewTestingLogger(t, ""))
+			require.NoError(t, err)
+
+			event := &beat.Event{
+				Timestamp: ts,
+				Meta:      mapstr.M{"_id": "abc"},
+				Fields:    tc.input,
+				Private:   "private",
+			}
+			events, err := p.(beat.FanOutProcessor).RunFanOut(event)
+			if tc.wantErr {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+			}
+
+			var got []mapstr.M
+			for _, e := range events {
+				got = append(got, e.Fields)
+				assert.Equal(t, ts, e.Timestamp)
+				assert.Equal(t, mapstr.M{"_id": "abc"}, e.Meta)
+				assert.Equal(t, "private", e.Private)
+			}
+			assert.Equal(t, tc.want, got)
+		})
+	}
+}
+
+func TestSplitArrayRun(t *testing.T) {
+	p, err := New(conf.MustNewConfigFrom(mapstr.M{"field": "records"}), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	_, err = p.Run(&beat.Event{Fields: mapstr.M{"records": []string{"a"}}})
+	assert.ErrorIs(t, err, processors.ErrFanOutUnsupported)
+}
+
+func TestSplitArrayInProcessors(t *testing.T) {
+	// Conditions and if/then/else processors pass the events on.
+	var cfg processors.PluginConfig
+	require.NoError(t, conf.MustNewConfigFrom([]mapstr.M{
+		{"split_array": mapstr.M{"field": "records", "when.has_fields": []string{"records"}}},
+		{
+			"if":   mapstr.M{"equals.records": "b"},
+			"then": []mapstr.M{{"split_array": mapstr.M{"field": "parts"}}},
+		},
+		{"add_fields": mapstr.M{"target": "", "fields": mapstr.M{"done": true}}},
+	}).Unpack(&cfg))
+	procs, err := processors.New(cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	require.True(t, processors.FansOut(procs))
+
+	events, err := procs.RunFanOut(&beat.Event{Fields: mapstr.M{
+		"records": []string{"a", "b"},
+		"parts":   []int{1, 2},
+	}})
+	require.NoError(t, err)
+
+	var got []mapstr.M
+	for _, e := range events {
+		got = append(got, e.Fields)
+	}
+	assert.Equal(t, []mapstr.M{
+		{"records": "a", "parts": []int{1, 2}, "done": true},
+		{"records": "b", "parts": 1, "done": true},
+		{"records": "b", "parts": 2, "done": true},
+	}, got)
+}
@@ -0,0 +1,209 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	_ "embed"
+	"fmt"
+	"regexp"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// bundledRegexes are the uap-core regular expressions.
+//
+//go:embed regexes.yaml
+var bundledRegexes []byte
+
+// regexFile is the format of uap-core regexes files. The replacements can
+// reference the groups of the regular expression with $1 to $9.
+type regexFile struct {
+	UserAgentParsers []struct {
+		Regex             string `yaml:"regex"`
+		RegexFlag         string `yaml:"regex_flag"`
+		FamilyReplacement string `yaml:"family_replacement"`
+		V1Replacement     string `yaml:"v1_replacement"`
+		V2Replacement     string `yaml:"v2_replacement"`
+		V3Replacement     string `yaml:"v3_replacement"`
+		V4Replacement     string `yaml:"v4_replacement"`
+	} `yaml:"user_agent_parsers"`
+	OSParsers []struct {
+		Regex           string `yaml:"regex"`
+		RegexFlag       string `yaml:"regex_flag"`
+		OSReplacement   string `yaml:"os_replacement"`
+		OSV1Replacement string `yaml:"os_v1_replacement"`
+		OSV2Replacement string `yaml:"os_v2_replacement"`
+		OSV3Replacement string `yaml:"os_v3_replacement"`
+		OSV4Replacement string `yaml:"os_v4_replacement"`
+	} `yaml:"os_parsers"`
+	DeviceParsers []struct {
+		Regex             string `yaml:"regex"`
+		RegexFlag         string `yaml:"regex_flag"`
+		DeviceReplacement string `yaml:"device_replacement"`
+	} `yaml:"device_parsers"`
+}
+
+// rule is a regular expression of a regexes file, with the replacements of
+// the values it extracts. Values without replacement are the groups of the
+// regular expression, in order.
+type rule struct {
+	re           *regexp.Regexp
+	replacements []string
+}
+
+func newRule(expr, flag string, replacements ...string) (rule, error) {
+	if flag != "" {
+		expr = "(?" + flag + ")" + expr
+	}
+	re, err := regexp.Compile(expr)
+	if err != nil {
+		return rule{}, err
+	}
+	return rule{re: re, replacements: replacements}, nil
+}
+
+// match returns the values extracted from s, or nil if the rule doesn't
+// match.
+func (r *rule) match(s string) []string {
+	loc := r.re.FindStringSubmatchIndex(s)
+	if loc == nil {
+		return nil
+	}
+	values := make([]string, len(r.replacements))
+	for i, replacement := range r.replacements {
+		if replacement != "" {
+			values[i] = strings.TrimSpace(expand(replacement, s, loc))
+		} else {
+			values[i] = group(s, loc, i+1)
+		}
+	}
+	return values
+}
+
+// expand replaces the $1 to $9 references of template with the groups of
+// the match. Unlike regexp.Regexp.Expand, a reference followed by letters,
+// like $1b, is still a reference to a group.
+func expand(template, s string, loc []int) string {
+	if !strings.Contains(template, "$") {
+		return template
+	}
+	var b strings.Builder
+	for i := 0; i < len(template); i++ {
+		c := template[i]
+		if c == '$' && i+1 < len(template) && template[i+1] >= '1' && template[i+1] <= '9' {
+			b.WriteString(group(s, loc, int(template[i+1]-'0')))
+			i++
+			continue
+		}
+		b.WriteByte(c)
+	}
+	return b.String()
+}
+
+func group(s string, loc []int, n int) string {
+	if 2*n+1 >= len(loc) || loc[2*n] < 0 {
+		return ""
+	}
+	return s[loc[2*n]:loc[2*n+1]]
+}
+
+// parser parses user agents with the rules of a regexes file. The first
+// matching rule of each kind is used.
+type parser struct {
+	userAgent []rule
+	os        []rule
+	device    []rule
+}
+
+func newParser(data []byte) (*parser, error) {
+	var f regexFile
+	if err := yaml.Unmarshal(data, &f); err != nil {
+		return nil, err
+	}
+	if len(f.UserAgentParsers) == 0 && len(f.OSParsers) == 0 && len(f.DeviceParsers) == 0 {
+		return nil, fmt.Errorf("no parsers found")
+	}
+
+	p := &parser{}
+	for i, r := range f.UserAgentParsers {
+		rule, err := newRule(r.Regex, r.RegexFlag, r.FamilyReplacement, r.V1Replacement, r.V2Replacement, r.V3Replacement, r.V4Replacement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid user agent parser %d: %w", i, err)
+		}
+		p.userAgent = append(p.userAgent, rule)
+	}
+	for i, r := range f.OSParsers {
+		rule, err := newRule(r.Regex, r.RegexFlag, r.OSReplacement, r.OSV1Replacement, r.OSV2Replacement, r.OSV3Replacement, r.OSV4Replacement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid OS parser %d: %w", i, err)
+		}
+		p.os = append(p.os, rule)
+	}
+	for i, r := range f.DeviceParsers {
+		rule, err := newRule(r.Regex, r.RegexFlag, r.DeviceReplacement)
+		if err != nil {
+			return nil, fmt.Errorf("invalid device parser %d: %w", i, err)
+		}
+		p.device = append(p.device, rule)
+	}
+	return p, nil
+}
+
+// userAgent is a parsed user agent. Empty strings are unknown values.
+type userAgent struct {
+	name       string
+	version    string
+	osName     string
+	osVersion  string
+	deviceName string
+}
+
+func (p *parser) parse(s string) *userAgent {
+	ua := &userAgent{}
+	if values := firstMatch(p.userAgent, s); values != nil && values[0] != "" {
+		ua.name = values[0]
+		ua.version = version(values[1:])
+	}
+	if values := firstMatch(p.os, s); values != nil && values[0] != "" {
+		ua.osName = values[0]
+		ua.osVersion = version(values[1:])
+	}
+	if values := firstMatch(p.device, s); values != nil {
+		ua.deviceName = values[0]
+	}
+	return ua
+}
+
+func firstMatch(rules []rule, s string) []string {
+	for i := range rules {
+		if values := rules[i].match(s); values != nil {
+			return values
+		}
+	}
+	return nil
+}
+
+// version joins the version parts up to the first missing part with dots.
+func version(parts []string) string {
+	n := 0
+	for n < len(parts) && parts[n] != "" {
+		n++
+	}
+	return strings.Join(parts[:n], ".")
+}
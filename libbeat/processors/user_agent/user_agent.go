@@ -0,0 +1,193 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"sync"
+
+	lru "github.com/hashicorp/golang-lru/v2"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+	"github.com/elastic/beats/v7/libbeat/processors/checks"
+	jsprocessor "github.com/elastic/beats/v7/libbeat/processors/script/javascript/module/processor/registry"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/paths"
+)
+
+const procName = "user_agent"
+
+// unknown is the name of user agents, operating systems and devices that
+// are not matched by any rule, like in the Elasticsearch user_agent
+// processor.
+const unknown = "Other"
+
+var errFieldIsNotString = errors.New("field value is not a string")
+
+// bundledParser is shared by all processors that use the bundled regexes.
+var bundledParser = sync.OnceValues(func() (*parser, error) {
+	return newParser(bundledRegexes)
+})
+
+type config struct {
+	Field         string `config:"field"`
+	TargetField   string `config:"target_field"`
+	RegexFile     string `config:"regex_file"`
+	CacheSize     int    `config:"cache_size" validate:"min=0"`
+	IgnoreMissing bool   `config:"ignore_missing"`
+	IgnoreFailure bool   `config:"ignore_failure"`
+}
+
+func defaultConfig() config {
+	return config{
+		Field:       "user_agent.original",
+		TargetField: "user_agent",
+		CacheSize:   10000,
+	}
+}
+
+type userAgentProcessor struct {
+	config
+	parser *parser
+	cache  *lru.Cache[string, *userAgent]
+}
+
+func init() {
+	processors.RegisterPlugin(procName,
+		checks.ConfigChecked(New,
+			checks.AllowedFields(
+				"field", "target_field", "regex_file", "cache_size",
+				"ignore_missing", "ignore_failure", "when",
+			)))
+	jsprocessor.RegisterPlugin("UserAgent", New)
+}
+
+// New constructs a new user_agent processor.
+func New(c *conf.C, log *logp.Logger) (beat.Processor, error) {
+	config := defaultConfig()
+	if err := c.Unpack(&config); err != nil {
+		return nil, fmt.Errorf("fail to unpack the "+procName+" processor configuration: %w", err)
+	}
+
+	p := &userAgentProcessor{config: config}
+	if config.RegexFile == "" {
+		parser, err := bundledParser()
+		if err != nil {
+			return nil, fmt.Errorf("failed to load the bundled regexes: %w", err)
+		}
+		p.parser = parser
+	} else {
+		path := paths.Resolve(paths.Config, config.RegexFile)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read regex_file: %w", err)
+		}
+		if p.parser, err = newParser(data); err != nil {
+			return nil, fmt.Errorf("failed to load regex_file %v: %w", path, err)
+		}
+	}
+	if config.CacheSize > 0 {
+		// The size is positive, so this can't fail.
+		p.cache, _ = lru.New[string, *userAgent](config.CacheSize)
+	}
+	return p, nil
+}
+
+func (p *userAgentProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	if err := p.run(event); err != nil && !p.IgnoreFailure {
+		err = fmt.Errorf("failed in %s on the %q field: %w", procName, p.Field, err)
+		_, _ = event.PutValue("error.message", err.Error())
+		return event, err
+	}
+	return event, nil
+}
+
+func (p *userAgentProcessor) run(event *beat.Event) error {
+	data, err := event.GetValue(p.Field)
+	if err != nil {
+		if p.IgnoreMissing && errors.Is(err, mapstr.ErrKeyNotFound) {
+			return nil
+		}
+		return err
+	}
+
+	original, ok := data.(string)
+	if !ok {
+		return errFieldIsNotString
+	}
+
+	ua := p.parse(original)
+	fields := mapstr.M{
+		"original":    original,
+		"name":        orUnknown(ua.name),
+		"os.name":     orUnknown(ua.osName),
+		"device.name": orUnknown(ua.deviceName),
+	}
+	if ua.version != "" {
+		fields["version"] = ua.version
+	}
+	if ua.osName != "" {
+		fields["os.full"] = ua.osName
+		if ua.osVersion != "" {
+			fields["os.version"] = ua.osVersion
+			fields["os.full"] = ua.osName + " " + ua.osVersion
+		}
+	}
+
+	prefix := ""
+	if p.TargetField != "" {
+		prefix = p.TargetField + "."
+	}
+	for k, v := range fields {
+		if _, err := event.PutValue(prefix+k, v); err != nil {
+			return fmt.Errorf("failed to put value into field %q: %w", prefix+k, err)
+		}
+	}
+	return nil
+}
+
+// parse returns the parsed user agent, from the cache if possible.
+func (p *userAgentProcessor) parse(s string) *userAgent {
+	if p.cache == nil {
+		return p.parser.parse(s)
+	}
+	if ua, ok := p.cache.Get(s); ok {
+		return ua
+	}
+	ua := p.parser.parse(s)
+	p.cache.Add(s, ua)
+	return ua
+}
+
+func orUnknown(s string) string {
+	if s == "" {
+		return unknown
+	}
+	return s
+}
+
+func (p *userAgentProcessor) String() string {
+	json, _ := json.Marshal(p.config)
+	return procName + "=" + string(json)
+}
@@ -0,0 +1,269 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package user_agent
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+)
+
+func newTestProcessor(t testing.TB, c map[string]interface{}) beat.Processor {
+	t.Helper()
+	p, err := New(conf.MustNewConfigFrom(c), logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return p
+}
+
+func TestUserAgent(t *testing.T) {
+	tests := map[string]struct {
+		original string
+		want     mapstr.M
+	}{
+		"chrome on windows": {
+			original: "Mozilla/5.0 (Windows NT 10.0; Win64; x64) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.6099.109 Safari/537.36",
+			want: mapstr.M{
+				"name":    "Chrome",
+				"version": "120.0.6099.109",
+				"os":      mapstr.M{"name": "Windows", "version": "10", "full": "Windows 10"},
+				"device":  mapstr.M{"name": "Other"},
+			},
+		},
+		"safari on iphone": {
+			original: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_1_2 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.1.2 Mobile/15E148 Safari/604.1",
+			want: mapstr.M{
+				"name":    "Mobile Safari",
+				"version": "17.1.2",
+				"os":      mapstr.M{"name": "iOS", "version": "17.1.2", "full": "iOS 17.1.2"},
+				"device":  mapstr.M{"name": "iPhone"},
+			},
+		},
+		"chrome on android": {
+			original: "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36",
+			want: mapstr.M{
+				"name":    "Chrome Mobile",
+				"version": "120.0.0.0",
+				"os":      mapstr.M{"name": "Android", "version": "14", "full": "Android 14"},
+				"device":  mapstr.M{"name": "Pixel 8"},
+			},
+		},
+		"bot": {
+			original: "Mozilla/5.0 (compatible; Googlebot/2.1; +http://www.google.com/bot.html)",
+			want: mapstr.M{
+				"name":    "Googlebot",
+				"version": "2.1",
+				"os":      mapstr.M{"name": "Other"},
+				"device":  mapstr.M{"name": "Spider"},
+			},
+		},
+		"unknown": {
+			original: "something",
+			want: mapstr.M{
+				"name":   "Other",
+				"os":     mapstr.M{"name": "Other"},
+				"device": mapstr.M{"name": "Other"},
+			},
+		},
+	}
+
+	p := newTestProcessor(t, map[string]interface{}{})
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			// The second run is served from the cache.
+			for i := 0; i < 2; i++ {
+				event, err := p.Run(&beat.Event{Fields: mapstr.M{
+					"user_agent": mapstr.M{"original": test.original},
+				}})
+				require.NoError(t, err)
+
+				want := test.want.Clone()
+				want["original"] = test.original
+				assert.Equal(t, mapstr.M{"user_agent": want}, event.Fields)
+			}
+		})
+	}
+}
+
+func TestSettings(t *testing.T) {
+	const original = "curl/8.4.0"
+
+	tests := map[string]struct {
+		config map[string]interface{}
+		input  mapstr.M
+		want   mapstr.M
+		err    string
+	}{
+		"field and target": {
+			config: map[string]interface{}{"field": "http.user_agent", "target_field": "ua", "cache_size": 0},
+			input:  mapstr.M{"http": mapstr.M{"user_agent": original}},
+			want: mapstr.M{
+				"http": mapstr.M{"user_agent": original},
+				"ua": mapstr.M{
+					"original": original,
+					"name":     "curl",
+					"version":  "8.4.0",
+					"os":       mapstr.M{"name": "Other"},
+					"device":   mapstr.M{"name": "Other"},
+				},
+			},
+		},
+		"root target": {
+			config: map[string]interface{}{"field": "agent", "target_field": ""},
+			input:  mapstr.M{"agent": original},
+			want: mapstr.M{
+				"agent":    original,
+				"original": original,
+				"name":     "curl",
+				"version":  "8.4.0",
+				"os":       mapstr.M{"name": "Other"},
+				"device":   mapstr.M{"name": "Other"},
+			},
+		},
+		"missing field": {
+			config: map[string]interface{}{},
+			input:  mapstr.M{"message": "hello"},
+			want: mapstr.M{
+				"message": "hello",
+				"error":   mapstr.M{"message": `failed in user_agent on the "user_agent.original" field: key not found`},
+			},
+			err: "key not found",
+		},
+		"ignore missing": {
+			config: map[string]interface{}{"ignore_missing": true},
+			input:  mapstr.M{"message": "hello"},
+			want:   mapstr.M{"message": "hello"},
+		},
+		"not a string": {
+			config: map[string]interface{}{"field": "agent"},
+			input:  mapstr.M{"agent": 1},
+			want: mapstr.M{
+				"agent": 1,
+				"error": mapstr.M{"message": `failed in user_agent on the "agent" field: field value is not a string`},
+			},
+			err: "not a string",
+		},
+		"ignore failure": {
+			config: map[string]interface{}{"field": "agent", "ignore_failure": true},
+			input:  mapstr.M{"agent": 1},
+			want:   mapstr.M{"agent": 1},
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			p := newTestProcessor(t, test.config)
+			event, err := p.Run(&beat.Event{Fields: test.input})
+			if test.err != "" {
+				assert.ErrorContains(t, err, test.err)
+			} else {
+				assert.NoError(t, err)
+			}
+			assert.Equal(t, test.want, event.Fields)
+		})
+	}
+}
+
+func TestRegexFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "regexes.yaml")
+	require.NoError(t, os.WriteFile(path, []byte(`
+user_agent_parsers:
+  - regex: '(InternalApp)/(\d+)\.(\d+)'
+  - regex: 'probe-(\w+)'
+    family_replacement: 'Probe $1b'
+    v1_replacement: '1'
+os_parsers:
+  - regex: 'os=(\w+)'
+    regex_flag: 'i'
+device_parsers:
+  - regex: 'device=(\w+)'
+    device_replacement: 'Device $1'
+`), 0o600))
+
+	p := newTestProcessor(t, map[string]interface{}{"regex_file": path})
+
+	tests := map[string]mapstr.M{
+		"InternalApp/2.3 OS=linux device=kiosk": {
+			"name":    "InternalApp",
+			"version": "2.3",
+			"os":      mapstr.M{"name": "linux", "full": "linux"},
+			"device":  mapstr.M{"name": "Device kiosk"},
+		},
+		"probe-health": {
+			"name":    "Probe healthb",
+			"version": "1",
+			"os":      mapstr.M{"name": "Other"},
+			"device":  mapstr.M{"name": "Other"},
+		},
+		// The bundled regexes are not used.
+		"curl/8.4.0": {
+			"name":   "Other",
+			"os":     mapstr.M{"name": "Other"},
+			"device": mapstr.M{"name": "Other"},
+		},
+	}
+	for original, want := range tests {
+		event, err := p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": original}}})
+		require.NoError(t, err)
+		want["original"] = original
+		assert.Equal(t, mapstr.M{"user_agent": want}, event.Fields, original)
+	}
+}
+
+func TestRegexFileErrors(t *testing.T) {
+	dir := t.TempDir()
+	tests := map[string]string{
+		"invalid yaml":  "user_agent_parsers: [",
+		"no parsers":    "other: 1",
+		"invalid regex": "user_agent_parsers:\n  - regex: '('",
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			path := filepath.Join(dir, name+".yaml")
+			require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+			_, err := New(conf.MustNewConfigFrom(map[string]interface{}{"regex_file": path}), logptest.NewTestingLogger(t, ""))
+			assert.Error(t, err)
+		})
+	}
+
+	_, err := New(conf.MustNewConfigFrom(map[string]interface{}{"regex_file": filepath.Join(dir, "missing.yaml")}), logptest.NewTestingLogger(t, ""))
+	assert.ErrorContains(t, err, "failed to read regex_file")
+}
+
+func BenchmarkUserAgent(b *testing.B) {
+	const original = "Mozilla/5.0 (Linux; Android 14; Pixel 8) AppleWebKit/537.36 (KHTML, like Gecko) Chrome/120.0.0.0 Mobile Safari/537.36"
+
+	for name, cacheSize := range map[string]int{"cache": 10000, "no cache": 0} {
+		b.Run(name, func(b *testing.B) {
+			p := newTestProcessor(b, map[string]interface{}{"cache_size": cacheSize})
+			b.ReportAllocs()
+			for b.Loop() {
+				if _, err := p.Run(&beat.Event{Fields: mapstr.M{"user_agent": mapstr.M{"original": original}}}); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
@@ -40,6 +40,10 @@ type client struct {
 	eventFlags publisher.EventFlags
 	canDrop    bool
 
+	// fanOut is set if the processors can replace an event with several
+	// events.
+	fanOut *fanOutACKer
+
 	// Open state, signaling, and sync primitives for coordinating client Close.
 	isOpen atomic.Bool // set to false during shutdown, such that no new events will be accepted anymore.
 
@@ -87,6 +91,11 @@ func (c *client) publish(e beat.Event) {
 		return
 	}
 
+	if c.fanOut != nil {
+		c.publishFanOut(e)
+		return
+	}
+
 	if c.processors != nil {
 		var err error
 
@@ -129,6 +138,62 @@ func (c *client) publish(e beat.Event) {
 	}
 }
 
+// publishFanOut publishes the events replacing e. The event listener is
+// informed once about e, and e is ACKed once all the events replacing it
+// are ACKed. If any of them is dropped on publish, e is never ACKed, like
+// events dropped on publish without fan-out. The events inherit the
+// private data of e.
+func (c *client) publishFanOut(e beat.Event) {
+	events, err := c.processors.(beat.FanOutProcessor).RunFanOut(&e)
+	if err != nil {
+		c.logger.Errorf("Failed to publish event: %v", err)
+	}
+
+	if len(events) == 0 {
+		c.eventListener.AddEvent(e, false)
+		c.onFilteredOut()
+		return
+	}
+
+	for _, event := range events {
+		event.Private = e.Private
+	}
+	c.eventListener.AddEvent(*events[0], true)
+
+	entry := c.fanOut.add(len(events))
+	failed := false
+	for _, event := range events {
+		pubEvent := publisher.Event{
+			Content: *event,
+			Flags:   c.eventFlags,
+		}
+
+		var published bool
+		if c.canDrop {
+			_, published = c.producer.TryPublish(pubEvent)
+		} else {
+			_, published = c.producer.Publish(pubEvent)
+		}
+
+		if published {
+			c.onPublished()
+			continue
+		}
+		// e is counted as active event once, so it is failed once.
+		if !failed {
+			failed = true
+			c.observer.failedPublishEvent()
+		}
+		c.clientListener.DroppedOnPublish(*event)
+		// Dropping the event can complete client events following e
+		// whose events were ACKed already.
+		if acked := c.fanOut.drop(entry); acked > 0 {
+			c.observer.eventsACKed(acked)
+			c.eventListener.ACKEvents(acked)
+		}
+	}
+}
+
 func (c *client) Close() error {
 	if c.isOpen.Swap(false) {
 		// Only do shutdown handling the first time Close is called
@@ -20,8 +20,10 @@ package pipeline
 import (
 	"errors"
 	"fmt"
+	"regexp"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
 	"github.com/elastic/beats/v7/libbeat/processors"
 	"github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/mapstr"
@@ -35,6 +37,41 @@ type Config struct {
 
 	// Event queue
 	Queue config.Namespace `config:"queue"`
+
+	// Outputs configures multiple named outputs events are routed to. If
+	// set, the single `output` setting must not be used.
+	Outputs []RouteConfig `config:"outputs"`
+}
+
+// RouteConfig configures a named output and the condition selecting the
+// events sent to it. Routes without condition receive all events.
+type RouteConfig struct {
+	Name   string             `config:"name" validate:"required"`
+	When   *conditions.Config `config:"when"`
+	Output config.Namespace   `config:"output"`
+}
+
+var validRouteName = regexp.MustCompile(`^[a-zA-Z0-9_-]+$`)
+
+func (c *Config) Validate() error {
+	names := make(map[string]struct{}, len(c.Outputs))
+	for _, route := range c.Outputs {
+		if _, exists := names[route.Name]; exists {
+			return fmt.Errorf("output route '%v' is configured multiple times", route.Name)
+		}
+		names[route.Name] = struct{}{}
+	}
+	return nil
+}
+
+func (c *RouteConfig) Validate() error {
+	if !validRouteName.MatchString(c.Name) {
+		return fmt.Errorf("invalid output route name '%v', only letters, digits, '_' and '-' are allowed", c.Name)
+	}
+	if !c.Output.IsSet() {
+		return fmt.Errorf("output route '%v' has no output configured", c.Name)
+	}
+	return nil
 }
 
 // validateClientConfig checks a ClientConfig can be used with (*Pipeline).ConnectWith.
@@ -104,7 +104,7 @@ func newOutputController(
 func (c *outputController) WaitClose(timeout time.Duration) error {
 	// First: signal the queue that we're shutting down, and wait up to the
 	// given duration for it to drain and process ACKs.
-	c.closeQueue(timeout)
+	queueClosed := c.closeQueue(timeout)
 
 	// We've drained the queue as much as we can, signal eventConsumer to
 	// close, and wait for it to finish. After consumer.close returns,
@@ -112,6 +112,12 @@ func (c *outputController) WaitClose(timeout time.Duration) error {
 	c.consumer.close()
 	close(c.workerChan)
 
+	// Once the queue has shut down, the queue reader can't be blocked in a
+	// read anymore, so it is safe to wait for it to stop.
+	if queueClosed {
+		<-c.consumer.queueReader.done
+	}
+
 	// Signal the output workers to close.
 	for _, out := range c.workers {
 		out.Close()
@@ -188,14 +194,16 @@ func (c *outputController) Reload(
 }
 
 // Close the queue, waiting up to the specified timeout for pending events
-// to complete.
-func (c *outputController) closeQueue(timeout time.Duration) {
+// to complete. Returns true if the queue has shut down.
+func (c *outputController) closeQueue(timeout time.Duration) bool {
 	c.queueLock.Lock()
 	defer c.queueLock.Unlock()
+	closed := false
 	if c.queue != nil {
 		c.queue.Close()
 		select {
 		case <-c.queue.Done():
+			closed = true
 		case <-time.After(timeout):
 		}
 	}
@@ -206,6 +214,7 @@ func (c *outputController) closeQueue(timeout time.Duration) {
 		// real error to the caller.
 		req.responseChan <- nil
 	}
+	return closed
 }
 
 // queueProducer creates a queue producer with the given config, blocking
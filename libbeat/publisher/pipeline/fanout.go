@@ -0,0 +1,107 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/processors"
+)
+
+// fansOut reports whether the processors of a client can replace an event
+// with several events.
+func fansOut(p beat.Processor) bool {
+	if p == nil {
+		return false
+	}
+	_, ok := p.(beat.FanOutProcessor)
+	return ok && processors.FansOut(p)
+}
+
+// fanOutACKer maps the ACKs of the events published to the queue to the
+// events published by a client, whose processors can replace an event with
+// several events. An event of the client is ACKed once all of the events
+// replacing it have been ACKed or dropped.
+type fanOutACKer struct {
+	mu sync.Mutex
+	// pending holds the client events that have not been ACKed yet, in
+	// publishing order.
+	pending []*fanOutEntry
+}
+
+// fanOutEntry tracks the number of events replacing a client event, that
+// are neither ACKed nor dropped yet. The client event is failed if any of
+// these events was dropped on publish, it is never ACKed then.
+type fanOutEntry struct {
+	remaining int
+	failed    bool
+}
+
+// add registers a client event replaced by n events. It must be called
+// before the events are published, as the queue might ACK them before
+// Publish returns.
+func (a *fanOutACKer) add(n int) *fanOutEntry {
+	entry := &fanOutEntry{remaining: n}
+	a.mu.Lock()
+	a.pending = append(a.pending, entry)
+	a.mu.Unlock()
+	return entry
+}
+
+// drop marks one of the events of the entry as dropped on publish, which
+// fails the entry, and returns the number of client events that are ACKed
+// as a result.
+func (a *fanOutACKer) drop(entry *fanOutEntry) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	entry.remaining--
+	entry.failed = true
+	return a.collectACKedLocked()
+}
+
+// ack marks count events ACKed by the queue, and returns the number of
+// client events that are ACKed as a result.
+func (a *fanOutACKer) ack(count int) int {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	for _, entry := range a.pending {
+		if count == 0 {
+			break
+		}
+		n := min(count, entry.remaining)
+		entry.remaining -= n
+		count -= n
+	}
+	return a.collectACKedLocked()
+}
+
+// collectACKedLocked removes the client events from the head of the
+// pending list whose events have all been ACKed or dropped, and returns the
+// number of removed events that are not failed.
+func (a *fanOutACKer) collectACKedLocked() int {
+	done, acked := 0, 0
+	for done < len(a.pending) && a.pending[done].remaining <= 0 {
+		if !a.pending[done].failed {
+			acked++
+		}
+		done++
+	}
+	a.pending = a.pending[done:]
+	return acked
+}
@@ -0,0 +1,246 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func TestFanOutACKer(t *testing.T) {
+	var a fanOutACKer
+	a.add(3)
+	a.add(1)
+	assert.Equal(t, 0, a.ack(2))
+	// The last event of the first client event and the second client event.
+	assert.Equal(t, 2, a.ack(2))
+
+	// A client event with a dropped event is never ACKed.
+	first := a.add(2)
+	a.add(1)
+	assert.Equal(t, 0, a.drop(first))
+	assert.Equal(t, 0, a.ack(1))
+	assert.Equal(t, 1, a.ack(1))
+	assert.Empty(t, a.pending)
+}
+
+// splitProcessor replaces events with one event per element of their
+// "parts" field, and drops events without parts.
+type splitProcessor struct{}
+
+func (splitProcessor) String() string { return "split" }
+
+func (splitProcessor) Run(event *beat.Event) (*beat.Event, error) {
+	return event, nil
+}
+
+func (splitProcessor) RunFanOut(event *beat.Event) ([]*beat.Event, error) {
+	var events []*beat.Event
+	parts, _ := event.Fields["parts"].([]string)
+	for _, part := range parts {
+		child := event.Clone()
+		child.Fields["parts"] = part
+		events = append(events, child)
+	}
+	return events, nil
+}
+
+// fanOutTest publishes events through a pipeline splitting them with
+// splitProcessor, and records the batches received by the output and the
+// private data of the ACKed events.
+type fanOutTest struct {
+	t        *testing.T
+	metrics  *monitoring.Registry
+	pipeline *Pipeline
+	client   beat.Client
+
+	mu      sync.Mutex
+	batches []publisher.Batch
+	parts   []interface{}
+	acked   []interface{}
+}
+
+func newFanOutTest(t *testing.T) *fanOutTest {
+	ft := &fanOutTest{t: t, metrics: monitoring.NewRegistry()}
+
+	logger := logptest.NewTestingLogger(t, "")
+	p, err := New(beat.Info{Logger: logger},
+		Monitors{Metrics: ft.metrics},
+		conf.Namespace{},
+		outputs.Group{},
+		Settings{Processors: testProcessorSupporter{splitProcessor{}}},
+	)
+	require.NoError(t, err)
+	p.outputController.queue = memqueue.NewQueue(logger, nil, memqueue.Settings{Events: 10}, 0, nil)
+	ft.pipeline = p
+	t.Cleanup(func() { p.Close() })
+
+	output := newMockClient(func(batch publisher.Batch) error {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		for _, event := range batch.Events() {
+			ft.parts = append(ft.parts, event.Content.Fields["parts"])
+			// Children inherit the private data of their event.
+			assert.Equal(t, event.Content.Fields["id"], event.Content.Private)
+		}
+		ft.batches = append(ft.batches, batch)
+		return nil
+	})
+	p.outputController.Set(outputs.Group{Clients: []outputs.Client{output}, BatchSize: 1})
+	t.Cleanup(func() {
+		p.outputController.Set(outputs.Group{})
+		output.Close()
+	})
+
+	client, err := p.ConnectWith(beat.ClientConfig{
+		EventListener: acker.EventPrivateReporter(func(_ int, data []interface{}) {
+			ft.mu.Lock()
+			ft.acked = append(ft.acked, data...)
+			ft.mu.Unlock()
+		}),
+	})
+	require.NoError(t, err)
+	ft.client = client
+	t.Cleanup(func() { client.Close() })
+	return ft
+}
+
+// waitFor waits for the output to receive n batches and returns them.
+func (ft *fanOutTest) waitFor(n int) []publisher.Batch {
+	ft.t.Helper()
+	var got []publisher.Batch
+	require.Eventually(ft.t, func() bool {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		got = append(got, ft.batches...)
+		n -= len(ft.batches)
+		ft.batches = nil
+		return n <= 0
+	}, 10*time.Second, time.Millisecond)
+	return got
+}
+
+// waitForACKed waits for the private data of the ACKed events to match
+// expected.
+func (ft *fanOutTest) waitForACKed(expected ...interface{}) {
+	ft.t.Helper()
+	require.Eventually(ft.t, func() bool {
+		ft.mu.Lock()
+		defer ft.mu.Unlock()
+		return assert.ObjectsAreEqual(expected, ft.acked)
+	}, 10*time.Second, time.Millisecond)
+}
+
+func (ft *fanOutTest) metric(name string) uint64 {
+	return ft.metrics.GetRegistry("pipeline").Get(name).(*monitoring.Uint).Get()
+}
+
+func TestClientFanOut(t *testing.T) {
+	ft := newFanOutTest(t)
+	ft.client.PublishAll([]beat.Event{
+		{Fields: mapstr.M{"id": "c", "parts": []string{"c1"}}, Private: "c"},
+		{Fields: mapstr.M{"id": "a", "parts": []string{"a1", "a2", "a3"}}, Private: "a"},
+		{Fields: mapstr.M{"id": "b"}, Private: "b"},
+	})
+
+	received := ft.waitFor(4)
+	assert.Equal(t, []interface{}{"c1", "a1", "a2", "a3"}, ft.parts)
+	// Active events are counted per client event.
+	assert.Equal(t, uint64(2), ft.metric("events.active"))
+
+	// The queue ACKs batches in order, so the first two batches of a are
+	// ACKed together with c once c's batch is ACKed. a is only ACKed once
+	// all of its children are.
+	received[1].ACK()
+	received[2].ACK()
+	received[0].ACK()
+	ft.waitForACKed("c")
+	assert.Equal(t, uint64(1), ft.metric("events.active"))
+
+	received[3].ACK()
+	ft.waitForACKed("c", "a", "b")
+	assert.Equal(t, uint64(0), ft.metric("events.active"))
+}
+
+// closingProducer closes the wrapped producer after publishing limit events,
+// and fails later publishes like a closed producer.
+type closingProducer struct {
+	queue.Producer
+	limit  int
+	closed bool
+}
+
+func (p *closingProducer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	if p.limit == 0 {
+		p.Close()
+	}
+	if p.closed {
+		return 0, false
+	}
+	p.limit--
+	return p.Producer.Publish(entry)
+}
+
+func (p *closingProducer) Close() {
+	if !p.closed {
+		p.closed = true
+		p.Producer.Close()
+	}
+}
+
+func TestClientFanOutDroppedOnPublish(t *testing.T) {
+	ft := newFanOutTest(t)
+	c := ft.client.(*client)
+	c.producer = &closingProducer{Producer: c.producer, limit: 2}
+
+	ft.client.PublishAll([]beat.Event{
+		{Fields: mapstr.M{"id": "c", "parts": []string{"c1"}}, Private: "c"},
+		{Fields: mapstr.M{"id": "a", "parts": []string{"a1", "a2"}}, Private: "a"},
+	})
+
+	// a2 is dropped, as the producer is closed.
+	received := ft.waitFor(2)
+	assert.Equal(t, []interface{}{"c1", "a1"}, ft.parts)
+	assert.Equal(t, uint64(1), ft.metric("events.failed"))
+
+	// a is never ACKed, even though all of its published events are.
+	received[1].ACK()
+	received[0].ACK()
+	ft.waitForACKed("c")
+	require.Eventually(t, func() bool {
+		return ft.metric("events.active") == 0
+	}, 10*time.Second, time.Millisecond)
+	ft.mu.Lock()
+	assert.Equal(t, []interface{}{"c"}, ft.acked)
+	ft.mu.Unlock()
+}
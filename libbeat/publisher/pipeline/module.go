@@ -19,12 +19,15 @@ package pipeline
 
 import (
 	"flag"
+	"fmt"
 
 	"go.elastic.co/apm/v2"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/conditions"
 	"github.com/elastic/beats/v7/libbeat/outputs"
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
+	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
 	"github.com/elastic/elastic-agent-libs/monitoring"
 )
@@ -45,6 +48,23 @@ type Monitors struct {
 	Tracer    *apm.Tracer
 }
 
+// forRoute returns the monitors used by the output and queue of a route.
+// Metrics and state are reported in a registry per route below `outputs`,
+// so they don't clash with the metrics of other routes.
+func (m Monitors) forRoute(name string) Monitors {
+	routeMonitors := m
+	if m.Metrics != nil {
+		routeMonitors.Metrics = m.Metrics.GetOrCreateRegistry("outputs." + name)
+	}
+	if m.Telemetry != nil {
+		routeMonitors.Telemetry = m.Telemetry.GetOrCreateRegistry("outputs." + name)
+	}
+	if m.Logger != nil {
+		routeMonitors.Logger = m.Logger.With("output.route", name)
+	}
+	return routeMonitors
+}
+
 // OutputFactory is used by the publisher pipeline to create an output instance.
 // If the group returned can be empty. The pipeline will accept events, but
 // eventually block.
@@ -106,6 +126,63 @@ func LoadWithSettings(
 	return p, err
 }
 
+// LoadRoutedWithSettings is the same as LoadWithSettings, but creates a
+// pipeline publishing to the outputs configured in config.Outputs. The
+// makeOutput function is called once per route with the route's output
+// configuration.
+func LoadRoutedWithSettings(
+	beatInfo beat.Info,
+	monitors Monitors,
+	config Config,
+	makeOutput func(outputs.Observer, conf.Namespace) (outputs.Group, error),
+	settings Settings,
+) (*Pipeline, error) {
+	log := monitors.Logger
+	if log == nil {
+		log = logp.L()
+	}
+
+	if publishDisabled {
+		log.Info("Dry run mode. All output types except the file based one are disabled.")
+	}
+
+	routes := make([]Route, 0, len(config.Outputs))
+	for _, routeConfig := range config.Outputs {
+		var condition conditions.Condition
+		if routeConfig.When != nil {
+			var err error
+			condition, err = conditions.NewCondition(routeConfig.When, log)
+			if err != nil {
+				return nil, fmt.Errorf("output route '%v': %w", routeConfig.Name, err)
+			}
+		}
+
+		outputConfig := routeConfig.Output
+		out, err := loadOutput(monitors.forRoute(routeConfig.Name), func(stats outputs.Observer) (string, outputs.Group, error) {
+			out, err := makeOutput(stats, outputConfig)
+			return outputConfig.Name(), out, err
+		})
+		if err != nil {
+			return nil, fmt.Errorf("output route '%v': %w", routeConfig.Name, err)
+		}
+
+		log.Infof("Routing events to output '%v' of type %v", routeConfig.Name, outputConfig.Name())
+		routes = append(routes, Route{
+			Name:      routeConfig.Name,
+			Condition: condition,
+			Output:    out,
+		})
+	}
+
+	p, err := NewRouted(beatInfo, monitors, config.Queue, routes, settings)
+	if err != nil {
+		return nil, err
+	}
+
+	log.Infof("Beat name: %s", beatInfo.Name)
+	return p, nil
+}
+
 func loadOutput(
 	monitors Monitors,
 	makeOutput outputFactory,
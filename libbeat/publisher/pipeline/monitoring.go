@@ -180,6 +180,55 @@ func (o *metricsObserver) eventsRetry(n int) {
 	o.vars.eventsRetry.Add(uint64(n))
 }
 
+// routeObserver reports the metrics of a single output route.
+type routeObserver interface {
+	retryObserver
+
+	// An event matching the route was rejected by the route's queue.
+	rejectedEvent()
+
+	cleanup()
+}
+
+// routeMetricsObserver reports the metrics of an output route in the route's
+// own registry, so they don't clash with the metrics of other routes.
+type routeMetricsObserver struct {
+	metrics *monitoring.Registry
+
+	dropped, retry, rejected *monitoring.Uint
+}
+
+func newRouteMetricsObserver(metrics *monitoring.Registry) *routeMetricsObserver {
+	reg := metrics.GetRegistry("pipeline")
+	if reg == nil {
+		reg = metrics.NewRegistry("pipeline")
+	}
+
+	return &routeMetricsObserver{
+		metrics: metrics,
+
+		// events.retry counts events that an output worker of the route sent
+		// back to be retried.
+		retry: monitoring.NewUint(reg, "events.retry"),
+
+		// events.dropped counts events that were dropped because errors from
+		// the route's output workers exceeded the configured maximum retry count.
+		dropped: monitoring.NewUint(reg, "events.dropped"),
+
+		// events.rejected counts events matching the route that were rejected
+		// by the route's queue, and so never reach its output.
+		rejected: monitoring.NewUint(reg, "events.rejected"),
+	}
+}
+
+func (o *routeMetricsObserver) cleanup() {
+	o.metrics.Remove("pipeline")
+}
+
+func (o *routeMetricsObserver) eventsDropped(n int) { o.dropped.Add(uint64(n)) }
+func (o *routeMetricsObserver) eventsRetry(n int)   { o.retry.Add(uint64(n)) }
+func (o *routeMetricsObserver) rejectedEvent()      { o.rejected.Inc() }
+
 type emptyObserver struct{}
 
 var nilObserver observer = (*emptyObserver)(nil)
@@ -194,3 +243,12 @@ func (*emptyObserver) failedPublishEvent() {}
 func (*emptyObserver) eventsACKed(n int)   {}
 func (*emptyObserver) eventsDropped(int)   {}
 func (*emptyObserver) eventsRetry(int)     {}
+
+type emptyRouteObserver struct{}
+
+var nilRouteObserver routeObserver = (*emptyRouteObserver)(nil)
+
+func (*emptyRouteObserver) cleanup()          {}
+func (*emptyRouteObserver) eventsDropped(int) {}
+func (*emptyRouteObserver) eventsRetry(int)   {}
+func (*emptyRouteObserver) rejectedEvent()    {}
@@ -21,7 +21,10 @@
 package pipeline
 
 import (
+	"errors"
 	"fmt"
+	"path/filepath"
+	"sync"
 	"time"
 
 	"github.com/elastic/beats/v7/libbeat/beat"
@@ -32,9 +35,11 @@ import (
 	"github.com/elastic/beats/v7/libbeat/publisher/processing"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/hybridqueue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
 	conf "github.com/elastic/elastic-agent-libs/config"
 	"github.com/elastic/elastic-agent-libs/logp"
+	"github.com/elastic/elastic-agent-libs/paths"
 )
 
 // Pipeline implementation providint all beats publisher functionality.
@@ -60,6 +65,10 @@ type Pipeline struct {
 
 	outputController *outputController
 
+	// routes are set instead of outputController if the pipeline publishes
+	// events to multiple outputs.
+	routes []*outputRoute
+
 	observer observer
 
 	// If waitCloseTimeout is positive, then the pipeline will wait up to the
@@ -156,6 +165,75 @@ func New(
 	return p, nil
 }
 
+// NewRouted creates a new Pipeline instance publishing events to multiple
+// outputs. Every route gets its own queue, created from userQueueConfig
+// unless the route's output configures a queue. Events are published to
+// all routes whose condition matches, and are ACKed to the client once all
+// of these routes have ACKed them.
+func NewRouted(
+	beat beat.Info,
+	monitors Monitors,
+	userQueueConfig conf.Namespace,
+	routes []Route,
+	settings Settings,
+) (*Pipeline, error) {
+	if len(routes) == 0 {
+		return nil, errors.New("no output routes configured")
+	}
+	if monitors.Logger == nil {
+		monitors.Logger = logp.NewLogger("publish")
+	}
+
+	p := &Pipeline{
+		beatInfo:         beat,
+		monitors:         monitors,
+		observer:         nilObserver,
+		waitCloseTimeout: settings.WaitClose,
+		processors:       settings.Processors,
+	}
+
+	if monitors.Metrics != nil {
+		p.observer = newMetricsObserver(monitors.Metrics)
+	}
+
+	queueType := defaultQueueType
+	if b := userQueueConfig.Name(); b != "" {
+		queueType = b
+	}
+
+	for _, route := range routes {
+		queueConfig, err := routeQueueConfig(route.Name, queueType, userQueueConfig.Config())
+		if err != nil {
+			return nil, err
+		}
+		queueFactory, err := queueFactoryForUserConfig(queueType, queueConfig)
+		if err != nil {
+			return nil, fmt.Errorf("output route '%v': %w", route.Name, err)
+		}
+
+		routeMonitors := monitors.forRoute(route.Name)
+		routeObserver := nilRouteObserver
+		if routeMonitors.Metrics != nil {
+			routeObserver = newRouteMetricsObserver(routeMonitors.Metrics)
+		}
+		output, err := newOutputController(beat, routeMonitors, routeObserver, queueFactory, settings.InputQueueSize)
+		if err != nil {
+			return nil, err
+		}
+		output.Set(route.Output)
+
+		p.routes = append(p.routes, &outputRoute{
+			name:       route.Name,
+			condition:  route.Condition,
+			controller: output,
+			observer:   routeObserver,
+			logger:     routeMonitors.Logger,
+		})
+	}
+
+	return p, nil
+}
+
 // Close stops the pipeline, outputs and queue.
 // If WaitClose with WaitOnPipelineClose mode is configured, Close will block
 // for a duration of WaitClose, if there are still active events in the pipeline.
@@ -166,7 +244,24 @@ func (p *Pipeline) Close() error {
 	log.Debug("close pipeline")
 
 	// Note: active clients are not closed / disconnected.
-	p.outputController.WaitClose(p.waitCloseTimeout)
+	if len(p.routes) == 0 {
+		p.outputController.WaitClose(p.waitCloseTimeout)
+	} else {
+		// Drain the routes in parallel, so the total wait is bound by
+		// waitCloseTimeout.
+		var wg sync.WaitGroup
+		for _, route := range p.routes {
+			wg.Add(1)
+			go func(controller *outputController) {
+				defer wg.Done()
+				controller.WaitClose(p.waitCloseTimeout)
+			}(route.controller)
+		}
+		wg.Wait()
+		for _, route := range p.routes {
+			route.observer.cleanup()
+		}
+	}
 
 	p.observer.cleanup()
 	return nil
@@ -236,10 +331,18 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 		}
 	}
 
+	if fansOut(processors) {
+		client.fanOut = &fanOutACKer{}
+	}
+
 	producerCfg := queue.ProducerConfig{
 		ACK: func(count int) {
+			if client.fanOut != nil {
+				// Active events are counted per client event.
+				count = client.fanOut.ack(count)
+			}
 			client.observer.eventsACKed(count)
-			if ackHandler != nil {
+			if ackHandler != nil && count > 0 {
 				ackHandler.ACKEvents(count)
 			}
 		},
@@ -251,7 +354,7 @@ func (p *Pipeline) ConnectWith(cfg beat.ClientConfig) (beat.Client, error) {
 
 	client.eventListener = ackHandler
 	client.waiter = waiter
-	client.producer = p.outputController.queueProducer(producerCfg)
+	client.producer = p.queueProducer(producerCfg)
 	if client.producer == nil {
 		// This can only happen if the pipeline was shut down while clients
 		// were still waiting to connect.
@@ -269,8 +372,20 @@ func (p *Pipeline) createEventProcessing(cfg beat.ProcessingConfig, noPublish bo
 	return p.processors.Create(cfg, noPublish)
 }
 
+// queueProducer creates a producer publishing to the pipeline's queue, or to
+// the queues of all matching routes if the pipeline has routes.
+func (p *Pipeline) queueProducer(cfg queue.ProducerConfig) queue.Producer {
+	if len(p.routes) == 0 {
+		return p.outputController.queueProducer(cfg)
+	}
+	return newRoutedProducer(p.routes, cfg)
+}
+
 // OutputReloader returns a reloadable object for the output section of this pipeline
 func (p *Pipeline) OutputReloader() OutputReloader {
+	if len(p.routes) > 0 {
+		return routedOutputReloader{}
+	}
 	return p.outputController
 }
 
@@ -292,11 +407,43 @@ func queueFactoryForUserConfig(queueType string, userConfig *conf.C) (queue.Queu
 			return nil, err
 		}
 		return diskqueue.FactoryForSettings(settings), nil
+	case hybridqueue.QueueType:
+		settings, err := hybridqueue.SettingsForUserConfig(userConfig)
+		if err != nil {
+			return nil, err
+		}
+		return hybridqueue.FactoryForSettings(settings), nil
 	default:
 		return nil, fmt.Errorf("unrecognized queue type '%v'", queueType)
 	}
 }
 
+// routeQueueConfig returns the queue configuration for a route. Disk queues
+// can not share a directory, so unless a path is configured, every route
+// stores its disk queue in its own directory below the default one.
+func routeQueueConfig(name, queueType string, userConfig *conf.C) (*conf.C, error) {
+	cfg := conf.NewConfig()
+	if userConfig != nil {
+		if err := cfg.Merge(userConfig); err != nil {
+			return nil, err
+		}
+	}
+	pathField := ""
+	switch queueType {
+	case diskqueue.QueueType:
+		pathField = "path"
+	case hybridqueue.QueueType:
+		pathField = "disk.path"
+	}
+	if pathField != "" && !cfg.HasField(pathField) {
+		path := paths.Resolve(paths.Data, filepath.Join("diskqueue", name))
+		if err := cfg.SetString(pathField, -1, path); err != nil {
+			return nil, err
+		}
+	}
+	return cfg, nil
+}
+
 type noopClientListener struct{}
 
 func (n noopClientListener) Closing()                    {}
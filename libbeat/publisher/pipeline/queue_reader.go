@@ -28,6 +28,9 @@ import (
 type queueReader struct {
 	req  chan queueReaderRequest // "give me a batch for this target"
 	resp chan *ttlBatch          // "here is your batch, or nil"
+
+	// done is closed when the reader goroutine returns.
+	done chan struct{}
 }
 
 type queueReaderRequest struct {
@@ -41,11 +44,13 @@ func makeQueueReader() queueReader {
 	qr := queueReader{
 		req:  make(chan queueReaderRequest, 1),
 		resp: make(chan *ttlBatch),
+		done: make(chan struct{}),
 	}
 	return qr
 }
 
 func (qr *queueReader) run(logger *logp.Logger) {
+	defer close(qr.done)
 	logger.Debug("pipeline event consumer queue reader: start")
 	for {
 		req, ok := <-qr.req
@@ -0,0 +1,261 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"errors"
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/common/reload"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// Route is a named output together with the condition selecting the events
+// it receives. A route without condition receives all events.
+type Route struct {
+	Name      string
+	Condition conditions.Condition
+	Output    outputs.Group
+}
+
+// outputRoute is an active Route. Every route owns its queue and output
+// workers through its own outputController.
+type outputRoute struct {
+	name       string
+	condition  conditions.Condition
+	controller *outputController
+	observer   routeObserver
+	logger     *logp.Logger
+}
+
+// routedProducer forwards every event to the queue producers of all routes
+// whose condition matches the event. It combines the ACKs of the per route
+// producers, such that an event is only ACKed to the client once all routes
+// it was published to have ACKed it.
+type routedProducer struct {
+	routes []*producerRoute
+
+	// ACKs are reported by the queues of all routes, ackMutex ensures the
+	// client's callback is never run concurrently.
+	ack      func(count int)
+	ackMutex sync.Mutex
+
+	mutex sync.Mutex
+	// pending holds all events published through this producer, that have not
+	// been ACKed to the client yet, in publishing order.
+	pending []*routedEntry
+	nextID  queue.EntryID
+}
+
+type producerRoute struct {
+	route    *outputRoute
+	producer queue.Producer
+
+	// pending holds the events published to this route's queue, that have
+	// not been ACKed by the queue yet, in publishing order.
+	pending []*routedEntry
+}
+
+// routedEntry tracks the number of routes that still need to ACK an event.
+type routedEntry struct {
+	remaining int
+}
+
+var errRoutedOutputReload = errors.New("output reloading is not supported when routing events to multiple outputs")
+
+// routedOutputReloader rejects output reloads for pipelines with routes, as
+// a reloaded output configuration can not be mapped to the configured routes.
+type routedOutputReloader struct{}
+
+func (routedOutputReloader) Reload(
+	_ *reload.ConfigWithMeta,
+	_ func(outputs.Observer, conf.Namespace) (outputs.Group, error),
+) error {
+	return errRoutedOutputReload
+}
+
+// newRoutedProducer creates a producer for every route. It returns nil if
+// any of the routes is shutting down.
+func newRoutedProducer(routes []*outputRoute, cfg queue.ProducerConfig) queue.Producer {
+	p := &routedProducer{ack: cfg.ACK}
+	for _, route := range routes {
+		pr := &producerRoute{route: route}
+		producer := route.controller.queueProducer(queue.ProducerConfig{
+			ACK: func(count int) { p.onACK(pr, count) },
+		})
+		if producer == nil {
+			for _, created := range p.routes {
+				created.producer.Close()
+			}
+			return nil
+		}
+		pr.producer = producer
+		p.routes = append(p.routes, pr)
+	}
+	return p
+}
+
+func (p *routedProducer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, func(producer queue.Producer, entry queue.Entry) bool {
+		_, ok := producer.Publish(entry)
+		return ok
+	})
+}
+
+func (p *routedProducer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, func(producer queue.Producer, entry queue.Entry) bool {
+		_, ok := producer.TryPublish(entry)
+		return ok
+	})
+}
+
+// publish sends the entry to all matching routes. The entry counts as
+// published if at least one route accepted it, routes rejecting it count
+// and log the dropped event. Entries not matching any route are ACKed right
+// away, entries rejected by all routes are never ACKed.
+func (p *routedProducer) publish(
+	entry queue.Entry,
+	publishFn func(queue.Producer, queue.Entry) bool,
+) (queue.EntryID, bool) {
+	event, ok := entry.(publisher.Event)
+	if !ok {
+		return 0, false
+	}
+
+	matching := make([]*producerRoute, 0, len(p.routes))
+	for _, pr := range p.routes {
+		if pr.route.condition == nil || pr.route.condition.Check(&event.Content) {
+			matching = append(matching, pr)
+		}
+	}
+
+	routed := &routedEntry{remaining: len(matching)}
+	p.mutex.Lock()
+	id := p.nextID
+	p.nextID++
+	p.pending = append(p.pending, routed)
+	p.mutex.Unlock()
+
+	published := len(matching) == 0
+	for i, pr := range matching {
+		routeEvent := event
+		if i > 0 {
+			// Outputs may modify events while encoding them, every queue
+			// needs its own copy.
+			routeEvent = cloneEvent(event)
+		}
+
+		// Register the entry before publishing, the queue might ACK the
+		// event before Publish returns.
+		p.mutex.Lock()
+		pr.pending = append(pr.pending, routed)
+		p.mutex.Unlock()
+
+		if publishFn(pr.producer, routeEvent) {
+			published = true
+			continue
+		}
+
+		pr.route.observer.rejectedEvent()
+		pr.route.logger.Debugf("Dropping event rejected by the queue of output route '%v'", pr.route.name)
+
+		p.mutex.Lock()
+		pr.pending = pr.pending[:len(pr.pending)-1]
+		routed.remaining--
+		if i == len(matching)-1 && !published {
+			// No route accepted the event. The client counts it as dropped,
+			// so it must not be ACKed as well.
+			p.removePendingLocked(routed)
+		}
+		p.mutex.Unlock()
+	}
+
+	p.mutex.Lock()
+	acked := p.collectACKedLocked()
+	p.mutex.Unlock()
+	p.notifyACK(acked)
+
+	return id, published
+}
+
+func (p *routedProducer) Close() {
+	for _, pr := range p.routes {
+		pr.producer.Close()
+	}
+}
+
+// onACK is called by the queue of a route, when count events have been ACKed.
+func (p *routedProducer) onACK(pr *producerRoute, count int) {
+	p.mutex.Lock()
+	if count > len(pr.pending) {
+		count = len(pr.pending)
+	}
+	for _, routed := range pr.pending[:count] {
+		routed.remaining--
+	}
+	pr.pending = pr.pending[count:]
+	acked := p.collectACKedLocked()
+	p.mutex.Unlock()
+
+	p.notifyACK(acked)
+}
+
+// collectACKedLocked removes all events from the head of the pending list
+// that have been ACKed by all their routes, and returns their count.
+func (p *routedProducer) collectACKedLocked() int {
+	acked := 0
+	for acked < len(p.pending) && p.pending[acked].remaining <= 0 {
+		acked++
+	}
+	p.pending = p.pending[acked:]
+	return acked
+}
+
+// removePendingLocked removes an entry that will never be ACKed from the
+// pending list.
+func (p *routedProducer) removePendingLocked(routed *routedEntry) {
+	for i := len(p.pending) - 1; i >= 0; i-- {
+		if p.pending[i] == routed {
+			p.pending = append(p.pending[:i], p.pending[i+1:]...)
+			return
+		}
+	}
+}
+
+func (p *routedProducer) notifyACK(count int) {
+	if count > 0 && p.ack != nil {
+		p.ackMutex.Lock()
+		defer p.ackMutex.Unlock()
+		p.ack(count)
+	}
+}
+
+func cloneEvent(event publisher.Event) publisher.Event {
+	if event.Content.Fields != nil {
+		event.Content.Fields = event.Content.Fields.Clone()
+	}
+	if event.Content.Meta != nil {
+		event.Content.Meta = event.Content.Meta.Clone()
+	}
+	return event
+}
@@ -0,0 +1,328 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package pipeline
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/beat"
+	"github.com/elastic/beats/v7/libbeat/common/acker"
+	"github.com/elastic/beats/v7/libbeat/conditions"
+	"github.com/elastic/beats/v7/libbeat/outputs"
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	conf "github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+// recordingProducer accepts every event, unless reject is set.
+type recordingProducer struct {
+	mu     sync.Mutex
+	events []publisher.Event
+	reject bool
+}
+
+func (p *recordingProducer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.reject {
+		return 0, false
+	}
+	p.events = append(p.events, entry.(publisher.Event))
+	return queue.EntryID(len(p.events)), true
+}
+
+func (p *recordingProducer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.Publish(entry)
+}
+
+func (p *recordingProducer) Close() {}
+
+func mustCondition(t *testing.T, raw map[string]interface{}) conditions.Condition {
+	t.Helper()
+	var cfg conditions.Config
+	require.NoError(t, conf.MustNewConfigFrom(raw).Unpack(&cfg))
+	cond, err := conditions.NewCondition(&cfg, logptest.NewTestingLogger(t, ""))
+	require.NoError(t, err)
+	return cond
+}
+
+func testRoute(t *testing.T, name string, condition conditions.Condition) *outputRoute {
+	return &outputRoute{
+		name:      name,
+		condition: condition,
+		observer:  nilRouteObserver,
+		logger:    logptest.NewTestingLogger(t, ""),
+	}
+}
+
+func categoryEvent(category string) publisher.Event {
+	return publisher.Event{Content: beat.Event{
+		Timestamp: time.Now(),
+		Fields:    mapstr.M{"event": mapstr.M{"category": category}},
+	}}
+}
+
+func TestRoutedProducerACK(t *testing.T) {
+	var acked []int
+	p := &routedProducer{ack: func(count int) { acked = append(acked, count) }}
+
+	security := &producerRoute{
+		route: testRoute(t, "security",
+			mustCondition(t, map[string]interface{}{"equals.event.category": "security"})),
+		producer: &recordingProducer{},
+	}
+	web := &producerRoute{
+		route: testRoute(t, "web",
+			mustCondition(t, map[string]interface{}{"equals.event.category": "web"})),
+		producer: &recordingProducer{},
+	}
+	all := &producerRoute{
+		route:    testRoute(t, "all", nil),
+		producer: &recordingProducer{},
+	}
+	p.routes = []*producerRoute{security, web, all}
+
+	for _, category := range []string{"security", "web", "security"} {
+		_, ok := p.Publish(categoryEvent(category))
+		require.True(t, ok)
+	}
+	assert.Len(t, security.producer.(*recordingProducer).events, 2)
+	assert.Len(t, web.producer.(*recordingProducer).events, 1)
+	assert.Len(t, all.producer.(*recordingProducer).events, 3)
+	assert.Empty(t, acked)
+
+	// The first event is still pending in the security route.
+	p.onACK(all, 2)
+	p.onACK(web, 1)
+	assert.Empty(t, acked)
+
+	// The first two events are now ACKed by all their routes.
+	p.onACK(security, 1)
+	assert.Equal(t, []int{2}, acked)
+
+	p.onACK(all, 1)
+	assert.Equal(t, []int{2}, acked)
+	p.onACK(security, 1)
+	assert.Equal(t, []int{2, 1}, acked)
+	assert.Empty(t, p.pending)
+}
+
+func TestRoutedProducerUnmatchedAndRejectedEvents(t *testing.T) {
+	var acked int
+	p := &routedProducer{ack: func(count int) { acked += count }}
+
+	metrics := monitoring.NewRegistry()
+	rejectingRoute := testRoute(t, "rejecting", nil)
+	rejectingRoute.observer = newRouteMetricsObserver(metrics)
+	rejecting := &producerRoute{
+		route:    rejectingRoute,
+		producer: &recordingProducer{reject: true},
+	}
+	security := &producerRoute{
+		route: testRoute(t, "security",
+			mustCondition(t, map[string]interface{}{"equals.event.category": "security"})),
+		producer: &recordingProducer{},
+	}
+
+	t.Run("event without matching route is ACKed", func(t *testing.T) {
+		p.routes = []*producerRoute{security}
+		_, ok := p.Publish(categoryEvent("web"))
+		assert.True(t, ok)
+		assert.Equal(t, 1, acked)
+	})
+
+	t.Run("event rejected by all routes is not published", func(t *testing.T) {
+		p.routes = []*producerRoute{rejecting}
+		_, ok := p.Publish(categoryEvent("web"))
+		assert.False(t, ok)
+		assert.Empty(t, rejecting.pending)
+		assert.Empty(t, p.pending)
+		// The client counts the event as dropped, it must not be ACKed.
+		assert.Equal(t, 1, acked)
+	})
+
+	t.Run("event rejected by some routes waits for the others", func(t *testing.T) {
+		acked = 0
+		p.routes = []*producerRoute{rejecting, security}
+		_, ok := p.Publish(categoryEvent("security"))
+		assert.True(t, ok)
+		assert.Equal(t, 0, acked)
+
+		p.onACK(security, 1)
+		assert.Equal(t, 1, acked)
+	})
+
+	assert.Equal(t, uint64(2), metrics.GetRegistry("pipeline").Get("events.rejected").(*monitoring.Uint).Get())
+}
+
+func TestRoutedProducerClonesEvents(t *testing.T) {
+	p := &routedProducer{}
+	first := &producerRoute{route: testRoute(t, "first", nil), producer: &recordingProducer{}}
+	second := &producerRoute{route: testRoute(t, "second", nil), producer: &recordingProducer{}}
+	p.routes = []*producerRoute{first, second}
+
+	_, ok := p.Publish(categoryEvent("web"))
+	require.True(t, ok)
+
+	firstEvent := first.producer.(*recordingProducer).events[0]
+	secondEvent := second.producer.(*recordingProducer).events[0]
+	_, err := firstEvent.Content.Fields.Put("event.category", "modified")
+	require.NoError(t, err)
+
+	category, err := secondEvent.Content.Fields.GetValue("event.category")
+	require.NoError(t, err)
+	assert.Equal(t, "web", category)
+}
+
+func TestRoutedPipeline(t *testing.T) {
+	logger := logptest.NewTestingLogger(t, "")
+
+	var securityCount, allCount atomic.Int64
+	countingOutput := func(counter *atomic.Int64) outputs.Group {
+		return outputs.Group{
+			Clients: []outputs.Client{newMockClient(func(batch publisher.Batch) error {
+				counter.Add(int64(len(batch.Events())))
+				batch.ACK()
+				return nil
+			})},
+			BatchSize: 10,
+		}
+	}
+
+	// Flush partial batches right away, so the last events of every route
+	// don't wait for the queue's flush timeout.
+	queueConfig := conf.Namespace{}
+	require.NoError(t, queueConfig.Unpack(conf.MustNewConfigFrom("mem.flush.timeout: 0s")))
+
+	pipeline, err := NewRouted(
+		beat.Info{Logger: logger},
+		Monitors{Logger: logger},
+		queueConfig,
+		[]Route{
+			{
+				Name:      "security",
+				Condition: mustCondition(t, map[string]interface{}{"equals.event.category": "security"}),
+				Output:    countingOutput(&securityCount),
+			},
+			{
+				Name:   "all",
+				Output: countingOutput(&allCount),
+			},
+		},
+		// Close waits for the routes to stop, so nothing logs after the test.
+		Settings{WaitClose: 5 * time.Second},
+	)
+	require.NoError(t, err)
+	defer pipeline.Close()
+
+	var ackedCount atomic.Int64
+	client, err := pipeline.ConnectWith(beat.ClientConfig{
+		EventListener: acker.RawCounting(func(count int) {
+			ackedCount.Add(int64(count))
+		}),
+	})
+	require.NoError(t, err)
+	defer client.Close()
+
+	const numEvents = 100
+	for i := 0; i < numEvents; i++ {
+		category := "web"
+		if i%4 == 0 {
+			category = "security"
+		}
+		client.Publish(categoryEvent(category).Content)
+	}
+
+	require.Eventually(t, func() bool {
+		return ackedCount.Load() == numEvents
+	}, 10*time.Second, 10*time.Millisecond)
+	assert.Equal(t, int64(numEvents/4), securityCount.Load())
+	assert.Equal(t, int64(numEvents), allCount.Load())
+
+	assert.ErrorIs(t, pipeline.OutputReloader().Reload(nil, nil), errRoutedOutputReload)
+}
+
+func TestRouteConfigValidate(t *testing.T) {
+	tests := map[string]struct {
+		input   map[string]interface{}
+		wantErr string
+	}{
+		"valid routes": {
+			input: map[string]interface{}{
+				"outputs": []interface{}{
+					map[string]interface{}{
+						"name":                   "security",
+						"when.equals.event.type": "security",
+						"output.console":         map[string]interface{}{},
+					},
+					map[string]interface{}{
+						"name":           "all",
+						"output.discard": map[string]interface{}{},
+					},
+				},
+			},
+		},
+		"duplicate names": {
+			input: map[string]interface{}{
+				"outputs": []interface{}{
+					map[string]interface{}{"name": "a", "output.console": map[string]interface{}{}},
+					map[string]interface{}{"name": "a", "output.discard": map[string]interface{}{}},
+				},
+			},
+			wantErr: "configured multiple times",
+		},
+		"invalid name": {
+			input: map[string]interface{}{
+				"outputs": []interface{}{
+					map[string]interface{}{"name": "a.b", "output.console": map[string]interface{}{}},
+				},
+			},
+			wantErr: "invalid output route name",
+		},
+		"missing output": {
+			input: map[string]interface{}{
+				"outputs": []interface{}{
+					map[string]interface{}{"name": "a"},
+				},
+			},
+			wantErr: "has no output configured",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			var cfg Config
+			err := conf.MustNewConfigFrom(test.input).Unpack(&cfg)
+			if test.wantErr == "" {
+				require.NoError(t, err)
+				assert.Len(t, cfg.Outputs, 2)
+			} else {
+				assert.ErrorContains(t, err, test.wantErr)
+			}
+		})
+	}
+}
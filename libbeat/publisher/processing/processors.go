@@ -41,6 +41,10 @@ type group struct {
 type processorFn struct {
 	name string
 	fn   func(event *beat.Event) (*beat.Event, error)
+
+	// fanOut is set if the function is backed by processors that can
+	// replace events with several events.
+	fanOut func(event *beat.Event) ([]*beat.Event, error)
 }
 
 func newGeneralizeProcessor(keepNull bool, logger *logp.Logger) *processorFn {
@@ -142,6 +146,40 @@ func (p *group) Run(event *beat.Event) (*beat.Event, error) {
 	return event, nil
 }
 
+// FansOut reports whether one of the processors of the group can replace
+// events with several events.
+func (p *group) FansOut() bool {
+	return p != nil && processors.FansOut(&processors.Processors{List: p.list})
+}
+
+// RunFanOut is like Run, but returns all events resulting from processors
+// replacing events with several events.
+func (p *group) RunFanOut(event *beat.Event) ([]*beat.Event, error) {
+	if p == nil || len(p.list) == 0 {
+		return []*beat.Event{event}, nil
+	}
+
+	events := []*beat.Event{event}
+	for _, sub := range p.list {
+		next := events[:0:0]
+		for _, event := range events {
+			out, err := processors.RunFanOut(sub, event)
+			if err != nil {
+				// Like Run, continue with the events returned by the
+				// processor.
+				p.log.Debugf("Fail to apply processor %s: %s", p, err)
+			}
+			next = append(next, out...)
+		}
+		if len(next) == 0 {
+			return nil, nil
+		}
+		events = next
+	}
+
+	return events, nil
+}
+
 func newProcessor(name string, fn func(*beat.Event) (*beat.Event, error)) *processorFn {
 	return &processorFn{name: name, fn: fn}
 }
@@ -153,8 +191,30 @@ func newAnnotateProcessor(name string, fn func(*beat.Event)) *processorFn {
 	})
 }
 
+// newGroupProcessor returns a processor running the group, which can't be
+// closed through the processor.
+func newGroupProcessor(g *group) *processorFn {
+	p := newProcessor(g.title, g.Run)
+	if g.FansOut() {
+		p.fanOut = g.RunFanOut
+	}
+	return p
+}
+
 func (p *processorFn) String() string                         { return p.name }
 func (p *processorFn) Run(e *beat.Event) (*beat.Event, error) { return p.fn(e) }
+func (p *processorFn) FansOut() bool                          { return p.fanOut != nil }
+
+func (p *processorFn) RunFanOut(e *beat.Event) ([]*beat.Event, error) {
+	if p.fanOut != nil {
+		return p.fanOut(e)
+	}
+	e, err := p.fn(e)
+	if e == nil {
+		return nil, err
+	}
+	return []*beat.Event{e}, err
+}
 
 func clientEventMeta(meta mapstr.M, needsCopy bool) *processorFn {
 	fn := func(event *beat.Event) { addMeta(event, meta) }
@@ -66,6 +66,14 @@ type Settings struct {
 
 	// UseCompression enables or disables LZ4 compression
 	UseCompression bool
+
+	// EncryptionKey enables AES-GCM encryption of new segments if set. It
+	// must be 16, 24 or 32 bytes long, selecting AES-128, AES-192 or AES-256.
+	EncryptionKey []byte
+
+	// PreviousEncryptionKeys are only used to read segments that were
+	// written before the encryption key was rotated.
+	PreviousEncryptionKeys [][]byte
 }
 
 // userConfig holds the parameters for a disk queue that are configurable
@@ -80,6 +88,30 @@ type userConfig struct {
 
 	RetryInterval    *time.Duration `config:"retry_interval" validate:"positive"`
 	MaxRetryInterval *time.Duration `config:"max_retry_interval" validate:"positive"`
+
+	Encryption *encryptionConfig `config:"encryption"`
+}
+
+// encryptionConfig holds the base64 encoded encryption keys. The keys are
+// meant to be stored in the beat keystore and referenced as variables,
+// e.g. key: "${DISK_QUEUE_KEY}".
+type encryptionConfig struct {
+	Key          string   `config:"key"`
+	PreviousKeys []string `config:"previous_keys"`
+}
+
+func (c *encryptionConfig) Validate() error {
+	if c.Key != "" {
+		if _, err := decodeEncryptionKey(c.Key); err != nil {
+			return fmt.Errorf("disk queue encryption.key: %w", err)
+		}
+	}
+	for i, key := range c.PreviousKeys {
+		if _, err := decodeEncryptionKey(key); err != nil {
+			return fmt.Errorf("disk queue encryption.previous_keys.%d: %w", i, err)
+		}
+	}
+	return nil
 }
 
 func (c *userConfig) Validate() error {
@@ -163,6 +195,23 @@ func SettingsForUserConfig(config *config.C) (Settings, error) {
 		settings.MaxRetryInterval = *userConfig.MaxRetryInterval
 	}
 
+	if userConfig.Encryption != nil {
+		var err error
+		if userConfig.Encryption.Key != "" {
+			settings.EncryptionKey, err = decodeEncryptionKey(userConfig.Encryption.Key)
+			if err != nil {
+				return Settings{}, err
+			}
+		}
+		for _, encoded := range userConfig.Encryption.PreviousKeys {
+			key, err := decodeEncryptionKey(encoded)
+			if err != nil {
+				return Settings{}, err
+			}
+			settings.PreviousEncryptionKeys = append(settings.PreviousEncryptionKeys, key)
+		}
+	}
+
 	return settings, nil
 }
 
@@ -187,6 +236,16 @@ func (settings Settings) segmentPath(segmentID segmentID) string {
 		fmt.Sprintf("%v.seg", segmentID))
 }
 
+// decryptionKeys returns all keys that can be used to read encrypted
+// segments, starting with the current key.
+func (settings Settings) decryptionKeys() [][]byte {
+	var keys [][]byte
+	if len(settings.EncryptionKey) > 0 {
+		keys = append(keys, settings.EncryptionKey)
+	}
+	return append(keys, settings.PreviousEncryptionKeys...)
+}
+
 // maxValidFrameSize returns the size of the largest possible frame that
 // can be stored with the current queue settings.
 func (settings Settings) maxValidFrameSize() uint64 {
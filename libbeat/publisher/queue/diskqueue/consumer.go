@@ -18,11 +18,13 @@
 package diskqueue
 
 import (
-	"fmt"
+	"errors"
 
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 )
 
+var errQueueClosed = errors.New("tried to read from a closed disk queue")
+
 type diskQueueBatch struct {
 	queue  *diskQueue
 	frames []*readFrame
@@ -33,8 +35,58 @@ func (dq *diskQueue) Get(eventCount int) (queue.Batch, error) {
 	// consumer is closed.
 	frame, ok := <-dq.readerLoop.output
 	if !ok {
-		return nil, fmt.Errorf("tried to read from a closed disk queue")
+		return nil, errQueueClosed
+	}
+	return dq.batchFrom(frame, eventCount), nil
+}
+
+// TryGet works like Get, but instead of blocking it returns a nil batch if
+// all events written to the queue have already been returned. Events
+// restored from a previous session are read until the end of their segment,
+// so they are all returned before TryGet reports the queue as drained.
+func (dq *diskQueue) TryGet(eventCount int) (queue.Batch, error) {
+	select {
+	case frame, ok := <-dq.readerLoop.output:
+		if !ok {
+			return nil, errQueueClosed
+		}
+		return dq.batchFrom(frame, eventCount), nil
+	default:
+	}
+
+	// Ask the core loop to tell us once all frames have been sent to the
+	// reader loop output, unless a frame arrives first.
+	drained := make(chan struct{})
+	select {
+	case dq.drainedRequestChan <- drained:
+	case <-dq.done:
+		return nil, errQueueClosed
 	}
+	select {
+	case frame, ok := <-dq.readerLoop.output:
+		if !ok {
+			return nil, errQueueClosed
+		}
+		return dq.batchFrom(frame, eventCount), nil
+	case <-drained:
+	}
+
+	// The last frames may have been sent to the output right before the
+	// core loop reported the queue as drained.
+	select {
+	case frame, ok := <-dq.readerLoop.output:
+		if !ok {
+			return nil, errQueueClosed
+		}
+		return dq.batchFrom(frame, eventCount), nil
+	default:
+		return nil, nil
+	}
+}
+
+// batchFrom returns a batch starting with the given frame, including up to
+// eventCount frames that can be read without blocking.
+func (dq *diskQueue) batchFrom(frame *readFrame, eventCount int) queue.Batch {
 	frames := []*readFrame{frame}
 
 eventLoop:
@@ -82,7 +134,7 @@ eventLoop:
 	return &diskQueueBatch{
 		queue:  dq,
 		frames: frames,
-	}, nil
+	}
 }
 
 //
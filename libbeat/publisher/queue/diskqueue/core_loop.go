@@ -41,6 +41,9 @@ func (dq *diskQueue) run() {
 			// writer loop.
 			dq.maybeWritePending()
 
+		case drained := <-dq.drainedRequestChan:
+			dq.drainedRequests = append(dq.drainedRequests, drained)
+
 		case ackedSegmentID := <-dq.acks.segmentACKChan:
 			dq.handleSegmentACK(ackedSegmentID)
 
@@ -85,6 +88,9 @@ func (dq *diskQueue) run() {
 			// we might be able to unblock them now.
 			dq.maybeUnblockProducers()
 		}
+
+		// Any of the above can finish reading the queue, or add frames to read.
+		dq.maybeReportDrained()
 	}
 }
 
@@ -398,6 +404,24 @@ func (dq *diskQueue) maybeReadPending() {
 	dq.reading = true
 }
 
+// If there are consumers waiting in TryGet, and every frame accepted by the
+// queue has been sent to the reader loop output, wake them up.
+func (dq *diskQueue) maybeReportDrained() {
+	if len(dq.drainedRequests) == 0 ||
+		dq.reading || dq.writing || len(dq.pendingFrames) > 0 {
+		return
+	}
+	segment := dq.segments.readingSegment()
+	if segment != nil && dq.segments.nextReadPosition < segment.byteCount {
+		// There is data left to read
+		return
+	}
+	for _, drained := range dq.drainedRequests {
+		close(drained)
+	}
+	dq.drainedRequests = nil
+}
+
 // If the acked list is nonempty, and there are no outstanding deletion
 // requests, send one.
 func (dq *diskQueue) maybeDeleteACKed() {
@@ -0,0 +1,285 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+// The data region of an encrypted segment starts with the ID of the key
+// that was used to encrypt it, followed by a sequence of chunks sealed
+// with AES-GCM. Each chunk consists of the length of the sealed data
+// (uint32), a random nonce and the sealed data including the GCM tag.
+// The index of the chunk within the segment is authenticated as
+// additional data, so chunks can't be reordered or dropped silently.
+const (
+	// EncryptionKeyIDSize is the size of the key ID stored in encrypted
+	// segments. The key ID is a prefix of the SHA-256 hash of the key.
+	EncryptionKeyIDSize = 8
+
+	// encryptionChunkSize is the maximum number of plaintext bytes
+	// sealed into a single chunk.
+	encryptionChunkSize = 64 * 1024
+
+	encryptionNonceSize = 12
+	encryptionTagSize   = 16
+)
+
+var errNoMatchingKey = errors.New("no configured encryption key matches the segment key ID")
+
+type encryptionKey struct {
+	id   [EncryptionKeyIDSize]byte
+	aead cipher.AEAD
+}
+
+// newEncryptionKey sets up AES-GCM for the given key, which must be 16, 24
+// or 32 bytes long to select AES-128, AES-192 or AES-256.
+func newEncryptionKey(key []byte) (*encryptionKey, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid encryption key: %w", err)
+	}
+	aead, err := cipher.NewGCM(block)
+	if err != nil {
+		return nil, err
+	}
+	k := &encryptionKey{aead: aead}
+	hash := sha256.Sum256(key)
+	copy(k.id[:], hash[:])
+	return k, nil
+}
+
+// decodeEncryptionKey decodes a base64 encoded AES key, as stored in the
+// beat keystore.
+func decodeEncryptionKey(encoded string) ([]byte, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("encryption key is not valid base64: %w", err)
+	}
+	switch len(key) {
+	case 16, 24, 32:
+		return key, nil
+	default:
+		return nil, fmt.Errorf(
+			"encryption key must be 16, 24 or 32 bytes long, got %d bytes", len(key))
+	}
+}
+
+// chunkAdditionalData returns the additional data authenticated with the
+// chunk at the given index.
+func chunkAdditionalData(index uint64) []byte {
+	var ad [8]byte
+	binary.LittleEndian.PutUint64(ad[:], index)
+	return ad[:]
+}
+
+// EncryptionReader allows reading a stream encrypted with AES-GCM
+type EncryptionReader struct {
+	src  io.ReadCloser
+	keys [][]byte
+
+	key        *encryptionKey
+	chunkIndex uint64
+	plaintext  []byte
+	chunk      []byte
+}
+
+// NewEncryptionReader returns a new AES-GCM decrypter. It reads the key
+// ID from the source and selects the matching key from the given keys, so
+// segments encrypted with a key that has since been rotated can still be
+// read as long as the old key is provided.
+func NewEncryptionReader(r io.ReadCloser, keys [][]byte) (*EncryptionReader, error) {
+	er := &EncryptionReader{
+		src:  r,
+		keys: keys,
+	}
+	if err := er.Reset(); err != nil {
+		return nil, err
+	}
+	return er, nil
+}
+
+func (r *EncryptionReader) Read(buf []byte) (int, error) {
+	if len(r.plaintext) == 0 {
+		if err := r.readChunk(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(buf, r.plaintext)
+	r.plaintext = r.plaintext[n:]
+	return n, nil
+}
+
+// readChunk reads and decrypts the next chunk. It returns io.EOF if the
+// source ends at a chunk boundary.
+func (r *EncryptionReader) readChunk() error {
+	var sealedLength uint32
+	if err := binary.Read(r.src, binary.LittleEndian, &sealedLength); err != nil {
+		return err
+	}
+	if sealedLength < encryptionNonceSize+encryptionTagSize ||
+		sealedLength > encryptionNonceSize+encryptionChunkSize+encryptionTagSize {
+		return fmt.Errorf("invalid encrypted chunk length %d", sealedLength)
+	}
+
+	if cap(r.chunk) < int(sealedLength) {
+		r.chunk = make([]byte, sealedLength)
+	}
+	chunk := r.chunk[:sealedLength]
+	if _, err := io.ReadFull(r.src, chunk); err != nil {
+		if errors.Is(err, io.EOF) {
+			err = io.ErrUnexpectedEOF
+		}
+		return fmt.Errorf("couldn't read encrypted chunk: %w", err)
+	}
+
+	nonce, sealed := chunk[:encryptionNonceSize], chunk[encryptionNonceSize:]
+	plaintext, err := r.key.aead.Open(
+		sealed[:0], nonce, sealed, chunkAdditionalData(r.chunkIndex))
+	if err != nil {
+		return fmt.Errorf("couldn't decrypt chunk %d: %w", r.chunkIndex, err)
+	}
+	r.chunkIndex++
+	r.plaintext = plaintext
+	return nil
+}
+
+func (r *EncryptionReader) Close() error {
+	return r.src.Close()
+}
+
+// Reset Sets up decryption again, assumes that caller has already set
+// the src to the correct position
+func (r *EncryptionReader) Reset() error {
+	var keyID [EncryptionKeyIDSize]byte
+	if _, err := io.ReadFull(r.src, keyID[:]); err != nil {
+		return fmt.Errorf("couldn't read encryption key ID: %w", err)
+	}
+
+	r.chunkIndex = 0
+	r.plaintext = nil
+	if r.key != nil && r.key.id == keyID {
+		return nil
+	}
+	for _, key := range r.keys {
+		k, err := newEncryptionKey(key)
+		if err != nil {
+			return err
+		}
+		if k.id == keyID {
+			r.key = k
+			return nil
+		}
+	}
+	return fmt.Errorf("%w %x", errNoMatchingKey, keyID)
+}
+
+// EncryptionWriter allows writing an AES-GCM encrypted stream
+type EncryptionWriter struct {
+	dst WriteCloseSyncer
+	key *encryptionKey
+
+	chunkIndex uint64
+	plaintext  []byte
+	sealed     []byte
+}
+
+// NewEncryptionWriter returns a new AES-GCM encrypter. It writes the key
+// ID to the destination right away.
+func NewEncryptionWriter(w WriteCloseSyncer, key []byte) (*EncryptionWriter, error) {
+	k, err := newEncryptionKey(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(k.id[:]); err != nil {
+		return nil, fmt.Errorf("couldn't write encryption key ID: %w", err)
+	}
+	return &EncryptionWriter{
+		dst:       w,
+		key:       k,
+		plaintext: make([]byte, 0, encryptionChunkSize),
+	}, nil
+}
+
+// Write buffers p and seals a chunk every time the buffer is full. Data
+// is only guaranteed to be written to dst after Sync or Close.
+func (w *EncryptionWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := copy(w.plaintext[len(w.plaintext):encryptionChunkSize], p)
+		w.plaintext = w.plaintext[:len(w.plaintext)+n]
+		p = p[n:]
+		written += n
+		if len(w.plaintext) == encryptionChunkSize {
+			// On error the plaintext stays buffered, it is sealed again on
+			// the next write or sync.
+			if err := w.flush(); err != nil {
+				return written, err
+			}
+		}
+	}
+	return written, nil
+}
+
+// flush seals the buffered plaintext into a chunk and writes it to dst.
+func (w *EncryptionWriter) flush() error {
+	if len(w.plaintext) == 0 {
+		return nil
+	}
+
+	sealedLength := encryptionNonceSize + len(w.plaintext) + encryptionTagSize
+	if cap(w.sealed) < 4+sealedLength {
+		w.sealed = make([]byte, 4+sealedLength)
+	}
+	buf := w.sealed[:4+encryptionNonceSize]
+	binary.LittleEndian.PutUint32(buf, uint32(sealedLength))
+	nonce := buf[4:]
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("couldn't generate nonce: %w", err)
+	}
+	buf = w.key.aead.Seal(buf, nonce, w.plaintext, chunkAdditionalData(w.chunkIndex))
+
+	if _, err := w.dst.Write(buf); err != nil {
+		return err
+	}
+	w.chunkIndex++
+	w.plaintext = w.plaintext[:0]
+	return nil
+}
+
+func (w *EncryptionWriter) Close() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Close()
+}
+
+func (w *EncryptionWriter) Sync() error {
+	if err := w.flush(); err != nil {
+		return err
+	}
+	return w.dst.Sync()
+}
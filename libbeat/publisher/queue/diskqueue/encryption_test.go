@@ -0,0 +1,287 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package diskqueue
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"io"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+var (
+	testKey    = []byte("0123456789abcdef0123456789abcdef")
+	rotatedKey = []byte("fedcba9876543210")
+)
+
+type nopSyncer struct {
+	io.WriteCloser
+}
+
+func (nopSyncer) Sync() error { return nil }
+
+func TestEncryptionRoundTrip(t *testing.T) {
+	tests := map[string][]byte{
+		"empty":         {},
+		"short":         []byte("user=jane.doe@example.com ssn=078-05-1120"),
+		"exactly chunk": bytes.Repeat([]byte("a"), encryptionChunkSize),
+		"several chunk": bytes.Repeat([]byte("0123456789"), encryptionChunkSize/3),
+	}
+
+	for name, plaintext := range tests {
+		t.Run(name, func(t *testing.T) {
+			var buf bytes.Buffer
+			ew, err := NewEncryptionWriter(nopSyncer{NopWriteCloser(&buf)}, testKey)
+			require.NoError(t, err)
+			n, err := ew.Write(plaintext)
+			require.NoError(t, err)
+			assert.Equal(t, len(plaintext), n)
+			require.NoError(t, ew.Close())
+
+			if len(plaintext) > 0 {
+				assert.NotContains(t, buf.String(), string(plaintext[:16]))
+			}
+
+			er, err := NewEncryptionReader(io.NopCloser(&buf), [][]byte{testKey})
+			require.NoError(t, err)
+			decrypted, err := io.ReadAll(er)
+			require.NoError(t, err)
+			assert.Equal(t, len(plaintext), len(decrypted))
+			assert.True(t, bytes.Equal(plaintext, decrypted))
+		})
+	}
+}
+
+func TestEncryptionSyncSealsChunks(t *testing.T) {
+	var buf bytes.Buffer
+	ew, err := NewEncryptionWriter(nopSyncer{NopWriteCloser(&buf)}, testKey)
+	require.NoError(t, err)
+
+	for _, part := range []string{"abc", "defg"} {
+		_, err = ew.Write([]byte(part))
+		require.NoError(t, err)
+		require.NoError(t, ew.Sync())
+	}
+
+	// The data written so far must be readable without closing the writer,
+	// the reader loop reads segments that are still being written.
+	er, err := NewEncryptionReader(io.NopCloser(bytes.NewReader(buf.Bytes())), [][]byte{testKey})
+	require.NoError(t, err)
+	decrypted, err := io.ReadAll(er)
+	require.NoError(t, err)
+	assert.Equal(t, "abcdefg", string(decrypted))
+}
+
+func TestEncryptionReaderRejectsTampering(t *testing.T) {
+	var buf bytes.Buffer
+	ew, err := NewEncryptionWriter(nopSyncer{NopWriteCloser(&buf)}, testKey)
+	require.NoError(t, err)
+	for _, part := range []string{"first chunk", "second chunk"} {
+		_, err = ew.Write([]byte(part))
+		require.NoError(t, err)
+		require.NoError(t, ew.Sync())
+	}
+	encrypted := buf.Bytes()
+	firstChunkEnd := EncryptionKeyIDSize + 4 +
+		int(binary.LittleEndian.Uint32(encrypted[EncryptionKeyIDSize:]))
+
+	t.Run("modified ciphertext", func(t *testing.T) {
+		modified := bytes.Clone(encrypted)
+		modified[len(modified)-1] ^= 0xff
+		er, err := NewEncryptionReader(io.NopCloser(bytes.NewReader(modified)), [][]byte{testKey})
+		require.NoError(t, err)
+		_, err = io.ReadAll(er)
+		assert.ErrorContains(t, err, "couldn't decrypt chunk 1")
+	})
+
+	t.Run("dropped chunk", func(t *testing.T) {
+		modified := append(bytes.Clone(encrypted[:EncryptionKeyIDSize]), encrypted[firstChunkEnd:]...)
+		er, err := NewEncryptionReader(io.NopCloser(bytes.NewReader(modified)), [][]byte{testKey})
+		require.NoError(t, err)
+		_, err = io.ReadAll(er)
+		assert.ErrorContains(t, err, "couldn't decrypt chunk 0")
+	})
+
+	t.Run("truncated chunk", func(t *testing.T) {
+		er, err := NewEncryptionReader(io.NopCloser(bytes.NewReader(encrypted[:len(encrypted)-3])), [][]byte{testKey})
+		require.NoError(t, err)
+		_, err = io.ReadAll(er)
+		assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+	})
+}
+
+func TestEncryptedSegmentOnDisk(t *testing.T) {
+	plaintext := []byte(`{"message":"login","user":{"email":"jane.doe@example.com"}}`)
+
+	for name, compress := range map[string]bool{"encrypted": false, "encrypted compressed": true} {
+		t.Run(name, func(t *testing.T) {
+			settings := DefaultSettings()
+			settings.Path = t.TempDir()
+			settings.UseCompression = compress
+			settings.EncryptionKey = testKey
+
+			qs := &queueSegment{id: 1}
+			sw, err := qs.getWriter(settings)
+			require.NoError(t, err)
+			for i := 0; i < 10; i++ {
+				_, err = sw.Write(plaintext)
+				require.NoError(t, err)
+			}
+			require.NoError(t, sw.Close())
+
+			raw, err := os.ReadFile(settings.segmentPath(qs.id))
+			require.NoError(t, err)
+			assert.NotContains(t, string(raw), "jane.doe@example.com")
+			assert.NotContains(t, string(raw), "login")
+
+			header, err := readSegmentHeader(bytes.NewReader(raw))
+			require.NoError(t, err)
+			assert.Equal(t, uint32(currentSegmentVersion), header.version)
+			assert.Equal(t, ENABLE_ENCRYPTION, header.options&ENABLE_ENCRYPTION)
+
+			// Without the key the segment can't be opened.
+			noKey := settings
+			noKey.EncryptionKey = nil
+			_, err = qs.getReader(noKey)
+			assert.ErrorContains(t, err, "no encryption key is configured")
+
+			wrongKey := settings
+			wrongKey.EncryptionKey = rotatedKey
+			_, err = qs.getReader(wrongKey)
+			assert.ErrorIs(t, err, errNoMatchingKey)
+
+			sr, err := qs.getReader(settings)
+			require.NoError(t, err)
+			decrypted, err := io.ReadAll(sr)
+			require.NoError(t, err)
+			assert.Equal(t, bytes.Repeat(plaintext, 10), decrypted)
+			require.NoError(t, sr.Close())
+		})
+	}
+}
+
+func TestEncryptionKeyRotation(t *testing.T) {
+	settings := DefaultSettings()
+	settings.Path = t.TempDir()
+	settings.EncryptionKey = testKey
+
+	write := func(qs *queueSegment, settings Settings, data string) {
+		sw, err := qs.getWriter(settings)
+		require.NoError(t, err)
+		_, err = sw.Write([]byte(data))
+		require.NoError(t, err)
+		require.NoError(t, sw.Close())
+	}
+	read := func(qs *queueSegment, settings Settings) (string, error) {
+		sr, err := qs.getReader(settings)
+		if err != nil {
+			return "", err
+		}
+		defer sr.Close()
+		data, err := io.ReadAll(sr)
+		return string(data), err
+	}
+
+	oldSegment := &queueSegment{id: 1}
+	write(oldSegment, settings, "written with the old key")
+
+	// Rotate the key, keeping the old one for reading.
+	settings.EncryptionKey = rotatedKey
+	settings.PreviousEncryptionKeys = [][]byte{testKey}
+	newSegment := &queueSegment{id: 2}
+	write(newSegment, settings, "written with the new key")
+
+	data, err := read(oldSegment, settings)
+	require.NoError(t, err)
+	assert.Equal(t, "written with the old key", data)
+	data, err = read(newSegment, settings)
+	require.NoError(t, err)
+	assert.Equal(t, "written with the new key", data)
+
+	// Once the old key is removed, old segments can't be read anymore.
+	settings.PreviousEncryptionKeys = nil
+	_, err = read(oldSegment, settings)
+	assert.ErrorIs(t, err, errNoMatchingKey)
+
+	// Disabling encryption keeps encrypted segments readable as long as
+	// the keys are provided.
+	settings.EncryptionKey = nil
+	settings.PreviousEncryptionKeys = [][]byte{rotatedKey}
+	plainSegment := &queueSegment{id: 3}
+	write(plainSegment, settings, "plaintext")
+	data, err = read(newSegment, settings)
+	require.NoError(t, err)
+	assert.Equal(t, "written with the new key", data)
+	data, err = read(plainSegment, settings)
+	require.NoError(t, err)
+	assert.Equal(t, "plaintext", data)
+}
+
+func TestEncryptionUserConfig(t *testing.T) {
+	encoded := base64.StdEncoding.EncodeToString(testKey)
+	encodedRotated := base64.StdEncoding.EncodeToString(rotatedKey)
+
+	tests := map[string]struct {
+		input   map[string]interface{}
+		wantErr string
+	}{
+		"keys": {
+			input: map[string]interface{}{
+				"encryption.key":           encodedRotated,
+				"encryption.previous_keys": []string{encoded},
+			},
+		},
+		"not base64": {
+			input:   map[string]interface{}{"encryption.key": "not base64!"},
+			wantErr: "not valid base64",
+		},
+		"invalid key length": {
+			input:   map[string]interface{}{"encryption.key": base64.StdEncoding.EncodeToString([]byte("short"))},
+			wantErr: "must be 16, 24 or 32 bytes long",
+		},
+		"invalid previous key": {
+			input: map[string]interface{}{
+				"encryption.key":           encoded,
+				"encryption.previous_keys": []string{"abc"},
+			},
+			wantErr: "encryption.previous_keys.0",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			test.input["max_size"] = "100MB"
+			settings, err := SettingsForUserConfig(config.MustNewConfigFrom(test.input))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, rotatedKey, settings.EncryptionKey)
+			assert.Equal(t, [][]byte{testKey}, settings.PreviousEncryptionKeys)
+			assert.Equal(t, [][]byte{rotatedKey, testKey}, settings.decryptionKeys())
+		})
+	}
+}
@@ -68,6 +68,14 @@ type diskQueue struct {
 	// The API channel used by diskQueueProducer to write events.
 	producerWriteRequestChan chan producerWriteRequest
 
+	// The API channel used by TryGet to wait until all frames have been
+	// sent to the reader loop output.
+	drainedRequestChan chan chan struct{}
+
+	// drainedRequests are the channels received on drainedRequestChan that
+	// haven't been closed yet, see maybeReportDrained.
+	drainedRequests []chan struct{}
+
 	// pendingFrames is a list of all incoming data frames that have been
 	// accepted by the queue and are waiting to be sent to the writer loop.
 	// Segment ids in this list always appear in sorted order, even between
@@ -86,6 +94,11 @@ type diskQueue struct {
 	// The channel to report that shutdown is finished, used by
 	// (*diskQueue).Done.
 	done chan struct{}
+
+	// The number of events from a previous session that were still pending
+	// when the queue was opened, and the number of segments holding them.
+	restoredEventCount   int
+	restoredSegmentCount int
 }
 
 // FactoryForSettings is a simple wrapper around NewQueue so a concrete
@@ -162,7 +175,7 @@ func NewQueue(
 
 	// Index any existing data segments to be placed in segments.reading.
 	initialSegments, err :=
-		scanExistingSegments(logger, settings.directoryPath())
+		scanExistingSegments(logger, settings)
 	if err != nil {
 		return nil, err
 	}
@@ -230,9 +243,13 @@ func NewQueue(
 		deleterLoop: newDeleterLoop(settings),
 
 		producerWriteRequestChan: make(chan producerWriteRequest),
+		drainedRequestChan:       make(chan chan struct{}),
 
 		close: make(chan struct{}),
 		done:  make(chan struct{}),
+
+		restoredEventCount:   activeFrameCount,
+		restoredSegmentCount: len(initialSegments),
 	}
 
 	// Start the goroutines and return the queue!
@@ -268,6 +285,21 @@ func (dq *diskQueue) BufferConfig() queue.BufferConfig {
 	return queue.BufferConfig{MaxEvents: 0}
 }
 
+// RestoredEvents returns the number of events from a previous session
+// that were still pending when the queue was opened. These events are
+// returned by Get before any newly published events. The number is only an
+// estimate if a segment was not closed cleanly, use TryGet to find out
+// whether all events have been read.
+func (dq *diskQueue) RestoredEvents() int {
+	return dq.restoredEventCount
+}
+
+// RestoredSegments returns the number of segments from a previous session
+// that may still hold pending events when the queue was opened.
+func (dq *diskQueue) RestoredSegments() int {
+	return dq.restoredSegmentCount
+}
+
 func (dq *diskQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
 	return &diskQueueProducer{
 		queue:   dq,
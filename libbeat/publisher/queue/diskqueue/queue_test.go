@@ -20,12 +20,18 @@ package diskqueue
 import (
 	"flag"
 	"math/rand/v2"
+	"os"
+	"sync/atomic"
 	"testing"
 	"time"
 
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
 	"github.com/elastic/beats/v7/libbeat/publisher/queue"
 	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
 	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
 )
 
 var seed int64
@@ -69,14 +75,24 @@ func TestProduceConsumer(t *testing.T) {
 		}
 	}
 
-	t.Run("direct", testWith(makeTestQueue()))
+	t.Run("direct", testWith(makeTestQueue(nil)))
+	t.Run("encrypted", testWith(makeTestQueue(func(settings *Settings) {
+		settings.EncryptionKey = []byte("0123456789abcdef0123456789abcdef")
+	})))
+	t.Run("encrypted compressed", testWith(makeTestQueue(func(settings *Settings) {
+		settings.UseCompression = true
+		settings.EncryptionKey = []byte("0123456789abcdef")
+	})))
 }
 
-func makeTestQueue() queuetest.QueueFactory {
+func makeTestQueue(modify func(*Settings)) queuetest.QueueFactory {
 	return func(t *testing.T) queue.Queue {
 		dir := t.TempDir()
 		settings := DefaultSettings()
 		settings.Path = dir
+		if modify != nil {
+			modify(&settings)
+		}
 		logger := logptest.NewTestingLogger(t, "")
 		queue, _ := NewQueue(logger, nil, settings, nil)
 		return testQueue{
@@ -89,3 +105,71 @@ func (t testQueue) Close() error {
 	err := t.diskQueue.Close()
 	return err
 }
+
+func TestRestoreCompressedSegment(t *testing.T) {
+	for name, unclean := range map[string]bool{"clean": false, "unclean": true} {
+		t.Run(name, func(t *testing.T) {
+			settings := DefaultSettings()
+			settings.Path = t.TempDir()
+			settings.UseCompression = true
+
+			dq, err := NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, nil)
+			require.NoError(t, err)
+			var written atomic.Int64
+			producer := dq.Producer(queue.ProducerConfig{
+				ACK: func(count int) { written.Add(int64(count)) },
+			})
+			for i := 0; i < 3; i++ {
+				_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"count": i}))
+				require.True(t, ok)
+			}
+			require.Eventually(t, func() bool { return written.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+			require.NoError(t, dq.Close())
+
+			// The frame count is written to the segment header, after the
+			// 4 byte version, once the segment is closed.
+			require.Eventually(t, func() bool {
+				header, err := readSegmentHeader(mustOpen(t, settings.segmentPath(0)))
+				require.NoError(t, err)
+				return header.frameCount == 3
+			}, 5*time.Second, 10*time.Millisecond)
+			if unclean {
+				// A segment that was not closed cleanly still has a frame
+				// count of 0.
+				f, err := os.OpenFile(settings.segmentPath(0), os.O_WRONLY, 0)
+				require.NoError(t, err)
+				_, err = f.WriteAt([]byte{0, 0, 0, 0}, 4)
+				require.NoError(t, err)
+				require.NoError(t, f.Close())
+			}
+
+			dq, err = NewQueue(logptest.NewTestingLogger(t, ""), nil, settings, nil)
+			require.NoError(t, err)
+			defer dq.Close()
+			assert.Equal(t, 3, dq.RestoredEvents())
+			assert.Equal(t, 1, dq.RestoredSegments())
+
+			// All events are read, even though the decompressed data is
+			// larger than the segment file.
+			count := 0
+			for count < 3 {
+				batch, err := dq.TryGet(3)
+				require.NoError(t, err)
+				require.NotNil(t, batch)
+				count += batch.Count()
+			}
+			assert.Equal(t, 3, count)
+			batch, err := dq.TryGet(3)
+			require.NoError(t, err)
+			assert.Nil(t, batch)
+		})
+	}
+}
+
+func mustOpen(t *testing.T, path string) *os.File {
+	t.Helper()
+	f, err := os.Open(path)
+	require.NoError(t, err)
+	t.Cleanup(func() { f.Close() })
+	return f
+}
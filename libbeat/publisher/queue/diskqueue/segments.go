@@ -121,7 +121,7 @@ type queueSegment struct {
 }
 
 type segmentHeader struct {
-	// The schema version for this segment file. Current schema version is 2.
+	// The schema version for this segment file. Current schema version is 3.
 	version uint32
 
 	// If the segment file has been completely written, this field contains
@@ -141,7 +141,11 @@ type WriteCloseSyncer interface {
 	Sync() error
 }
 
-const currentSegmentVersion = 2
+const currentSegmentVersion = 3
+
+// Segments that don't use encryption are still written with schema
+// version 2, so they remain readable by earlier versions.
+const unencryptedSegmentVersion = 2
 
 // Segment headers are currently a 4-byte version, a 4-byte frame count and 1-byte options.
 // In contexts where the segment may have been created by an earlier version,
@@ -153,6 +157,7 @@ const (
 	_                  uint32 = 1 << iota // 0x1
 	ENABLE_COMPRESSION                    // 0x2
 	ENABLE_PROTOBUF                       // 0x4
+	ENABLE_ENCRYPTION                     // 0x8
 )
 
 // Sort order: we store loaded segments in ascending order by their id.
@@ -162,9 +167,10 @@ func (s bySegmentID) Len() int           { return len(s) }
 func (s bySegmentID) Swap(i, j int)      { s[i], s[j] = s[j], s[i] }
 func (s bySegmentID) Less(i, j int) bool { return s[i].id < s[j].id }
 
-// Scan the given path for segment files, and return them in a list
+// Scan the queue directory for segment files, and return them in a list
 // ordered by segment id.
-func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment, error) {
+func scanExistingSegments(logger *logp.Logger, settings Settings) ([]*queueSegment, error) {
+	pathStr := settings.directoryPath()
 	dirEntries, err := os.ReadDir(pathStr)
 	if err != nil {
 		return nil, fmt.Errorf("could not read queue directory '%s': %w", pathStr, err)
@@ -197,12 +203,35 @@ func scanExistingSegments(logger *logp.Logger, pathStr string) ([]*queueSegment,
 						"error loading segment file '%v', data may be incomplete: %v",
 						fullPath, err)
 				}
-				segments = append(segments, &queueSegment{
+				segment := &queueSegment{
 					id:            segmentID(id),
 					schemaVersion: &header.version,
 					frameCount:    header.frameCount,
 					byteCount:     uint64(file.Size()),
-				})
+				}
+				if header.options&(ENABLE_COMPRESSION|ENABLE_ENCRYPTION) != 0 {
+					// The reader loop reads the decoded data, whose size
+					// doesn't match the file size.
+					frameCount, byteCount, err := scanEncodedSegment(settings, segment)
+					switch {
+					case err == nil || frameCount > 0:
+						if err != nil {
+							logger.Warnf(
+								"error loading segment file '%v', data may be incomplete: %v",
+								fullPath, err)
+						}
+						segment.frameCount = frameCount
+						segment.byteCount = byteCount
+					case header.frameCount == 0:
+						logger.Errorf("couldn't load segment file '%v': %v", fullPath, err)
+						continue
+					default:
+						// The segment might still be readable with other
+						// settings, keep what the header says.
+						logger.Warnf("couldn't scan segment file '%v': %v", fullPath, err)
+					}
+				}
+				segments = append(segments, segment)
 			}
 		}
 	}
@@ -255,8 +284,27 @@ func (segment *queueSegment) getReader(queueSettings Settings) (*segmentReader,
 		sr.serializationFormat = SerializationCBOR
 	}
 
+	if (header.options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		keys := queueSettings.decryptionKeys()
+		if len(keys) == 0 {
+			file.Close()
+			return nil, fmt.Errorf(
+				"segment %d is encrypted but no encryption key is configured", segment.id)
+		}
+		sr.er, err = NewEncryptionReader(sr.src, keys)
+		if err != nil {
+			file.Close()
+			return nil, fmt.Errorf(
+				"couldn't set up decryption for segment %d: %w", segment.id, err)
+		}
+	}
+
 	if (header.options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sr.cr = NewCompressionReader(sr.src)
+		if sr.er != nil {
+			sr.cr = NewCompressionReader(sr.er)
+		} else {
+			sr.cr = NewCompressionReader(sr.src)
+		}
 	}
 	return sr, nil
 }
@@ -275,16 +323,32 @@ func (segment *queueSegment) getWriter(queueSettings Settings) (*segmentWriter,
 	if queueSettings.UseCompression {
 		options = options | ENABLE_COMPRESSION
 	}
+	if len(queueSettings.EncryptionKey) > 0 {
+		options = options | ENABLE_ENCRYPTION
+	}
 
 	sw := &segmentWriter{}
 	sw.dst = file
 
 	if err := sw.WriteHeader(options); err != nil {
+		file.Close()
 		return nil, err
 	}
 
+	if (options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		sw.ew, err = NewEncryptionWriter(sw.dst, queueSettings.EncryptionKey)
+		if err != nil {
+			file.Close()
+			return nil, err
+		}
+	}
+
 	if (options & ENABLE_COMPRESSION) == ENABLE_COMPRESSION {
-		sw.cw = NewCompressionWriter(sw.dst)
+		if sw.ew != nil {
+			sw.cw = NewCompressionWriter(sw.ew)
+		} else {
+			sw.cw = NewCompressionWriter(sw.dst)
+		}
 	}
 
 	return sw, nil
@@ -335,6 +399,11 @@ func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
 	if header.frameCount > 0 {
 		return header, nil
 	}
+	// The frames of compressed or encrypted segments can't be scanned
+	// without decoding them, see scanEncodedSegment.
+	if header.options&(ENABLE_COMPRESSION|ENABLE_ENCRYPTION) != 0 {
+		return header, nil
+	}
 	// If we made it here, we loaded a valid header but the frame count is
 	// zero, so we need to check it with a manual scan. This can
 	// only happen in one of two uncommon situations:
@@ -385,6 +454,52 @@ func readSegmentHeaderWithFrameCount(path string) (*segmentHeader, error) {
 	return nil, err
 }
 
+// scanEncodedSegment decodes the given compressed or encrypted segment, and
+// returns the number of its frames and its size including the header, as
+// seen by the reader loop. If an error is returned, the frame count and
+// size cover the frames read before the error.
+func scanEncodedSegment(settings Settings, segment *queueSegment) (uint32, uint64, error) {
+	handle, err := segment.getReader(settings)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer handle.Close()
+
+	reader := autoRetryReader{handle}
+	frameCount := uint32(0)
+	byteCount := segment.headerSize()
+	for {
+		var frameLength uint32
+		err := binary.Read(reader, binary.LittleEndian, &frameLength)
+		if errors.Is(err, io.EOF) {
+			// EOF at a frame boundary means we scanned all frames.
+			return frameCount, byteCount, nil
+		}
+		if err != nil {
+			return frameCount, byteCount, err
+		}
+		if frameLength < frameMetadataSize {
+			return frameCount, byteCount, fmt.Errorf("invalid frame length: %v", frameLength)
+		}
+		// Skip to the trailing length, which has to match the leading one.
+		_, err = io.CopyN(io.Discard, reader, int64(frameLength)-8)
+		if err != nil {
+			return frameCount, byteCount, err
+		}
+		var duplicateLength uint32
+		err = binary.Read(reader, binary.LittleEndian, &duplicateLength)
+		if err != nil {
+			return frameCount, byteCount, err
+		}
+		if frameLength != duplicateLength {
+			return frameCount, byteCount, fmt.Errorf(
+				"mismatched frame length: %v vs %v", frameLength, duplicateLength)
+		}
+		frameCount++
+		byteCount += uint64(frameLength)
+	}
+}
+
 // readSegmentHeader decodes a raw header from the given reader and
 // returns it as a struct.
 func readSegmentHeader(in io.Reader) (*segmentHeader, error) {
@@ -435,34 +550,41 @@ func (segments *diskQueueSegments) sizeOnDisk() uint64 {
 
 // segmentReader handles reading of segments.  getReader sets up the
 // reader and handles setting up the Reader to deal with the different
-// schema version.  With Schema version 2 there is the option for
+// schema version.  With Schema version 3 there is the option for
 // plain data, encrypted data, compressed data and encrypted
 // compressed data.  If compression is enabled operations go through
-// the CompressionReader because compressing encrypted data defeats
+// the CompressionReader, which reads from the EncryptionReader if
+// encryption is enabled, because compressing encrypted data defeats
 // the purpose of compression since encryption will make the data
 // less compressable.
 type segmentReader struct {
 	src                 io.ReadSeekCloser
+	er                  *EncryptionReader
 	cr                  *CompressionReader
 	serializationFormat SerializationFormat
 }
 
-func (r *segmentReader) Read(p []byte) (int, error) {
+// reader returns the outermost reader of the segment data.
+func (r *segmentReader) reader() io.ReadCloser {
 	if r.cr != nil {
-		return r.cr.Read(p)
+		return r.cr
+	}
+	if r.er != nil {
+		return r.er
 	}
-	return r.src.Read(p)
+	return r.src
+}
+
+func (r *segmentReader) Read(p []byte) (int, error) {
+	return r.reader().Read(p)
 }
 
 func (r *segmentReader) Close() error {
-	if r.cr != nil {
-		return r.cr.Close()
-	}
-	return r.src.Close()
+	return r.reader().Close()
 }
 
 func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
-	if r.cr != nil {
+	if r.cr != nil || r.er != nil {
 		//can't seek before segment header
 		if (offset + int64(whence)) < segmentHeaderSize {
 			return 0, fmt.Errorf("illegal seek offset %d, whence %d", offset, whence)
@@ -470,46 +592,57 @@ func (r *segmentReader) Seek(offset int64, whence int) (int64, error) {
 		if _, err := r.src.Seek(segmentHeaderSize, io.SeekStart); err != nil {
 			return 0, fmt.Errorf("could not seek past segment header: %w", err)
 		}
-		if err := r.cr.Reset(); err != nil {
-			return 0, fmt.Errorf("could not reset compression: %w", err)
+		if r.er != nil {
+			if err := r.er.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset encryption: %w", err)
+			}
+		}
+		if r.cr != nil {
+			if err := r.cr.Reset(); err != nil {
+				return 0, fmt.Errorf("could not reset compression: %w", err)
+			}
 		}
-		written, err := io.CopyN(io.Discard, r.cr, (offset+int64(whence))-segmentHeaderSize)
+		written, err := io.CopyN(io.Discard, r.reader(), (offset+int64(whence))-segmentHeaderSize)
 		return written + segmentHeaderSize, err
 	}
 	return r.src.Seek(offset, whence)
 }
 
-// segmentWriter handles writing of segments.  With Schema version 2
+// segmentWriter handles writing of segments.  With Schema version 3
 // there is the option for plain data, encrypted data, compressed data
 // and encrypted compressed data.  getWriter sets up the segmentWriter
 // to handle these options.  If compression is enabled operations go
-// through the CompressionWriter because compressing encrypted data
+// through the CompressionWriter, which writes to the EncryptionWriter
+// if encryption is enabled, because compressing encrypted data
 // defeats the purpose of compression since encryption will make the
 // data less compressable.
 type segmentWriter struct {
 	dst *os.File
+	ew  *EncryptionWriter
 	cw  *CompressionWriter
 }
 
-func (w *segmentWriter) Write(p []byte) (int, error) {
+// writer returns the outermost writer of the segment data.
+func (w *segmentWriter) writer() WriteCloseSyncer {
 	if w.cw != nil {
-		return w.cw.Write(p)
+		return w.cw
+	}
+	if w.ew != nil {
+		return w.ew
 	}
-	return w.dst.Write(p)
+	return w.dst
+}
+
+func (w *segmentWriter) Write(p []byte) (int, error) {
+	return w.writer().Write(p)
 }
 
 func (w *segmentWriter) Close() error {
-	if w.cw != nil {
-		return w.cw.Close()
-	}
-	return w.dst.Close()
+	return w.writer().Close()
 }
 
 func (w *segmentWriter) Sync() error {
-	if w.cw != nil {
-		return w.cw.Sync()
-	}
-	return w.dst.Sync()
+	return w.writer().Sync()
 }
 
 func (w *segmentWriter) WriteHeader(options uint32) error {
@@ -518,8 +651,15 @@ func (w *segmentWriter) WriteHeader(options uint32) error {
 		return fmt.Errorf("could not seek to beginning of segment: %w", err)
 	}
 
+	// Encryption requires schema version 3, other segments are written
+	// with version 2, so they can still be read after a downgrade.
+	version := uint32(unencryptedSegmentVersion)
+	if (options & ENABLE_ENCRYPTION) == ENABLE_ENCRYPTION {
+		version = currentSegmentVersion
+	}
+
 	//write version
-	err = binary.Write(w.dst, binary.LittleEndian, uint32(2))
+	err = binary.Write(w.dst, binary.LittleEndian, version)
 	if err != nil {
 		return fmt.Errorf("could not write version to segment: %w", err)
 	}
@@ -28,6 +28,7 @@ func TestSegmentsRoundTrip(t *testing.T) {
 	tests := map[string]struct {
 		id        segmentID
 		compress  bool
+		encrypt   bool
 		plaintext []byte
 	}{
 		"No Compression": {
@@ -40,6 +41,17 @@ func TestSegmentsRoundTrip(t *testing.T) {
 			compress:  true,
 			plaintext: []byte("compression only"),
 		},
+		"With Encryption": {
+			id:        3,
+			encrypt:   true,
+			plaintext: []byte("encryption only"),
+		},
+		"With Encryption and Compression": {
+			id:        4,
+			compress:  true,
+			encrypt:   true,
+			plaintext: []byte("encryption and compression"),
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
@@ -47,6 +59,9 @@ func TestSegmentsRoundTrip(t *testing.T) {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		if tc.encrypt {
+			settings.EncryptionKey = testKey
+		}
 		qs := &queueSegment{
 			id: tc.id,
 		}
@@ -84,6 +99,7 @@ func TestSegmentReaderSeek(t *testing.T) {
 	tests := map[string]struct {
 		id         segmentID
 		compress   bool
+		encrypt    bool
 		plaintexts [][]byte
 	}{
 		"No Compression": {
@@ -96,12 +112,26 @@ func TestSegmentReaderSeek(t *testing.T) {
 			compress:   true,
 			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
 		},
+		"With Encryption": {
+			id:         3,
+			encrypt:    true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
+		"With Encryption and Compression": {
+			id:         4,
+			compress:   true,
+			encrypt:    true,
+			plaintexts: [][]byte{[]byte("abc"), []byte("defg")},
+		},
 	}
 	dir := t.TempDir()
 	for name, tc := range tests {
 		settings := DefaultSettings()
 		settings.Path = dir
 		settings.UseCompression = tc.compress
+		if tc.encrypt {
+			settings.EncryptionKey = testKey
+		}
 
 		qs := &queueSegment{
 			id: tc.id,
@@ -0,0 +1,117 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/config"
+)
+
+// Settings contains the configuration fields to create a new hybrid queue.
+type Settings struct {
+	// Mem configures the memory tier, which holds events while the output
+	// keeps up.
+	Mem memqueue.Settings
+
+	// Disk configures the disk tier, which holds events once the queue
+	// started spilling.
+	Disk diskqueue.Settings
+
+	// SpillThreshold is the number of events held by the memory tier at
+	// which new events are written to the disk tier instead.
+	SpillThreshold int
+
+	// StallTimeout is the time after which the output is considered stalled
+	// if it doesn't acknowledge any events held by the memory tier. New
+	// events are written to the disk tier while the output is stalled.
+	// A value of 0 disables stall detection.
+	StallTimeout time.Duration
+}
+
+// userConfig holds the parameters for a hybrid queue that are
+// configurable by the end user in the beats yml file.
+type userConfig struct {
+	Mem   *config.C   `config:"mem"`
+	Disk  *config.C   `config:"disk"`
+	Spill spillConfig `config:"spill"`
+}
+
+type spillConfig struct {
+	// Threshold is the fraction of the memory tier's capacity at which
+	// events start spilling to disk.
+	Threshold    float64       `config:"threshold"`
+	StallTimeout time.Duration `config:"stall_timeout"`
+}
+
+var defaultSpillConfig = spillConfig{
+	Threshold:    1.0,
+	StallTimeout: 30 * time.Second,
+}
+
+func (c *spillConfig) Validate() error {
+	if c.Threshold <= 0 || c.Threshold > 1 {
+		return fmt.Errorf(
+			"hybrid queue spill.threshold (%v) must be greater than 0 and at most 1", c.Threshold)
+	}
+	if c.StallTimeout < 0 {
+		return fmt.Errorf(
+			"hybrid queue spill.stall_timeout (%v) can't be negative", c.StallTimeout)
+	}
+	return nil
+}
+
+// SettingsForUserConfig returns a Settings struct initialized with the
+// end-user-configurable settings in the given config tree.
+func SettingsForUserConfig(cfg *config.C) (Settings, error) {
+	userConfig := userConfig{Spill: defaultSpillConfig}
+	if cfg != nil {
+		if err := cfg.Unpack(&userConfig); err != nil {
+			return Settings{}, fmt.Errorf("couldn't unpack hybrid queue config: %w", err)
+		}
+	}
+
+	memSettings, err := memqueue.SettingsForUserConfig(userConfig.Mem)
+	if err != nil {
+		return Settings{}, fmt.Errorf("hybrid queue mem: %w", err)
+	}
+
+	// The disk tier requires at least max_size, report a missing disk
+	// section the same way as a missing max_size.
+	if userConfig.Disk == nil {
+		userConfig.Disk = config.NewConfig()
+	}
+	diskSettings, err := diskqueue.SettingsForUserConfig(userConfig.Disk)
+	if err != nil {
+		return Settings{}, fmt.Errorf("hybrid queue disk: %w", err)
+	}
+
+	threshold := int(userConfig.Spill.Threshold * float64(memSettings.Events))
+	if threshold < 1 {
+		threshold = 1
+	}
+	return Settings{
+		Mem:            memSettings,
+		Disk:           diskSettings,
+		SpillThreshold: threshold,
+		StallTimeout:   userConfig.Spill.StallTimeout,
+	}, nil
+}
@@ -0,0 +1,155 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"sync"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+)
+
+// producer publishes events to the tier selected by the queue. The memory
+// tier acknowledges events once the output has processed them, the disk
+// tier once they have been written to disk. producer combines both, such
+// that ACKs are reported in the order the events were published.
+type producer struct {
+	queue *hybridQueue
+	mem   queue.Producer
+	disk  queue.Producer
+
+	// ACKs are reported by both tiers, ackMutex ensures the callback is
+	// never run concurrently.
+	ack      func(count int)
+	ackMutex sync.Mutex
+
+	mutex sync.Mutex
+	// pending holds the events that have not been ACKed yet, as runs of
+	// consecutive events published to the same tier.
+	pending []ackRun
+}
+
+type ackRun struct {
+	tier  tier
+	count int
+	acked int
+}
+
+func newProducer(q *hybridQueue, cfg queue.ProducerConfig) *producer {
+	p := &producer{queue: q, ack: cfg.ACK}
+	p.mem = q.mem.Producer(queue.ProducerConfig{
+		ACK: func(count int) {
+			q.memACKed(count)
+			p.onACK(memTier, count)
+		},
+	})
+	p.disk = q.disk.Producer(queue.ProducerConfig{
+		ACK: func(count int) { p.onACK(diskTier, count) },
+	})
+	return p
+}
+
+func (p *producer) Publish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, queue.Producer.Publish)
+}
+
+func (p *producer) TryPublish(entry queue.Entry) (queue.EntryID, bool) {
+	return p.publish(entry, queue.Producer.TryPublish)
+}
+
+func (p *producer) publish(
+	entry queue.Entry,
+	publishFn func(queue.Producer, queue.Entry) (queue.EntryID, bool),
+) (queue.EntryID, bool) {
+	t := p.queue.reserve()
+
+	// Register the event before publishing, the tier might ACK it before
+	// Publish returns.
+	p.mutex.Lock()
+	if last := len(p.pending) - 1; last >= 0 && p.pending[last].tier == t {
+		p.pending[last].count++
+	} else {
+		p.pending = append(p.pending, ackRun{tier: t, count: 1})
+	}
+	p.mutex.Unlock()
+
+	target := p.mem
+	if t == diskTier {
+		target = p.disk
+	}
+	id, ok := publishFn(target, entry)
+	if !ok {
+		p.mutex.Lock()
+		last := len(p.pending) - 1
+		p.pending[last].count--
+		if p.pending[last].count == 0 {
+			p.pending = p.pending[:last]
+		}
+		// The remaining events of the run might all be ACKed already.
+		acked := p.collectACKedLocked()
+		p.mutex.Unlock()
+		p.notifyACK(acked)
+	}
+	p.queue.published(t, ok)
+	return id, ok
+}
+
+func (p *producer) Close() {
+	p.mem.Close()
+	p.disk.Close()
+}
+
+// onACK is called by a tier when count events published by this producer
+// have been ACKed.
+func (p *producer) onACK(t tier, count int) {
+	p.mutex.Lock()
+	for i := range p.pending {
+		if count == 0 {
+			break
+		}
+		run := &p.pending[i]
+		if run.tier != t || run.acked == run.count {
+			continue
+		}
+		n := min(count, run.count-run.acked)
+		run.acked += n
+		count -= n
+	}
+	acked := p.collectACKedLocked()
+	p.mutex.Unlock()
+
+	p.notifyACK(acked)
+}
+
+// collectACKedLocked removes all fully ACKed runs from the head of the
+// pending list, and returns their number of events.
+func (p *producer) collectACKedLocked() int {
+	acked := 0
+	for len(p.pending) > 0 && p.pending[0].acked == p.pending[0].count {
+		acked += p.pending[0].count
+		p.pending = p.pending[1:]
+	}
+	return acked
+}
+
+func (p *producer) notifyACK(count int) {
+	if count > 0 && p.ack != nil {
+		p.ackMutex.Lock()
+		defer p.ackMutex.Unlock()
+		p.ack(count)
+	}
+}
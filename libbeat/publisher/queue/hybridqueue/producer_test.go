@@ -0,0 +1,64 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestProducerACKOrder(t *testing.T) {
+	var acked []int
+	p := &producer{ack: func(count int) { acked = append(acked, count) }}
+	// 2 events in memory, 3 on disk, 1 in memory
+	p.pending = []ackRun{
+		{tier: memTier, count: 2},
+		{tier: diskTier, count: 3},
+		{tier: memTier, count: 1},
+	}
+
+	// Disk ACKs can't be reported before the memory events published earlier.
+	p.onACK(diskTier, 3)
+	assert.Empty(t, acked)
+
+	p.onACK(memTier, 1)
+	assert.Empty(t, acked)
+
+	// The second memory ACK covers the last event of the first run and the
+	// event of the third run.
+	p.onACK(memTier, 2)
+	assert.Equal(t, []int{6}, acked)
+	assert.Empty(t, p.pending)
+}
+
+func TestProducerACKPartialRuns(t *testing.T) {
+	var acked []int
+	p := &producer{ack: func(count int) { acked = append(acked, count) }}
+	p.pending = []ackRun{
+		{tier: diskTier, count: 4},
+		{tier: memTier, count: 2},
+	}
+
+	p.onACK(diskTier, 2)
+	assert.Empty(t, acked)
+	p.onACK(memTier, 2)
+	assert.Empty(t, acked)
+	p.onACK(diskTier, 2)
+	assert.Equal(t, []int{6}, acked)
+}
@@ -0,0 +1,377 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// The string used to specify this queue in beats configurations.
+const QueueType = "hybrid"
+
+type tier int
+
+const (
+	memTier tier = iota
+	diskTier
+)
+
+func (t tier) String() string {
+	if t == diskTier {
+		return "disk"
+	}
+	return "memory"
+}
+
+// hybridQueue keeps events in a memory queue while the output keeps up,
+// and spills new events to a disk queue once the memory tier reaches its
+// threshold or the output stalls. Events are returned to the consumer in
+// the order they were published: once the queue started spilling, all
+// new events are written to disk until the disk tier has been drained.
+type hybridQueue struct {
+	logger   *logp.Logger
+	settings Settings
+
+	mem  queue.Queue
+	disk diskTierQueue
+
+	// getMutex serializes Get requests, so concurrent consumers can't
+	// both wait for the last event of a tier.
+	getMutex sync.Mutex
+
+	mutex sync.Mutex
+	cond  *sync.Cond
+
+	// spilling is set while new events are written to the disk tier.
+	spilling bool
+
+	// memActive is the number of events in the memory tier, including
+	// events that are being published and events that have been consumed
+	// but not acknowledged yet.
+	memActive int
+
+	// memPending and diskPending are the number of events that have been
+	// published to a tier but not yet returned by Get. They are negative
+	// while Get returned events whose publishing hasn't completed yet.
+	// diskPending is only exact once restoring is cleared.
+	memPending  int
+	diskPending int
+
+	// diskPublishing is the number of events that are being published to
+	// the disk tier, and diskPublished the number of events that have been
+	// published to it.
+	diskPublishing int
+	diskPublished  int
+
+	// restoring is set while the disk tier may hold events from a previous
+	// session that haven't been returned by Get. The number of these events
+	// is only known once the disk tier has been drained.
+	restoring bool
+
+	// lastProgress is the last time the output acknowledged events from
+	// the memory tier, or the memory tier received an event while empty.
+	lastProgress time.Time
+
+	closing bool
+	done    chan struct{}
+}
+
+// diskTierQueue is the disk queue used as disk tier.
+type diskTierQueue interface {
+	queue.Queue
+
+	// TryGet returns a nil batch instead of blocking if all events written
+	// to the queue have been returned already.
+	TryGet(eventCount int) (queue.Batch, error)
+}
+
+// FactoryForSettings is a simple wrapper around NewQueue so a concrete
+// Settings object can be wrapped in a queue-agnostic interface for
+// later use by the pipeline.
+func FactoryForSettings(settings Settings) queue.QueueFactory {
+	return func(
+		logger *logp.Logger,
+		observer queue.Observer,
+		inputQueueSize int,
+		encoderFactory queue.EncoderFactory,
+	) (queue.Queue, error) {
+		return NewQueue(logger, observer, settings, inputQueueSize, encoderFactory)
+	}
+}
+
+// NewQueue creates a hybrid queue with the given settings. Events left in
+// the disk tier by a previous session are returned before any new events.
+func NewQueue(
+	logger *logp.Logger,
+	observer queue.Observer,
+	settings Settings,
+	inputQueueSize int,
+	encoderFactory queue.EncoderFactory,
+) (*hybridQueue, error) {
+	if logger == nil {
+		logger = logp.NewLogger("hybridqueue")
+	} else {
+		logger = logger.Named("hybridqueue")
+	}
+	if observer == nil {
+		observer = queue.NewQueueObserver(nil)
+	}
+	if settings.SpillThreshold <= 0 || settings.SpillThreshold > settings.Mem.Events {
+		settings.SpillThreshold = settings.Mem.Events
+	}
+
+	disk, err := diskqueue.NewQueue(
+		logger, queue.NewTierObserver(observer, diskTier.String()), settings.Disk, encoderFactory)
+	if err != nil {
+		return nil, fmt.Errorf("couldn't create disk tier: %w", err)
+	}
+	mem := memqueue.NewQueue(
+		logger, queue.NewTierObserver(observer, memTier.String()), settings.Mem, inputQueueSize, encoderFactory)
+
+	observer.MaxEvents(settings.Mem.Events)
+	observer.MaxBytes(int(settings.Disk.MaxBufferSize))
+
+	q := &hybridQueue{
+		logger:   logger,
+		settings: settings,
+		mem:      mem,
+		disk:     disk,
+		done:     make(chan struct{}),
+	}
+	q.cond = sync.NewCond(&q.mutex)
+
+	// Events from a previous session have to be returned first, keep
+	// spilling until the disk tier has been drained. The number of restored
+	// events is only an estimate if a segment was not closed cleanly, so it
+	// can't tell when they have been read.
+	if disk.RestoredSegments() > 0 {
+		q.restoring = true
+		q.spilling = true
+		logger.Infof("Found about %v pending events in the disk tier, spilling new events to disk until they have been read", disk.RestoredEvents())
+	}
+
+	// The disk queue doesn't signal when its shutdown is complete, so Done
+	// only follows the memory tier.
+	go func() {
+		<-mem.Done()
+		close(q.done)
+	}()
+
+	return q, nil
+}
+
+func (q *hybridQueue) Close() error {
+	q.mutex.Lock()
+	q.closing = true
+	q.cond.Broadcast()
+	q.mutex.Unlock()
+
+	memErr := q.mem.Close()
+	diskErr := q.disk.Close()
+	if memErr != nil {
+		return memErr
+	}
+	return diskErr
+}
+
+func (q *hybridQueue) Done() <-chan struct{} {
+	return q.done
+}
+
+func (q *hybridQueue) QueueType() string {
+	return QueueType
+}
+
+func (q *hybridQueue) BufferConfig() queue.BufferConfig {
+	// The disk tier has no fixed event limit.
+	return queue.BufferConfig{MaxEvents: 0}
+}
+
+func (q *hybridQueue) Producer(cfg queue.ProducerConfig) queue.Producer {
+	return newProducer(q, cfg)
+}
+
+// Get returns events from the memory tier while it has pending events,
+// and from the disk tier otherwise.
+func (q *hybridQueue) Get(eventCount int) (queue.Batch, error) {
+	q.getMutex.Lock()
+	defer q.getMutex.Unlock()
+
+	for {
+		q.mutex.Lock()
+		for q.memPending <= 0 && q.diskPending <= 0 && !q.restoring && !q.closing {
+			q.cond.Wait()
+		}
+		var source tier
+		switch {
+		case q.memPending > 0:
+			source = memTier
+		case q.diskPending > 0 || (q.restoring && !q.closing):
+			source = diskTier
+		default:
+			q.mutex.Unlock()
+			return nil, io.EOF
+		}
+		restoring, published := q.restoring, q.diskPublished
+		q.mutex.Unlock()
+
+		if source == memTier {
+			batch, err := q.mem.Get(eventCount)
+			if err != nil {
+				return nil, err
+			}
+			q.mutex.Lock()
+			q.memPending -= batch.Count()
+			q.mutex.Unlock()
+			return batch, nil
+		}
+
+		var batch queue.Batch
+		var err error
+		if restoring {
+			// Restored events aren't counted by diskPending, only the disk
+			// tier knows whether any of them are left.
+			batch, err = q.disk.TryGet(eventCount)
+		} else {
+			batch, err = q.disk.Get(eventCount)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		q.mutex.Lock()
+		if batch == nil {
+			q.finishRestoringLocked(published)
+			q.mutex.Unlock()
+			continue
+		}
+		q.diskPending -= batch.Count()
+		if restoring && q.diskPending < 0 {
+			// Restored events were read.
+			q.diskPending = 0
+		}
+		q.maybeStopSpillingLocked()
+		q.mutex.Unlock()
+		return batch, nil
+	}
+}
+
+// finishRestoringLocked is called once TryGet found the disk tier drained,
+// with the value of diskPublished before TryGet was called. If events were
+// published to the disk tier since, diskPending can't tell whether they
+// have been read, so the disk tier has to be checked again.
+func (q *hybridQueue) finishRestoringLocked(published int) {
+	// An event that is being published might have been read already.
+	for q.diskPublished == published && q.diskPublishing > 0 && !q.closing {
+		q.cond.Wait()
+	}
+	if q.diskPublished != published || q.closing {
+		// Check the disk tier again.
+		return
+	}
+	q.restoring = false
+	q.diskPending = 0
+	q.logger.Info("All events restored from the disk tier have been read")
+	q.maybeStopSpillingLocked()
+}
+
+// reserve selects the tier for the next event. Events for the memory
+// tier are counted right away, so concurrent producers can't exceed the
+// spill threshold.
+func (q *hybridQueue) reserve() tier {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	if !q.spilling {
+		now := time.Now()
+		switch {
+		case q.memActive >= q.settings.SpillThreshold:
+			q.startSpillingLocked("the memory tier reached its threshold")
+		case q.memActive > 0 && q.settings.StallTimeout > 0 &&
+			now.Sub(q.lastProgress) >= q.settings.StallTimeout:
+			q.startSpillingLocked("the output stalled")
+		default:
+			if q.memActive == 0 {
+				q.lastProgress = now
+			}
+			q.memActive++
+			return memTier
+		}
+	}
+	q.diskPublishing++
+	return diskTier
+}
+
+// published is called once the event reserved for the given tier has been
+// published, or publishing failed.
+func (q *hybridQueue) published(t tier, ok bool) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+
+	switch t {
+	case memTier:
+		if ok {
+			q.memPending++
+		} else {
+			q.memActive--
+		}
+	case diskTier:
+		q.diskPublishing--
+		if ok {
+			q.diskPending++
+			q.diskPublished++
+		} else {
+			q.maybeStopSpillingLocked()
+		}
+	}
+	// Wake up Get, if it waits for events or for publishing to the disk
+	// tier to complete.
+	q.cond.Signal()
+}
+
+// memACKed is called when events from the memory tier have been
+// acknowledged by the output.
+func (q *hybridQueue) memACKed(count int) {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	q.memActive -= count
+	q.lastProgress = time.Now()
+}
+
+func (q *hybridQueue) startSpillingLocked(reason string) {
+	q.spilling = true
+	q.logger.Infof("Spilling new events to the disk tier, because %v (%v events in memory)", reason, q.memActive)
+}
+
+// maybeStopSpillingLocked switches back to the memory tier once all events
+// written to the disk tier have been read.
+func (q *hybridQueue) maybeStopSpillingLocked() {
+	if q.spilling && !q.restoring && q.diskPending == 0 && q.diskPublishing == 0 {
+		q.spilling = false
+		q.lastProgress = time.Now()
+		q.logger.Info("The disk tier has been drained, new events are kept in memory again")
+	}
+}
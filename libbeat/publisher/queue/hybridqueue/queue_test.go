@@ -0,0 +1,352 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package hybridqueue
+
+import (
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/elastic/beats/v7/libbeat/publisher"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/diskqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/memqueue"
+	"github.com/elastic/beats/v7/libbeat/publisher/queue/queuetest"
+	"github.com/elastic/elastic-agent-libs/config"
+	"github.com/elastic/elastic-agent-libs/logp/logptest"
+	"github.com/elastic/elastic-agent-libs/mapstr"
+	"github.com/elastic/elastic-agent-libs/monitoring"
+)
+
+func testSettings(t *testing.T) Settings {
+	disk := diskqueue.DefaultSettings()
+	disk.Path = t.TempDir()
+	return Settings{
+		Mem:            memqueue.Settings{Events: 64, MaxGetRequest: 64},
+		Disk:           disk,
+		SpillThreshold: 16,
+	}
+}
+
+func newTestQueue(t *testing.T, settings Settings, metrics *monitoring.Registry) *hybridQueue {
+	q, err := NewQueue(logptest.NewTestingLogger(t, ""), queue.NewQueueObserver(metrics), settings, 0, nil)
+	require.NoError(t, err)
+	t.Cleanup(func() { q.Close() })
+	return q
+}
+
+func TestProduceConsumer(t *testing.T) {
+	// The spill threshold is much lower than the number of events, so all
+	// tests switch between the memory and disk tiers.
+	factory := func(t *testing.T) queue.Queue {
+		// The tiers may still log once a test completed, so don't log to t.
+		q, err := NewQueue(nil, nil, testSettings(t), 0, nil)
+		require.NoError(t, err)
+		return q
+	}
+
+	t.Run("single", func(t *testing.T) {
+		queuetest.TestSingleProducerConsumer(t, 200, 10, factory)
+	})
+	t.Run("multi", func(t *testing.T) {
+		queuetest.TestMultiProducerConsumer(t, 200, 10, factory)
+	})
+}
+
+func publishCounted(t *testing.T, producer queue.Producer, from, to int) {
+	t.Helper()
+	for i := from; i < to; i++ {
+		_, ok := producer.Publish(queuetest.MakeEvent(mapstr.M{"count": i}))
+		require.True(t, ok)
+	}
+}
+
+// getCounted reads a batch from the queue and returns the counts of its
+// events.
+func getCounted(t *testing.T, q queue.Queue) ([]int, queue.Batch) {
+	t.Helper()
+	batch, err := q.Get(100)
+	require.NoError(t, err)
+	counts := make([]int, batch.Count())
+	for i := range counts {
+		event := batch.Entry(i).(publisher.Event)
+		value, err := event.Content.Fields.GetValue("count")
+		require.NoError(t, err)
+		// The disk tier decodes numbers with their serialized width.
+		counts[i], err = strconv.Atoi(fmt.Sprint(value))
+		require.NoError(t, err)
+	}
+	return counts, batch
+}
+
+func intRange(from, to int) []int {
+	r := make([]int, 0, to-from)
+	for i := from; i < to; i++ {
+		r = append(r, i)
+	}
+	return r
+}
+
+func tierMetric(metrics *monitoring.Registry, name string) uint64 {
+	v, _ := metrics.Get("queue.tiers." + name).(*monitoring.Uint)
+	if v == nil {
+		return 0
+	}
+	return v.Get()
+}
+
+func TestSpillOnThreshold(t *testing.T) {
+	metrics := monitoring.NewRegistry()
+	settings := testSettings(t)
+	settings.SpillThreshold = 5
+	q := newTestQueue(t, settings, metrics)
+
+	var acked atomic.Int64
+	producer := q.Producer(queue.ProducerConfig{
+		ACK: func(count int) { acked.Add(int64(count)) },
+	})
+	publishCounted(t, producer, 0, 12)
+
+	assert.Equal(t, uint64(5), tierMetric(metrics, "memory.filled.events"))
+	assert.Equal(t, uint64(7), tierMetric(metrics, "disk.added.events"))
+
+	// Events are returned in order, starting with the memory tier.
+	counts, memBatch := getCounted(t, q)
+	assert.Equal(t, intRange(0, 5), counts)
+
+	var diskCounts []int
+	for len(diskCounts) < 7 {
+		counts, batch := getCounted(t, q)
+		diskCounts = append(diskCounts, counts...)
+		batch.Done()
+	}
+	assert.Equal(t, intRange(5, 12), diskCounts)
+
+	// The disk tier ACKs events once they are written, but the producer
+	// only sees ACKs in publishing order.
+	assert.Equal(t, int64(0), acked.Load())
+	memBatch.Done()
+	require.Eventually(t, func() bool { return acked.Load() == 12 }, 5*time.Second, 10*time.Millisecond)
+
+	// Once the disk tier is drained, new events are kept in memory again.
+	publishCounted(t, producer, 12, 14)
+	assert.Equal(t, uint64(7), tierMetric(metrics, "memory.added.events"))
+	assert.Equal(t, uint64(7), tierMetric(metrics, "disk.added.events"))
+
+	counts, batch := getCounted(t, q)
+	assert.Equal(t, []int{12, 13}, counts)
+	batch.Done()
+}
+
+func TestSpillOnStall(t *testing.T) {
+	metrics := monitoring.NewRegistry()
+	settings := testSettings(t)
+	settings.StallTimeout = 50 * time.Millisecond
+	q := newTestQueue(t, settings, metrics)
+
+	producer := q.Producer(queue.ProducerConfig{})
+	publishCounted(t, producer, 0, 1)
+
+	// The output reads the event, but doesn't ACK it.
+	counts, batch := getCounted(t, q)
+	assert.Equal(t, []int{0}, counts)
+
+	time.Sleep(2 * settings.StallTimeout)
+	publishCounted(t, producer, 1, 3)
+	assert.Equal(t, uint64(1), tierMetric(metrics, "memory.added.events"))
+	assert.Equal(t, uint64(2), tierMetric(metrics, "disk.added.events"))
+
+	batch.Done()
+	var diskCounts []int
+	for len(diskCounts) < 2 {
+		counts, batch := getCounted(t, q)
+		diskCounts = append(diskCounts, counts...)
+		batch.Done()
+	}
+	assert.Equal(t, []int{1, 2}, diskCounts)
+}
+
+func TestRestoredEventsAreReadFirst(t *testing.T) {
+	settings := testSettings(t)
+
+	// Leave some events in the disk queue, as a previous session would.
+	disk, err := diskqueue.NewQueue(logptest.NewTestingLogger(t, ""), nil, settings.Disk, nil)
+	require.NoError(t, err)
+	var written atomic.Int64
+	diskProducer := disk.Producer(queue.ProducerConfig{
+		ACK: func(count int) { written.Add(int64(count)) },
+	})
+	publishCounted(t, diskProducer, 0, 3)
+	require.Eventually(t, func() bool { return written.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+	// The disk queue doesn't report when it has shut down, but all events
+	// have been written and none were consumed, so nothing changes on disk
+	// anymore.
+	require.NoError(t, disk.Close())
+
+	metrics := monitoring.NewRegistry()
+	q := newTestQueue(t, settings, metrics)
+	producer := q.Producer(queue.ProducerConfig{})
+	publishCounted(t, producer, 3, 5)
+	assert.Equal(t, uint64(0), tierMetric(metrics, "memory.added.events"))
+
+	var received []int
+	for len(received) < 5 {
+		counts, batch := getCounted(t, q)
+		received = append(received, counts...)
+		batch.Done()
+	}
+	assert.Equal(t, intRange(0, 5), received)
+}
+
+func TestRestoredEventsOfUncleanSegmentAreReadFirst(t *testing.T) {
+	settings := testSettings(t)
+	settings.Disk.UseCompression = true
+
+	disk, err := diskqueue.NewQueue(logptest.NewTestingLogger(t, ""), nil, settings.Disk, nil)
+	require.NoError(t, err)
+	var written atomic.Int64
+	diskProducer := disk.Producer(queue.ProducerConfig{
+		ACK: func(count int) { written.Add(int64(count)) },
+	})
+	publishCounted(t, diskProducer, 0, 3)
+	require.Eventually(t, func() bool { return written.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+	require.NoError(t, disk.Close())
+
+	// A segment that was not closed cleanly still has a frame count of 0
+	// in its header, after the 4 byte version. The frames of a compressed
+	// segment can't be counted on startup.
+	segments, err := filepath.Glob(filepath.Join(settings.Disk.Path, "*.seg"))
+	require.NoError(t, err)
+	require.Len(t, segments, 1)
+	require.Eventually(t, func() bool {
+		// Closing the segment updates its frame count asynchronously.
+		header := make([]byte, 8)
+		f, err := os.Open(segments[0])
+		require.NoError(t, err)
+		defer f.Close()
+		_, err = io.ReadFull(f, header)
+		require.NoError(t, err)
+		return binary.LittleEndian.Uint32(header[4:]) == 3
+	}, 5*time.Second, 10*time.Millisecond)
+	f, err := os.OpenFile(segments[0], os.O_WRONLY, 0)
+	require.NoError(t, err)
+	_, err = f.WriteAt([]byte{0, 0, 0, 0}, 4)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	metrics := monitoring.NewRegistry()
+	q := newTestQueue(t, settings, metrics)
+	var acked atomic.Int64
+	producer := q.Producer(queue.ProducerConfig{
+		ACK: func(count int) { acked.Add(int64(count)) },
+	})
+	publishCounted(t, producer, 3, 5)
+	assert.Equal(t, uint64(0), tierMetric(metrics, "memory.added.events"))
+
+	var received []int
+	for len(received) < 5 {
+		counts, batch := getCounted(t, q)
+		received = append(received, counts...)
+		batch.Done()
+	}
+	assert.Equal(t, intRange(0, 5), received)
+
+	// The next Get finds the disk tier drained, new events are kept in
+	// memory then.
+	batches := make(chan queue.Batch, 1)
+	go func() {
+		batch, err := q.Get(100)
+		assert.NoError(t, err)
+		batches <- batch
+	}()
+	require.Eventually(t, func() bool {
+		q.mutex.Lock()
+		defer q.mutex.Unlock()
+		return !q.restoring && !q.spilling
+	}, 5*time.Second, 10*time.Millisecond)
+	publishCounted(t, producer, 5, 6)
+	batch := <-batches
+	require.NotNil(t, batch)
+	assert.Equal(t, 1, batch.Count())
+	batch.Done()
+	assert.Equal(t, uint64(1), tierMetric(metrics, "memory.added.events"))
+	require.Eventually(t, func() bool { return acked.Load() == 3 }, 5*time.Second, 10*time.Millisecond)
+}
+
+func TestSettingsForUserConfig(t *testing.T) {
+	tests := map[string]struct {
+		input   map[string]interface{}
+		check   func(t *testing.T, settings Settings)
+		wantErr string
+	}{
+		"defaults": {
+			input: map[string]interface{}{"disk.max_size": "1GB"},
+			check: func(t *testing.T, settings Settings) {
+				assert.Equal(t, 3200, settings.Mem.Events)
+				assert.Equal(t, 3200, settings.SpillThreshold)
+				assert.Equal(t, 30*time.Second, settings.StallTimeout)
+				assert.Equal(t, uint64(1e9), settings.Disk.MaxBufferSize)
+			},
+		},
+		"threshold": {
+			input: map[string]interface{}{
+				"mem.events":           1000,
+				"mem.flush.min_events": 500,
+				"disk.max_size":        "1GB",
+				"spill.threshold":      0.5,
+				"spill.stall_timeout":  "0s",
+			},
+			check: func(t *testing.T, settings Settings) {
+				assert.Equal(t, 500, settings.SpillThreshold)
+				assert.Equal(t, time.Duration(0), settings.StallTimeout)
+			},
+		},
+		"missing disk size": {
+			input:   map[string]interface{}{},
+			wantErr: "hybrid queue disk",
+		},
+		"invalid threshold": {
+			input: map[string]interface{}{
+				"disk.max_size":   "1GB",
+				"spill.threshold": 1.5,
+			},
+			wantErr: "spill.threshold",
+		},
+	}
+
+	for name, test := range tests {
+		t.Run(name, func(t *testing.T) {
+			settings, err := SettingsForUserConfig(config.MustNewConfigFrom(test.input))
+			if test.wantErr != "" {
+				assert.ErrorContains(t, err, test.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			test.check(t, settings)
+		})
+	}
+}
@@ -39,6 +39,8 @@ type Observer interface {
 }
 
 type queueObserver struct {
+	metrics *monitoring.Registry
+
 	maxEvents *monitoring.Uint // gauge
 	maxBytes  *monitoring.Uint // gauge
 
@@ -79,6 +81,8 @@ func NewQueueObserver(metrics *monitoring.Registry) Observer {
 	}
 
 	ob := &queueObserver{
+		metrics: queueMetrics,
+
 		maxEvents: monitoring.NewUint(queueMetrics, "max_events"), // gauge
 		maxBytes:  monitoring.NewUint(queueMetrics, "max_bytes"),  // gauge
 
@@ -145,6 +149,97 @@ func (ob *queueObserver) updateFilledPct() {
 	}
 }
 
+// tierObserver reports the metrics of one storage tier of a queue, and
+// forwards all event updates to the observer of the queue itself.
+type tierObserver struct {
+	parent Observer
+
+	maxEvents *monitoring.Uint // gauge
+	maxBytes  *monitoring.Uint // gauge
+
+	addedEvents    *monitoring.Uint
+	consumedEvents *monitoring.Uint
+	removedEvents  *monitoring.Uint
+
+	filledEvents *monitoring.Uint // gauge
+	filledBytes  *monitoring.Uint // gauge
+}
+
+// NewTierObserver returns an Observer for one storage tier of a queue that
+// keeps its events in multiple tiers. Event updates are forwarded to the
+// parent Observer, and the tier's own metrics are reported under the path
+// "pipeline.queue.tiers.<name>". The tier's limits are not forwarded, the
+// queue is expected to report its overall limits to the parent itself.
+func NewTierObserver(parent Observer, name string) Observer {
+	queueOb, ok := parent.(*queueObserver)
+	if !ok || queueOb.metrics == nil {
+		return tierObserver{parent: parent}
+	}
+	tierMetrics := queueOb.metrics.GetOrCreateRegistry("tiers").GetOrCreateRegistry(name)
+	if err := tierMetrics.Clear(); err != nil {
+		return tierObserver{parent: parent}
+	}
+
+	return tierObserver{
+		parent: parent,
+
+		maxEvents: monitoring.NewUint(tierMetrics, "max_events"), // gauge
+		maxBytes:  monitoring.NewUint(tierMetrics, "max_bytes"),  // gauge
+
+		addedEvents:    monitoring.NewUint(tierMetrics, "added.events"),
+		consumedEvents: monitoring.NewUint(tierMetrics, "consumed.events"),
+		removedEvents:  monitoring.NewUint(tierMetrics, "removed.events"),
+
+		filledEvents: monitoring.NewUint(tierMetrics, "filled.events"), // gauge
+		filledBytes:  monitoring.NewUint(tierMetrics, "filled.bytes"),  // gauge
+	}
+}
+
+func (ob tierObserver) MaxEvents(value int) {
+	if ob.maxEvents != nil {
+		ob.maxEvents.Set(uint64(value))
+	}
+}
+
+func (ob tierObserver) MaxBytes(value int) {
+	if ob.maxBytes != nil {
+		ob.maxBytes.Set(uint64(value))
+	}
+}
+
+func (ob tierObserver) Restore(eventCount int, byteCount int) {
+	if ob.filledEvents != nil {
+		ob.filledEvents.Set(uint64(eventCount))
+		ob.filledBytes.Set(uint64(byteCount))
+	}
+	ob.parent.Restore(eventCount, byteCount)
+}
+
+func (ob tierObserver) AddEvent(byteCount int) {
+	if ob.addedEvents != nil {
+		ob.addedEvents.Inc()
+		ob.filledEvents.Inc()
+		ob.filledBytes.Add(uint64(byteCount))
+	}
+	ob.parent.AddEvent(byteCount)
+}
+
+func (ob tierObserver) ConsumeEvents(eventCount int, byteCount int) {
+	if ob.consumedEvents != nil {
+		ob.consumedEvents.Add(uint64(eventCount))
+	}
+	ob.parent.ConsumeEvents(eventCount, byteCount)
+}
+
+func (ob tierObserver) RemoveEvents(eventCount int, byteCount int) {
+	if ob.removedEvents != nil {
+		ob.removedEvents.Add(uint64(eventCount))
+		ob.filledEvents.Sub(uint64(eventCount))
+		ob.filledBytes.Sub(uint64(byteCount))
+	}
+	ob.parent.RemoveEvents(eventCount, byteCount)
+}
+
 func (nilObserver) MaxEvents(_ int)            {}
 func (nilObserver) MaxBytes(_ int)             {}
 func (nilObserver) Restore(_ int, _ int)       {}
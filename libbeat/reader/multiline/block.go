@@ -0,0 +1,232 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package multiline
+
+import (
+	"errors"
+	"io"
+
+	"github.com/elastic/beats/v7/libbeat/common/match"
+	"github.com/elastic/beats/v7/libbeat/reader"
+	"github.com/elastic/beats/v7/libbeat/reader/readfile"
+	"github.com/elastic/elastic-agent-libs/logp"
+)
+
+// blockMatcher finds the first and the last line of blocks of lines.
+type blockMatcher interface {
+	// start returns true if the line starts a new block.
+	start(content []byte) bool
+	// end returns true if the line ends the current block.
+	end(content []byte) bool
+}
+
+// beginEndMatcher finds blocks delimited by a line matching the begin
+// pattern and a line matching the end pattern. The end pattern is not
+// matched against the first line of the block.
+type beginEndMatcher struct {
+	beginPattern match.Matcher
+	endPattern   match.Matcher
+}
+
+func (m *beginEndMatcher) start(content []byte) bool { return m.beginPattern.Match(content) }
+func (m *beginEndMatcher) end(content []byte) bool   { return m.endPattern.Match(content) }
+
+// blockReader combines the lines of a block into one multi-line event.
+// Lines outside of blocks are returned as they are.
+//
+// The block is returned before its end is found if max_lines lines have
+// been read or on timeout.
+//
+// Errors will force the multiline reader to return the currently active
+// multiline event first and finally return the actual error on next call to Next.
+type blockReader struct {
+	reader    reader.Reader
+	matcher   blockMatcher
+	maxLines  int
+	logger    *logp.Logger
+	msgBuffer *messageBuffer
+	state     func(*blockReader) (reader.Message, error)
+}
+
+func newMultilineBeginEndReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+	logger *logp.Logger,
+) (reader.Reader, error) {
+	matcher := &beginEndMatcher{
+		beginPattern: *config.BeginPattern,
+		endPattern:   *config.EndPattern,
+	}
+	return newBlockReader(r, separator, maxBytes, config, matcher, logger), nil
+}
+
+func newMultilineJSONObjectReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+	logger *logp.Logger,
+) (reader.Reader, error) {
+	return newBlockReader(r, separator, maxBytes, config, &jsonObjectMatcher{}, logger), nil
+}
+
+func newBlockReader(
+	r reader.Reader,
+	separator string,
+	maxBytes int,
+	config *Config,
+	matcher blockMatcher,
+	logger *logp.Logger,
+) *blockReader {
+	maxLines := defaultMaxLines
+	if config.MaxLines != nil {
+		maxLines = *config.MaxLines
+	}
+
+	tout := defaultMultilineTimeout
+	if config.Timeout != nil {
+		tout = *config.Timeout
+	}
+
+	if tout > 0 {
+		r = readfile.NewTimeoutReader(r, sigMultilineTimeout, tout)
+	}
+
+	return &blockReader{
+		reader:    r,
+		matcher:   matcher,
+		maxLines:  maxLines,
+		msgBuffer: newMessageBuffer(maxBytes, maxLines, []byte(separator), config.SkipNewLine),
+		logger:    logger.Named("reader_multiline"),
+		state:     (*blockReader).readFirst,
+	}
+}
+
+// Next returns next multi-line event.
+func (br *blockReader) Next() (reader.Message, error) {
+	return br.state(br)
+}
+
+func (br *blockReader) readFirst() (reader.Message, error) {
+	for {
+		message, err := br.reader.Next()
+		if err != nil {
+			// no lines buffered -> ignore timeout
+			if errors.Is(err, sigMultilineTimeout) {
+				continue
+			}
+
+			// pass error to caller (next layer) for handling
+			return message, err
+		}
+
+		if message.Bytes == 0 {
+			continue
+		}
+
+		// no block started, return message
+		if !br.matcher.start(message.Content) {
+			return message, nil
+		}
+
+		// Start new multiline event
+		br.msgBuffer.startNewMessage(message)
+		if br.isMaxLinesReached() {
+			return br.finalize(), nil
+		}
+		br.setState((*blockReader).readNext)
+		return br.readNext()
+	}
+}
+
+func (br *blockReader) readNext() (reader.Message, error) {
+	for {
+		message, err := br.reader.Next()
+		if err != nil {
+			// handle multiline timeout signal
+			if errors.Is(err, sigMultilineTimeout) {
+				// no lines buffered -> ignore timeout
+				if br.msgBuffer.isEmpty() {
+					continue
+				}
+
+				br.logger.Debug("Multiline event flushed because timeout reached.")
+				return br.finalize(), nil
+			}
+
+			// content read with the error is part of the block, return
+			// multiline and error on next read
+			br.msgBuffer.addLine(message)
+			msg := br.msgBuffer.finalize()
+			br.msgBuffer.setErr(err)
+			br.setState((*blockReader).readFailed)
+			return msg, nil
+		}
+
+		// add line to current multiline event
+		br.msgBuffer.addLine(message)
+		if br.matcher.end(message.Content) {
+			return br.finalize(), nil
+		}
+		if br.isMaxLinesReached() {
+			br.logger.Debug("Multiline event flushed because max_lines reached.")
+			return br.finalize(), nil
+		}
+	}
+}
+
+func (br *blockReader) isMaxLinesReached() bool {
+	return br.maxLines > 0 && br.msgBuffer.processedLines >= br.maxLines
+}
+
+// finalize returns the collected multiline event and starts looking
+// for the next block.
+func (br *blockReader) finalize() reader.Message {
+	msg := br.msgBuffer.finalize()
+	br.resetState()
+	return msg
+}
+
+// readFailed returns empty message and error and resets line reader
+func (br *blockReader) readFailed() (reader.Message, error) {
+	err := br.msgBuffer.err
+	br.msgBuffer.setErr(nil)
+	br.resetState()
+	return reader.Message{}, err
+}
+
+// resetState sets state of the reader to readFirst
+func (br *blockReader) resetState() {
+	br.setState((*blockReader).readFirst)
+}
+
+// setState sets state to the given function
+func (br *blockReader) setState(next func(br *blockReader) (reader.Message, error)) {
+	br.state = next
+}
+
+func (br *blockReader) Close() error {
+	br.setState((*blockReader).readClosed)
+	return br.reader.Close()
+}
+
+func (br *blockReader) readClosed() (reader.Message, error) {
+	return reader.Message{}, io.EOF
+}
@@ -0,0 +1,69 @@
+// Licensed to Elasticsearch B.V. under one or more contributor
+// license agreements. See the NOTICE file distributed with
+// this work for additional information regarding copyright
+// ownership. Elasticsearch B.V. licenses this file to you under
+// the Apache License, Version 2.0 (the "License"); you may
+// not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing,
+// software distributed under the License is distributed on an
+// "AS IS" BASIS, WITHOUT WARRANTIES OR CONDITIONS OF ANY
+// KIND, either express or implied.  See the License for the
+// specific language governing permissions and limitations
+// under the License.
+
+package multiline
+
+import "bytes"
+
+// jsonObjectMatcher finds JSON objects and arrays spanning multiple lines.
+// A block starts with a line beginning with '{' or '[' that leaves braces
+// or brackets open, and ends with the line closing them. Braces and
+// brackets in strings are skipped.
+type jsonObjectMatcher struct {
+	depth    int
+	inString bool
+	escaped  bool
+}
+
+func (m *jsonObjectMatcher) start(content []byte) bool {
+	*m = jsonObjectMatcher{}
+
+	content = bytes.TrimLeft(content, " \t")
+	if len(content) == 0 || (content[0] != '{' && content[0] != '[') {
+		return false
+	}
+	m.scan(content)
+	return m.depth > 0
+}
+
+func (m *jsonObjectMatcher) end(content []byte) bool {
+	m.scan(content)
+	return m.depth <= 0
+}
+
+// scan updates the depth of the braces and brackets that are open.
+func (m *jsonObjectMatcher) scan(content []byte) {
+	for _, c := range content {
+		switch {
+		case m.escaped:
+			m.escaped = false
+		case m.inString:
+			switch c {
+			case '\\':
+				m.escaped = true
+			case '"':
+				m.inString = false
+			}
+		case c == '"':
+			m.inString = true
+		case c == '{' || c == '[':
+			m.depth++
+		case c == '}' || c == ']':
+			m.depth--
+		}
+	}
+}
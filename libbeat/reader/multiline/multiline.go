@@ -40,6 +40,10 @@ func New(
 		return newMultilineCountReader(r, separator, maxBytes, config)
 	case whilePatternMode:
 		return newMultilineWhilePatternReader(r, separator, maxBytes, config, logger)
+	case beginEndMode:
+		return newMultilineBeginEndReader(r, separator, maxBytes, config, logger)
+	case jsonObjectMode:
+		return newMultilineJSONObjectReader(r, separator, maxBytes, config, logger)
 	default:
 		return nil, fmt.Errorf("unknown multiline type %d", config.Type)
 	}
@@ -31,10 +31,14 @@ const (
 	patternMode multilineType = iota
 	countMode
 	whilePatternMode
+	beginEndMode
+	jsonObjectMode
 
 	patternStr      = "pattern"
 	countStr        = "count"
 	whilePatternStr = "while_pattern"
+	beginEndStr     = "begin_end"
+	jsonObjectStr   = "json_object"
 )
 
 var (
@@ -42,10 +46,13 @@ var (
 		patternStr:      patternMode,
 		countStr:        countMode,
 		whilePatternStr: whilePatternMode,
+		beginEndStr:     beginEndMode,
+		jsonObjectStr:   jsonObjectMode,
 	}
 
-	ErrMissingPattern = errors.New("multiline.pattern cannot be empty when pattern based matching is selected")
-	ErrMissingCount   = errors.New("multiline.count cannot be empty when count based aggregation is selected")
+	ErrMissingPattern         = errors.New("multiline.pattern cannot be empty when pattern based matching is selected")
+	ErrMissingCount           = errors.New("multiline.count cannot be empty when count based aggregation is selected")
+	ErrMissingBeginEndPattern = errors.New("multiline.begin_pattern and multiline.end_pattern cannot be empty when begin_end based aggregation is selected")
 )
 
 // Config holds the options of multiline readers.
@@ -58,6 +65,8 @@ type Config struct {
 	Pattern      *match.Matcher `config:"pattern"`
 	Timeout      *time.Duration `config:"timeout" validate:"positive"`
 	FlushPattern *match.Matcher `config:"flush_pattern"`
+	BeginPattern *match.Matcher `config:"begin_pattern"`
+	EndPattern   *match.Matcher `config:"end_pattern"`
 
 	LinesCount  int  `config:"count_lines" validate:"positive"`
 	SkipNewLine bool `config:"skip_newline"`
@@ -80,7 +89,11 @@ func (c *Config) Validate() error {
 		if c.Pattern == nil {
 			return ErrMissingPattern
 		}
-	} else {
+	} else if c.Type == beginEndMode {
+		if c.BeginPattern == nil || c.EndPattern == nil {
+			return ErrMissingBeginEndPattern
+		}
+	} else if c.Type != jsonObjectMode {
 		return fmt.Errorf("unknown multiline type %d", c.Type)
 	}
 	return nil
@@ -55,6 +55,13 @@ func TestInvalidConfiguration(t *testing.T) {
 			},
 			expectedError: ErrMissingPattern,
 		},
+		"missing end pattern when begin_end type is selected": {
+			config: map[string]interface{}{
+				"type":          "begin_end",
+				"begin_pattern": "^BEGIN",
+			},
+			expectedError: ErrMissingBeginEndPattern,
+		},
 	}
 
 	for name, test := range testcases {
@@ -92,6 +99,18 @@ func TestValidConfiguration(t *testing.T) {
 				"count_lines": 5,
 			},
 		},
+		"correct begin_end based multiline": {
+			config: map[string]interface{}{
+				"type":          "begin_end",
+				"begin_pattern": "^BEGIN",
+				"end_pattern":   "^END",
+			},
+		},
+		"correct json_object based multiline": {
+			config: map[string]interface{}{
+				"type": "json_object",
+			},
+		},
 	}
 
 	for name, test := range testcases {
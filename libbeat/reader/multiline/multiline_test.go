@@ -285,6 +285,86 @@ func TestMultilineWhilePattern(t *testing.T) {
 	)
 }
 
+func TestMultilineBeginEnd(t *testing.T) {
+	begin := match.MustCompile(`^BEGIN`)
+	end := match.MustCompile(`^END`)
+	testMultilineOK(t,
+		Config{
+			Type:         beginEndMode,
+			BeginPattern: &begin,
+			EndPattern:   &end,
+		},
+		4,
+		"not in a block\n",
+		"BEGIN line1\n line1.1\nBEGIN line1.2\nEND\n",
+		"END outside of a block\n",
+		"BEGIN line2\nEND\n",
+	)
+	// begin and end patterns are the same
+	separator := match.MustCompile(`^---$`)
+	testMultilineOK(t,
+		Config{
+			Type:         beginEndMode,
+			BeginPattern: &separator,
+			EndPattern:   &separator,
+		},
+		2,
+		"---\nline1\nline1.1\n---\n",
+		"line2\n",
+	)
+	// the block is flushed once max_lines is reached
+	maxLines := 2
+	testMultilineOK(t,
+		Config{
+			Type:         beginEndMode,
+			BeginPattern: &begin,
+			EndPattern:   &end,
+			MaxLines:     &maxLines,
+		},
+		4,
+		"BEGIN line1\n line1.1\n",
+		" line1.2\n",
+		"END\n",
+		"BEGIN line2\nEND\n",
+	)
+	// the last block is returned at the end of the input
+	testMultilineOK(t,
+		Config{
+			Type:         beginEndMode,
+			BeginPattern: &begin,
+			EndPattern:   &end,
+		},
+		1,
+		"BEGIN line1\n line1.1\n",
+	)
+}
+
+func TestMultilineJSONObject(t *testing.T) {
+	testMultilineOK(t,
+		Config{
+			Type: jsonObjectMode,
+		},
+		5,
+		"{\"single\": \"line\"}\n",
+		"{\n  \"message\": \"multi line\",\n  \"nested\": {\"list\": [1, 2]}\n}\n",
+		"not json {\n",
+		"[\n  {\"brace in string\": \"}]\\\"}\"},\n  \"\\\\\"\n]\n",
+		"  {\"indented\":\n  true}\n",
+	)
+	// the object is flushed once max_lines is reached
+	maxLines := 2
+	testMultilineOK(t,
+		Config{
+			Type:     jsonObjectMode,
+			MaxLines: &maxLines,
+		},
+		3,
+		"{\n  \"a\": 1,\n",
+		"  \"b\": 2\n",
+		"}\n",
+	)
+}
+
 func testMultilineOK(t *testing.T, cfg Config, events int, expected ...string) {
 	_, buf := createLineBuffer(expected...)
 	r := createMultilineTestReader(t, buf, cfg)